@@ -4,8 +4,6 @@ import (
 	"encoding/hex"
 	"fmt"
 	"os"
-	"strconv"
-	"strings"
 
 	"github.com/pzl/usb"
 )
@@ -15,19 +13,15 @@ func main() {
 		fmt.Fprintln(os.Stderr, "Arguments required: <vid> <pid> <hex of bytearray>")
 		os.Exit(1)
 	}
-	vid, err := strconv.ParseUint(strings.TrimPrefix(os.Args[1], "0x"), 16, 16)
-	if err != nil {
-		panic(err)
-	}
-	pid, err := strconv.ParseUint(strings.TrimPrefix(os.Args[2], "0x"), 16, 16)
+	vid, pid, err := usb.ParseVIDPID(os.Args[1] + ":" + os.Args[2])
 	if err != nil {
 		panic(err)
 	}
 
-	fmt.Printf("looking for %04x:%04x\n", vid, pid)
+	fmt.Printf("looking for %s:%s\n", vid, pid)
 
 	ctx := usb.NewContext()
-	dev, err := ctx.OpenDeviceWithVIDPID(usb.ID(vid), usb.ID(pid))
+	dev, err := ctx.OpenDeviceWithVIDPID(vid, pid)
 	if err == usb.ErrDeviceNotFound {
 		fmt.Println("Device Not found")
 		return
@@ -35,7 +29,7 @@ func main() {
 		panic(err)
 	}
 
-	iface, done, err := dev.DefaultInterface()
+	iface, done, err := dev.FirstBulkInterface()
 	if err != nil {
 		panic(err)
 	}
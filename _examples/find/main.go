@@ -3,8 +3,6 @@ package main
 import (
 	"fmt"
 	"os"
-	"strconv"
-	"strings"
 
 	"github.com/pzl/usb"
 )
@@ -18,16 +16,12 @@ func main() {
 		fmt.Fprintln(os.Stderr, "Arguments required: <vid> <pid>")
 		os.Exit(1)
 	}
-	vid, err := strconv.ParseUint(strings.TrimPrefix(os.Args[1], "0x"), 16, 16)
-	if err != nil {
-		panic(err)
-	}
-	pid, err := strconv.ParseUint(strings.TrimPrefix(os.Args[2], "0x"), 16, 16)
+	vid, pid, err := usb.ParseVIDPID(os.Args[1] + ":" + os.Args[2])
 	if err != nil {
 		panic(err)
 	}
 
-	fmt.Printf("looking for %04x:%04x\n", vid, pid)
+	fmt.Printf("looking for %s:%s\n", vid, pid)
 
 	device, err := usb.VidPid(uint16(vid), uint16(pid))
 	if err == usb.ErrDeviceNotFound {
@@ -37,5 +31,5 @@ func main() {
 		panic(err)
 	}
 
-	fmt.Printf("Device: %s %s\n", device.Vendor.Name(), device.Product.Name())
+	fmt.Printf("Device: %s %s\n", device.VendorName(), device.ProductName())
 }
@@ -1,17 +1,40 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"os"
+	"strings"
 
 	"github.com/pzl/usb"
 )
 
+/*
+ * List devices like lsusb. An optional match expression selects which, e.g.
+ *   lsusb 'vendor==0x1a86 && class==cdc'
+ * With -v, class-specific and vendor descriptors are listed too, decoded by
+ * whatever decoders were registered with usb.RegisterDescriptor.
+ */
 func main() {
-	devs, err := usb.List()
+	verbose := flag.Bool("v", false, "list class and vendor descriptors")
+	flag.Parse()
+
+	devs, err := usb.ListWhere(strings.Join(flag.Args(), " "))
 	if err != nil {
-		panic(err)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
 	}
 	for _, d := range devs {
-		fmt.Printf("Bus %03d Device %03d: ID %04x:%04x %s %s\n", d.Bus, d.Device, d.Vendor, d.Product, d.VendorName(), d.ProductName())
+		fmt.Printf("Bus %03d Device %03d: ID %s:%s %s %s\n", d.Bus, d.Device, d.Vendor, d.Product, d.VendorName(), d.ProductName())
+		if !*verbose {
+			continue
+		}
+		extras, err := d.ExtraDescriptors()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "  %v\n", err)
+		}
+		for _, e := range extras {
+			fmt.Printf("  config %d interface %d.%d: %v\n", e.Config, e.Interface, e.Alternate, e)
+		}
 	}
 }
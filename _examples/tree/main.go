@@ -1,28 +1,24 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
-	"strconv"
 	"strings"
 
 	"github.com/pzl/usb"
 )
 
 /*
- * Locate a device using VID and PID
- * then print its parent tree
+ * Without arguments, print the whole device tree like lsusb -t (or as JSON with -json).
+ * Given a VID and PID, locate that device then print its parent tree
  */
 func main() {
 	if len(os.Args) < 3 {
-		fmt.Fprintln(os.Stderr, "Arguments required: <vid> <pid>")
-		os.Exit(1)
-	}
-	vid, err := strconv.ParseUint(strings.TrimPrefix(os.Args[1], "0x"), 16, 16)
-	if err != nil {
-		panic(err)
+		printTopology(len(os.Args) == 2 && os.Args[1] == "-json")
+		return
 	}
-	pid, err := strconv.ParseUint(strings.TrimPrefix(os.Args[2], "0x"), 16, 16)
+	vid, pid, err := usb.ParseVIDPID(os.Args[1] + ":" + os.Args[2])
 	if err != nil {
 		panic(err)
 	}
@@ -41,6 +37,22 @@ func main() {
 	}
 }
 
+func printTopology(asJSON bool) {
+	t, err := usb.Topology()
+	if err != nil {
+		panic(err)
+	}
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(t); err != nil {
+			panic(err)
+		}
+		return
+	}
+	t.WriteTree(os.Stdout)
+}
+
 func printDevice(d *usb.Device) string {
-	return fmt.Sprintf("Bus %03d Device %03d: ID %04x:%04x %s %s", d.Bus, d.Device, d.Vendor.ID, d.Product.ID, d.Vendor.Name(), d.Product.Name())
+	return fmt.Sprintf("Bus %03d Device %03d: ID %s:%s %s %s", d.Bus, d.Device, d.Vendor, d.Product, d.VendorName(), d.ProductName())
 }
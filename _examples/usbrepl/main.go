@@ -0,0 +1,386 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pzl/usb"
+)
+
+/*
+ * An interactive shell for bringing up a device's vendor protocol: pick a device,
+ * claim an interface, and send control, bulk and interrupt transfers typed in hex.
+ *   usbrepl
+ *   > open 1a86:7523
+ *   > claim 0
+ *   > write 02 55aa0001
+ *   > read 81 40
+ *   > ctrl c0 01 0000 0000 8
+ *   > save session.txt
+ * and later, to run the same exchange again:
+ *   usbrepl -replay session.txt
+ *
+ * Type "help" for the commands.
+ */
+func main() {
+	replay := flag.String("replay", "", "run the commands in this file first")
+	batch := flag.Bool("batch", false, "exit after the replay instead of reading commands")
+	flag.Parse()
+
+	s := &session{timeout: time.Second}
+	defer s.close()
+
+	if *replay != "" {
+		f, err := os.Open(*replay)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		ok := s.run(f, true)
+		f.Close()
+		if !ok {
+			os.Exit(1)
+		}
+		if *batch {
+			return
+		}
+	}
+	s.run(os.Stdin, false)
+}
+
+type session struct {
+	devs    []*usb.Device // as last listed
+	dev     *usb.Device
+	intf    *usb.Interface
+	timeout time.Duration
+	history []string // commands that succeeded, for save
+}
+
+// run executes the commands read from r. A replay stops at the first failure.
+func (s *session) run(r io.Reader, replay bool) bool {
+	sc := bufio.NewScanner(r)
+	for {
+		if !replay {
+			fmt.Print("> ")
+		}
+		if !sc.Scan() {
+			return true
+		}
+		line := strings.TrimSpace(sc.Text())
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = strings.TrimSpace(line[:i])
+		}
+		if line == "" {
+			continue
+		}
+		if replay {
+			fmt.Println(">", line)
+		}
+		args := strings.Fields(line)
+		if args[0] == "quit" || args[0] == "exit" {
+			return true
+		}
+		if err := s.exec(args[0], args[1:]); err != nil {
+			fmt.Println("error:", err)
+			if replay {
+				return false
+			}
+			continue
+		}
+		switch args[0] {
+		case "help", "save", "eps":
+		default:
+			s.history = append(s.history, line)
+		}
+	}
+}
+
+func (s *session) exec(cmd string, args []string) error {
+	switch cmd {
+	case "help":
+		fmt.Print(help)
+		return nil
+	case "list":
+		return s.list(args)
+	case "open":
+		return s.open(args)
+	case "close":
+		s.close()
+		return nil
+	case "claim":
+		return s.claim(args)
+	case "eps":
+		return s.endpoints()
+	case "read":
+		return s.read(args)
+	case "write":
+		return s.write(args)
+	case "ctrl":
+		return s.control(args)
+	case "timeout":
+		if len(args) != 1 {
+			return errors.New("usage: timeout <ms>")
+		}
+		ms, err := strconv.Atoi(args[0])
+		if err != nil || ms <= 0 {
+			return fmt.Errorf("bad timeout %q", args[0])
+		}
+		s.timeout = time.Duration(ms) * time.Millisecond
+		return nil
+	case "save":
+		if len(args) != 1 {
+			return errors.New("usage: save <file>")
+		}
+		return os.WriteFile(args[0], []byte(strings.Join(s.history, "\n")+"\n"), 0644)
+	}
+	return fmt.Errorf("unknown command %q, try help", cmd)
+}
+
+const help = `commands:
+  list [expr]                      list devices, optionally matching a usb.ParseMatch expression
+  open <n|vid:pid|expr>            open a device: by its number in the last list, or the one matching
+  close                            close the device
+  claim <interface>                claim an interface, releasing the previous one
+  eps                              show the claimed interface's endpoints
+  read <ep> [length]               read from a bulk or interrupt IN endpoint, a packet by default
+  write <ep> <hex>                 write to a bulk or interrupt OUT endpoint
+  ctrl <type> <req> <value> <index> <length|hex|->
+                                   control transfer, reading length bytes if type has bit 7 set,
+                                   else sending the hex data, or none for -
+  timeout <ms>                     transfer timeout, 1000 by default
+  save <file>                      save the session's commands, to run again with -replay
+  quit
+numbers are hex, as in descriptors: "ctrl c0 01 0 0 8", "read 81"
+`
+
+func (s *session) list(args []string) error {
+	devs, err := usb.ListWhere(strings.Join(args, " "))
+	if err != nil {
+		return err
+	}
+	s.devs = devs
+	for i, d := range devs {
+		fmt.Printf("%3d  %-8s %s:%s  %s %s\n", i, d.PortPath(), d.Vendor, d.Product, d.VendorName(), d.ProductName())
+	}
+	return nil
+}
+
+func (s *session) open(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: open <n|vid:pid|expr>")
+	}
+	var d *usb.Device
+	if n, err := strconv.Atoi(args[0]); err == nil && len(args) == 1 {
+		if n < 0 || n >= len(s.devs) {
+			return fmt.Errorf("no device %d in the last list", n)
+		}
+		d = s.devs[n]
+	} else {
+		expr := strings.Join(args, " ")
+		if vid, pid, err := usb.ParseVIDPID(expr); err == nil {
+			expr = fmt.Sprintf("vendor==%s && product==%s", vid, pid)
+		}
+		devs, err := usb.ListWhere(expr)
+		if err != nil {
+			return err
+		}
+		switch len(devs) {
+		case 0:
+			return usb.ErrDeviceNotFound
+		case 1:
+			d = devs[0]
+		default:
+			s.devs = devs
+			return fmt.Errorf("%d devices match, list them and open one by number", len(devs))
+		}
+	}
+	s.close()
+	if err := d.Open(); err != nil {
+		return err
+	}
+	s.dev = d
+	fmt.Printf("opened %s %s:%s %s %s\n", d.PortPath(), d.Vendor, d.Product, d.VendorName(), d.ProductName())
+	return nil
+}
+
+func (s *session) close() {
+	if s.intf != nil {
+		s.intf.Release()
+		s.intf = nil
+	}
+	if s.dev != nil {
+		s.dev.Close()
+		s.dev = nil
+	}
+}
+
+func (s *session) claim(args []string) error {
+	if s.dev == nil {
+		return usb.ErrNotOpen
+	}
+	if len(args) != 1 {
+		return errors.New("usage: claim <interface>")
+	}
+	n, err := parseHex(args[0], 8)
+	if err != nil {
+		return err
+	}
+	i, err := s.dev.InterfaceByNumber(int(n))
+	if err != nil {
+		return err
+	}
+	if s.intf != nil {
+		s.intf.Release()
+		s.intf = nil
+	}
+	if err := i.Claim(); err != nil {
+		return err
+	}
+	s.intf = i
+	return s.endpoints()
+}
+
+func (s *session) endpoints() error {
+	if s.intf == nil {
+		return errors.New("no interface claimed")
+	}
+	types := map[int]string{0: "control", 1: "isochronous", 2: "bulk", 3: "interrupt"}
+	for _, ep := range s.intf.Endpoints {
+		dir := "OUT"
+		if ep.Address&0x80 != 0 {
+			dir = "IN"
+		}
+		fmt.Printf("  ep %02x %-3s %-11s max packet %d\n", ep.Address, dir, types[ep.TransferType], ep.MaxPacketSize)
+	}
+	return nil
+}
+
+// endpoint finds an endpoint of the claimed interface by its hex address.
+func (s *session) endpoint(arg string) (*usb.Endpoint, error) {
+	if s.intf == nil {
+		return nil, errors.New("no interface claimed")
+	}
+	addr, err := parseHex(arg, 8)
+	if err != nil {
+		return nil, err
+	}
+	for i := range s.intf.Endpoints {
+		if s.intf.Endpoints[i].Address == int(addr) {
+			return &s.intf.Endpoints[i], nil
+		}
+	}
+	return nil, fmt.Errorf("interface %d has no endpoint %02x", s.intf.ID, addr)
+}
+
+// transfer submits buf on ep and waits for it, up to the timeout.
+func (s *session) transfer(ep *usb.Endpoint, buf []byte) (int, error) {
+	t, err := ep.Submit(buf)
+	if err != nil {
+		return 0, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	return t.Wait(ctx)
+}
+
+func (s *session) read(args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return errors.New("usage: read <ep> [length]")
+	}
+	ep, err := s.endpoint(args[0])
+	if err != nil {
+		return err
+	}
+	n := ep.PacketSize()
+	if len(args) == 2 {
+		l, err := parseHex(args[1], 24)
+		if err != nil {
+			return err
+		}
+		n = int(l)
+	}
+	buf := ep.NewBuffer(n)
+	got, err := s.transfer(ep, buf)
+	fmt.Print(usb.Hexdump(buf[:got]))
+	return err
+}
+
+func (s *session) write(args []string) error {
+	if len(args) < 2 {
+		return errors.New("usage: write <ep> <hex>")
+	}
+	ep, err := s.endpoint(args[0])
+	if err != nil {
+		return err
+	}
+	data, err := parseBytes(args[1:])
+	if err != nil {
+		return err
+	}
+	n, err := s.transfer(ep, data)
+	fmt.Printf("wrote %d of %d bytes\n", n, len(data))
+	return err
+}
+
+func (s *session) control(args []string) error {
+	if s.dev == nil {
+		return usb.ErrNotOpen
+	}
+	if len(args) < 5 {
+		return errors.New("usage: ctrl <type> <req> <value> <index> <length|hex>")
+	}
+	var v [4]uint64
+	for i, bits := range []int{8, 8, 16, 16} {
+		n, err := parseHex(args[i], bits)
+		if err != nil {
+			return err
+		}
+		v[i] = n
+	}
+	var data []byte
+	if v[0]&0x80 != 0 { // device to host
+		l, err := parseHex(args[4], 16)
+		if err != nil {
+			return err
+		}
+		data = make([]byte, l)
+	} else {
+		var err error
+		if data, err = parseBytes(args[4:]); err != nil {
+			return err
+		}
+	}
+	// standard and class requests to an interface or endpoint need it claimed first
+	n, err := s.dev.Control(uint8(v[0]), uint8(v[1]), uint16(v[2]), uint16(v[3]), data, s.timeout)
+	if err != nil {
+		return err
+	}
+	if v[0]&0x80 != 0 {
+		fmt.Print(usb.Hexdump(data[:n]))
+	} else {
+		fmt.Printf("sent %d bytes\n", n)
+	}
+	return nil
+}
+
+func parseHex(s string, bits int) (uint64, error) {
+	return strconv.ParseUint(strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X"), 16, bits)
+}
+
+// parseBytes decodes hex data, given as one or more words: "55aa 0001" or "55 aa 00 01".
+func parseBytes(words []string) ([]byte, error) {
+	s := strings.TrimPrefix(strings.Join(words, ""), "0x")
+	if s == "-" {
+		return nil, nil // no data stage
+	}
+	return hex.DecodeString(s)
+}
@@ -0,0 +1,156 @@
+package usb
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// AccessReason classifies why a device can not be opened.
+type AccessReason int
+
+const (
+	AccessNoNode      AccessReason = iota // no device node could be found
+	AccessPermissions                     // file mode or ownership of the node
+	AccessCgroup                          // devices cgroup (container device policy)
+	AccessOther                           // opening failed for another reason
+)
+
+func (r AccessReason) String() string {
+	switch r {
+	case AccessNoNode:
+		return "no device node"
+	case AccessPermissions:
+		return "insufficient file permissions"
+	case AccessCgroup:
+		return "blocked by container device policy"
+	}
+	return "open failed"
+}
+
+// AccessError explains why CanOpen determined a device could not be opened.
+type AccessError struct {
+	Reason AccessReason
+	Node   string // device node path, if one was found
+	Detail string
+	Err    error
+}
+
+func (e *AccessError) Error() string {
+	return fmt.Sprintf("usb: cannot open %s: %s: %s", e.Node, e.Reason, e.Detail)
+}
+
+func (e *AccessError) Unwrap() error { return e.Err }
+
+// CanOpen checks, without claiming anything, whether the device node can be opened
+// read-write by this process. It returns nil if so, or an *AccessError explaining which
+// of node lookup, file permissions or the devices cgroup is in the way.
+func (d Device) CanOpen() error {
+	node, err := d.DevNode()
+	if err != nil {
+		return &AccessError{Reason: AccessNoNode, Node: d.nodePath(), Detail: err.Error(), Err: err}
+	}
+
+	var st unix.Stat_t
+	if err := unix.Stat(node, &st); err != nil {
+		return &AccessError{Reason: AccessNoNode, Node: node, Detail: err.Error(), Err: err}
+	}
+	if err := unix.Access(node, unix.R_OK|unix.W_OK); err != nil {
+		return &AccessError{
+			Reason: AccessPermissions,
+			Node:   node,
+			Detail: fmt.Sprintf("mode %04o owned by %d:%d, running as %d:%d", st.Mode&0o7777, st.Uid, st.Gid, os.Geteuid(), os.Getegid()),
+			Err:    err,
+		}
+	}
+
+	major, minor := unix.Major(uint64(st.Rdev)), unix.Minor(uint64(st.Rdev)) //nolint:unconvert // Rdev is a uint32 on mips
+	if allowed, known := cgroupV1Allows(major, minor); known && !allowed {
+		return &AccessError{
+			Reason: AccessCgroup,
+			Node:   node,
+			Detail: fmt.Sprintf("devices.list has no rw rule for c %d:%d", major, minor),
+			Err:    os.ErrPermission,
+		}
+	}
+
+	// cgroup v2 enforces device policy with eBPF, which can't be inspected. Try it
+	f, err := os.OpenFile(node, os.O_RDWR, 0)
+	if err == nil {
+		f.Close()
+		return nil
+	}
+	if errors.Is(err, os.ErrPermission) {
+		// file permissions passed above, so the kernel is refusing by policy
+		return &AccessError{Reason: AccessCgroup, Node: node, Detail: fmt.Sprintf("open of c %d:%d denied despite file permissions", major, minor), Err: err}
+	}
+	return &AccessError{Reason: AccessOther, Node: node, Detail: err.Error(), Err: err}
+}
+
+// cgroupV1Allows checks the devices.list of this process's v1 devices cgroup.
+// known is false if there is no such cgroup to check.
+func cgroupV1Allows(major, minor uint32) (allowed bool, known bool) {
+	f, err := os.Open("/proc/self/cgroup")
+	if err != nil {
+		return false, false
+	}
+	defer f.Close()
+
+	var path string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// hierarchy-ID:controller-list:cgroup-path
+		parts := strings.SplitN(scanner.Text(), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		for _, c := range strings.Split(parts[1], ",") {
+			if c == "devices" {
+				path = parts[2]
+			}
+		}
+	}
+	if path == "" {
+		return false, false
+	}
+
+	list, err := os.Open(filepath.Join("/sys/fs/cgroup/devices", path, "devices.list"))
+	if err != nil {
+		return false, false
+	}
+	defer list.Close()
+
+	scanner = bufio.NewScanner(list)
+	for scanner.Scan() {
+		// type major:minor access, e.g. "c 189:* rwm" or "a *:* rwm"
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 || (fields[0] != "a" && fields[0] != "c") {
+			continue
+		}
+		if !strings.Contains(fields[2], "r") || !strings.Contains(fields[2], "w") {
+			continue
+		}
+		if fields[0] == "a" {
+			return true, true
+		}
+		nums := strings.SplitN(fields[1], ":", 2)
+		if len(nums) == 2 && cgroupNumMatches(nums[0], major) && cgroupNumMatches(nums[1], minor) {
+			return true, true
+		}
+	}
+	return false, true
+}
+
+func cgroupNumMatches(rule string, n uint32) bool {
+	if rule == "*" {
+		return true
+	}
+	v, err := strconv.ParseUint(rule, 10, 32)
+	return err == nil && uint32(v) == n
+}
@@ -0,0 +1,150 @@
+package usb_test
+
+import (
+	"bytes"
+	"flag"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+)
+
+var updateAPI = flag.Bool("update-api", false, "rewrite testdata/api.txt with the current API")
+
+// TestAPI enforces the stability policy of README.md: everything listed in
+// testdata/api.txt must still exist, with the same signature. Additions are free, but
+// are only protected once recorded with go test -run TestAPI -update-api. Declarations
+// documented as Experimental are left out. Aliases of x/class and x/gusb types are
+// listed as the types they forward, which those packages must then keep as they are.
+// Other signatures name only top-level types, so nothing else of x/ is pinned.
+func TestAPI(t *testing.T) {
+	current := exportedAPI(t, ".")
+	if *updateAPI {
+		if err := os.WriteFile("testdata/api.txt", []byte(strings.Join(current, "\n")+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	b, err := os.ReadFile("testdata/api.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	have := make(map[string]bool, len(current))
+	for _, l := range current {
+		have[l] = true
+	}
+	for _, l := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		if !have[l] {
+			t.Errorf("removed or changed: %s\n\tkeep it behind a Deprecated: wrapper, or update testdata/api.txt for a major release", l)
+		}
+	}
+}
+
+// exportedAPI lists the exported declarations of the package in dir, one per line,
+// across all build tags.
+func exportedAPI(t *testing.T, dir string) []string {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go") && fi.Name() != "gen.go"
+	}, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	str := func(n any) string {
+		var buf bytes.Buffer
+		printer.Fprint(&buf, fset, n)
+		return strings.Join(strings.Fields(buf.String()), " ")
+	}
+	experimental := func(doc *ast.CommentGroup) bool {
+		return doc != nil && strings.Contains(doc.Text(), "Experimental:")
+	}
+
+	// the types package usb forwards from x/class and x/gusb, by qualified name
+	forwarded := map[string]ast.Expr{}
+	for _, x := range []string{"class", "gusb"} {
+		xpkgs, err := parser.ParseDir(fset, dir+"/x/"+x, func(fi os.FileInfo) bool {
+			return !strings.HasSuffix(fi.Name(), "_test.go")
+		}, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, f := range xpkgs[x].Files {
+			for _, decl := range f.Decls {
+				if decl, ok := decl.(*ast.GenDecl); ok {
+					for _, spec := range decl.Specs {
+						if spec, ok := spec.(*ast.TypeSpec); ok {
+							forwarded[x+"."+spec.Name.Name] = spec.Type
+						}
+					}
+				}
+			}
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, f := range pkgs["usb"].Files {
+		for _, decl := range f.Decls {
+			switch decl := decl.(type) {
+			case *ast.FuncDecl:
+				if !decl.Name.IsExported() || experimental(decl.Doc) {
+					continue
+				}
+				sig := str(decl.Type)
+				sig = "func " + decl.Name.Name + strings.TrimPrefix(sig, "func")
+				if decl.Recv != nil {
+					recv := str(decl.Recv.List[0].Type)
+					if !ast.IsExported(strings.TrimPrefix(recv, "*")) {
+						continue
+					}
+					sig = "method (" + recv + ") " + strings.TrimPrefix(sig, "func ")
+				}
+				seen[sig] = true
+			case *ast.GenDecl:
+				for _, spec := range decl.Specs {
+					switch spec := spec.(type) {
+					case *ast.TypeSpec:
+						if !spec.Name.IsExported() || experimental(decl.Doc) || experimental(spec.Doc) {
+							continue
+						}
+						typ := spec.Type
+						if fwd, ok := forwarded[str(typ)]; ok && spec.Assign.IsValid() {
+							typ = fwd
+						}
+						st, ok := typ.(*ast.StructType)
+						if !ok {
+							seen["type "+spec.Name.Name+" "+str(typ)] = true
+							continue
+						}
+						seen["type "+spec.Name.Name+" struct"] = true
+						for _, field := range st.Fields.List {
+							for _, name := range field.Names {
+								if name.IsExported() {
+									seen["field "+spec.Name.Name+"."+name.Name+" "+str(field.Type)] = true
+								}
+							}
+							if len(field.Names) == 0 {
+								seen["field "+spec.Name.Name+" embeds "+str(field.Type)] = true
+							}
+						}
+					case *ast.ValueSpec:
+						for _, name := range spec.Names {
+							if name.IsExported() && !experimental(decl.Doc) && !experimental(spec.Doc) {
+								seen[decl.Tok.String()+" "+name.Name] = true
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	api := make([]string, 0, len(seen))
+	for l := range seen {
+		api = append(api, l)
+	}
+	sort.Strings(api)
+	return api
+}
@@ -0,0 +1,575 @@
+package usb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"github.com/pzl/usb/x/gusb"
+	"golang.org/x/sys/unix"
+)
+
+// ErrTransferCanceled is the result of a Transfer that was cancelled before it completed.
+var ErrTransferCanceled = errors.New("usb: transfer canceled")
+
+// Transfer is an asynchronous transfer on an endpoint, started with Endpoint.Submit.
+type Transfer struct {
+	ep   *Endpoint
+	urb  *gusb.URB            // handed to the kernel by address, must stay reachable while in flight
+	iso  []gusb.IsoPacketDesc // trailing the URB, for isochronous transfers
+	buf  []byte
+	eng  *asyncEngine
+	done chan struct{}
+
+	submittedAt time.Time // set as the URB goes to the kernel, see submitLocked
+	completedAt time.Time
+
+	queued bool // waiting for a submission slot, see AsyncOptions.MaxInFlight
+
+	notify *completionQueue // see Device.Completions
+
+	n   int
+	err error
+}
+
+// Done returns a channel that's closed when the transfer completes, fails, or is cancelled.
+func (t *Transfer) Done() <-chan struct{} { return t.done }
+
+// StartFrame returns the (micro)frame an isochronous transfer was scheduled to start in.
+// It is only meaningful once Done is closed.
+func (t *Transfer) StartFrame() int { return int(t.urb.StartFrame) }
+
+// Result returns the number of bytes transferred, and the transfer error.
+// It is only meaningful once Done is closed.
+func (t *Transfer) Result() (int, error) { return t.n, t.err }
+
+// Wait blocks until the transfer completes, or ctx is done. In the latter case
+// the transfer is cancelled, and ctx.Err() is returned once the kernel gives it back.
+func (t *Transfer) Wait(ctx context.Context) (int, error) {
+	select {
+	case <-t.done:
+		return t.n, t.err
+	case <-ctx.Done():
+		t.Cancel()
+		<-t.done
+		return t.n, ctx.Err()
+	}
+}
+
+// Cancel asks the kernel to discard the transfer. It is safe to call after the transfer completed.
+func (t *Transfer) Cancel() error {
+	select {
+	case <-t.done:
+		return nil
+	default:
+	}
+	t.eng.mu.Lock()
+	if t.queued {
+		t.eng.unqueue(t)
+		t.err = ErrTransferCanceled
+		t.finish()
+		t.eng.mu.Unlock()
+		return nil
+	}
+	t.eng.mu.Unlock()
+	err := gusb.DiscardURB(t.eng.f, t.urb)
+	if errors.Is(err, unix.EINVAL) {
+		return nil // already completed, waiting to be reaped
+	}
+	return err
+}
+
+func (t *Transfer) complete() {
+	t.n = int(t.urb.ActualLength)
+	switch status := unix.Errno(-t.urb.Status); {
+	case t.urb.Status == 0:
+	case status == unix.ENOENT || status == unix.ECONNRESET:
+		t.err = ErrTransferCanceled
+	case status == unix.EOVERFLOW:
+		o := t.ep.overflow(len(t.buf))
+		o.Salvaged = t.n
+		t.err = o
+	default:
+		t.err = &URBStatusError{Endpoint: t.ep.Address, Errno: status}
+	}
+	if t.err != ErrTransferCanceled {
+		t.ep.i.d.recordLatency(uint8(t.ep.Address), t.submittedAt)
+	}
+	t.ep.i.d.recordTransfer(t.err)
+	t.finish()
+}
+
+// finish marks the transfer done, whether it completed, failed or never got submitted.
+func (t *Transfer) finish() {
+	t.completedAt = time.Now()
+	close(t.done)
+	if t.notify != nil {
+		t.notify.push(t)
+	}
+}
+
+// Submit starts an asynchronous transfer of buf on a bulk or interrupt endpoint.
+// For IN endpoints buf is filled, for OUT endpoints it is sent. buf must not be
+// touched until the Transfer is done.
+func (e *Endpoint) Submit(buf []byte) (*Transfer, error) {
+	return e.submit(context.Background(), buf)
+}
+
+// submit is Submit, with ctx bounding the wait for the endpoint's tuning MinInterval.
+func (e *Endpoint) submit(ctx context.Context, buf []byte) (*Transfer, error) {
+	if e.i == nil || e.i.d == nil {
+		return nil, ErrNotOpen
+	}
+	var typ gusb.URBType
+	switch e.TransferType {
+	case TransferTypeBulk:
+		typ = gusb.URBTypeBulk
+	case int(gusb.EndpointTypeInterrupt):
+		typ = gusb.URBTypeInterrupt
+	default:
+		return nil, fmt.Errorf("usb: endpoint address %02X: asynchronous transfers of type %02X not supported", e.Address, e.TransferType)
+	}
+	t, err := e.newTransfer(typ, buf, 0)
+	if err != nil {
+		return nil, err
+	}
+	if (e.Address & 0x80) == 0 {
+		e.pace(len(buf))
+	}
+	flags, err := e.tuning(ctx)
+	if err != nil {
+		return nil, err
+	}
+	t.urb.Flags |= uint32(flags)
+	if err := t.eng.submit(t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// submitWait moves one buffer through an URB, waiting for it: for buffers mapped from
+// the device, or transfers cancelled cleanly with ctx. Closing the device's Context
+// cancels it too, with context.Canceled.
+func (e *Endpoint) submitWait(ctx context.Context, buf []byte) (int, error) {
+	if e.i == nil || e.i.d == nil {
+		return 0, ErrNotOpen
+	}
+	if c := e.i.d.context(); c != nil {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(ctx)
+		defer cancel()
+		defer context.AfterFunc(c, cancel)()
+	}
+	t, err := e.submit(ctx, buf)
+	if err != nil {
+		return 0, err
+	}
+	return t.Wait(ctx)
+}
+
+func (e *Endpoint) newTransfer(typ gusb.URBType, buf []byte, numPackets int) (*Transfer, error) {
+	eng, err := e.i.d.async()
+	if err != nil {
+		return nil, err
+	}
+	if err := e.checkClaimed(); err != nil {
+		return nil, err
+	}
+	e.i.d.st.mu.Lock()
+	notify := e.i.d.st.completions
+	e.i.d.st.mu.Unlock()
+	t := &Transfer{
+		ep:     e,
+		buf:    buf,
+		eng:    eng,
+		done:   make(chan struct{}),
+		notify: notify,
+	}
+	t.urb, t.iso = gusb.NewURB(numPackets)
+	t.urb.Type = typ
+	t.urb.Endpoint = uint8(e.Address)
+	t.urb.BufferLength = int32(len(buf))
+	if len(buf) > 0 {
+		t.urb.Buffer = gusb.SlicePtr(buf)
+	}
+	return t, nil
+}
+
+// AsyncStats counts the work done by a device's asynchronous completion loop.
+type AsyncStats struct {
+	Submitted uint64 // URBs submitted
+	Completed uint64 // URBs reaped
+	Wakeups   uint64 // times the loop woke from poll
+	Reaps     uint64 // reap syscalls, including those finding nothing
+}
+
+// AsyncStats returns the counters of the device's asynchronous completion loop.
+// Completed/Wakeups is the average number of URBs reaped per wakeup.
+func (d *Device) AsyncStats() AsyncStats {
+	d.st.mu.Lock()
+	eng := d.st.async
+	d.st.mu.Unlock()
+	if eng == nil {
+		return AsyncStats{}
+	}
+	return AsyncStats{
+		Submitted: eng.submitted.Load(),
+		Completed: eng.completed.Load(),
+		Wakeups:   eng.wakeups.Load(),
+		Reaps:     eng.reaps.Load(),
+	}
+}
+
+// AsyncOptions configure the goroutine reaping a device's asynchronous transfers.
+type AsyncOptions struct {
+	// LockOSThread wires the completion goroutine to its own OS thread for its lifetime,
+	// so Go scheduling does not move it between threads.
+	LockOSThread bool
+	// OnStart, if set, is called from the completion goroutine before it reaps anything,
+	// after the thread is locked. Use it to set CPU affinity (see PinToCPUs), NUMA policy
+	// or scheduling priority of the thread. An error aborts starting the loop, and is
+	// returned from the Submit that started it.
+	OnStart func() error
+	// MaxInFlight limits how many transfers are submitted to the kernel at once. Further
+	// transfers are queued, and submitted in the order set by Device.SetEndpointPriority
+	// as slots free up. 0 submits everything immediately, in call order.
+	MaxInFlight int
+	// PerInterface applies MaxInFlight to each interface separately, for composite
+	// devices: transfers kept pending on one interface, such as a CDC status endpoint's,
+	// then never hold up those of another.
+	PerInterface bool
+}
+
+// SetAsyncOptions configures the completion loop of the device. They take effect when
+// the loop is next started, by the first Submit after the device is opened.
+func (d *Device) SetAsyncOptions(opts AsyncOptions) {
+	d.st.mu.Lock()
+	defer d.st.mu.Unlock()
+	d.st.asyncOpts = opts
+}
+
+// PinToCPUs returns an AsyncOptions.OnStart func restricting the calling thread to the given CPUs.
+// It is only meaningful along with LockOSThread.
+func PinToCPUs(cpus ...int) func() error {
+	return func() error {
+		var set unix.CPUSet
+		for _, c := range cpus {
+			set.Set(c)
+		}
+		return unix.SchedSetaffinity(0, &set) // 0 is the calling thread
+	}
+}
+
+// async returns the device's completion loop, starting it if needed.
+func (d *Device) async() (*asyncEngine, error) {
+	reapBatch := defaultBuffers.ReapBatch
+	if c := d.context(); c != nil {
+		reapBatch = c.Buffers().ReapBatch
+	}
+	d.st.mu.Lock()
+	defer d.st.mu.Unlock()
+	if d.st.refused != nil {
+		return nil, d.st.refused
+	}
+	if d.st.f == nil {
+		if d.st.closed {
+			return nil, ErrClosed
+		}
+		return nil, ErrNotOpen
+	}
+	if d.st.readOnly {
+		return nil, ErrReadOnly
+	}
+	if d.st.async != nil {
+		return d.st.async, nil
+	}
+	eng, err := newAsyncEngine(d.st.f, d.st.asyncOpts, reapBatch)
+	if err != nil {
+		return nil, err
+	}
+	for addr, p := range d.st.priorities {
+		eng.setPriority(addr, p)
+	}
+	d.st.async = eng
+	return eng, nil
+}
+
+// asyncEngine reaps completed URBs for one open device, in a single goroutine.
+// Rather than one blocking REAPURB per transfer, it waits in poll(2) for the fd to
+// signal completions, then reaps every completed URB with REAPURBNDELAY until EAGAIN.
+type asyncEngine struct {
+	f            *os.File
+	wakeR, wakeW *os.File // self-pipe, to interrupt poll when stopping
+
+	mu          sync.Mutex
+	inflight    map[uintptr]*Transfer
+	stopping    bool
+	stopped     chan struct{}
+	maxInFlight int
+	reapBatch   int // URBs reaped per wakeup, 0 for all
+	perIntf     bool
+	intfFlight  map[int]int        // in flight by interface number, when perIntf
+	queues      map[uint8]*epQueue // by endpoint address
+
+	frame   int       // last (micro)frame seen in a completed isochronous URB
+	frameAt time.Time // when that URB was reaped
+
+	submitted, completed, wakeups, reaps atomic.Uint64
+}
+
+// newAsyncEngine starts the completion loop on f, reaping up to reapBatch URBs per
+// wakeup, 0 for all.
+func newAsyncEngine(f *os.File, opts AsyncOptions, reapBatch int) (*asyncEngine, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	eng := &asyncEngine{
+		f:           f,
+		wakeR:       r,
+		wakeW:       w,
+		inflight:    make(map[uintptr]*Transfer),
+		stopped:     make(chan struct{}),
+		maxInFlight: opts.MaxInFlight,
+		reapBatch:   reapBatch,
+		perIntf:     opts.PerInterface,
+		intfFlight:  make(map[int]int),
+		queues:      make(map[uint8]*epQueue),
+	}
+	started := make(chan error, 1)
+	go func() {
+		if opts.LockOSThread {
+			// never unlocked: the thread exits with the goroutine, rather than
+			// returning to the pool with whatever affinity OnStart gave it
+			runtime.LockOSThread()
+		}
+		if opts.OnStart != nil {
+			if err := opts.OnStart(); err != nil {
+				started <- err
+				eng.wakeR.Close()
+				eng.wakeW.Close()
+				close(eng.stopped)
+				return
+			}
+		}
+		started <- nil
+		eng.loop()
+	}()
+	if err := <-started; err != nil {
+		return nil, fmt.Errorf("usb: starting completion loop: %w", err)
+	}
+	return eng, nil
+}
+
+func (eng *asyncEngine) submit(t *Transfer) error {
+	eng.mu.Lock()
+	defer eng.mu.Unlock()
+	if eng.stopping {
+		return ErrClosed
+	}
+	if eng.maxInFlight > 0 && (eng.full(t.intf()) || eng.anyQueued(t.intf())) {
+		eng.enqueue(t)
+		return nil
+	}
+	if err := eng.submitLocked(t); err != nil {
+		return fmt.Errorf("usb: submitting transfer on ep %02X: %w", t.ep.Address, err)
+	}
+	return nil
+}
+
+func (eng *asyncEngine) submitLocked(t *Transfer) error {
+	key := uintptr(unsafe.Pointer(t.urb))
+	t.submittedAt = time.Now()
+	if err := gusb.SubmitURB(eng.f, t.urb); err != nil {
+		return err
+	}
+	eng.inflight[key] = t
+	eng.intfFlight[t.intf()]++
+	eng.submitted.Add(1)
+	return nil
+}
+
+// full reports whether intf has no submission slot free.
+func (eng *asyncEngine) full(intf int) bool {
+	if eng.maxInFlight <= 0 {
+		return false
+	}
+	if eng.perIntf {
+		return eng.intfFlight[intf] >= eng.maxInFlight
+	}
+	return len(eng.inflight) >= eng.maxInFlight
+}
+
+// intf is the number of the interface the transfer's endpoint belongs to.
+func (t *Transfer) intf() int { return t.ep.i.ID }
+
+// cancelInterface cancels the transfers on the endpoints of an interface, and waits
+// until they are done. Releasing an interface has the kernel free its URBs without
+// giving them back, which would leave their Transfers pending for ever.
+func (eng *asyncEngine) cancelInterface(intf int) {
+	eng.mu.Lock()
+	var pending []*Transfer
+	for _, t := range eng.inflight {
+		if t.intf() == intf {
+			pending = append(pending, t)
+		}
+	}
+	for _, q := range eng.queues {
+		kept := q.q[:0]
+		for _, t := range q.q {
+			if t.intf() == intf {
+				t.queued = false
+				t.err = ErrTransferCanceled
+				t.finish()
+			} else {
+				kept = append(kept, t)
+			}
+		}
+		q.q = kept
+	}
+	eng.mu.Unlock()
+	for _, t := range pending {
+		t.Cancel()
+		<-t.done
+	}
+}
+
+// dispatch submits queued transfers while there are free slots.
+func (eng *asyncEngine) dispatch() {
+	eng.mu.Lock()
+	defer eng.mu.Unlock()
+	for !eng.stopping {
+		t := eng.next()
+		if t == nil {
+			return
+		}
+		if err := eng.submitLocked(t); err != nil {
+			t.err = fmt.Errorf("usb: submitting transfer on ep %02X: %w", t.ep.Address, err)
+			t.finish()
+		}
+	}
+}
+
+// stop cancels everything in flight, and returns once it has all been reaped.
+func (eng *asyncEngine) stop() {
+	eng.mu.Lock()
+	if !eng.stopping {
+		eng.stopping = true
+		eng.wakeW.Write([]byte{0})
+	}
+	eng.mu.Unlock()
+	<-eng.stopped
+}
+
+func (eng *asyncEngine) loop() {
+	defer func() {
+		eng.wakeR.Close()
+		eng.wakeW.Close()
+		close(eng.stopped)
+	}()
+
+	fds := []unix.PollFd{
+		{Fd: int32(eng.f.Fd()), Events: unix.POLLOUT},
+		{Fd: int32(eng.wakeR.Fd()), Events: unix.POLLIN},
+	}
+	discarded := false
+	for {
+		eng.mu.Lock()
+		stopping, pending := eng.stopping, len(eng.inflight)
+		eng.mu.Unlock()
+		if stopping {
+			if pending == 0 {
+				return
+			}
+			if !discarded {
+				eng.discardAll()
+				discarded = true
+			}
+		}
+
+		if _, err := unix.Poll(fds, -1); err == unix.EINTR {
+			continue
+		} else if err != nil {
+			eng.failAll(err)
+			return
+		}
+		if fds[1].Revents != 0 {
+			fds[1].Events = 0 // drained by stop state, stop watching
+		}
+		if fds[0].Revents == 0 {
+			continue
+		}
+		eng.wakeups.Add(1)
+		if err := eng.reapAll(); err != nil {
+			eng.failAll(err)
+			return
+		}
+		eng.dispatch()
+		if fds[0].Revents&(unix.POLLERR|unix.POLLHUP) != 0 {
+			eng.failAll(unix.ENODEV) // disconnected
+			return
+		}
+	}
+}
+
+// reapAll reaps completed URBs until none are left, or reapBatch of them. The
+// rest keep the fd ready, for the next poll.
+func (eng *asyncEngine) reapAll() error {
+	for n := 0; eng.reapBatch <= 0 || n < eng.reapBatch; n++ {
+		addr, err := gusb.ReapURB(eng.f, false)
+		eng.reaps.Add(1)
+		if err == unix.EAGAIN {
+			return nil
+		} else if err == unix.EINTR {
+			continue
+		} else if err != nil {
+			return err
+		}
+		eng.mu.Lock()
+		t := eng.inflight[addr]
+		delete(eng.inflight, addr)
+		if t != nil {
+			eng.intfFlight[t.intf()]--
+		}
+		eng.mu.Unlock()
+		if t != nil {
+			eng.completed.Add(1)
+			if t.urb.Type == gusb.URBTypeISO && t.urb.Status == 0 {
+				eng.mu.Lock()
+				eng.frame, eng.frameAt = t.StartFrame()+len(t.iso)-1, time.Now()
+				eng.mu.Unlock()
+			}
+			t.complete()
+		}
+	}
+	return nil
+}
+
+func (eng *asyncEngine) discardAll() {
+	eng.mu.Lock()
+	defer eng.mu.Unlock()
+	eng.cancelQueued(ErrTransferCanceled)
+	for _, t := range eng.inflight {
+		gusb.DiscardURB(eng.f, t.urb)
+	}
+}
+
+// failAll completes everything left in flight with err, when the kernel can no longer give them back.
+func (eng *asyncEngine) failAll(err error) {
+	eng.mu.Lock()
+	defer eng.mu.Unlock()
+	eng.stopping = true
+	eng.cancelQueued(ErrClosed)
+	for key, t := range eng.inflight {
+		delete(eng.inflight, key)
+		eng.intfFlight[t.intf()]--
+		t.err = fmt.Errorf("usb: transfer on ep %02X failed: %w", t.ep.Address, err)
+		t.finish()
+	}
+}
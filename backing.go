@@ -10,6 +10,7 @@ type dataBacking interface {
 	getDevNum(Device) (int, error) // usbfs can't determine bus number alone
 	getVendorName(Device) (string, error)
 	getProductName(Device) (string, error)
+	getSerial(Device) (string, error)
 	getPort(Device) (int, error)
 	getActiveConfig(Device) (int, error)
 	getSpeed(Device) (Speed, error)
@@ -3,13 +3,12 @@ package usb
 import (
 	"fmt"
 	"io/ioutil"
-	"log"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
 
-	"github.com/pzl/usb/gusb"
+	"github.com/pzl/usb/x/gusb"
 )
 
 // @todo: usbfs fallback?
@@ -26,10 +25,18 @@ func (b backingSysfs) getProductName(d Device) (string, error) {
 	data, err := ioutil.ReadFile(filepath.Join(d.SysPath, "product"))
 	return strings.TrimSpace(string(data)), err
 }
+func (b backingSysfs) getSerial(d Device) (string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(d.SysPath, "serial"))
+	if os.IsNotExist(err) {
+		return "", nil // many devices have no serial number
+	}
+	return strings.TrimSpace(string(data)), err
+}
 func (b backingSysfs) getPort(d Device) (int, error) {
-	if has := strings.LastIndexAny(d.SysPath, ".-"); has != -1 {
+	name := filepath.Base(d.SysPath) // only the name: the directories above may contain anything
+	if has := strings.LastIndexAny(name, ".-"); has != -1 {
 		// look for last port, separated by .  or top-level hub port after the -
-		if port, err := strconv.Atoi(d.SysPath[has+1:]); err == nil {
+		if port, err := strconv.Atoi(name[has+1:]); err == nil {
 			return port, nil
 		} else {
 			return 0, err
@@ -42,37 +49,70 @@ func (b backingSysfs) getPort(d Device) (int, error) {
 	return 0, fmt.Errorf("unable to find port number in path: %s", d.SysPath)
 }
 func (b backingSysfs) getActiveConfig(d Device) (int, error) {
-	cfg, err := readAsInt(filepath.Join(d.SysPath, "bConfigurationValue"))
-	return cfg, err
+	path := filepath.Join(d.SysPath, "bConfigurationValue")
+	s, err := readAttr(path)
+	if err != nil {
+		return -1, err
+	}
+	if s == "" {
+		return 0, nil // empty when the device is unconfigured
+	}
+	v, err := parseAttrInt(s, 255)
+	if err != nil {
+		return -1, &AttrError{Path: path, Value: s, Err: err}
+	}
+	return v, nil
 }
 func (b backingSysfs) getSpeed(d Device) (Speed, error) {
-	speed, err := readAsFloat(filepath.Join(d.SysPath, "speed"))
-	return toSpeedSysfs(speed), err
+	path := filepath.Join(d.SysPath, "speed")
+	s, err := readAttr(path)
+	if err != nil {
+		return SpeedUnknown, err
+	}
+	if s == "53.3-480" { // how the kernel reports Wireless USB
+		return SpeedWireless, nil
+	}
+	speed, err := parseAttrSpeed(s)
+	if err != nil {
+		return SpeedUnknown, &AttrError{Path: path, Value: s, Err: err}
+	}
+	// lanes only exist on kernels 4.18+, and devices that are not root hubs
+	rx, _ := readAsInt(filepath.Join(d.SysPath, "rx_lanes"))
+	tx, _ := readAsInt(filepath.Join(d.SysPath, "tx_lanes"))
+	if tx > rx {
+		rx = tx
+	}
+	return speedFromSysfs(speed, rx), nil
 }
 
 func (b backingSysfs) getDriver(d Device, intf int) (string, error) {
+	if d.ActiveConfig == nil {
+		return "", ErrNoActiveConfig
+	}
 	driver := filepath.Join(fmt.Sprintf("%s:%d.%d", d.SysPath, d.ActiveConfig.Value, intf), "driver")
 	if drv, err := os.Readlink(driver); err == nil {
 		return filepath.Base(drv), nil
 	} else {
-		log.Printf("ERROR: could not use sysfs to get driver for path %s: %v\n", driver, err)
+		logf("ERROR: could not use sysfs to get driver for path %s: %v\n", driver, err)
 		return "", err
 	}
 }
 
 func (b backingSysfs) setConfiguration(d Device, cfg int) error {
-	//	write to sysfs_path/bConfigurationValue
-	return ErrNotImplemented
+	return ioutil.WriteFile(filepath.Join(d.SysPath, "bConfigurationValue"), []byte(strconv.Itoa(cfg)), 0200)
 }
 
 // write interface basename to SYSFS_PATH/drivers/DRIVERNAME/unbind
-// write interface basename to SYSFS_PATH/drivers/usbfs/bind
+// write interface basename to SYSFS_PATH/drivers/usbfs/bind, see Device.driversDir
 func (b backingSysfs) claim(i Interface) error {
+	if i.d.ActiveConfig == nil {
+		return ErrNoActiveConfig
+	}
 	// look for bound driver file
 	devPath := fmt.Sprintf("%s:%d.%d", i.d.SysPath, i.d.ActiveConfig.Value, i.ID)
 	_, err := os.Stat(filepath.Join(devPath, "driver"))
 	if err != nil && !os.IsNotExist(err) {
-		log.Printf("ERROR: could not get driver information for device %s: %v\n", devPath, err)
+		logf("ERROR: could not get driver information for device %s: %v\n", devPath, err)
 		return err
 	}
 
@@ -80,16 +120,16 @@ func (b backingSysfs) claim(i Interface) error {
 	// @todo: HID does not like to be unbound this way.
 	// see: https://unix.stackexchange.com/questions/12005/how-to-use-linux-kernel-driver-bind-unbind-interface-for-usb-hid-devices
 	if !os.IsNotExist(err) {
-		// log.Printf("DEBUG: device %s has bound driver\n", devPath)
+		// logf("DEBUG: device %s has bound driver\n", devPath)
 		unbind := filepath.Join(devPath, "driver", "unbind")
 		if err := ioutil.WriteFile(unbind, []byte(filepath.Base(devPath)), 0200); err != nil {
 			return fmt.Errorf("error unbinding driver: %v", err)
 		}
 	} else {
-		// log.Printf("DEBUG: no current driver found for device %s, nothing to unbind\n", devPath)
+		// logf("DEBUG: no current driver found for device %s, nothing to unbind\n", devPath)
 	}
 	// and bind to usbfs
-	return ioutil.WriteFile("/sys/bus/usb/drivers/usbfs/bind", []byte(filepath.Base(devPath)), 0200)
+	return ioutil.WriteFile(filepath.Join(i.d.driversDir(), "usbfs", "bind"), []byte(filepath.Base(devPath)), 0200)
 }
 
 func (b backingSysfs) release(i Interface) error {
@@ -107,17 +147,18 @@ func (b backingSysfs) getBusNum(d Device) (int, error) {
 }
 
 func (b backingSysfs) getParent(d Device) (*Device, error) {
-	if has := strings.LastIndexAny(d.SysPath, ".-"); has != -1 {
-		parent := d.SysPath[:has]
-		if !strings.ContainsRune(parent, '-') {
-			parent = filepath.Join(filepath.Dir(parent), fmt.Sprintf("usb%s", filepath.Base(parent)))
+	dir, name := filepath.Split(d.SysPath)
+	if has := strings.LastIndexAny(name, ".-"); has != -1 {
+		parent := filepath.Join(dir, name[:has])
+		if !strings.ContainsRune(name[:has], '-') {
+			parent = filepath.Join(dir, fmt.Sprintf("usb%s", name[:has]))
 		}
 
 		if f, err := os.OpenFile(filepath.Join(parent, "descriptors"), os.O_RDONLY, 0644); err == nil {
 			defer f.Close()
 			if pdesc, err := gusb.ParseDescriptor(f); err == nil {
 				pdesc.PathInfo.SysPath = parent
-				return toDevice(pdesc), nil
+				return newDevice(pdesc, devSource{devRoot: d.devRoot}), nil
 			} else {
 				return nil, err
 			}
@@ -128,22 +169,38 @@ func (b backingSysfs) getParent(d Device) (*Device, error) {
 	return nil, nil
 }
 
-/*  helpers  */
-
-// in Mbps apparently
-func toSpeedSysfs(speed float64) Speed {
-	s := int(speed)
-	switch s {
-	case 1: // truncated from 1.5, which is low speed
-		return SpeedLow
-	case 12:
-		return SpeedFull
-	case 480:
-		return SpeedHigh
-	case 5000:
-		return SpeedSuper
-	case 10000:
-		return SpeedSuperPlus
-	}
-	return SpeedUnknown
+// virtualHCDs are the drivers of host controllers with no hardware behind them.
+var virtualHCDs = []string{"vhci_hcd", "dummy_hcd"}
+
+// isVirtual reports whether the device is on a virtual host controller: the device
+// its root hub's directory is in, driven by one of virtualHCDs, or named after one
+// (vhci_hcd.0) when its driver isn't visible.
+func (b backingSysfs) isVirtual(d Device) bool {
+	dir, err := filepath.EvalSymlinks(d.SysPath)
+	if err != nil {
+		return false
+	}
+	for ; !isRootHubDir(filepath.Base(dir)); dir = filepath.Dir(dir) {
+		if dir == filepath.Dir(dir) {
+			return false
+		}
+	}
+	hcd := filepath.Dir(dir)
+	name := filepath.Base(hcd)
+	if drv, err := os.Readlink(filepath.Join(hcd, "driver")); err == nil {
+		name = filepath.Base(drv)
+	}
+	for _, v := range virtualHCDs {
+		if name == v || strings.HasPrefix(name, v+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// isRootHubDir reports whether name is a root hub's sysfs name, usbN.
+func isRootHubDir(name string) bool {
+	n, ok := strings.CutPrefix(name, "usb")
+	_, err := strconv.Atoi(n)
+	return ok && err == nil
 }
@@ -1,47 +1,54 @@
 package usb
 
 import (
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"os"
+	"unicode/utf16"
 
-	"github.com/pzl/usb/gusb"
+	"github.com/pzl/usb/x/gusb"
+	"golang.org/x/sys/unix"
 )
 
 type backingUsbfs struct{}
 
 func (b backingUsbfs) getDevNum(d Device) (int, error) {
 	// get_connectinfo
-
+	// usbfs nodes are named by device number, Walk already knows it
 	return 0, ErrNotImplemented
 }
 func (b backingUsbfs) getVendorName(d Device) (string, error) {
-	return "", ErrNotImplemented
+	return b.getString(d, d.strIdx[0])
 }
 func (b backingUsbfs) getProductName(d Device) (string, error) {
-	return "", ErrNotImplemented
+	return b.getString(d, d.strIdx[1])
+}
+func (b backingUsbfs) getSerial(d Device) (string, error) {
+	return b.getString(d, d.strIdx[2])
 }
 func (b backingUsbfs) getPort(d Device) (int, error) {
-	// hub_portinfo
-	// https://elixir.bootlin.com/linux/v3.2/source/drivers/usb/core/hub.c#L1372
-	return 0, ErrNotImplemented
-
+	// usbfs has no way to ask a device where it is, only to ask a hub what's
+	// on its ports: List fills this in with linkUsbfsHubs
+	return 0, nil
 }
 func (b backingUsbfs) getActiveConfig(d Device) (int, error) {
 	// https://github.com/libusb/libusb/blob/93dcb8ed205a4e4cea105c2141fbbbdeac84bb66/libusb/os/linux_usbfs.c#L924
-	return 0, ErrNotImplemented
-
+	var cfg [1]byte
+	err := b.withNode(d, func(f *os.File) error {
+		_, err := gusb.Control(f, gusb.RequestDirIn, gusb.RequestGetConfiguration, 0, 0, cfg[:], usbfsTimeoutMs)
+		return err
+	})
+	return int(cfg[0]), err
 }
 
 func (b backingUsbfs) getSpeed(d Device) (Speed, error) {
-	var fh *os.File
-	if d.f != nil {
-		fh = d.f
-	} else if d.Bus <= 0 || d.Device <= 0 {
+	fh := d.node()
+	if fh == nil && (d.Bus <= 0 || d.Device <= 0) {
 		return SpeedUnknown, errors.New("unable to determine device speed without being Open, or knowing bus and device numbers")
-	} else {
+	} else if fh == nil {
 		//grab a file handle ourselves, read only
-		f, err := os.OpenFile(fmt.Sprintf("/dev/bus/usb/%03d/%03d", d.Bus, d.Device), os.O_RDONLY, 0644)
+		f, err := os.OpenFile(d.nodePath(), os.O_RDONLY, 0644)
 		if err != nil {
 			return SpeedUnknown, err
 		}
@@ -52,18 +59,143 @@ func (b backingUsbfs) getSpeed(d Device) (Speed, error) {
 	if err != nil {
 		return SpeedUnknown, err
 	}
-	return Speed(speed), nil
+	return speedFromUsbfs(speed), nil
 }
 
 func (b backingUsbfs) getDriver(d Device, intf int) (string, error) {
-	return gusb.GetDriver(d.f, int32(intf))
+	return gusb.GetDriver(d.node(), int32(intf))
 }
 
 func (b backingUsbfs) setConfiguration(d Device, cfg int) error {
-	return ErrNotImplemented
+	f, err := d.file()
+	if err != nil {
+		return err
+	}
+	return gusb.SetConfiguration(f, int32(cfg))
 }
 
-func (b backingUsbfs) claim(i Interface) error   { return gusb.Claim(i.d.f, int32(i.ID)) }   // ioctl
-func (b backingUsbfs) release(i Interface) error { return gusb.Release(i.d.f, int32(i.ID)) } // ioctl
+func (b backingUsbfs) claim(i Interface) error { return b.claimWith(i, claimOptions{}) }
+
+func (b backingUsbfs) release(i Interface) error {
+	f, err := i.d.file()
+	if err != nil {
+		return err
+	}
+	return gusb.Release(f, int32(i.ID)) // ioctl
+}
+
+// claimWith detaches the kernel driver and claims the interface in one ioctl, so the driver
+// can't re-bind in between. Without a caller's driver filter, older kernels fall back to two.
+func (b backingUsbfs) claimWith(i Interface, o claimOptions) error {
+	f, err := i.d.file()
+	if err != nil {
+		return err
+	}
+	if o.driverFlags == 0 {
+		return gusb.Claim(f, int32(i.ID))
+	}
+	err = gusb.DisconnectAndClaim(f, int32(i.ID), o.driverFlags, o.driver)
+	switch {
+	case errors.Is(err, unix.ENOTTY) && o.pinned:
+		return gusb.Claim(f, int32(i.ID)) // kernel too old to close the race
+	case errors.Is(err, unix.EBUSY) && o.pinned:
+		return fmt.Errorf("usb: interface %d: kernel driver changed while claiming: %w", i.ID, err)
+	case errors.Is(err, unix.EBUSY):
+		return fmt.Errorf("usb: interface %d: bound driver does not pass the %s filter: %w", i.ID, o.driver, err)
+	}
+	return err
+}
 
 /* Not universal funcs */
+
+// usbfsTimeoutMs bounds the control requests made while enumerating over usbfs.
+const usbfsTimeoutMs = 1000
+
+// withNode calls fn with the device's usbfs node: its open file, or else the node
+// opened read-write for the call, as control requests need.
+func (b backingUsbfs) withNode(d Device, fn func(*os.File) error) error {
+	if f := d.node(); f != nil {
+		return fn(f)
+	}
+	f, err := os.OpenFile(d.nodePath(), os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return fn(f)
+}
+
+// getString reads string descriptor idx, in the first language the device lists.
+func (b backingUsbfs) getString(d Device, idx uint8) (string, error) {
+	if idx == 0 {
+		return "", nil // the device has no such string
+	}
+	var s string
+	err := b.withNode(d, func(f *os.File) error {
+		buf := make([]byte, 255)
+		n, err := gusb.Control(f, gusb.RequestDirIn, gusb.RequestGetDescriptor, uint16(gusb.DTString)<<8, 0, buf, usbfsTimeoutMs) // string 0: languages
+		if err != nil {
+			return err
+		}
+		if n < 4 {
+			return errors.New("usb: device lists no string languages")
+		}
+		lang := binary.LittleEndian.Uint16(buf[2:])
+		n, err = gusb.Control(f, gusb.RequestDirIn, gusb.RequestGetDescriptor, uint16(gusb.DTString)<<8|uint16(idx), lang, buf, usbfsTimeoutMs)
+		if err != nil {
+			return err
+		}
+		if n > int(buf[0]) {
+			n = int(buf[0])
+		}
+		if n < 2 {
+			return fmt.Errorf("usb: short string descriptor %d", idx)
+		}
+		u := make([]uint16, (n-2)/2)
+		for i := range u {
+			u[i] = binary.LittleEndian.Uint16(buf[2+2*i:])
+		}
+		s = string(utf16.Decode(u))
+		return nil
+	})
+	return s, err
+}
+
+// linkUsbfsHubs fills in Port, Parent and Ports of the devices listed without sysfs,
+// from the port tables of their hubs. Hubs whose node can't be opened read-write
+// are skipped, leaving what's below them unlinked.
+func linkUsbfsHubs(devs []*Device) {
+	type busDev struct{ bus, dev int }
+	byNum := make(map[busDev]*Device, len(devs))
+	linked := false
+	for _, d := range devs {
+		byNum[busDev{d.Bus, d.Device}] = d
+	}
+	for _, hub := range devs {
+		if hub.SysPath != "" || !hub.IsHub() {
+			continue
+		}
+		var ports []int
+		if err := (backingUsbfs{}).withNode(*hub, func(f *os.File) (err error) {
+			ports, err = gusb.HubPorts(f)
+			return err
+		}); err != nil {
+			logf("INFO: bus %d, dev %d: can't read hub ports, devices below it have no parent: %v\n", hub.Bus, hub.Device, err)
+			continue
+		}
+		for i, num := range ports {
+			if child, ok := byNum[busDev{hub.Bus, num}]; ok && num != 0 && child.SysPath == "" {
+				child.Port, child.Parent = i+1, hub
+				linked = true
+			}
+		}
+	}
+	if !linked {
+		return
+	}
+	for _, d := range devs {
+		if d.SysPath == "" {
+			d.Ports = getPorts(*d)
+		}
+	}
+}
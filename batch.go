@@ -0,0 +1,76 @@
+package usb
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// DeviceError associates an error with the device it occurred on.
+type DeviceError struct {
+	Device *Device
+	Err    error
+}
+
+func (e *DeviceError) Error() string {
+	return fmt.Sprintf("usb: bus %d device %d: %v", e.Device.Bus, e.Device.Device, e.Err)
+}
+
+func (e *DeviceError) Unwrap() error { return e.Err }
+
+// ForEach opens every device accepted by filter, and calls fn on it, running at most
+// parallelism callbacks at once (all of them, if parallelism < 1). Each device is closed
+// once its callback returns, even if it panics.
+// Errors from opening devices, or returned by fn, are wrapped in a DeviceError
+// and joined together in the returned error.
+func (c *Context) ForEach(filter func(*Device) bool, parallelism int, fn func(*Device) error) error {
+	devs, err := c.OpenDevices(filter)
+	if err != nil {
+		for _, d := range devs {
+			d.Close()
+		}
+		return err
+	}
+	if parallelism < 1 || parallelism > len(devs) {
+		parallelism = len(devs)
+	}
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+		sem  = make(chan struct{}, parallelism)
+	)
+	for _, d := range devs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(d *Device) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := runOnDevice(d, fn); err != nil {
+				mu.Lock()
+				errs = append(errs, &DeviceError{Device: d, Err: err})
+				mu.Unlock()
+			}
+		}(d)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+func runOnDevice(d *Device, fn func(*Device) error) (err error) {
+	defer func() {
+		if cerr := d.Close(); err == nil {
+			err = cerr
+		}
+	}()
+	defer func() {
+		if r := recover(); r != nil {
+			err = newPanicError(r)
+		}
+	}()
+	if err := d.Open(); err != nil {
+		return err
+	}
+	return fn(d)
+}
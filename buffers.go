@@ -0,0 +1,97 @@
+package usb
+
+// DefaultChunkSize is the Buffers.ChunkSize used when none is given.
+const DefaultChunkSize = 64 * 1024
+
+// DefaultQueueDepth is the Buffers.QueueDepth used when none is given.
+const DefaultQueueDepth = 4
+
+// Buffers are the sizes transfers use where a call doesn't give its own: set them for
+// a whole Context with WithBuffers, and for an endpoint with Device.SetEndpointBuffers,
+// rather than at every call site. Zero fields inherit, from the Context for an
+// endpoint, and from the package defaults for a Context.
+type Buffers struct {
+	// ChunkSize is the bytes per transfer of streams, uploads and EndpointConn writes,
+	// and the read buffer of an EndpointConn. Default DefaultChunkSize.
+	ChunkSize int
+	// QueueDepth is the URBs an IsoStream keeps in flight. Default DefaultQueueDepth.
+	QueueDepth int
+	// ReapBatch caps the completed URBs the completion loop reaps per wakeup, before
+	// submitting queued transfers into the freed slots. Default 0, reaping all there
+	// are. It is Context-wide: the loop serves every endpoint of a device.
+	ReapBatch int
+}
+
+// inherit fills b's zero fields from def.
+func (b Buffers) inherit(def Buffers) Buffers {
+	if b.ChunkSize <= 0 {
+		b.ChunkSize = def.ChunkSize
+	}
+	if b.QueueDepth <= 0 {
+		b.QueueDepth = def.QueueDepth
+	}
+	if b.ReapBatch <= 0 {
+		b.ReapBatch = def.ReapBatch
+	}
+	return b
+}
+
+var defaultBuffers = Buffers{ChunkSize: DefaultChunkSize, QueueDepth: DefaultQueueDepth}
+
+// WithBuffers sets the Context's default Buffers.
+func WithBuffers(b Buffers) ContextOption {
+	return func(c *Context) { c.buffers = b }
+}
+
+// SetBuffers changes the Context's default Buffers, see WithBuffers. Streams and
+// completion loops already running keep the sizes they started with.
+func (c *Context) SetBuffers(b Buffers) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.buffers = b
+}
+
+// Buffers returns the Context's effective default Buffers, package defaults filled in.
+func (c *Context) Buffers() Buffers {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.buffers.inherit(defaultBuffers)
+}
+
+// SetEndpointBuffers overrides the Context's Buffers for the endpoint with the given
+// address. A zero Buffers removes the override.
+func (d *Device) SetEndpointBuffers(addr int, b Buffers) {
+	d.st.mu.Lock()
+	defer d.st.mu.Unlock()
+	if b == (Buffers{}) {
+		delete(d.st.buffers, uint8(addr))
+		return
+	}
+	if d.st.buffers == nil {
+		d.st.buffers = make(map[uint8]Buffers)
+	}
+	d.st.buffers[uint8(addr)] = b
+}
+
+// Buffers returns the effective Buffers of the endpoint: its own, see
+// Device.SetEndpointBuffers, then its device's Context's, then the package defaults.
+func (e *Endpoint) Buffers() Buffers {
+	if e.i == nil || e.i.d == nil {
+		return defaultBuffers
+	}
+	return e.i.d.buffers(uint8(e.Address))
+}
+
+func (d *Device) buffers(addr uint8) Buffers {
+	if d.st == nil {
+		return defaultBuffers
+	}
+	d.st.mu.Lock()
+	b := d.st.buffers[addr]
+	d.st.mu.Unlock()
+	def := defaultBuffers
+	if c := d.context(); c != nil {
+		def = c.Buffers()
+	}
+	return b.inherit(def)
+}
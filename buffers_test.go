@@ -0,0 +1,28 @@
+package usb_test
+
+import (
+	"testing"
+
+	"github.com/pzl/usb"
+)
+
+func TestBuffers(t *testing.T) {
+	ctx, w := openWidget(t, usb.WithBuffers(usb.Buffers{QueueDepth: 8}))
+	if b := ctx.Buffers(); b.ChunkSize != usb.DefaultChunkSize || b.QueueDepth != 8 {
+		t.Errorf("context buffers %+v", b)
+	}
+
+	w.SetEndpointBuffers(0x81, usb.Buffers{ChunkSize: 4096})
+	in := &w.ActiveConfig.Interfaces[0].Endpoints[0]
+	if b := in.Buffers(); b.ChunkSize != 4096 || b.QueueDepth != 8 {
+		t.Errorf("endpoint 81 buffers %+v", b)
+	}
+	out := &w.ActiveConfig.Interfaces[0].Endpoints[1]
+	if b := out.Buffers(); b.ChunkSize != usb.DefaultChunkSize {
+		t.Errorf("endpoint 02 buffers %+v", b)
+	}
+	w.SetEndpointBuffers(0x81, usb.Buffers{})
+	if b := in.Buffers(); b.ChunkSize != usb.DefaultChunkSize {
+		t.Errorf("endpoint 81 buffers after reset %+v", b)
+	}
+}
@@ -0,0 +1,60 @@
+package usb_test
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+)
+
+// TestCrossBuild type-checks the module, tests included, for the Linux architectures
+// whose syscall structs differ from the host's: 32-bit, and big endian. Stat_t.Rdev
+// is a uint32 on mips, for one.
+func TestCrossBuild(t *testing.T) {
+	if testing.Short() {
+		t.Skip("cross builds are slow")
+	}
+	gotool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip(err)
+	}
+	for _, arch := range []string{"386", "arm", "mips", "mipsle", "mips64", "mips64le", "ppc64", "s390x"} {
+		t.Run(arch, func(t *testing.T) {
+			t.Parallel()
+			cmd := exec.Command(gotool, "vet", "./...")
+			cmd.Env = append(os.Environ(), "GOOS=linux", "GOARCH="+arch, "CGO_ENABLED=0")
+			if out, err := cmd.CombinedOutput(); err != nil {
+				t.Errorf("GOARCH=%s go vet: %v\n%s", arch, err, out)
+			}
+		})
+	}
+}
+
+// TestBigEndian runs the x/gusb tests, which cover descriptor and ioctl byte order, on
+// big-endian targets under qemu user emulation, where it is installed.
+func TestBigEndian(t *testing.T) {
+	if testing.Short() {
+		t.Skip("emulated tests are slow")
+	}
+	gotool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip(err)
+	}
+	for _, arch := range []string{"mips", "s390x"} {
+		t.Run(arch, func(t *testing.T) {
+			t.Parallel()
+			qemu, err := exec.LookPath("qemu-" + arch + "-static")
+			if err != nil {
+				if qemu, err = exec.LookPath("qemu-" + arch); err != nil {
+					t.Skipf("no qemu-%s: %v", arch, err)
+				}
+			}
+			cmd := exec.Command(gotool, "test", "-count=1", "-exec", qemu, "./x/gusb")
+			cmd.Env = append(os.Environ(), "GOOS=linux", "GOARCH="+arch, "CGO_ENABLED=0")
+			out, err := cmd.CombinedOutput()
+			if err != nil {
+				t.Errorf("GOARCH=%s go test -exec %s: %v\n%s", arch, qemu, err, out)
+			}
+			t.Logf("%s", out)
+		})
+	}
+}
@@ -0,0 +1,480 @@
+// Package ch9test runs USB 2.0 Chapter 9 compliance checks against a device, in the
+// spirit of the USB-IF's USB20CV, and reports which pass. It is meant for firmware
+// under development: catching a malformed descriptor or a request that doesn't stall
+// here is cheaper than at a compliance workshop.
+//
+//	d, err := usb.VidPid(0x1234, 0x5678)
+//	...
+//	if err := d.Open(); err != nil { ... }
+//	r := ch9test.Run(d)
+//	r.WriteTo(os.Stdout)
+//
+// The checks change the device's state: they unconfigure and reconfigure it, and halt
+// its endpoints. Run them on a device nothing else uses, with none of its interfaces
+// claimed, and no kernel drivers bound.
+package ch9test
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/pzl/usb"
+	"github.com/pzl/usb/x/gusb"
+	"golang.org/x/sys/unix"
+)
+
+// ErrSkip is wrapped by the error of a check that doesn't apply to the device, e.g.
+// string checks on a device without strings.
+var ErrSkip = errors.New("ch9test: does not apply")
+
+// timeout bounds each request. Chapter 9 allows a device 500ms for standard requests
+// without a data stage, and 5s for those with one.
+const timeout = 5 * time.Second
+
+// Check is a compliance check. Run returns nil when the device passes.
+type Check struct {
+	Name string
+	Run  func(d *usb.Device) error
+}
+
+// Checks are the checks Run runs by default, in order. Those that change the device's
+// configuration restore it afterwards.
+var Checks = []Check{
+	{"device descriptor", checkDeviceDescriptor},
+	{"short device descriptor", checkShortDescriptor},
+	{"configuration descriptors", checkConfigDescriptors},
+	{"string descriptors", checkStrings},
+	{"device status", checkStatus},
+	{"get configuration", checkGetConfiguration},
+	{"descriptors in address state", checkAddressState},
+	{"set configuration", checkSetConfiguration},
+	{"endpoint halt", checkHalt},
+	{"unsupported request stalls", checkUnsupported},
+}
+
+// Result is the outcome of one check.
+type Result struct {
+	Check string
+	Err   error // nil if it passed, wrapping ErrSkip if it didn't apply
+}
+
+// Passed reports whether the device passed the check.
+func (r Result) Passed() bool { return r.Err == nil }
+
+// Skipped reports whether the check didn't apply to the device.
+func (r Result) Skipped() bool { return errors.Is(r.Err, ErrSkip) }
+
+// Report is the outcome of the checks on one device.
+type Report struct {
+	Device  string
+	Results []Result
+}
+
+// Failed returns the results of the checks that failed.
+func (r *Report) Failed() []Result {
+	var failed []Result
+	for _, res := range r.Results {
+		if !res.Passed() && !res.Skipped() {
+			failed = append(failed, res)
+		}
+	}
+	return failed
+}
+
+// WriteTo writes the report as text, a line per check, then a summary.
+func (r *Report) WriteTo(w io.Writer) (int64, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Chapter 9 checks of %s\n", r.Device)
+	var skipped int
+	for _, res := range r.Results {
+		switch {
+		case res.Passed():
+			fmt.Fprintf(&b, "PASS  %s\n", res.Check)
+		case res.Skipped():
+			skipped++
+			fmt.Fprintf(&b, "SKIP  %s: %v\n", res.Check, res.Err)
+		default:
+			fmt.Fprintf(&b, "FAIL  %s: %v\n", res.Check, res.Err)
+		}
+	}
+	failed := len(r.Failed())
+	fmt.Fprintf(&b, "%d passed, %d failed, %d skipped\n", len(r.Results)-failed-skipped, failed, skipped)
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// Run runs the checks, or Checks if none are given, against an open device.
+func Run(d *usb.Device, checks ...Check) *Report {
+	if len(checks) == 0 {
+		checks = Checks
+	}
+	r := &Report{Device: fmt.Sprintf("%s %s:%s %s", d.PortPath(), d.Vendor, d.Product, d.ProductName())}
+	for _, c := range checks {
+		r.Results = append(r.Results, Result{Check: c.Name, Err: c.Run(d)})
+	}
+	return r
+}
+
+const (
+	standardIn  = gusb.RequestDirIn | gusb.RequestTypeStandard
+	standardOut = gusb.RequestDirOut | gusb.RequestTypeStandard
+)
+
+func getDescriptor(d *usb.Device, dt gusb.DT, index uint8, lang uint16, length int) ([]byte, error) {
+	buf := make([]byte, length)
+	n, err := d.Control(standardIn|gusb.RecipientDevice, gusb.RequestGetDescriptor, uint16(dt)<<8|uint16(index), lang, buf, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("GET_DESCRIPTOR(%v, %d): %w", dt, index, err)
+	}
+	return buf[:n], nil
+}
+
+func getConfiguration(d *usb.Device) (int, error) {
+	buf := make([]byte, 1)
+	n, err := d.Control(standardIn|gusb.RecipientDevice, gusb.RequestGetConfiguration, 0, 0, buf, timeout)
+	if err != nil {
+		return 0, fmt.Errorf("GET_CONFIGURATION: %w", err)
+	} else if n != 1 {
+		return 0, fmt.Errorf("GET_CONFIGURATION returned %d bytes, want 1", n)
+	}
+	return int(buf[0]), nil
+}
+
+func getStatus(d *usb.Device, recipient uint8, index uint16) (uint16, error) {
+	buf := make([]byte, 2)
+	n, err := d.Control(standardIn|recipient, gusb.RequestGetStatus, 0, index, buf, timeout)
+	if err != nil {
+		return 0, fmt.Errorf("GET_STATUS: %w", err)
+	} else if n != 2 {
+		return 0, fmt.Errorf("GET_STATUS returned %d bytes, want 2", n)
+	}
+	return binary.LittleEndian.Uint16(buf), nil
+}
+
+func deviceDescriptor(d *usb.Device) ([]byte, error) {
+	b, err := getDescriptor(d, gusb.DTDevice, 0, 0, 18)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) != 18 || b[0] != 18 || gusb.DT(b[1]) != gusb.DTDevice {
+		return nil, fmt.Errorf("device descriptor is % x, want 18 bytes of type %v", b, gusb.DTDevice)
+	}
+	return b, nil
+}
+
+// checkDeviceDescriptor reads the device descriptor, and compares it with the copy
+// the kernel read at enumeration.
+func checkDeviceDescriptor(d *usb.Device) error {
+	b, err := deviceDescriptor(d)
+	if err != nil {
+		return err
+	}
+	switch mps := b[7]; {
+	case binary.LittleEndian.Uint16(b[2:]) >= 0x0300 && mps == 9: // 2^9 bytes
+	case mps == 8 || mps == 16 || mps == 32 || mps == 64:
+	default:
+		return fmt.Errorf("bMaxPacketSize0 is %d", mps)
+	}
+	if b[17] == 0 {
+		return errors.New("bNumConfigurations is 0")
+	}
+	if raw, err := d.RawDescriptors(); err == nil && len(raw) >= 18 && string(raw[:18]) != string(b) {
+		return fmt.Errorf("device descriptor % x differs from % x read at enumeration", b, raw[:18])
+	}
+	return nil
+}
+
+// checkShortDescriptor asks for the first 8 bytes only, as hosts do before they know
+// bMaxPacketSize0.
+func checkShortDescriptor(d *usb.Device) error {
+	full, err := deviceDescriptor(d)
+	if err != nil {
+		return err
+	}
+	b, err := getDescriptor(d, gusb.DTDevice, 0, 0, 8)
+	if err != nil {
+		return err
+	}
+	if string(b) != string(full[:8]) {
+		return fmt.Errorf("asked for 8 bytes, got % x, want % x", b, full[:8])
+	}
+	return nil
+}
+
+// checkConfigDescriptors reads each configuration, and walks its descriptors.
+func checkConfigDescriptors(d *usb.Device) error {
+	dev, err := deviceDescriptor(d)
+	if err != nil {
+		return err
+	}
+	for i := uint8(0); i < dev[17]; i++ {
+		head, err := getDescriptor(d, gusb.DTConfig, i, 0, 9)
+		if err != nil {
+			return err
+		}
+		if len(head) != 9 || head[0] != 9 || gusb.DT(head[1]) != gusb.DTConfig {
+			return fmt.Errorf("configuration %d header is % x", i, head)
+		}
+		total := int(binary.LittleEndian.Uint16(head[2:]))
+		b, err := getDescriptor(d, gusb.DTConfig, i, 0, total)
+		if err != nil {
+			return err
+		}
+		if len(b) != total {
+			return fmt.Errorf("configuration %d: wTotalLength is %d, got %d bytes", i, total, len(b))
+		}
+		if err := walkConfig(b); err != nil {
+			return fmt.Errorf("configuration %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// walkConfig checks the descriptors of a configuration add up: lengths, and the
+// interfaces and endpoints the headers count.
+func walkConfig(b []byte) error {
+	interfaces := map[uint8]bool{}
+	endpoints := -1 // the current interface's, left to find
+	for off := 0; off < len(b); {
+		l := int(b[off])
+		if l < 2 || off+l > len(b) {
+			return fmt.Errorf("descriptor at offset %d has bLength %d", off, l)
+		}
+		desc := b[off : off+l]
+		switch gusb.DT(desc[1]) {
+		case gusb.DTInterface:
+			if l < 9 {
+				return fmt.Errorf("interface descriptor of %d bytes", l)
+			}
+			if endpoints > 0 {
+				return fmt.Errorf("%d endpoint descriptors missing before offset %d", endpoints, off)
+			}
+			interfaces[desc[2]] = true
+			endpoints = int(desc[4])
+		case gusb.DTEndpoint:
+			if l < 7 {
+				return fmt.Errorf("endpoint descriptor of %d bytes", l)
+			}
+			if desc[2]&0x0f == 0 {
+				return fmt.Errorf("endpoint descriptor at offset %d for endpoint 0", off)
+			}
+			endpoints--
+		}
+		off += l
+	}
+	if endpoints > 0 {
+		return fmt.Errorf("%d endpoint descriptors missing", endpoints)
+	}
+	if len(interfaces) != int(b[4]) {
+		return fmt.Errorf("bNumInterfaces is %d, found %d interfaces", b[4], len(interfaces))
+	}
+	return nil
+}
+
+// checkStrings reads the language IDs, and the strings the device descriptor refers to.
+func checkStrings(d *usb.Device) error {
+	dev, err := deviceDescriptor(d)
+	if err != nil {
+		return err
+	}
+	indexes := []uint8{dev[14], dev[15], dev[16]} // iManufacturer, iProduct, iSerialNumber
+	if indexes[0] == 0 && indexes[1] == 0 && indexes[2] == 0 {
+		return fmt.Errorf("%w: the device has no strings", ErrSkip)
+	}
+	langs, err := getDescriptor(d, gusb.DTString, 0, 0, 255)
+	if err != nil {
+		return err
+	}
+	if len(langs) < 4 || len(langs)%2 != 0 || int(langs[0]) != len(langs) || gusb.DT(langs[1]) != gusb.DTString {
+		return fmt.Errorf("language ID descriptor is % x", langs)
+	}
+	lang := binary.LittleEndian.Uint16(langs[2:])
+	for _, i := range indexes {
+		if i == 0 {
+			continue
+		}
+		s, err := getDescriptor(d, gusb.DTString, i, lang, 255)
+		if err != nil {
+			return err
+		}
+		if len(s) < 2 || len(s)%2 != 0 || int(s[0]) != len(s) || gusb.DT(s[1]) != gusb.DTString {
+			return fmt.Errorf("string %d is % x", i, s)
+		}
+	}
+	return nil
+}
+
+// checkStatus reads the device's status, and that of endpoint 0, which must not be
+// halted.
+func checkStatus(d *usb.Device) error {
+	st, err := getStatus(d, gusb.RecipientDevice, 0)
+	if err != nil {
+		return err
+	}
+	if st&^0x1f != 0 {
+		return fmt.Errorf("device status %04x has reserved bits set", st)
+	}
+	if st, err = getStatus(d, gusb.RecipientEndpoint, 0); err != nil {
+		return fmt.Errorf("endpoint 0: %w", err)
+	}
+	if st != 0 {
+		return fmt.Errorf("endpoint 0 status is %04x, want 0", st)
+	}
+	return nil
+}
+
+// checkGetConfiguration compares GET_CONFIGURATION with the configuration the kernel
+// set.
+func checkGetConfiguration(d *usb.Device) error {
+	want := 0
+	if d.ActiveConfig != nil {
+		want = d.ActiveConfig.Value
+	}
+	got, err := getConfiguration(d)
+	if err != nil {
+		return err
+	}
+	if got != want {
+		return fmt.Errorf("configuration is %d, want %d", got, want)
+	}
+	return nil
+}
+
+// checkAddressState unconfigures the device, which must then report configuration 0
+// and still return its descriptors.
+func checkAddressState(d *usb.Device) error {
+	if d.ActiveConfig == nil {
+		return checkUnconfigured(d)
+	}
+	orig := d.ActiveConfig.Value
+	if err := d.SetConfiguration(0); err != nil {
+		return fmt.Errorf("unconfiguring: %w", err)
+	}
+	err := checkUnconfigured(d)
+	if rerr := d.SetConfiguration(orig); rerr != nil && err == nil {
+		err = fmt.Errorf("restoring configuration %d: %w", orig, rerr)
+	}
+	return err
+}
+
+func checkUnconfigured(d *usb.Device) error {
+	if c, err := getConfiguration(d); err != nil {
+		return err
+	} else if c != 0 {
+		return fmt.Errorf("unconfigured, configuration is %d", c)
+	}
+	if _, err := deviceDescriptor(d); err != nil {
+		return fmt.Errorf("unconfigured: %w", err)
+	}
+	if _, err := getDescriptor(d, gusb.DTConfig, 0, 0, 9); err != nil {
+		return fmt.Errorf("unconfigured: %w", err)
+	}
+	return nil
+}
+
+// checkSetConfiguration selects each configuration in turn, checking the device
+// reports it.
+func checkSetConfiguration(d *usb.Device) error {
+	orig := 0
+	if d.ActiveConfig != nil {
+		orig = d.ActiveConfig.Value
+	}
+	var err error
+	for _, c := range d.Configs {
+		if err = d.SetConfiguration(c.Value); err != nil {
+			err = fmt.Errorf("setting configuration %d: %w", c.Value, err)
+			break
+		}
+		var got int
+		if got, err = getConfiguration(d); err == nil && got != c.Value {
+			err = fmt.Errorf("set configuration %d, device reports %d", c.Value, got)
+		}
+		if err != nil {
+			break
+		}
+	}
+	if rerr := d.SetConfiguration(orig); rerr != nil && err == nil {
+		err = fmt.Errorf("restoring configuration %d: %w", orig, rerr)
+	}
+	return err
+}
+
+// checkHalt halts each bulk and interrupt endpoint of the active configuration with
+// SET_FEATURE, checks its status, and clears it. The interfaces are claimed for it,
+// and released afterwards.
+func checkHalt(d *usb.Device) error {
+	if d.ActiveConfig == nil {
+		return fmt.Errorf("%w: the device is unconfigured", ErrSkip)
+	}
+	var tested int
+	for i := range d.ActiveConfig.Interfaces {
+		intf := &d.ActiveConfig.Interfaces[i]
+		var eps []usb.Endpoint
+		for _, ep := range intf.Endpoints {
+			if ep.TransferType == int(gusb.EndpointTypeBulk) || ep.TransferType == int(gusb.EndpointTypeInterrupt) {
+				eps = append(eps, ep)
+			}
+		}
+		if len(eps) == 0 {
+			continue
+		}
+		if err := intf.Claim(); err != nil {
+			return fmt.Errorf("claiming interface %d: %w", intf.ID, err)
+		}
+		err := haltEndpoints(d, eps)
+		intf.Release()
+		if err != nil {
+			return err
+		}
+		tested += len(eps)
+	}
+	if tested == 0 {
+		return fmt.Errorf("%w: no bulk or interrupt endpoints", ErrSkip)
+	}
+	return nil
+}
+
+func haltEndpoints(d *usb.Device, eps []usb.Endpoint) error {
+	for _, ep := range eps {
+		addr := uint16(ep.Address)
+		if _, err := d.Control(standardOut|gusb.RecipientEndpoint, gusb.RequestSetFeature, gusb.FeatureEndpointHalt, addr, nil, timeout); err != nil {
+			return fmt.Errorf("halting ep %02x: %w", addr, err)
+		}
+		if st, err := getStatus(d, gusb.RecipientEndpoint, addr); err != nil {
+			return fmt.Errorf("ep %02x: %w", addr, err)
+		} else if st&1 == 0 {
+			return fmt.Errorf("ep %02x: not halted after SET_FEATURE(ENDPOINT_HALT), status %04x", addr, st)
+		}
+		if err := ep.ClearHalt(); err != nil {
+			return err
+		}
+		if st, err := getStatus(d, gusb.RecipientEndpoint, addr); err != nil {
+			return fmt.Errorf("ep %02x: %w", addr, err)
+		} else if st&1 != 0 {
+			return fmt.Errorf("ep %02x: still halted after CLEAR_FEATURE(ENDPOINT_HALT), status %04x", addr, st)
+		}
+	}
+	return nil
+}
+
+// checkUnsupported sends a standard request with an undefined code, which the device
+// must answer with a stall.
+func checkUnsupported(d *usb.Device) error {
+	buf := make([]byte, 2)
+	_, err := d.Control(standardIn|gusb.RecipientDevice, 0x02, 0, 0, buf, timeout) // bRequest 2 is reserved
+	if err == nil {
+		return errors.New("reserved request 0x02 did not stall")
+	}
+	if !errors.Is(err, unix.EPIPE) {
+		return fmt.Errorf("reserved request 0x02: %w, want a stall", err)
+	}
+	// the device must take requests after a stall
+	if _, err := getStatus(d, gusb.RecipientDevice, 0); err != nil {
+		return fmt.Errorf("after a stall: %w", err)
+	}
+	return nil
+}
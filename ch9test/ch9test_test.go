@@ -0,0 +1,57 @@
+package ch9test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/pzl/usb"
+)
+
+func TestReport(t *testing.T) {
+	d := &usb.Device{Bus: 1, Ports: []int{2}, Vendor: 0x1234, Product: 0x5678}
+	r := Run(d,
+		Check{"passes", func(*usb.Device) error { return nil }},
+		Check{"fails", func(*usb.Device) error { return errors.New("bad descriptor") }},
+		Check{"skips", func(*usb.Device) error { return fmt.Errorf("%w: no strings", ErrSkip) }},
+	)
+	if f := r.Failed(); len(f) != 1 || f[0].Check != "fails" {
+		t.Errorf("failed: %v", f)
+	}
+	var b strings.Builder
+	if _, err := r.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"PASS  passes\n", "FAIL  fails: bad descriptor\n", "SKIP  skips: ch9test: does not apply: no strings\n", "1 passed, 1 failed, 1 skipped\n"} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("report lacks %q:\n%s", want, b.String())
+		}
+	}
+}
+
+func TestWalkConfig(t *testing.T) {
+	config := []byte{9, 2, 32, 0, 1, 1, 0, 0x80, 50}
+	intf := []byte{9, 4, 0, 0, 2, 0xff, 0, 0, 0}
+	ep1 := []byte{7, 5, 0x81, 2, 64, 0, 0}
+	ep2 := []byte{7, 5, 0x02, 2, 64, 0, 0}
+	cat := func(parts ...[]byte) []byte {
+		var b []byte
+		for _, p := range parts {
+			b = append(b, p...)
+		}
+		return b
+	}
+	if err := walkConfig(cat(config, intf, ep1, ep2)); err != nil {
+		t.Errorf("valid configuration: %v", err)
+	}
+	if err := walkConfig(cat(config, intf, ep1)); err == nil {
+		t.Error("missing endpoint passed")
+	}
+	if err := walkConfig(cat(config, intf, ep1, []byte{7, 5, 0x80, 2, 64, 0, 0})); err == nil {
+		t.Error("endpoint 0 descriptor passed")
+	}
+	if err := walkConfig(cat(config, intf, ep1, ep2[:5])); err == nil {
+		t.Error("truncated descriptor passed")
+	}
+}
@@ -0,0 +1,50 @@
+package usb
+
+// ClaimMode is what a Context's devices do about a transfer on an endpoint whose
+// interface isn't claimed, see WithClaimMode.
+type ClaimMode int
+
+const (
+	// ClaimLoose leaves it to usbfs, which claims the interface behind our back, or
+	// fails with a bare EBUSY if a kernel driver has it. The default.
+	ClaimLoose ClaimMode = iota
+	// ClaimStrict fails the transfer with a NotClaimedError.
+	ClaimStrict
+	// ClaimAuto claims the interface, as Claim with no options would, and keeps it
+	// claimed until Release or Close.
+	ClaimAuto
+)
+
+// WithClaimMode sets how transfers on endpoints of unclaimed interfaces are handled.
+// Control requests to an interface or endpoint are always checked, see
+// Device.ControlTransfer.
+func WithClaimMode(m ClaimMode) ContextOption {
+	return func(c *Context) { c.claimMode = m }
+}
+
+func (d *Device) claimMode() ClaimMode {
+	if d.st == nil {
+		return ClaimLoose
+	}
+	d.st.mu.Lock()
+	ctx := d.ctx
+	d.st.mu.Unlock()
+	if ctx == nil {
+		return ClaimLoose
+	}
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+	return ctx.claimMode
+}
+
+// checkClaimed enforces the Context's ClaimMode before a transfer on the endpoint.
+func (e *Endpoint) checkClaimed() error {
+	mode := e.i.d.claimMode()
+	if mode == ClaimLoose || e.i.d.isClaimed(e.i.ID) {
+		return nil
+	}
+	if mode == ClaimAuto {
+		return e.i.Claim()
+	}
+	return &NotClaimedError{Interface: e.i.ID, Endpoint: e.Address, Transfer: true}
+}
@@ -0,0 +1,41 @@
+package usb_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pzl/usb"
+)
+
+func TestClaimMode(t *testing.T) {
+	tree := fixtureTree(t)
+	for _, mode := range []usb.ClaimMode{usb.ClaimLoose, usb.ClaimStrict, usb.ClaimAuto} {
+		ctx := usb.NewContext(usb.WithRoots(tree.Roots), usb.WithClaimMode(mode))
+		w, err := ctx.OpenDeviceWithVIDPID(0x1234, 0x5678)
+		if err != nil || w == nil {
+			t.Fatalf("widget: %v, %v", w, err)
+		}
+		if err := w.Open(); err != nil {
+			t.Fatal(err)
+		}
+		ep, err := w.Endpoint(0x81)
+		if err != nil {
+			t.Fatal(err)
+		}
+		in := &usb.InEndpoint{Endpoint: *ep}
+		_, err = in.BulkInTimeout(make([]byte, 64), time.Second)
+		var nc *usb.NotClaimedError
+		if strict := errors.As(err, &nc); strict != (mode == usb.ClaimStrict) {
+			t.Errorf("mode %d: %v", mode, err)
+		} else if strict && (nc.Interface != 0 || nc.Endpoint != 0x81 || !nc.Transfer) {
+			t.Errorf("mode %d: %+v", mode, nc)
+		}
+		// the fixture's claims fail, so ClaimAuto can't get past the claim either
+		if _, err := ep.Submit(make([]byte, 64)); mode != usb.ClaimLoose && err == nil {
+			t.Errorf("mode %d: submitted unclaimed", mode)
+		}
+		w.Close()
+		ctx.Close()
+	}
+}
@@ -0,0 +1,77 @@
+package usb
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+)
+
+// ErrAlreadyClaimedLocally is matched by an AlreadyClaimedError.
+var ErrAlreadyClaimedLocally = errors.New("usb: interface already claimed in this program")
+
+// AlreadyClaimedError is returned by Claim when the interface is claimed through
+// another handle of the same device in this program. usbfs would let both open files
+// claim, each thinking it owns the interface, or fail the second with a bare EBUSY.
+// Claiming again through the same handle is fine.
+type AlreadyClaimedError struct {
+	Bus       int
+	Device    int
+	Interface int
+	Stack     string // of the goroutine that claimed first
+}
+
+func (e *AlreadyClaimedError) Error() string {
+	return fmt.Sprintf("usb: interface %d of bus %d device %d is already claimed in this program, by:\n%s", e.Interface, e.Bus, e.Device, e.Stack)
+}
+
+func (e *AlreadyClaimedError) Is(target error) bool { return target == ErrAlreadyClaimedLocally }
+
+type claimKey struct{ bus, dev, intf int }
+
+type claimRecord struct {
+	st    *deviceState // the handle that claimed
+	stack string
+}
+
+// claims are the interfaces claimed in the process, across Contexts.
+var (
+	claimsMu sync.Mutex
+	claims   = make(map[claimKey]claimRecord)
+)
+
+// reserveClaim records the interface as claimed through d, fresh if it wasn't already.
+func (d *Device) reserveClaim(intf int) (fresh bool, err error) {
+	k := claimKey{d.Bus, d.Device, intf}
+	claimsMu.Lock()
+	defer claimsMu.Unlock()
+	if r, ok := claims[k]; ok {
+		if r.st == d.st {
+			return false, nil
+		}
+		return false, &AlreadyClaimedError{Bus: d.Bus, Device: d.Device, Interface: intf, Stack: r.stack}
+	}
+	claims[k] = claimRecord{st: d.st, stack: string(debug.Stack())}
+	return true, nil
+}
+
+// dropClaim forgets the interface's claim, if made through d.
+func (d *Device) dropClaim(intf int) {
+	k := claimKey{d.Bus, d.Device, intf}
+	claimsMu.Lock()
+	defer claimsMu.Unlock()
+	if claims[k].st == d.st {
+		delete(claims, k)
+	}
+}
+
+// dropClaims forgets every claim made through d, as closing it releases them.
+func (d *Device) dropClaims() {
+	claimsMu.Lock()
+	defer claimsMu.Unlock()
+	for k, r := range claims {
+		if r.st == d.st {
+			delete(claims, k)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package usb_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/pzl/usb"
+)
+
+func TestClaimRegistry(t *testing.T) {
+	tree := fixtureTree(t)
+	// the fixture's nodes can't be claimed: pretend they were
+	ctx := usb.NewContext(usb.WithRoots(tree.Roots), usb.WithClaimHooks(func(*usb.Interface, func() error) error { return nil }))
+	defer ctx.Close()
+	first, err := ctx.OpenDeviceWithVIDPID(0x1234, 0x5678)
+	if err != nil || first == nil {
+		t.Fatalf("widget: %v, %v", first, err)
+	}
+	defer first.Close()
+	if err := first.ClaimInterface(0); err != nil {
+		t.Fatal(err)
+	}
+	if err := first.ClaimInterface(0); err != nil {
+		t.Errorf("claiming again through the same handle: %v", err)
+	}
+
+	second := listWidget(t, tree)
+	var ac *usb.AlreadyClaimedError
+	if err := second.ClaimInterface(0); !errors.As(err, &ac) || ac.Interface != 0 || !strings.Contains(ac.Stack, "TestClaimRegistry") {
+		t.Fatalf("claiming through another handle: %v", err)
+	}
+	if err := second.ClaimInterface(1); errors.Is(err, usb.ErrAlreadyClaimedLocally) {
+		t.Errorf("claiming another interface: %v", err)
+	}
+	first.Close()
+	if err := second.ClaimInterface(0); errors.Is(err, usb.ErrAlreadyClaimedLocally) {
+		t.Errorf("claiming after the first handle closed: %v", err)
+	}
+}
@@ -0,0 +1,50 @@
+package usb
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is the time source behind the package's retries, backoffs, pacing and
+// operation timeouts. Tests swap in a fake one, such as usbtest.Clock, to run that
+// logic without real sleeps. Transfer timeouts handed to the kernel are unaffected.
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+	After(d time.Duration) <-chan time.Time
+	// NewTimer is After with a stop function, like time.NewTimer's Stop: for waits
+	// that may end another way, so the timer doesn't outlive them.
+	NewTimer(d time.Duration) (c <-chan time.Time, stop func() bool)
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) Sleep(d time.Duration)                  { time.Sleep(d) }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+func (systemClock) NewTimer(d time.Duration) (<-chan time.Time, func() bool) {
+	t := time.NewTimer(d)
+	return t.C, t.Stop
+}
+
+var (
+	clockMu  sync.RWMutex
+	theClock Clock = systemClock{}
+)
+
+// SetClock makes the package keep time with c. A nil Clock restores the system clock.
+func SetClock(c Clock) {
+	if c == nil {
+		c = systemClock{}
+	}
+	clockMu.Lock()
+	theClock = c
+	clockMu.Unlock()
+}
+
+func clock() Clock {
+	clockMu.RLock()
+	defer clockMu.RUnlock()
+	return theClock
+}
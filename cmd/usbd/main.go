@@ -0,0 +1,141 @@
+/*
+Usbd is a daemon giving remote access to the devices of a shared host, e.g. for lab
+machines to use test devices attached to it. It serves the gRPC service of package
+usbdrpc, either on a TCP address, over TLS and authenticated with a shared token:
+
+	USBD_TOKEN=secret usbd -listen :7531 -tls-cert cert.pem -tls-key key.pem
+
+or on stdin/stdout, relying on whatever started it (e.g. ssh) for auth:
+
+	ssh labhost usbd -stdio
+
+A loopback -listen address may go without TLS; the token is still required.
+
+Opened devices are persistent usb.Handles, re-opened and re-claimed if they reset or
+are re-plugged. They belong to the connection that opened them, and are closed when it
+goes away.
+*/
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+func main() {
+	listen := flag.String("listen", "", "TCP address to serve on")
+	stdio := flag.Bool("stdio", false, "serve a single client on stdin and stdout")
+	certFile := flag.String("tls-cert", "", "TLS certificate, required by -listen on a non-loopback address")
+	keyFile := flag.String("tls-key", "", "TLS key for -tls-cert")
+	flag.Parse()
+
+	switch {
+	case *stdio:
+		g := newServer("").register()
+		if err := g.Serve(newStdioListener()); err != nil && !errors.Is(err, net.ErrClosed) {
+			log.Fatal(err)
+		}
+	case *listen != "":
+		token := os.Getenv("USBD_TOKEN")
+		if token == "" {
+			log.Fatal("USBD_TOKEN must be set to serve on TCP")
+		}
+		var opts []grpc.ServerOption
+		if *certFile != "" || *keyFile != "" {
+			cert, err := tls.LoadX509KeyPair(*certFile, *keyFile)
+			if err != nil {
+				log.Fatal(err)
+			}
+			opts = append(opts, grpc.Creds(credentials.NewTLS(&tls.Config{
+				Certificates: []tls.Certificate{cert},
+				MinVersion:   tls.VersionTLS12,
+			})))
+		} else if !loopback(*listen) {
+			log.Fatal("-tls-cert and -tls-key are required to serve on a non-loopback address")
+		}
+		l, err := net.Listen("tcp", *listen)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Fatal(newServer(token).register(opts...).Serve(l))
+	default:
+		fmt.Fprintln(os.Stderr, "one of -listen or -stdio is required")
+		os.Exit(1)
+	}
+}
+
+// loopback reports whether addr only listens on a loopback interface.
+func loopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// stdioListener accepts a single connection, on stdin and stdout. Accept blocks after
+// that one, until the connection is closed, and then fails, ending Serve.
+type stdioListener struct {
+	conn   chan net.Conn
+	closed chan struct{}
+	once   sync.Once
+}
+
+func newStdioListener() *stdioListener {
+	l := &stdioListener{conn: make(chan net.Conn, 1), closed: make(chan struct{})}
+	l.conn <- stdioConn{l: l}
+	return l
+}
+
+func (l *stdioListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.conn:
+		return c, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *stdioListener) Close() error {
+	l.once.Do(func() { close(l.closed) })
+	return nil
+}
+
+func (l *stdioListener) Addr() net.Addr { return stdioAddr{} }
+
+type stdioAddr struct{}
+
+func (stdioAddr) Network() string { return "stdio" }
+func (stdioAddr) String() string  { return "stdio" }
+
+// stdioConn is the connection on stdin and stdout. Closing it closes its listener.
+type stdioConn struct {
+	noDeadline
+	l *stdioListener
+}
+
+func (stdioConn) Read(b []byte) (int, error)  { return os.Stdin.Read(b) }
+func (stdioConn) Write(b []byte) (int, error) { return os.Stdout.Write(b) }
+func (c stdioConn) Close() error              { return c.l.Close() }
+func (stdioConn) LocalAddr() net.Addr         { return stdioAddr{} }
+func (stdioConn) RemoteAddr() net.Addr        { return stdioAddr{} }
+
+type noDeadline struct{}
+
+func (noDeadline) SetDeadline(time.Time) error      { return nil }
+func (noDeadline) SetReadDeadline(time.Time) error  { return nil }
+func (noDeadline) SetWriteDeadline(time.Time) error { return nil }
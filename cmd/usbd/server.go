@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pzl/usb"
+	"github.com/pzl/usb/cmd/usbd/usbdrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/stats"
+	"google.golang.org/grpc/status"
+)
+
+// server implements usbdrpc.Server. Handles belong to the connection that opened them:
+// it is also the gRPC stats handler, and closes a connection's handles as it ends.
+type server struct {
+	token string       // required of every call, unless empty
+	ctx   *usb.Context // to list and open devices with, nil for the default
+	list  []usb.ListOption
+
+	mu      sync.Mutex
+	next    int
+	conns   int
+	handles map[int]*handle
+}
+
+type handle struct {
+	h      *usb.Handle
+	conn   int // connection that opened it
+	intf   int // claimed interface, or -1
+	cancel context.CancelFunc
+}
+
+func newServer(token string) *server {
+	return &server{token: token, handles: map[int]*handle{}}
+}
+
+// register serves s on a new grpc.Server.
+func (s *server) register(opts ...grpc.ServerOption) *grpc.Server {
+	opts = append(opts, grpc.StatsHandler(s), grpc.UnaryInterceptor(s.authenticate))
+	g := grpc.NewServer(opts...)
+	g.RegisterService(&usbdrpc.ServiceDesc, s)
+	return g
+}
+
+func (s *server) authenticate(ctx context.Context, req any, _ *grpc.UnaryServerInfo, next grpc.UnaryHandler) (any, error) {
+	if s.token != "" {
+		md, _ := metadata.FromIncomingContext(ctx)
+		var got string
+		if v := md.Get(usbdrpc.TokenKey); len(v) == 1 {
+			got, _ = usbdrpc.ParseToken(v[0])
+		}
+		if subtle.ConstantTimeCompare([]byte(got), []byte(s.token)) != 1 {
+			return nil, status.Error(codes.Unauthenticated, usbdrpc.ErrAuth.Error())
+		}
+	}
+	return next(ctx, req)
+}
+
+type connKey struct{}
+
+func (s *server) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	s.mu.Lock()
+	s.conns++
+	id := s.conns
+	s.mu.Unlock()
+	return context.WithValue(ctx, connKey{}, id)
+}
+
+func (s *server) HandleConn(ctx context.Context, st stats.ConnStats) {
+	if _, ok := st.(*stats.ConnEnd); !ok {
+		return
+	}
+	conn := ctx.Value(connKey{}).(int)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, h := range s.handles {
+		if h.conn == conn {
+			h.cancel()
+			delete(s.handles, id)
+		}
+	}
+}
+
+func (s *server) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context { return ctx }
+func (s *server) HandleRPC(context.Context, stats.RPCStats)                       {}
+
+func (s *server) List(_ context.Context, req *usbdrpc.ListRequest) (*usbdrpc.ListReply, error) {
+	devs, err := usb.ListWhere(req.Match, s.list...)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	reply := &usbdrpc.ListReply{}
+	for _, d := range devs {
+		reply.Devices = append(reply.Devices, usbdrpc.DeviceInfo{
+			Bus:      d.Bus,
+			Device:   d.Device,
+			PortPath: d.PortPath(),
+			Vendor:   d.Vendor.String(),
+			Product:  d.Product.String(),
+			Name:     strings.TrimSpace(d.VendorName() + " " + d.ProductName()),
+			Serial:   d.Serial,
+		})
+	}
+	return reply, nil
+}
+
+func (s *server) Open(ctx context.Context, req *usbdrpc.OpenRequest) (*usbdrpc.OpenReply, error) {
+	if req.Serial == "" && req.PortPath == "" {
+		return nil, status.Error(codes.InvalidArgument, "usbd: Open needs a serial or port_path")
+	}
+	conn, _ := ctx.Value(connKey{}).(int)
+	h := &usb.Handle{
+		Serial:   req.Serial,
+		PortPath: req.PortPath,
+		Context:  s.ctx,
+		OnError:  func(err error) { log.Printf("%s%s: %v", req.Serial, req.PortPath, err) },
+	}
+	if req.Interface >= 0 {
+		h.OnOpen = func(d *usb.Device) error {
+			i, err := d.InterfaceByNumber(req.Interface)
+			if err != nil {
+				return err
+			}
+			return i.ClaimWithTimeout(2 * time.Second) // drivers may still be probing a re-plugged device
+		}
+	}
+	run, cancel := context.WithCancel(context.Background())
+	go h.Run(run)
+
+	wait, done := context.WithTimeout(ctx, 5*time.Second)
+	defer done()
+	if _, err := h.Device(wait); err != nil {
+		cancel()
+		return nil, status.Errorf(codes.Unavailable, "usbd: device not available: %v", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.next++
+	s.handles[s.next] = &handle{h: h, conn: conn, intf: req.Interface, cancel: cancel}
+	return &usbdrpc.OpenReply{Handle: s.next}, nil
+}
+
+func (s *server) Read(ctx context.Context, req *usbdrpc.TransferRequest) (*usbdrpc.ReadReply, error) {
+	if req.Length <= 0 || req.Length > usbdrpc.MaxTransfer {
+		return nil, status.Errorf(codes.InvalidArgument, "usbd: length %d not in 1..%d", req.Length, usbdrpc.MaxTransfer)
+	}
+	reply := &usbdrpc.ReadReply{}
+	err := s.transfer(ctx, req, func(ctx context.Context, ep usb.Endpoint) error {
+		in := &usb.InEndpoint{Endpoint: ep}
+		buf := in.NewBuffer(req.Length)
+		n, err := in.ReadContext(ctx, buf)
+		reply.Data = buf[:n]
+		return err
+	})
+	return reply, err
+}
+
+func (s *server) Write(ctx context.Context, req *usbdrpc.TransferRequest) (*usbdrpc.WriteReply, error) {
+	if len(req.Data) > usbdrpc.MaxTransfer {
+		return nil, status.Errorf(codes.InvalidArgument, "usbd: %d bytes is over %d", len(req.Data), usbdrpc.MaxTransfer)
+	}
+	reply := &usbdrpc.WriteReply{}
+	err := s.transfer(ctx, req, func(ctx context.Context, ep usb.Endpoint) error {
+		n, err := (&usb.OutEndpoint{Endpoint: ep}).WriteContext(ctx, req.Data)
+		reply.N = n
+		return err
+	})
+	return reply, err
+}
+
+func (s *server) Close(ctx context.Context, req *usbdrpc.CloseRequest) (*usbdrpc.CloseReply, error) {
+	h, err := s.handle(ctx, req.Handle)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	delete(s.handles, req.Handle)
+	s.mu.Unlock()
+	h.cancel() // the Handle closes its device as Run returns
+	return &usbdrpc.CloseReply{}, nil
+}
+
+// handle returns an open handle of the calling connection.
+func (s *server) handle(ctx context.Context, id int) (*handle, error) {
+	conn, _ := ctx.Value(connKey{}).(int)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if h, ok := s.handles[id]; ok && h.conn == conn {
+		return h, nil
+	}
+	return nil, status.Errorf(codes.NotFound, "usbd: no handle %d", id)
+}
+
+// transfer runs fn on an endpoint of a handle's device, in its claimed interface if
+// it has one.
+func (s *server) transfer(ctx context.Context, req *usbdrpc.TransferRequest, fn func(context.Context, usb.Endpoint) error) error {
+	h, err := s.handle(ctx, req.Handle)
+	if err != nil {
+		return err
+	}
+	timeout := time.Duration(req.TimeoutMs) * time.Millisecond
+	if timeout <= 0 {
+		timeout = time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	err = h.h.Do(ctx, func(d *usb.Device) error {
+		ep, err := findEndpoint(d, h.intf, req.Endpoint)
+		if err != nil {
+			return err
+		}
+		return fn(ctx, ep)
+	})
+	if err != nil {
+		if st, ok := status.FromError(err); ok {
+			return st.Err()
+		}
+		return status.Error(codeOf(err), err.Error())
+	}
+	return nil
+}
+
+var errNoEndpoint = errors.New("usbd: no such endpoint")
+
+func findEndpoint(d *usb.Device, intf, addr int) (usb.Endpoint, error) {
+	if d.ActiveConfig == nil {
+		return usb.Endpoint{}, usb.ErrNoActiveConfig
+	}
+	for _, i := range d.ActiveConfig.Interfaces {
+		if intf >= 0 && i.ID != intf {
+			continue
+		}
+		for _, ep := range i.Endpoints {
+			if ep.Address == addr {
+				return ep, nil
+			}
+		}
+	}
+	return usb.Endpoint{}, fmt.Errorf("%w: %02x", errNoEndpoint, addr)
+}
+
+func codeOf(err error) codes.Code {
+	switch {
+	case errors.Is(err, errNoEndpoint):
+		return codes.InvalidArgument
+	case errors.Is(err, context.DeadlineExceeded):
+		return codes.DeadlineExceeded
+	case errors.Is(err, context.Canceled):
+		return codes.Canceled
+	}
+	return codes.Unknown
+}
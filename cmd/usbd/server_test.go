@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pzl/usb"
+	"github.com/pzl/usb/cmd/usbd/usbdrpc"
+	"github.com/pzl/usb/usbtest"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// serveFixture serves a server on a fixture tree holding a widget, 1234:5678 serial
+// W0001, with bulk endpoints 81 and 02.
+func serveFixture(t *testing.T, token string) (*server, string) {
+	t.Helper()
+	tree, err := usbtest.NewTree(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range []usbtest.Device{usbtest.RootHub(1), {
+		Bus: 1, Dev: 2, Ports: []int{1},
+		Vendor: 0x1234, Product: 0x5678, Serial: "W0001", Speed: "12",
+		Configs: []usbtest.Config{{
+			Value: 1,
+			Interfaces: []usbtest.Interface{{Number: 0, Class: 0xff, Endpoints: []usbtest.Endpoint{
+				{Address: 0x81, Attributes: 0x02, MaxPacketSize: 64},
+				{Address: 0x02, Attributes: 0x02, MaxPacketSize: 64},
+			}}},
+		}},
+	}} {
+		if err := tree.Add(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := newServer(token)
+	s.ctx = usb.NewContext(usb.WithRoots(tree.Roots))
+	s.list = []usb.ListOption{usb.ListRoots(tree.Roots)}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := s.register()
+	go g.Serve(l)
+	t.Cleanup(func() {
+		g.Stop()
+		s.ctx.Close()
+	})
+	return s, l.Addr().String()
+}
+
+func TestServer(t *testing.T) {
+	s, addr := serveFixture(t, "secret")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	bad, err := usbdrpc.Dial(addr, "wrong", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bad.Close()
+	if _, err := bad.List(ctx, ""); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("List with a wrong token: %v", err)
+	}
+
+	c, err := usbdrpc.Dial(addr, "secret", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	devs, err := c.List(ctx, "vendor==1234 && product==5678")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devs) != 1 || devs[0].Serial != "W0001" || devs[0].PortPath != "1-1" {
+		t.Fatalf("listed %+v", devs)
+	}
+
+	h, err := c.Open(ctx, &usbdrpc.OpenRequest{Serial: "W0001", Interface: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, length := range []int{0, -1, usbdrpc.MaxTransfer + 1} {
+		_, err := c.Read(ctx, &usbdrpc.TransferRequest{Handle: h, Endpoint: 0x81, Length: length})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("Read of %d bytes: %v", length, err)
+		}
+	}
+	if _, err := c.Read(ctx, &usbdrpc.TransferRequest{Handle: h, Endpoint: 0x85, Length: 64}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Read of a missing endpoint: %v", err)
+	}
+	if err := bad.CloseHandle(ctx, h); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Close with a wrong token: %v", err)
+	}
+
+	// the client goes away without closing its handle
+	c.Close()
+	for {
+		s.mu.Lock()
+		n := len(s.handles)
+		s.mu.Unlock()
+		if n == 0 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatal("handle not closed with its connection")
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+}
+
+func TestLoopback(t *testing.T) {
+	for addr, want := range map[string]bool{
+		"127.0.0.1:7531": true,
+		"[::1]:7531":     true,
+		"localhost:7531": true,
+		":7531":          false,
+		"0.0.0.0:7531":   false,
+		"10.0.0.1:7531":  false,
+	} {
+		if got := loopback(addr); got != want {
+			t.Errorf("loopback(%q) = %v", addr, got)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+// Package usbdrpc defines the gRPC service of usbd, and a client for it.
+//
+// Messages are plain Go structs, marshalled as JSON by a gRPC codec registered under
+// the "json" content subtype, so the service needs no generated code. Clients in
+// other languages set the content type application/grpc+json, and send the messages
+// as the JSON encoding of the structs below.
+package usbdrpc
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding"
+)
+
+// ServiceName is the full name of the gRPC service.
+const ServiceName = "usbd.USB"
+
+// MaxTransfer is the most bytes one Read or Write moves.
+const MaxTransfer = 1 << 20
+
+type ListRequest struct {
+	Match string `json:"match,omitempty"` // a usb.ParseMatch expression, empty for every device
+}
+
+type DeviceInfo struct {
+	Bus      int    `json:"bus"`
+	Device   int    `json:"device"`
+	PortPath string `json:"port_path"`
+	Vendor   string `json:"vendor"`
+	Product  string `json:"product"`
+	Name     string `json:"name,omitempty"`
+	Serial   string `json:"serial,omitempty"`
+}
+
+type ListReply struct {
+	Devices []DeviceInfo `json:"devices"`
+}
+
+type OpenRequest struct {
+	Serial   string `json:"serial,omitempty"` // identify the device, as usb.Handle does
+	PortPath string `json:"port_path,omitempty"`
+	// Interface to claim on each (re-)open, -1 for none: transfers then rely on usbfs
+	// claiming it.
+	Interface int `json:"interface"`
+}
+
+type OpenReply struct {
+	Handle int `json:"handle"`
+}
+
+type TransferRequest struct {
+	Handle    int    `json:"handle"`
+	Endpoint  int    `json:"endpoint"`         // endpoint address
+	Length    int    `json:"length,omitempty"` // bytes to read, at most MaxTransfer
+	Data      []byte `json:"data,omitempty"`   // bytes to write, at most MaxTransfer
+	TimeoutMs int    `json:"timeout_ms,omitempty"`
+}
+
+type ReadReply struct {
+	Data []byte `json:"data"`
+}
+
+type WriteReply struct {
+	N int `json:"n"`
+}
+
+type CloseRequest struct {
+	Handle int `json:"handle"`
+}
+
+type CloseReply struct{}
+
+// Server is the service's implementation. Handles are owned by the connection that
+// opened them, and closed when it goes away.
+type Server interface {
+	List(context.Context, *ListRequest) (*ListReply, error)
+	Open(context.Context, *OpenRequest) (*OpenReply, error)
+	Read(context.Context, *TransferRequest) (*ReadReply, error)
+	Write(context.Context, *TransferRequest) (*WriteReply, error)
+	Close(context.Context, *CloseRequest) (*CloseReply, error)
+}
+
+// unary adapts a Server method to a grpc.MethodDesc handler.
+func unary[Req, Reply any](name string, call func(Server, context.Context, *Req) (*Reply, error)) grpc.MethodDesc {
+	return grpc.MethodDesc{
+		MethodName: name,
+		Handler: func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+			req := new(Req)
+			if err := dec(req); err != nil {
+				return nil, err
+			}
+			if interceptor == nil {
+				return call(srv.(Server), ctx, req)
+			}
+			info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + ServiceName + "/" + name}
+			return interceptor(ctx, req, info, func(ctx context.Context, req any) (any, error) {
+				return call(srv.(Server), ctx, req.(*Req))
+			})
+		},
+	}
+}
+
+// ServiceDesc describes the service to grpc.Server.RegisterService.
+var ServiceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*Server)(nil),
+	Methods: []grpc.MethodDesc{
+		unary("List", Server.List),
+		unary("Open", Server.Open),
+		unary("Read", Server.Read),
+		unary("Write", Server.Write),
+		unary("Close", Server.Close),
+	},
+	Metadata: "usbd",
+}
+
+// Codec marshals messages as JSON. It is registered under its Name.
+type Codec struct{}
+
+func (Codec) Marshal(v any) ([]byte, error)   { return json.Marshal(v) }
+func (Codec) Unmarshal(b []byte, v any) error { return json.Unmarshal(b, v) }
+func (Codec) Name() string                    { return "json" }
+
+func init() { encoding.RegisterCodec(Codec{}) }
+
+// TokenKey is the metadata key carrying the shared token, as "Bearer <token>".
+const TokenKey = "authorization"
+
+// ErrAuth is the message of the Unauthenticated status for a missing or wrong token.
+var ErrAuth = errors.New("usbd: bad token")
+
+// Client calls a usbd server.
+type Client struct {
+	cc *grpc.ClientConn
+}
+
+// Dial connects to a usbd server at addr, sending token with every call. A nil tlsConf
+// connects without TLS, for servers on stdio or loopback.
+func Dial(addr, token string, tlsConf *tls.Config, opts ...grpc.DialOption) (*Client, error) {
+	creds := insecure.NewCredentials()
+	if tlsConf != nil {
+		creds = credentials.NewTLS(tlsConf)
+	}
+	opts = append([]grpc.DialOption{
+		grpc.WithTransportCredentials(creds),
+		grpc.WithDefaultCallOptions(grpc.CallContentSubtype(Codec{}.Name())),
+	}, opts...)
+	if token != "" {
+		opts = append(opts, grpc.WithPerRPCCredentials(bearer{token: token, secure: tlsConf != nil}))
+	}
+	cc, err := grpc.NewClient(addr, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{cc: cc}, nil
+}
+
+// Close closes the connection. The server then closes the handles it opened.
+func (c *Client) Close() error { return c.cc.Close() }
+
+func invoke[Reply any](ctx context.Context, c *Client, method string, req any) (*Reply, error) {
+	reply := new(Reply)
+	if err := c.cc.Invoke(ctx, "/"+ServiceName+"/"+method, req, reply); err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+func (c *Client) List(ctx context.Context, match string) ([]DeviceInfo, error) {
+	r, err := invoke[ListReply](ctx, c, "List", &ListRequest{Match: match})
+	if err != nil {
+		return nil, err
+	}
+	return r.Devices, nil
+}
+
+func (c *Client) Open(ctx context.Context, req *OpenRequest) (int, error) {
+	r, err := invoke[OpenReply](ctx, c, "Open", req)
+	if err != nil {
+		return 0, err
+	}
+	return r.Handle, nil
+}
+
+func (c *Client) Read(ctx context.Context, req *TransferRequest) ([]byte, error) {
+	r, err := invoke[ReadReply](ctx, c, "Read", req)
+	if err != nil {
+		return nil, err
+	}
+	return r.Data, nil
+}
+
+func (c *Client) Write(ctx context.Context, req *TransferRequest) (int, error) {
+	r, err := invoke[WriteReply](ctx, c, "Write", req)
+	if err != nil {
+		return 0, err
+	}
+	return r.N, nil
+}
+
+func (c *Client) CloseHandle(ctx context.Context, handle int) error {
+	_, err := invoke[CloseReply](ctx, c, "Close", &CloseRequest{Handle: handle})
+	return err
+}
+
+// bearer sends the token as call credentials.
+type bearer struct {
+	token  string
+	secure bool
+}
+
+func (b bearer) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	return map[string]string{TokenKey: "Bearer " + b.token}, nil
+}
+
+// RequireTransportSecurity is false only for Dial without TLS, which the caller chose.
+func (b bearer) RequireTransportSecurity() bool { return b.secure }
+
+// ParseToken returns the token of an authorization metadata value.
+func ParseToken(v string) (string, error) {
+	t, ok := strings.CutPrefix(v, "Bearer ")
+	if !ok {
+		return "", fmt.Errorf("usbd: %s is not a bearer token", TokenKey)
+	}
+	return t, nil
+}
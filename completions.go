@@ -0,0 +1,89 @@
+package usb
+
+import "sync"
+
+// Completions returns a channel receiving every asynchronous transfer of the device
+// as it finishes, whether completed, failed or cancelled, for select-based event loops
+// instead of a Wait per transfer. Only transfers submitted after the first call are
+// delivered. Completions queue without bound, so the completion loop never waits on
+// the reader. Closing the device closes the channel: completions not yet received by
+// then, including those of the transfers Close cancels, are dropped, so a reader that
+// stopped receiving holds nothing up. Their Transfers still report how they ended.
+func (d *Device) Completions() <-chan *Transfer {
+	d.st.mu.Lock()
+	defer d.st.mu.Unlock()
+	if d.st.completions == nil {
+		d.st.completions = newCompletionQueue()
+	}
+	return d.st.completions.out
+}
+
+// completionQueue forwards finished transfers to a channel, in order, without blocking the finisher.
+type completionQueue struct {
+	mu     sync.Mutex
+	q      []*Transfer
+	closed bool
+	wake   chan struct{}
+	done   chan struct{} // closed by close, ending delivery
+	out    chan *Transfer
+}
+
+func newCompletionQueue() *completionQueue {
+	c := &completionQueue{
+		wake: make(chan struct{}, 1),
+		done: make(chan struct{}),
+		out:  make(chan *Transfer),
+	}
+	go c.pump()
+	return c
+}
+
+func (c *completionQueue) push(t *Transfer) {
+	c.mu.Lock()
+	if !c.closed {
+		c.q = append(c.q, t)
+	}
+	c.mu.Unlock()
+	c.signal()
+}
+
+// close ends the channel, dropping what is still queued.
+func (c *completionQueue) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.closed {
+		c.closed = true
+		close(c.done)
+	}
+}
+
+func (c *completionQueue) signal() {
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (c *completionQueue) pump() {
+	defer close(c.out)
+	for {
+		c.mu.Lock()
+		q := c.q
+		c.q = nil
+		c.mu.Unlock()
+		for _, t := range q {
+			select {
+			case c.out <- t:
+			case <-c.done:
+				return
+			}
+		}
+		if len(q) == 0 {
+			select {
+			case <-c.wake:
+			case <-c.done:
+				return
+			}
+		}
+	}
+}
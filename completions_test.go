@@ -0,0 +1,23 @@
+package usb_test
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCompletionsClose(t *testing.T) {
+	_, w := openWidget(t)
+	if err := w.Open(); err != nil {
+		t.Fatal(err)
+	}
+	c := w.Completions()
+	w.Close()
+	select {
+	case _, ok := <-c:
+		if ok {
+			t.Error("a completion from a device with no transfers")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("completions not closed with the device")
+	}
+}
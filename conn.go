@@ -0,0 +1,219 @@
+//go:build !usb_core
+
+package usb
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pzl/usb/x/gusb"
+)
+
+// EndpointConn is a net.Conn over a pair of bulk (or interrupt) endpoints, so stream
+// protocols written for sockets, e.g. a framing or multiplexing library, run over USB
+// unchanged. Reads and writes go through asynchronous transfers, so a deadline cancels
+// the transfer in flight without losing data the device already sent.
+type EndpointConn struct {
+	in  *InEndpoint
+	out *OutEndpoint
+
+	rmu     sync.Mutex // serializes Reads
+	rbuf    []byte
+	pending []byte // received, not yet returned by Read
+
+	wmu sync.Mutex // serializes Writes
+
+	rd, wd    *connDeadline
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+var _ net.Conn = (*EndpointConn)(nil)
+
+// EndpointAddr is the address of an EndpointConn.
+type EndpointAddr struct {
+	Bus, Device int
+	Endpoint    int // endpoint address, including the direction bit
+}
+
+func (a EndpointAddr) Network() string { return "usb" }
+
+func (a EndpointAddr) String() string {
+	return fmt.Sprintf("%03d:%03d/ep%02x", a.Bus, a.Device, a.Endpoint)
+}
+
+// NewEndpointConn joins an IN and an OUT endpoint of claimed interfaces into a net.Conn.
+func NewEndpointConn(in *InEndpoint, out *OutEndpoint) (*EndpointConn, error) {
+	for _, e := range []*Endpoint{&in.Endpoint, &out.Endpoint} {
+		if e.i == nil || e.i.d == nil {
+			return nil, ErrNotOpen
+		}
+		if e.TransferType != TransferTypeBulk && e.TransferType != int(gusb.EndpointTypeInterrupt) {
+			return nil, fmt.Errorf("usb: endpoint address %02X is not a bulk or interrupt endpoint (type %02X)", e.Address, e.TransferType)
+		}
+	}
+	if (in.Address & 0x80) == 0 {
+		return nil, fmt.Errorf("usb: endpoint address %02X is not an IN endpoint", in.Address)
+	}
+	if (out.Address & 0x80) != 0 {
+		return nil, fmt.Errorf("usb: endpoint address %02X is not an OUT endpoint", out.Address)
+	}
+	return &EndpointConn{
+		in:     in,
+		out:    out,
+		rbuf:   in.NewBuffer(in.Buffers().ChunkSize),
+		rd:     newConnDeadline(),
+		wd:     newConnDeadline(),
+		closed: make(chan struct{}),
+	}, nil
+}
+
+// Read receives into b. Data from a transfer larger than b is kept for the next Read.
+func (c *EndpointConn) Read(b []byte) (int, error) {
+	c.rmu.Lock()
+	defer c.rmu.Unlock()
+	if len(c.pending) == 0 {
+		n, err := c.transfer(&c.in.Endpoint, c.rbuf, c.rd)
+		c.pending = c.rbuf[:n]
+		if n == 0 {
+			return 0, err
+		}
+	}
+	n := copy(b, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+// Write sends b, in transfers of at most the OUT endpoint's Buffers.ChunkSize bytes.
+func (c *EndpointConn) Write(b []byte) (int, error) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	done, size := 0, c.out.Buffers().ChunkSize
+	for done < len(b) {
+		chunk := b[done:min(len(b), done+size)]
+		n, err := c.transfer(&c.out.Endpoint, chunk, c.wd)
+		done += n
+		if err != nil {
+			return done, err
+		}
+	}
+	return done, nil
+}
+
+// transfer moves buf through one URB, until it completes, the deadline passes or c is closed.
+func (c *EndpointConn) transfer(e *Endpoint, buf []byte, dl *connDeadline) (int, error) {
+	select {
+	case <-c.closed:
+		return 0, net.ErrClosed
+	case <-dl.wait():
+		return 0, os.ErrDeadlineExceeded
+	default:
+	}
+	t, err := e.Submit(buf)
+	if err != nil {
+		return 0, err
+	}
+	var stopped error
+	select {
+	case <-t.Done():
+	case <-dl.wait():
+		stopped = os.ErrDeadlineExceeded
+	case <-c.closed:
+		stopped = net.ErrClosed
+	}
+	if stopped != nil {
+		t.Cancel()
+		<-t.Done()
+		n, _ := t.Result()
+		return n, stopped
+	}
+	return t.Result()
+}
+
+// Close stops the Conn, failing Reads and Writes in progress with net.ErrClosed.
+// The device and its interfaces stay open and claimed.
+func (c *EndpointConn) Close() error {
+	c.closeOnce.Do(func() { close(c.closed) })
+	return nil
+}
+
+// LocalAddr is the IN endpoint, which the Conn receives from.
+func (c *EndpointConn) LocalAddr() net.Addr { return c.addr(&c.in.Endpoint) }
+
+// RemoteAddr is the OUT endpoint, which the Conn sends to.
+func (c *EndpointConn) RemoteAddr() net.Addr { return c.addr(&c.out.Endpoint) }
+
+func (c *EndpointConn) addr(e *Endpoint) EndpointAddr {
+	return EndpointAddr{Bus: e.i.d.Bus, Device: e.i.d.Device, Endpoint: e.Address}
+}
+
+func (c *EndpointConn) SetDeadline(t time.Time) error {
+	c.rd.set(t)
+	c.wd.set(t)
+	return nil
+}
+
+func (c *EndpointConn) SetReadDeadline(t time.Time) error {
+	c.rd.set(t)
+	return nil
+}
+
+func (c *EndpointConn) SetWriteDeadline(t time.Time) error {
+	c.wd.set(t)
+	return nil
+}
+
+// connDeadline is a deadline that can be moved while a transfer is waiting on it.
+type connDeadline struct {
+	mu      sync.Mutex
+	timer   *time.Timer
+	expired chan struct{} // closed once the deadline passes
+}
+
+func newConnDeadline() *connDeadline {
+	return &connDeadline{expired: make(chan struct{})}
+}
+
+// set moves the deadline to t. The zero time means none.
+func (d *connDeadline) set(t time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.timer != nil && !d.timer.Stop() {
+		<-d.expired // the timer fired, wait for it to close the channel
+	}
+	d.timer = nil
+
+	closed := false
+	select {
+	case <-d.expired:
+		closed = true
+	default:
+	}
+	if t.IsZero() {
+		if closed {
+			d.expired = make(chan struct{})
+		}
+		return
+	}
+	if wait := time.Until(t); wait > 0 {
+		if closed {
+			d.expired = make(chan struct{})
+		}
+		expired := d.expired
+		d.timer = time.AfterFunc(wait, func() { close(expired) })
+		return
+	}
+	if !closed {
+		close(d.expired)
+	}
+}
+
+// wait returns a channel closed when the deadline passes.
+func (d *connDeadline) wait() <-chan struct{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.expired
+}
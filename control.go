@@ -0,0 +1,168 @@
+package usb
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pzl/usb/x/gusb"
+)
+
+// ErrNotClaimed is matched by a NotClaimedError.
+var ErrNotClaimed = errors.New("usb: interface not claimed")
+
+// NotClaimedError is returned by ControlTransfer for a request to an interface, or an
+// endpoint, whose interface isn't claimed, and under ClaimStrict for a transfer on such
+// an endpoint. usbfs would otherwise claim it behind our back, or fail with a bare
+// EBUSY if a kernel driver has it.
+type NotClaimedError struct {
+	Interface int
+	Endpoint  int  // the endpoint address, -1 for an interface request
+	Transfer  bool // a transfer on the endpoint, rather than a control request
+}
+
+func (e *NotClaimedError) Error() string {
+	if e.Transfer {
+		return fmt.Sprintf("usb: transfer on endpoint %02x, whose interface %d is not claimed (claim it, or use usb.ClaimAuto)", e.Endpoint, e.Interface)
+	}
+	if e.Endpoint < 0 {
+		return fmt.Sprintf("usb: control request to interface %d, which is not claimed (claim it, or pass usb.AutoClaim)", e.Interface)
+	}
+	return fmt.Sprintf("usb: control request to endpoint %02x, whose interface %d is not claimed (claim it, or pass usb.AutoClaim)", e.Endpoint, e.Interface)
+}
+
+func (e *NotClaimedError) Is(target error) bool { return target == ErrNotClaimed }
+
+// ControlOption configures Device.ControlTransfer.
+type ControlOption func(*controlOptions)
+
+type controlOptions struct {
+	autoClaim bool
+	claimOpts []ClaimOption
+}
+
+// AutoClaim makes ControlTransfer claim the request's interface if it isn't, with the
+// given options, and release it again afterwards.
+func AutoClaim(opts ...ClaimOption) ControlOption {
+	return func(o *controlOptions) { o.autoClaim, o.claimOpts = true, opts }
+}
+
+// ControlTransfer runs a control transfer on the default endpoint. data holds the data
+// stage, at least setup.Length bytes: filled for IN requests, sent for OUT requests. A
+// timeout of 0 waits forever. It returns the bytes transferred.
+//
+// A standard or class request to an interface or endpoint recipient needs the
+// interface claimed, see NotClaimedError, unless AutoClaim is given. Vendor requests
+// are sent as they are.
+func (d *Device) ControlTransfer(setup SetupPacket, data []byte, timeout time.Duration, opts ...ControlOption) (int, error) {
+	var o controlOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	f, err := d.file()
+	if err != nil {
+		return 0, err
+	}
+	if intf, err := d.recipientInterface(setup); err != nil {
+		return 0, err
+	} else if intf != nil && !d.isClaimed(intf.ID) {
+		if !o.autoClaim {
+			ep := -1
+			if setup.Recipient() == gusb.RecipientEndpoint {
+				ep = int(setup.Index & 0xff)
+			}
+			return 0, &NotClaimedError{Interface: intf.ID, Endpoint: ep}
+		}
+		if err := intf.Claim(o.claimOpts...); err != nil {
+			return 0, err
+		}
+		defer intf.Release()
+	}
+	start := time.Now()
+	n, err := gusb.ControlSetup(f, setup, data, kernelTimeout(timeout))
+	d.recordLatency(0, start)
+	return n, err
+}
+
+// Control runs a control transfer on the default endpoint, the setup packet made of
+// the arguments and len(data). data is filled for IN requests (bit 7 of requestType
+// set), and sent for OUT requests. See ControlTransfer.
+func (d *Device) Control(requestType, request uint8, value, index uint16, data []byte, timeout time.Duration, opts ...ControlOption) (int, error) {
+	return d.ControlTransfer(SetupPacket{
+		RequestType: requestType,
+		Request:     request,
+		Value:       value,
+		Index:       index,
+		Length:      uint16(len(data)),
+	}, data, timeout, opts...)
+}
+
+// recipientInterface returns the interface a request is addressed to, directly or
+// through one of its endpoints, or nil for other recipients. Like the kernel's
+// check_ctrlrecip, it lets through vendor requests, whose wIndex is the vendor's to
+// define, and the printer class GET_DEVICE_ID, which is allowed without a claim.
+func (d *Device) recipientInterface(setup SetupPacket) (*Interface, error) {
+	if setup.Type() == gusb.RequestTypeVendor {
+		return nil, nil
+	}
+	if setup.RequestType == gusb.RequestDirIn|gusb.RequestTypeClass|gusb.RecipientInterface && setup.Request == 0 &&
+		d.isPrinter(int(setup.Index>>8), int(setup.Index&0xff)) {
+		return nil, nil
+	}
+	switch setup.Recipient() {
+	case gusb.RecipientInterface:
+		return d.InterfaceByNumber(int(setup.Index & 0xff))
+	case gusb.RecipientEndpoint:
+		addr := int(setup.Index & 0xff)
+		if addr&0x7f == 0 {
+			return nil, nil // the default endpoint belongs to no interface
+		}
+		if d.ActiveConfig == nil {
+			return nil, ErrNoActiveConfig
+		}
+		if intf := d.endpointInterface(addr); intf != nil {
+			return intf, nil
+		}
+		// some hosts' software passes the endpoint number without its direction bit
+		if intf := d.endpointInterface(addr ^ 0x80); intf != nil {
+			return intf, nil
+		}
+		return nil, fmt.Errorf("usb: control request to endpoint %02x, which is not in the active configuration", addr)
+	}
+	return nil, nil
+}
+
+// endpointInterface returns the interface of the active configuration with the
+// endpoint, or nil.
+func (d *Device) endpointInterface(addr int) *Interface {
+	for i := range d.ActiveConfig.Interfaces {
+		for _, ep := range d.ActiveConfig.Interfaces[i].Endpoints {
+			if ep.Address == addr {
+				return &d.ActiveConfig.Interfaces[i]
+			}
+		}
+	}
+	return nil
+}
+
+// isPrinter reports whether alternate setting alt of interface intf is of the printer
+// class.
+func (d *Device) isPrinter(intf, alt int) bool {
+	i, err := d.InterfaceByNumber(intf)
+	if err != nil {
+		return false
+	}
+	for _, s := range append([]Interface{*i}, i.AltSettings...) {
+		if s.Alternate == alt {
+			return s.Class == gusb.USBClassPrinter
+		}
+	}
+	return false
+}
+
+func (d *Device) isClaimed(intf int) bool {
+	d.st.mu.Lock()
+	defer d.st.mu.Unlock()
+	_, ok := d.st.claimed[intf]
+	return ok
+}
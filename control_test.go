@@ -0,0 +1,81 @@
+package usb_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pzl/usb"
+	"github.com/pzl/usb/usbtest"
+	"github.com/pzl/usb/x/gusb"
+)
+
+func TestControlTransferClaimCheck(t *testing.T) {
+	tree := fixtureTree(t)
+	ctx := usb.NewContext(usb.WithRoots(tree.Roots))
+	defer ctx.Close()
+	w, err := ctx.OpenDeviceWithVIDPID(0x1234, 0x5678)
+	if err != nil || w == nil {
+		t.Fatalf("widget: %v, %v", w, err)
+	}
+	defer w.Close()
+	if err := w.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	getStatus := func(recipient uint8, index uint16) usb.SetupPacket {
+		return usb.SetupPacket{RequestType: gusb.RequestDirIn | recipient, Request: gusb.RequestGetStatus, Index: index, Length: 2}
+	}
+	buf := make([]byte, 2)
+	var nc *usb.NotClaimedError
+	if _, err := w.ControlTransfer(getStatus(gusb.RecipientInterface, 1), buf, time.Second); !errors.As(err, &nc) || nc.Interface != 1 || nc.Endpoint != -1 {
+		t.Errorf("interface 1: %v", err)
+	}
+	if _, err := w.ControlTransfer(getStatus(gusb.RecipientEndpoint, 0x83), buf, time.Second); !errors.As(err, &nc) || nc.Interface != 1 || nc.Endpoint != 0x83 {
+		t.Errorf("endpoint 83: %v", err)
+	}
+	if _, err := w.ControlTransfer(getStatus(gusb.RecipientEndpoint, 0x84), buf, time.Second); err == nil || errors.Is(err, usb.ErrNotClaimed) {
+		t.Errorf("endpoint 84: %v", err)
+	}
+	if _, err := w.ControlTransfer(getStatus(gusb.RecipientInterface, 7), buf, time.Second); !errors.Is(err, usb.ErrInvalidInterfaceIndex) {
+		t.Errorf("interface 7: %v", err)
+	}
+	// the kernel also takes the endpoint number without its direction bit
+	if _, err := w.ControlTransfer(getStatus(gusb.RecipientEndpoint, 0x03), buf, time.Second); !errors.As(err, &nc) || nc.Interface != 1 {
+		t.Errorf("endpoint 03: %v", err)
+	}
+	// vendor requests define their own wIndex, and go through unclaimed
+	vendor := usb.SetupPacket{RequestType: gusb.RequestDirIn | gusb.RequestTypeVendor | gusb.RecipientInterface, Request: 0x5b, Index: 1, Length: 2}
+	if _, err := w.ControlTransfer(vendor, buf, time.Second); err == nil || errors.Is(err, usb.ErrNotClaimed) {
+		t.Errorf("vendor request: %v", err)
+	}
+
+	// so does the printer class GET_DEVICE_ID, wIndex holding interface and alternate setting
+	printer := usbtest.Device{
+		Bus: 1, Dev: 4, Ports: []int{2, 4}, Vendor: 0x1234, Product: 0x0007, Speed: "12",
+		Configs: []usbtest.Config{{Value: 1, Interfaces: []usbtest.Interface{
+			{Number: 0, Class: 0x03},
+			{Number: 1, Class: 0x07, Endpoints: []usbtest.Endpoint{{Address: 0x01, Attributes: 0x02, MaxPacketSize: 64}}},
+		}}},
+	}
+	if err := tree.Add(printer); err != nil {
+		t.Fatal(err)
+	}
+	p, err := ctx.OpenDeviceWithVIDPID(0x1234, 0x0007)
+	if err != nil || p == nil {
+		t.Fatalf("printer: %v, %v", p, err)
+	}
+	defer p.Close()
+	if err := p.Open(); err != nil {
+		t.Fatal(err)
+	}
+	getDeviceID := func(index uint16) usb.SetupPacket {
+		return usb.SetupPacket{RequestType: gusb.RequestDirIn | gusb.RequestTypeClass | gusb.RecipientInterface, Request: 0, Index: index, Length: 2}
+	}
+	if _, err := p.ControlTransfer(getDeviceID(1<<8), buf, time.Second); err == nil || errors.Is(err, usb.ErrNotClaimed) {
+		t.Errorf("GET_DEVICE_ID: %v", err)
+	}
+	if _, err := p.ControlTransfer(getDeviceID(0), buf, time.Second); !errors.Is(err, usb.ErrNotClaimed) {
+		t.Errorf("GET_DEVICE_ID to a HID interface: %v", err)
+	}
+}
@@ -2,38 +2,58 @@ package usb
 
 import (
 	"errors"
-	"io/ioutil"
-	"log"
+	"math"
 	"os"
 	"path/filepath"
-	"strconv"
 
-	"github.com/pzl/usb/gusb"
+	"github.com/pzl/usb/x/gusb"
 )
 
 /* ---------- Descriptors to library-native objects ---------- */
 
 func toDevice(dd gusb.DeviceDescriptor) *Device {
+	return newDevice(dd, devSource{sysRoot: defaultRoots().SysFS})
+}
+
+// devSource is where newDevice reads what the descriptors don't say.
+type devSource struct {
+	sysRoot string   // where to look up the sysfs directory, if the descriptor doesn't name it. Empty for nowhere
+	devRoot string   // usbfs root, if not the default
+	f       *os.File // the device's open node, if any
+}
+
+func newDevice(dd gusb.DeviceDescriptor, src devSource) *Device {
 	var err error
 	vid := uint16(dd.Vendor)
 	pid := uint16(dd.Product)
 
 	d := &Device{
-		Bus:                   dd.PathInfo.Bus,
-		Device:                dd.PathInfo.Dev,
-		SysPath:               dd.PathInfo.SysPath,
-		Vendor:                ID(vid),
-		vendorNameFromIdFile:  vendorName(vid),
-		Product:               ID(pid),
-		productNameFromIdFile: productName(vid, pid),
-		Configs:               make([]Configuration, dd.NumConfigs),
-	}
+		Bus:        dd.PathInfo.Bus,
+		Device:     dd.PathInfo.Dev,
+		SysPath:    dd.PathInfo.SysPath,
+		Vendor:     ID(vid),
+		Product:    ID(pid),
+		Class:      dd.Class,
+		SubClass:   dd.SubClass,
+		Protocol:   dd.Protocol,
+		USBVersion: dd.USBVer,
+		Release:    dd.Version,
+		Configs:    make([]Configuration, 0, len(dd.Configs)),
+		st:         newDeviceState(),
+		devRoot:    src.devRoot,
+		sysRoot:    src.sysRoot,
+		strIdx:     [3]uint8{dd.ManufStr, dd.ProductStr, dd.SerialStr},
+	}
+	d.st.f = src.f
 	for _, c := range dd.Configs {
-		d.Configs[c.Value-1] = toConfig(c, d)
+		if c.Length == 0 {
+			continue // advertised in bNumConfigurations, but never described
+		}
+		d.Configs = append(d.Configs, toConfig(c, d))
 	}
 	// walk sysfs path to find matching device, and set d.sysPath
-	if d.SysPath == "" {
-		d.SysPath = getSysfsFromBusDev(d.Bus, d.Device)
+	if d.SysPath == "" && src.sysRoot != "" {
+		d.SysPath = getSysfsFromBusDev(src.sysRoot, d.Bus, d.Device)
 	}
 
 	if d.SysPath != "" {
@@ -44,7 +64,7 @@ func toDevice(dd gusb.DeviceDescriptor) *Device {
 
 	if d.Device <= 0 {
 		if dev, err := d.dataSource.getDevNum(*d); err != nil {
-			log.Printf("ERROR: could not get device number: %v\n", err)
+			logf("ERROR: could not get device number: %v\n", err)
 		} else {
 			d.Device = dev
 		}
@@ -52,34 +72,47 @@ func toDevice(dd gusb.DeviceDescriptor) *Device {
 
 	if d.Bus <= 0 {
 		if sysfs, ok := d.dataSource.(backingSysfs); ok {
-			d.Bus, err = sysfs.getBusNum(*d)
-			if err != nil {
-				log.Printf("ERROR: problem getting bus number: %v\n", err)
+			if bus, err := sysfs.getBusNum(*d); err != nil {
+				logf("ERROR: problem getting bus number: %v\n", err)
+			} else {
+				d.Bus = bus
 			}
 		}
 	}
 
 	d.vendorNameFromDevice, err = d.dataSource.getVendorName(*d)
 	if err != nil {
-		log.Printf("ERROR: problem fetching manufacturer name: %v\n", err)
+		logf("ERROR: problem fetching manufacturer name: %v\n", err)
 	}
 	d.productNameFromDevice, err = d.dataSource.getProductName(*d)
 	if err != nil {
-		log.Printf("ERROR: problem fetching product name: %v\n", err)
+		logf("ERROR: problem fetching product name: %v\n", err)
+	}
+	d.Serial, err = d.dataSource.getSerial(*d)
+	if err != nil {
+		logf("ERROR: problem fetching serial number: %v\n", err)
 	}
 	d.Port, err = d.dataSource.getPort(*d)
 	if err != nil {
-		log.Printf("ERROR: problem fetching device port number: %v\n", err)
+		logf("ERROR: problem fetching device port number: %v\n", err)
 	}
 	cfg, err := d.dataSource.getActiveConfig(*d)
 	if err != nil {
-		log.Printf("ERROR: problem fetching active config: %v\n", err)
-		cfg = 1 // assume it's the first one ?
+		logf("ERROR: problem fetching active config: %v\n", err)
+		if len(d.Configs) > 0 {
+			cfg = d.Configs[0].Value // assume it's the first one ?
+		}
+	}
+	// a bConfigurationValue of 0 means the device is unconfigured, ActiveConfig stays nil
+	if cfg != 0 {
+		d.ActiveConfig = d.configByValue(cfg)
+		if d.ActiveConfig == nil {
+			logf("ERROR: active config %d not found in device descriptors\n", cfg)
+		}
 	}
-	d.ActiveConfig = &d.Configs[cfg-1]
 	d.Speed, err = d.dataSource.getSpeed(*d)
 	if err != nil {
-		log.Printf("ERROR: problem fetching device speed: %v\n", err)
+		logf("ERROR: problem fetching device speed: %v\n", err)
 		d.Speed = SpeedUnknown
 	}
 
@@ -87,13 +120,14 @@ func toDevice(dd gusb.DeviceDescriptor) *Device {
 	if sysfs, ok := d.dataSource.(backingSysfs); ok {
 		d.Parent, err = sysfs.getParent(*d)
 		if err != nil {
-			log.Printf("ERROR: problem determining device parent: %v\n", err)
+			logf("ERROR: problem determining device parent: %v\n", err)
 		}
-	} else {
-		log.Println("INFO: sysfs not available, not able to determine device hub parents")
+		d.Virtual = sysfs.isVirtual(*d)
 	}
+	// without sysfs, List links devices to their hubs afterwards, see linkUsbfsHubs
 	d.Ports = getPorts(*d)
 
+	d.st.f = nil // the caller decides whether the device is open
 	return d
 }
 
@@ -103,11 +137,14 @@ func toConfig(c gusb.ConfigDescriptor, d *Device) Configuration {
 		RemoteWakeup: c.RemoteWakeup,
 		MaxPower:     int(c.MaxPower * 2),
 		Value:        int(c.Value),
-		Interfaces:   make([]Interface, c.NumInterfaces),
+		Interfaces:   make([]Interface, 0, c.NumInterfaces),
 		d:            d,
 	}
 	for _, intf := range c.Interfaces {
-		cfg.Interfaces[intf.InterfaceNumber] = toInterface(intf, d)
+		if intf.Length == 0 {
+			continue // advertised in bNumInterfaces, but never described
+		}
+		cfg.Interfaces = append(cfg.Interfaces, toInterface(intf, d))
 	}
 
 	return cfg
@@ -116,7 +153,10 @@ func toConfig(c gusb.ConfigDescriptor, d *Device) Configuration {
 func toInterface(i gusb.InterfaceDescriptor, d *Device) Interface {
 	intf := Interface{
 		ID:        int(i.InterfaceNumber),
-		Alternate: 0, //@todo?
+		Alternate: int(i.AlternateSetting),
+		Class:     i.Class,
+		SubClass:  i.SubClass,
+		Protocol:  i.Protocol,
 		Endpoints: make([]Endpoint, i.NumEndpoints),
 		d:         d,
 	}
@@ -124,6 +164,9 @@ func toInterface(i gusb.InterfaceDescriptor, d *Device) Interface {
 	for idx, ep := range i.Endpoints {
 		intf.Endpoints[idx] = toEndpoint(ep, &intf)
 	}
+	for _, alt := range i.AltSettings {
+		intf.AltSettings = append(intf.AltSettings, toInterface(alt, d))
+	}
 
 	return intf
 }
@@ -133,7 +176,8 @@ func toEndpoint(e gusb.EndpointDescriptor, i *Interface) Endpoint {
 		Address:          int(e.Address),
 		TransferType:     int(e.TransferType),
 		MaxPacketSize:    int(e.MaxPacketSize),
-		MaxISOPacketSize: int(e.MaxPacketSize), //@todo: what
+		MaxISOPacketSize: isoPacketSize(e),
+		Interval:         int(e.Interval),
 		i:                i,
 	}
 
@@ -142,24 +186,23 @@ func toEndpoint(e gusb.EndpointDescriptor, i *Interface) Endpoint {
 
 /* ---------------- helpers -------------------------- */
 
-func readAsInt(fname string) (int, error) {
-	data, err := ioutil.ReadFile(fname)
-	if err != nil {
-		return -1, err
+// isoPacketSize is the bytes an endpoint can move per (micro)frame: the packet size
+// times the additional transactions of high-bandwidth endpoints (wMaxPacketSize bits 12..11)
+func isoPacketSize(e gusb.EndpointDescriptor) int {
+	size := int(e.MaxPacketSize & 0x7ff)
+	if e.TransferType == gusb.EndpointTypeIsochronous || e.TransferType == gusb.EndpointTypeInterrupt {
+		size *= 1 + int(e.MaxPacketSize>>11&0x3)
 	}
-	return strconv.Atoi(string(data[:len(data)-1]))
+	return size
 }
-func readAsFloat(fname string) (float64, error) {
-	data, err := ioutil.ReadFile(fname)
-	if err != nil {
-		return -1, err
-	}
-	return strconv.ParseFloat(string(data[:len(data)-1]), 64)
+
+func readAsInt(fname string) (int, error) {
+	return readAttrInt(fname, math.MaxInt32)
 }
 
-func getSysfsFromBusDev(bus int, dev int) string {
+func getSysfsFromBusDev(root string, bus int, dev int) string {
 	syspath := ""
-	filepath.Walk("/sys/bus/usb/devices/", func(path string, info os.FileInfo, err error) error {
+	filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
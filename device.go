@@ -1,17 +1,19 @@
 package usb
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"log"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 
-	"github.com/pzl/usb/gusb"
+	"github.com/pzl/usb/x/gusb"
 )
 
-// @todo: Class,Subclass,Protocol
-
 const badIndexNumber = "invalid %s value: %d"
 
 var (
@@ -19,79 +21,236 @@ var (
 	ErrNoActiveConfig        = errors.New("usb: device has no active configuration")
 	ErrNoInterfacesInConfig  = errors.New("usb: active configuration has no interfaces")
 	ErrInvalidInterfaceIndex = errors.New("usb: interface index out of bounds")
+	ErrNoConfigs             = errors.New("usb: device describes no configurations")
+	ErrInvalidConfigValue    = errors.New("usb: no configuration with that value")
+	ErrNotOpen               = errors.New("usb: device not open")
+	ErrClosed                = errors.New("usb: device closed")
+	ErrReadOnly              = errors.New("usb: device opened read-only")
 )
 
+// ID is a vendor or product ID. It prints as 4 hex digits, as lsusb does.
 type ID uint16
 
+func (id ID) String() string { return fmt.Sprintf("%04x", uint16(id)) }
+
+// ParseID parses a vendor or product ID in hex, with or without a 0x prefix, e.g. "1a86" or "0x1A86".
+func ParseID(s string) (ID, error) {
+	hex := strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X")
+	id, err := strconv.ParseUint(hex, 16, 16)
+	if err != nil || hex == "" || strings.HasPrefix(hex, "+") {
+		return 0, fmt.Errorf("usb: invalid ID %q, want 4 hex digits", s)
+	}
+	return ID(id), nil
+}
+
+// ParseVIDPID parses a vendor:product pair as lsusb prints it, e.g. "1a86:7523".
+func ParseVIDPID(s string) (vid, pid ID, err error) {
+	v, p, ok := strings.Cut(s, ":")
+	if !ok {
+		return 0, 0, fmt.Errorf("usb: invalid VID:PID %q", s)
+	}
+	if vid, err = ParseID(v); err != nil {
+		return 0, 0, err
+	}
+	if pid, err = ParseID(p); err != nil {
+		return 0, 0, err
+	}
+	return vid, pid, nil
+}
+
+// VendorName is the vendor's name from usb.ids, see SetIDs, or else the device's
+// manufacturer string.
 func (d Device) VendorName() string {
-	if d.vendorNameFromIdFile != "" {
-		return d.vendorNameFromIdFile
-	} else {
-		return d.vendorNameFromDevice
+	if name := vendorName(uint16(d.Vendor)); name != "" {
+		return name
 	}
+	return d.vendorNameFromDevice
 }
 
+// ProductName is the product's name from usb.ids, or else the device's product string.
 func (d Device) ProductName() string {
-	if d.productNameFromIdFile != "" {
-		return d.productNameFromIdFile
-	} else {
-		return d.productNameFromDevice
+	if name := productName(uint16(d.Vendor), uint16(d.Product)); name != "" {
+		return name
 	}
+	return d.productNameFromDevice
 }
 
+// The class codes and BCD versions of device and interface descriptors, forwarded
+// from x/gusb, which also has their constants (gusb.USBClassHID and so on).
+type (
+	USBClass        = gusb.USBClass
+	USBSubClass     = gusb.USBSubClass
+	USBProtocolDesc = gusb.USBProtocolDesc
+	USBVer          = gusb.USBVer
+)
+
 type Device struct {
 	Bus                   int
 	Device                int
-	Port                  int // @todo: keep this up to date with hotplugs, resets?
-	Ports                 []int
+	Port                  int   // port on the parent hub, 0 for root hubs
+	Ports                 []int // port path from the root hub, as in PortPath
 	Vendor                ID
-	vendorNameFromIdFile  string
 	vendorNameFromDevice  string
 	Product               ID
-	productNameFromIdFile string
 	productNameFromDevice string
+	Serial                string
+	Class                 USBClass
+	SubClass              USBSubClass
+	Protocol              USBProtocolDesc
+	USBVersion            USBVer // bcdUSB
+	Release               USBVer // bcdDevice, usually the firmware version
 	Parent                *Device
 	Speed                 Speed
 	Configs               []Configuration
-	ActiveConfig          *Configuration // can read SYSFSPATH/bConfigurationValue
+	ActiveConfig          *Configuration // can read SYSFSPATH/bConfigurationValue. nil if Unconfigured
+	Virtual               bool           // behind a host controller with no hardware: usbip's vhci_hcd, or dummy_hcd
 
 	dataSource dataBacking
-	ctx        *Context // Context that this device was opened with
-	f          *os.File // USBFS file
-	SysPath    string   // SYSFS directory for this device
+	ctx        *Context     // Context that this device was opened with
+	rule       *Rule        // naming rule this device matched, if any
+	st         *deviceState // mutable handle state, shared by copies of this Device
+	SysPath    string       // SYSFS directory for this device
+	strIdx     [3]uint8     // iManufacturer, iProduct, iSerialNumber, for reading names over usbfs
+	devRoot    string       // usbfs root it was listed under, if not the default
+	sysRoot    string       // sysfs devices directory it was listed under, if any
 }
 
-func List() ([]*Device, error) {
-	dd, err := gusb.Walk(nil)
-	if err != nil {
-		return nil, err
+// Alias returns the user-defined name given to this device by a matching Rule,
+// or an empty string if no rule has matched.
+func (d Device) Alias() string {
+	if d.rule == nil {
+		return ""
+	}
+	return d.rule.Name
+}
+
+// Rule returns the naming Rule this device matched, or nil.
+func (d Device) Rule() *Rule { return d.rule }
+
+// PortPath returns the physical location of the device as named in sysfs,
+// e.g. "3-1.2" for port 2 of a hub on port 1 of bus 3. Root hubs are "usb3".
+func (d Device) PortPath() string {
+	if len(d.Ports) == 0 {
+		return fmt.Sprintf("usb%d", d.Bus)
+	}
+	ports := make([]string, len(d.Ports))
+	for i, p := range d.Ports {
+		ports[i] = strconv.Itoa(p)
+	}
+	return fmt.Sprintf("%d-%s", d.Bus, strings.Join(ports, "."))
+}
+
+// IsHub reports whether the device is a USB hub, including root hubs.
+func (d Device) IsHub() bool { return d.Class == gusb.USBClassHub }
+
+// IsRootHub reports whether the device is the virtual hub of a host controller,
+// at the root of a bus.
+func (d Device) IsRootHub() bool {
+	if !d.IsHub() {
+		return false
+	}
+	if d.SysPath != "" {
+		return strings.HasPrefix(filepath.Base(d.SysPath), "usb")
+	}
+	return d.Vendor == 0x1d6b // Linux Foundation, the vendor of every root hub
+}
+
+// ListOption filters the devices returned by List.
+type ListOption func(*listOptions)
+
+type listOptions struct {
+	noHubs     bool
+	noRootHubs bool
+	noVirtual  bool
+	usbfsOnly  bool
+	roots      *gusb.Roots
+}
+
+// ExcludeHubs leaves every hub, root or not, out of List.
+func ExcludeHubs() ListOption { return func(o *listOptions) { o.noHubs = true } }
+
+// ExcludeRootHubs leaves host controller root hubs out of List.
+func ExcludeRootHubs() ListOption { return func(o *listOptions) { o.noRootHubs = true } }
+
+// ExcludeVirtual leaves out of List the devices on virtual host controllers, such as
+// usbip imports and dummy_hcd gadgets. See Device.Virtual.
+func ExcludeVirtual() ListOption { return func(o *listOptions) { o.noVirtual = true } }
+
+// ListRoots enumerates devices under other sysfs and usbfs directories than the
+// standard ones. The Devices listed open their nodes under r.USBFS.
+func ListRoots(r Roots) ListOption { return func(o *listOptions) { o.roots = &r } }
+
+// UsbfsOnly enumerates the usbfs device nodes alone, ignoring sysfs, for systems
+// where sysfs USB information is missing or restricted, as on Android. Names, the
+// active configuration, and hub ports are then read from the devices and hubs over
+// usbfs, as far as their nodes can be opened read-write.
+func UsbfsOnly() ListOption { return func(o *listOptions) { o.usbfsOnly = true } }
+
+// List returns every USB device on the system, including hubs, unless filtered by opts.
+// Descriptors are parsed from the copies the kernel keeps in sysfs, so listing opens no
+// device nodes, needs no permissions, and causes no bus traffic.
+// Devices whose descriptors can't be parsed are left out, with a *gusb.WalkError each
+// joined in the returned error, which comes along with the devices that were listed.
+func List(opts ...ListOption) ([]*Device, error) {
+	return listContext(context.Background(), opts...)
+}
+
+// listContext is List, stopping between devices once ctx is done.
+func listContext(ctx context.Context, opts ...ListOption) ([]*Device, error) {
+	var o listOptions
+	for _, opt := range opts {
+		opt(&o)
 	}
 
-	devs := make([]*Device, len(dd))
+	roots := defaultRoots()
+	if o.roots != nil {
+		roots = *o.roots
+	}
+	if o.usbfsOnly {
+		roots.SysFS = ""
+	}
+	dd, err := roots.Walk(func(*gusb.DeviceDescriptor) error { return ctx.Err() })
+	if err != nil && len(dd) == 0 {
+		return nil, err
+	}
 
+	src := devSource{sysRoot: roots.SysFS}
+	if o.roots != nil {
+		src.devRoot = o.roots.USBFS
+	}
+	all := make([]*Device, 0, len(dd))
 	for i := range dd {
-		devs[i] = toDevice(dd[i])
+		all = append(all, newDevice(dd[i], src))
 	}
-	return devs, nil
+	linkUsbfsHubs(all)
+
+	devs := make([]*Device, 0, len(all))
+	for _, d := range all {
+		if (o.noHubs && d.IsHub()) || (o.noRootHubs && d.IsRootHub()) || (o.noVirtual && d.Virtual) {
+			continue
+		}
+		devs = append(devs, d)
+	}
+	return devs, err
 }
 
 func Open(bus int, dev int) (*Device, error) {
-	f, err := os.OpenFile(fmt.Sprintf("/dev/bus/usb/%03d/%03d", bus, dev), os.O_RDWR, 0644)
+	f, err := os.OpenFile(devNodePath(bus, dev), os.O_RDWR, 0644)
 	if os.IsNotExist(err) {
 		return nil, ErrDeviceNotFound
 	} else if err != nil {
-		log.Printf("ERROR: bus %d, dev %d: failed opening file: %v\n", bus, dev, err)
+		logf("ERROR: bus %d, dev %d: failed opening file: %v\n", bus, dev, err)
 		return nil, err
 	}
-	desc, err := gusb.ParseDescriptor(f)
+	desc, err := gusb.ParseUsbfsDescriptor(f)
 	if err != nil {
-		log.Printf("ERROR: bus %d, dev %d: failed parsing descriptor: %v\n", bus, dev, err)
+		logf("ERROR: bus %d, dev %d: failed parsing descriptor: %v\n", bus, dev, err)
 		return nil, err
 	}
 	desc.PathInfo.Bus = bus
 	desc.PathInfo.Dev = dev
 	d := toDevice(desc)
-	d.f = f
+	d.st.f = f
 
 	return d, nil
 }
@@ -112,45 +271,162 @@ func VidPid(vid uint16, pid uint16) (*Device, error) {
 	return dev, nil
 }
 
-func (d *Device) Open() error {
-	if d.f != nil {
-		d.f.Close()
+// Open opens the device's usbfs node for I/O. See OpenRetry and WaitUdevSettle
+// for opening devices that were only just plugged in.
+// The open hooks of the device's Context run around it, see OpenHook, after its Policy.
+func (d *Device) Open(opts ...OpenOption) error {
+	var o openOptions
+	for _, opt := range opts {
+		opt(&o)
 	}
+	if c := d.context(); c != nil {
+		if err := c.checkPolicy(d); err != nil {
+			return err
+		}
+		d.st.mu.Lock()
+		d.st.refused = nil
+		d.st.mu.Unlock()
+	}
+	return d.withOpenHooks(func() error {
+		if o.settle > 0 {
+			d.waitUdevSettle(o.settle)
+		}
+		backoff := o.backoff
+		for attempt := 0; ; attempt++ {
+			err := d.open(o.readOnly)
+			if err == nil || attempt >= o.retries || !retryOpen(err) {
+				return err
+			}
+			clock().Sleep(backoff)
+			if backoff *= 2; backoff > maxOpenBackoff {
+				backoff = maxOpenBackoff
+			}
+		}
+	})
+}
 
-	f, err := os.OpenFile(fmt.Sprintf("/dev/bus/usb/%03d/%03d", d.Bus, d.Device), os.O_RDWR, 0644)
+func (d *Device) open(readOnly bool) error {
+	d.st.mu.Lock()
+	defer d.st.mu.Unlock()
+	if d.st.async != nil {
+		d.st.async.stop()
+		d.st.async = nil
+	}
+	if d.st.f != nil {
+		d.st.f.Close()
+		d.st.f = nil
+	}
+
+	node, err := d.DevNode()
 	if err != nil {
 		return err
 	}
-	d.f = f
+	flag := os.O_RDWR
+	if readOnly {
+		flag = os.O_RDONLY
+	}
+	f, err := os.OpenFile(node, flag, 0644)
+	if err != nil {
+		return err
+	}
+	d.st.f = f
+	d.st.closed = false
+	d.st.readOnly = readOnly
 	return nil
 }
 
+// ReadOnly reports whether the device was opened with the ReadOnly option.
+func (d *Device) ReadOnly() bool {
+	if d.st == nil {
+		return false
+	}
+	d.st.mu.Lock()
+	defer d.st.mu.Unlock()
+	return d.st.readOnly
+}
+
+// Close releases the device file, and deregisters it from its Context.
+// It is safe to call more than once, and from multiple goroutines; only the call that
+// actually closes the file can return an error. Transfers started afterwards return ErrClosed.
 func (d *Device) Close() error {
-	if d.f == nil {
-		// Already closed or was never opened via d.Open()
-		// If it was managed by a context, still try to deregister.
-		if d.ctx != nil {
-			d.ctx.closeDev(d)
-			d.ctx = nil // Avoid future calls if Close is called multiple times
-		}
-		return nil
+	if d.st == nil {
+		return nil // never listed, so never opened
+	}
+	d.st.mu.Lock()
+	f, ctx, eng, completions := d.st.f, d.ctx, d.st.async, d.st.completions
+	d.st.f, d.ctx, d.st.async, d.st.completions = nil, nil, nil, nil
+	d.st.closed = true
+	// the kernel releases every claim along with the file
+	for intf := range d.st.claimed {
+		delete(d.st.claimed, intf)
+	}
+	d.st.mu.Unlock()
+	d.dropClaims()
+
+	if eng != nil {
+		eng.stop() // cancels and reaps anything in flight, while the file is still open
+	}
+	if completions != nil {
+		completions.close()
+	}
+	if ctx != nil {
+		ctx.closeDev(d)
+	}
+	if f == nil {
+		return nil // already closed, or never opened
 	}
+	return f.Close()
+}
 
-	// Deregister from context if associated
-	if d.ctx != nil {
-		d.ctx.closeDev(d)
-		d.ctx = nil
+// file returns the open usbfs file for I/O, or ErrClosed / ErrNotOpen / ErrReadOnly.
+func (d *Device) file() (*os.File, error) {
+	if d.st == nil {
+		return nil, ErrNotOpen
+	}
+	d.st.mu.Lock()
+	defer d.st.mu.Unlock()
+	if d.st.refused != nil {
+		return nil, d.st.refused
+	}
+	if d.st.f != nil && d.st.readOnly {
+		return nil, ErrReadOnly
 	}
+	if d.st.f != nil {
+		return d.st.f, nil
+	}
+	if d.st.closed {
+		return nil, ErrClosed
+	}
+	return nil, ErrNotOpen
+}
 
-	// @todo release any claimed interfaces. This is typically handled by the user.
-	err := d.f.Close()
-	d.f = nil // Mark as closed
-	return err
+// node returns the open usbfs file, or nil, whatever the handle's state: for reads
+// that don't disturb the device, and open the node themselves without it.
+func (d *Device) node() *os.File {
+	if d.st == nil {
+		return nil
+	}
+	d.st.mu.Lock()
+	defer d.st.mu.Unlock()
+	return d.st.f
 }
 
+// ctxDone returns the Done channel of the Context this device was opened with,
+// or nil (which blocks forever) if there isn't one.
+func (d *Device) ctxDone() <-chan struct{} {
+	d.st.mu.Lock()
+	defer d.st.mu.Unlock()
+	if d.ctx == nil {
+		return nil
+	}
+	return d.ctx.Done()
+}
+
+// Interface returns the i-th interface of the active configuration, by position.
+// Interface numbers may be sparse; see InterfaceByNumber.
 func (d *Device) Interface(i int) (*Interface, error) {
 	if d.ActiveConfig == nil {
-		log.Printf("ERROR: interface %d: %v\n", i, ErrNoActiveConfig)
+		logf("ERROR: interface %d: %v\n", i, ErrNoActiveConfig)
 		return nil, ErrNoActiveConfig
 	}
 	if len(d.ActiveConfig.Interfaces) == 0 {
@@ -169,50 +445,375 @@ func (d *Device) DefaultInterface() (intf *Interface, done func(), err error) {
 	if err != nil {
 		return nil, nil, err
 	}
-	d.Open()
+	if err = d.Open(); err != nil {
+		return nil, nil, err
+	}
 	err = intf.Claim()
 	if err != nil {
+		d.Close()
 		return nil, nil, err
 	}
+	var once sync.Once
 	return intf, func() {
+		once.Do(func() {
+			intf.Release()
+			d.Close()
+		})
+	}, nil
+}
+
+// ErrNoBulkInterface is returned by FirstBulkInterface when no interface has a bulk IN and OUT pair.
+var ErrNoBulkInterface = errors.New("usb: no interface with both bulk IN and OUT endpoints")
+
+// FirstBulkInterface opens the device, and claims the first interface of the active
+// configuration with both a bulk IN and a bulk OUT endpoint, checking every alternate
+// setting, and selecting the one found. Call done to release it and close the device.
+func (d *Device) FirstBulkInterface() (intf *Interface, done func(), err error) {
+	if d.ActiveConfig == nil {
+		return nil, nil, ErrNoActiveConfig
+	}
+	intf = findBulkPair(d.ActiveConfig.Interfaces)
+	if intf == nil {
+		return nil, nil, ErrNoBulkInterface
+	}
+	if err = d.Open(); err != nil {
+		return nil, nil, err
+	}
+	if err = intf.Claim(); err != nil {
 		d.Close()
-		intf.Release()
+		return nil, nil, err
+	}
+	if intf.Alternate != 0 {
+		if err = intf.SetAlt(intf.Alternate); err != nil {
+			intf.Release()
+			d.Close()
+			return nil, nil, err
+		}
+	}
+	var once sync.Once
+	return intf, func() {
+		once.Do(func() {
+			intf.Release()
+			d.Close()
+		})
 	}, nil
 }
 
-// Return endpoint by its Address number.
+func findBulkPair(intfs []Interface) *Interface {
+	for i := range intfs {
+		for _, cand := range append([]*Interface{&intfs[i]}, altPtrs(&intfs[i])...) {
+			var in, out bool
+			for _, ep := range cand.Endpoints {
+				if ep.TransferType != TransferTypeBulk {
+					continue
+				}
+				if ep.Address&0x80 != 0 {
+					in = true
+				} else {
+					out = true
+				}
+			}
+			if in && out {
+				return cand
+			}
+		}
+	}
+	return nil
+}
+
+func altPtrs(i *Interface) []*Interface {
+	alts := make([]*Interface, len(i.AltSettings))
+	for k := range i.AltSettings {
+		alts[k] = &i.AltSettings[k]
+	}
+	return alts
+}
+
+// selected returns the alternate setting of i in effect, among i and its AltSettings,
+// see ActiveAltSetting. It is i when that can't be told.
+func (i *Interface) selected() *Interface {
+	alt, err := i.ActiveAltSetting()
+	if err != nil || alt == i.Alternate {
+		return i
+	}
+	for _, s := range altPtrs(i) {
+		if s.Alternate == alt {
+			return s
+		}
+	}
+	return i
+}
+
+// Endpoint returns the endpoint of the active configuration with the given address,
+// including its direction bit, in each interface's alternate setting in effect, as
+// Interface.ActiveAltSetting reports it.
 func (d *Device) Endpoint(num int) (*Endpoint, error) {
-	if num < 0 {
+	if num < 0 || num > 0xff {
 		return nil, fmt.Errorf(badIndexNumber, "endpoint", num)
 	}
-	return nil, nil // @todo, look up endpoint
+	if d.ActiveConfig == nil {
+		return nil, ErrNoActiveConfig
+	}
+	for i := range d.ActiveConfig.Interfaces {
+		eps := d.ActiveConfig.Interfaces[i].selected().Endpoints
+		for k := range eps {
+			if eps[k].Address == num {
+				return &eps[k], nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("usb: no endpoint %02x in the active configuration", num)
 }
 
+// Unconfigured reports whether the device has no active configuration,
+// either because the host never set one (bConfigurationValue 0), or it failed to.
+func (d *Device) Unconfigured() bool { return d.ActiveConfig == nil }
+
+// Ready checks everything transfers need, to fail early with one error rather than
+// on the first transfer: the device came from List or a Context, is open for writing,
+// has an active configuration with interfaces, and has not been marked unhealthy.
+func (d *Device) Ready() error {
+	if d == nil || d.st == nil {
+		return ErrNotOpen
+	}
+	if _, err := d.file(); err != nil {
+		return err
+	}
+	if d.ActiveConfig == nil {
+		return ErrNoActiveConfig
+	}
+	if len(d.ActiveConfig.Interfaces) == 0 {
+		return ErrNoInterfacesInConfig
+	}
+	if !d.Healthy() {
+		return ErrUnhealthy
+	}
+	return nil
+}
+
+// SetConfiguration activates the configuration with the given bConfigurationValue,
+// which is not its index in Configs: see SelectConfiguration to pass the Configuration.
+// A value of 0 puts the device in the Unconfigured state.
 func (d *Device) SetConfiguration(cfg int) error {
-	err := d.dataSource.setConfiguration(*d, cfg)
+	var c *Configuration
+	if cfg != 0 {
+		if c = d.configByValue(cfg); c == nil {
+			return fmt.Errorf("%w: %d", ErrInvalidConfigValue, cfg)
+		}
+	}
+	if d.dataSource == nil {
+		return ErrNotImplemented
+	}
+	if err := d.dataSource.setConfiguration(*d, cfg); err != nil {
+		return err
+	}
+	d.ActiveConfig = c
+	return nil
+}
+
+// SelectConfiguration activates c, one of the device's Configs. A nil c puts the
+// device in the Unconfigured state.
+func (d *Device) SelectConfiguration(c *Configuration) error {
+	if c == nil {
+		return d.SetConfiguration(0)
+	}
+	if !d.ownsConfig(c) {
+		return fmt.Errorf("%w: configuration %d is not one of this device's", ErrInvalidConfigValue, c.Value)
+	}
+	return d.SetConfiguration(c.Value)
+}
+
+// ConfigurationByValue returns the configuration with bConfigurationValue v.
+func (d *Device) ConfigurationByValue(v int) (*Configuration, error) {
+	if c := d.configByValue(v); c != nil {
+		return c, nil
+	}
+	return nil, fmt.Errorf("%w: %d", ErrInvalidConfigValue, v)
+}
+
+// ownsConfig reports whether c points into the device's Configs, which copies of
+// the Device share.
+func (d *Device) ownsConfig(c *Configuration) bool {
+	for i := range d.Configs {
+		if &d.Configs[i] == c {
+			return true
+		}
+	}
+	return false
+}
+
+// EnsureConfigured forces an Unconfigured device into its first described configuration.
+// It does nothing if the device already has an active configuration.
+func (d *Device) EnsureConfigured() error {
+	if d.ActiveConfig != nil {
+		return nil
+	}
+	if len(d.Configs) == 0 {
+		return ErrNoConfigs
+	}
+	return d.SelectConfiguration(&d.Configs[0])
+}
+
+func (d *Device) configByValue(v int) *Configuration {
+	for i := range d.Configs {
+		if d.Configs[i].Value == v {
+			return &d.Configs[i]
+		}
+	}
+	return nil
+}
+
+// InterfaceByNumber returns the interface of the active configuration with bInterfaceNumber n.
+func (d *Device) InterfaceByNumber(n int) (*Interface, error) {
+	if d.ActiveConfig == nil {
+		return nil, ErrNoActiveConfig
+	}
+	for i := range d.ActiveConfig.Interfaces {
+		if d.ActiveConfig.Interfaces[i].ID == n {
+			return &d.ActiveConfig.Interfaces[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%w: no interface number %d", ErrInvalidInterfaceIndex, n)
+}
+
+// ActiveAltSetting returns the active alternate setting of the interface with
+// bInterfaceNumber intf. See Interface.ActiveAltSetting.
+func (d *Device) ActiveAltSetting(intf int) (int, error) {
+	i, err := d.InterfaceByNumber(intf)
 	if err != nil {
-		d.ActiveConfig = &d.Configs[cfg-1]
+		return 0, err
 	}
-	return err
+	return i.ActiveAltSetting()
 }
-func (d *Device) ClaimInterface(intf int) error { // accept int? or Interface?
-	i, err := d.Interface(intf)
+
+// ClaimInterface claims the interface with bInterfaceNumber intf.
+func (d *Device) ClaimInterface(intf int, opts ...ClaimOption) error {
+	i, err := d.InterfaceByNumber(intf)
 	if err != nil {
 		return err
 	}
-	return i.Claim()
+	return i.Claim(opts...)
 }
+
+// ReleaseInterface releases the interface with bInterfaceNumber intf.
 func (d *Device) ReleaseInterface(intf int) error {
-	i, err := d.Interface(intf)
+	i, err := d.InterfaceByNumber(intf)
 	if err != nil {
 		return err
 	}
 	return i.Release()
 }
+
+// Reset performs a USB port reset of the device. If auto re-claim is enabled,
+// every interface claimed before the reset is claimed again, its alternate setting
+// restored, and the re-init hook is run.
 func (d *Device) Reset() error {
 	// https://github.com/libusb/libusb/blob/master/libusb/os/linux_usbfs.c#L1629
-	return nil
+	f, err := d.file()
+	if err != nil {
+		return err
+	}
+	if err := gusb.Reset(f); err != nil {
+		return err
+	}
+	d.st.mu.Lock()
+	enabled := d.st.autoReclaim
+	d.st.mu.Unlock()
+	if !enabled {
+		return nil
+	}
+
+	d.st.mu.Lock()
+	claimed := make(map[int]int, len(d.st.claimed))
+	for intf, alt := range d.st.claimed {
+		claimed[intf] = alt
+	}
+	d.st.mu.Unlock()
+
+	for intf, alt := range claimed {
+		if err := d.timed(fmt.Sprintf("claim interface %d", intf), func() error { return gusb.Claim(f, int32(intf)) }, nil); err != nil {
+			return fmt.Errorf("usb: re-claiming interface %d after reset: %w", intf, err)
+		}
+		if alt != 0 {
+			if err := gusb.SetAltSetting(f, int32(intf), int32(alt)); err != nil {
+				return fmt.Errorf("usb: restoring alt setting %d of interface %d after reset: %w", alt, intf, err)
+			}
+		}
+	}
+	return d.runReinit()
+}
+
+// AutoReclaim enables or disables re-claiming interfaces after Reset.
+// hook, if not nil, is run after a Reset or Interface.SetAlt to re-drive any
+// device-specific initialization.
+func (d *Device) AutoReclaim(enable bool, hook func(*Device) error) {
+	d.st.mu.Lock()
+	defer d.st.mu.Unlock()
+	d.st.autoReclaim = enable
+	d.st.reinit = hook
 }
+
+func (d *Device) trackClaim(intf int, alt int) {
+	d.st.mu.Lock()
+	defer d.st.mu.Unlock()
+	d.st.claimed[intf] = alt
+}
+
+func (d *Device) untrackClaim(intf int) {
+	d.st.mu.Lock()
+	defer d.st.mu.Unlock()
+	delete(d.st.claimed, intf)
+}
+
+func (d *Device) runReinit() error {
+	d.st.mu.Lock()
+	hook := d.st.reinit
+	enabled := d.st.autoReclaim
+	d.st.mu.Unlock()
+	if !enabled || hook == nil {
+		return nil
+	}
+	return hook(d)
+}
+
+// deviceState holds what changes while a Device is in use. Device is
+// frequently passed by value, so this lives behind a pointer.
+type deviceState struct {
+	mu          sync.Mutex
+	f           *os.File    // the open usbfs node, nil while closed
+	closed      bool        // Close was called, and the device not re-opened
+	readOnly    bool        // opened O_RDONLY: descriptors only, no I/O
+	lowLatency  bool        // synchronous transfers run inline, see SetLowLatency
+	claimed     map[int]int // claimed interface number -> alt setting
+	async       *asyncEngine
+	completions *completionQueue
+	asyncOpts   AsyncOptions
+	priorities  map[uint8]EndpointPriority // by endpoint address
+	pacers      map[uint8]*pacer           // by endpoint address
+	tuning      map[uint8]*endpointTuner   // by endpoint address
+	buffers     map[uint8]Buffers          // by endpoint address
+	mapped      map[*byte]bool             // buffers mapped by AllocBuffer
+	refused     error                      // PolicyError, once the Context's policy changed to refuse the device
+	autoReclaim bool
+	reinit      func(*Device) error
+
+	cmd            chan struct{} // held while a Do command runs
+	faults         int           // consecutive
+	faultThreshold int
+	unhealthy      bool
+
+	counters transferCounters
+	latency  atomic.Pointer[latencyTracker] // nil unless SetLatencyTracking
+}
+
+func newDeviceState() *deviceState {
+	return &deviceState{
+		claimed:        make(map[int]int),
+		cmd:            make(chan struct{}, 1),
+		faultThreshold: defaultFaultThreshold,
+	}
+}
+
 func (d *Device) GetDriver(intf int) (string, error) {
 	i, err := d.Interface(intf)
 	if err != nil {
@@ -231,33 +832,3 @@ type Configuration struct {
 
 	d *Device
 }
-
-type Speed int
-
-const (
-	SpeedUnknown Speed = iota
-	SpeedLow
-	SpeedFull
-	SpeedHigh
-	SpeedWireless
-	SpeedSuper
-	SpeedSuperPlus
-)
-
-func (s Speed) String() string {
-	switch s {
-	case SpeedUnknown:
-		return "Unknown"
-	case SpeedLow:
-		return "Low, 1.5 Mbps"
-	case SpeedFull:
-		return "Full, 12Mbps"
-	case SpeedHigh:
-		return "High, 480 Mbps"
-	case SpeedSuper:
-		return "Super, 5 Gbps"
-	case SpeedSuperPlus:
-		return "Super Plus, 10 Gbps"
-	}
-	return "invalid"
-}
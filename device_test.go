@@ -0,0 +1,94 @@
+package usb_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/pzl/usb"
+)
+
+func TestSelectConfiguration(t *testing.T) {
+	tree := fixtureTree(t)
+	devs, err := usb.ListWhere("vendor==1234", usb.ListRoots(tree.Roots))
+	if err != nil || len(devs) != 1 {
+		t.Fatalf("listing widget: %v, %v", devs, err)
+	}
+	w := devs[0]
+	if _, err := w.ConfigurationByValue(2); !errors.Is(err, usb.ErrInvalidConfigValue) {
+		t.Errorf("configuration 2: %v", err)
+	}
+	c, err := w.ConfigurationByValue(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.SelectConfiguration(&usb.Configuration{Value: 1}); !errors.Is(err, usb.ErrInvalidConfigValue) {
+		t.Errorf("selecting another device's configuration: %v", err)
+	}
+	if err := w.SelectConfiguration(c); err != nil || w.ActiveConfig != c {
+		t.Errorf("selecting configuration 1: %v, active %p want %p", err, w.ActiveConfig, c)
+	}
+	if err := w.SelectConfiguration(nil); err != nil || !w.Unconfigured() {
+		t.Errorf("unconfiguring: %v", err)
+	}
+}
+
+func TestReady(t *testing.T) {
+	var zero usb.Device
+	if err := zero.Ready(); !errors.Is(err, usb.ErrNotOpen) {
+		t.Errorf("zero device: %v", err)
+	}
+	if err := zero.Close(); err != nil {
+		t.Errorf("closing zero device: %v", err)
+	}
+	if err := (&usb.Interface{}).Claim(); !errors.Is(err, usb.ErrNotOpen) {
+		t.Errorf("claiming zero interface: %v", err)
+	}
+
+	_, w := openWidget(t)
+	if err := w.Ready(); !errors.Is(err, usb.ErrNotOpen) {
+		t.Errorf("before open: %v", err)
+	}
+	if err := w.Open(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Ready(); err != nil {
+		t.Errorf("open: %v", err)
+	}
+	if ep, err := w.Endpoint(0x83); err != nil || ep.MaxPacketSize != 8 {
+		t.Errorf("endpoint 83: %v, %v", ep, err)
+	}
+	if _, err := w.Endpoint(0x84); err == nil {
+		t.Error("found endpoint 84")
+	}
+
+	w.ActiveConfig = nil // as if unconfigured
+	if err := w.Ready(); !errors.Is(err, usb.ErrNoActiveConfig) {
+		t.Errorf("unconfigured: %v", err)
+	}
+	if _, err := w.Endpoint(0x83); !errors.Is(err, usb.ErrNoActiveConfig) {
+		t.Errorf("unconfigured endpoint: %v", err)
+	}
+}
+
+// TestCopyRace copies a device while it is re-opened, as value receivers do: run
+// with -race.
+func TestCopyRace(t *testing.T) {
+	_, w := openWidget(t)
+	if err := w.Open(); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			w.Open()
+		}
+	}()
+	for i := 0; i < 200; i++ {
+		c := *w
+		if _, err := c.RawDescriptors(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-done
+}
@@ -0,0 +1,229 @@
+package usb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pzl/usb/x/gusb"
+	"golang.org/x/sys/unix"
+)
+
+var (
+	rootsMu sync.RWMutex
+	roots   = gusb.DefaultRoots // where List looks without ListRoots; see SetDevNodeRoot
+)
+
+// SetDevNodeRoot sets the directory holding usbfs device nodes, arranged as BBB/DDD
+// for bus and device number. It is gusb.DefaultRoots.USBFS by default: /dev/bus/usb,
+// or gusb.LegacyUSBFS on old kernels that only mount usbfs there. Containers
+// bind-mounting the host's nodes elsewhere, or a devtmpfs mounted other than on /dev
+// (its nodes are in bus/usb), can point here instead.
+//
+// It replaces the USBFS of the default roots, used by List and Open, and by Contexts
+// without WithRoots. Devices listed under other roots keep theirs.
+func SetDevNodeRoot(root string) {
+	rootsMu.Lock()
+	defer rootsMu.Unlock()
+	roots.USBFS = root
+}
+
+// defaultRoots are gusb.DefaultRoots, with the usbfs root set by SetDevNodeRoot.
+func defaultRoots() gusb.Roots {
+	rootsMu.RLock()
+	defer rootsMu.RUnlock()
+	return roots
+}
+
+func devNodePath(bus, dev int) string {
+	return gusb.NodePath(defaultRoots().USBFS, bus, dev)
+}
+
+func (d Device) nodeRoot() string {
+	if d.devRoot != "" {
+		return d.devRoot
+	}
+	return defaultRoots().USBFS
+}
+
+// driversDir is sysfs's directory of USB drivers, next to the devices directory the
+// device was listed under: /sys/bus/usb/drivers by default.
+func (d Device) driversDir() string {
+	root := d.sysRoot
+	if root == "" {
+		root = defaultRoots().SysFS
+	}
+	return filepath.Join(filepath.Dir(root), "drivers")
+}
+
+// nodePath is where the device node is, going by bus and device number.
+func (d Device) nodePath() string {
+	return gusb.NodePath(d.nodeRoot(), d.Bus, d.Device)
+}
+
+// DevNode returns the path of the device's usbfs node. It is normally found by bus and
+// device number. When that fails, as when /sys is visible but /dev is remapped inside a
+// container, the node is looked up by the major:minor number sysfs reports for the device.
+func (d Device) DevNode() (string, error) {
+	p := d.nodePath()
+	if _, err := os.Stat(p); err == nil || d.SysPath == "" {
+		return p, err
+	}
+
+	major, minor, err := d.devNumber()
+	if err != nil {
+		return "", fmt.Errorf("usb: no device node at %s, and %w", p, err)
+	}
+	rdev := unix.Mkdev(major, minor)
+
+	// udev keeps a link per device number
+	if link := fmt.Sprintf("/dev/char/%d:%d", major, minor); isCharDev(link, rdev) {
+		return link, nil
+	}
+	root := d.nodeRoot()
+	for _, dir := range []string{root, "/dev"} {
+		if found := findCharDev(dir, rdev); found != "" {
+			return found, nil
+		}
+	}
+	return "", fmt.Errorf("usb: no device node for %d:%d: %w", major, minor, ErrDeviceNotFound)
+}
+
+// RawDescriptors returns the device descriptor followed by every configuration's
+// descriptors, as the device sent them at enumeration. They come from the kernel's
+// copy in the sysfs "descriptors" attribute, which anyone can read and which causes
+// no bus traffic, or else from the usbfs node, which needs read access to it. List
+// parses them from sysfs already: this is for tools decoding class-specific or
+// vendor descriptors the library doesn't.
+func (d Device) RawDescriptors() ([]byte, error) {
+	if d.SysPath != "" {
+		if b, err := os.ReadFile(filepath.Join(d.SysPath, "descriptors")); err == nil {
+			return b, nil
+		}
+	}
+	if f := d.node(); f != nil {
+		return readDescriptors(f)
+	}
+	p, err := d.DevNode()
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readDescriptors(f)
+}
+
+// readDescriptors reads what a usbfs node holds, from its start, leaving its offset
+// alone, in bus order.
+func readDescriptors(f *os.File) ([]byte, error) {
+	var b []byte
+	buf := make([]byte, 4096)
+	for {
+		n, err := f.ReadAt(buf, int64(len(b)))
+		b = append(b, buf[:n]...)
+		if err == io.EOF {
+			return gusb.UsbfsToBusOrder(b, binary.NativeEndian), nil
+		} else if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// devNumber returns the major:minor number sysfs reports for the device.
+func (d Device) devNumber() (major, minor uint32, err error) {
+	data, err := os.ReadFile(filepath.Join(d.SysPath, "dev"))
+	if err != nil {
+		return 0, 0, fmt.Errorf("no device number in sysfs: %w", err)
+	}
+	if _, err := fmt.Sscanf(strings.TrimSpace(string(data)), "%d:%d", &major, &minor); err != nil {
+		return 0, 0, fmt.Errorf("bad sysfs dev attribute %q: %w", data, err)
+	}
+	return major, minor, nil
+}
+
+// OpenFile adopts an already open usbfs file for the device, instead of opening its node.
+// Use this when a privileged helper hands over the descriptor (e.g. over a unix socket),
+// or for a descriptor inherited as /proc/self/fd/N, with os.NewFile.
+func (d *Device) OpenFile(f *os.File) error {
+	if f == nil {
+		return errors.New("usb: nil file")
+	}
+	d.st.mu.Lock()
+	defer d.st.mu.Unlock()
+	if d.st.async != nil {
+		d.st.async.stop()
+		d.st.async = nil
+	}
+	if d.st.f != nil && d.st.f != f {
+		d.st.f.Close()
+	}
+	d.st.f = f
+	d.st.closed = false
+	return nil
+}
+
+// DeviceFromFile describes the device behind an already open usbfs file, and adopts
+// the file for I/O. This is how to use devices on Android without root: the app's
+// UsbDeviceConnection.getFileDescriptor(), or the descriptor termux-usb passes to its
+// command, is opened with os.NewFile. Names and the active configuration are read
+// through the file, so it works without sysfs or access to /dev/bus/usb.
+func DeviceFromFile(f *os.File) (*Device, error) {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	desc, err := gusb.ParseUsbfsDescriptor(f)
+	if err != nil {
+		return nil, err
+	}
+	// the descriptor doesn't know where the device is: the node's name does
+	if p, err := os.Readlink(fmt.Sprintf("/proc/self/fd/%d", f.Fd())); err == nil {
+		dev, derr := strconv.Atoi(filepath.Base(p))
+		bus, berr := strconv.Atoi(filepath.Base(filepath.Dir(p)))
+		if derr == nil && berr == nil {
+			desc.PathInfo.Bus, desc.PathInfo.Dev = bus, dev
+		}
+	}
+	src := devSource{f: f}
+	if desc.PathInfo.Bus > 0 {
+		src.sysRoot = defaultRoots().SysFS // used if readable
+	}
+	d := newDevice(desc, src)
+	d.st.f = f
+	return d, nil
+}
+
+func isCharDev(path string, rdev uint64) bool {
+	var st unix.Stat_t
+	if err := unix.Stat(path, &st); err != nil {
+		return false
+	}
+	return st.Mode&unix.S_IFMT == unix.S_IFCHR && uint64(st.Rdev) == rdev //nolint:unconvert // Rdev is a uint32 on mips
+}
+
+func findCharDev(dir string, rdev uint64) string {
+	var found string
+	filepath.WalkDir(dir, func(path string, e fs.DirEntry, err error) error {
+		if err != nil {
+			if path == dir {
+				return err
+			}
+			return nil
+		}
+		if e.Type()&fs.ModeCharDevice != 0 && isCharDev(path, rdev) {
+			found = path
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	return found
+}
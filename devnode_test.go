@@ -0,0 +1,34 @@
+package usb_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pzl/usb"
+)
+
+func TestRawDescriptors(t *testing.T) {
+	tree := fixtureTree(t)
+	devs, err := usb.ListWhere("vendor==1234", usb.ListRoots(tree.Roots))
+	if err != nil || len(devs) != 1 {
+		t.Fatalf("listed %d devices, %v", len(devs), err)
+	}
+	want, err := os.ReadFile(filepath.Join(tree.Roots.USBFS, "001", "003"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := usb.DevNodeRoot()
+	t.Cleanup(func() { usb.SetDevNodeRoot(old) })
+	usb.SetDevNodeRoot(tree.Roots.USBFS)
+	for _, d := range []usb.Device{*devs[0], {Bus: 1, Device: 3}} { // from sysfs, then usbfs
+		got, err := d.RawDescriptors()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("sysfs path %q: got % x, want % x", d.SysPath, got, want)
+		}
+	}
+}
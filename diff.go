@@ -0,0 +1,203 @@
+//go:build !usb_core
+
+package usb
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pzl/usb/x/gusb"
+)
+
+// Snapshot records the attached devices at one time, as plain data to store (it
+// encodes with encoding/json) and later compare against with Diff.
+type Snapshot struct {
+	Taken   time.Time        `json:"taken"`
+	Devices []DeviceSnapshot `json:"devices"`
+}
+
+// DeviceSnapshot is one device in a Snapshot.
+type DeviceSnapshot struct {
+	PortPath     string          `json:"port_path"`
+	Vendor       ID              `json:"vendor"`
+	Product      ID              `json:"product"`
+	Name         string          `json:"name,omitempty"`
+	Serial       string          `json:"serial,omitempty"`
+	Class        string          `json:"class"`
+	USBVersion   string          `json:"usb_version"`
+	Release      string          `json:"release"` // bcdDevice, usually the firmware version
+	SpeedMbps    float64         `json:"speed_mbps"`
+	ActiveConfig int             `json:"active_config"` // 0 when unconfigured
+	Interfaces   []TreeInterface `json:"interfaces,omitempty"`
+}
+
+// TakeSnapshot lists the devices, filtered by opts, into a Snapshot.
+func TakeSnapshot(opts ...ListOption) (Snapshot, error) {
+	devs, err := List(opts...)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	s := Snapshot{Taken: time.Now(), Devices: make([]DeviceSnapshot, 0, len(devs))}
+	for _, d := range devs {
+		s.Devices = append(s.Devices, snapshotDevice(d))
+	}
+	sort.Slice(s.Devices, func(i, j int) bool { return s.Devices[i].PortPath < s.Devices[j].PortPath })
+	return s, nil
+}
+
+func snapshotDevice(d *Device) DeviceSnapshot {
+	n := toTreeNode(d)
+	s := DeviceSnapshot{
+		PortPath:   n.PortPath,
+		Vendor:     d.Vendor,
+		Product:    d.Product,
+		Name:       n.Name,
+		Serial:     d.Serial,
+		Class:      n.Class,
+		USBVersion: bcd(d.USBVersion),
+		Release:    bcd(d.Release),
+		SpeedMbps:  d.Speed.Mbps(),
+		Interfaces: n.Interfaces,
+	}
+	if d.ActiveConfig != nil {
+		s.ActiveConfig = d.ActiveConfig.Value
+	}
+	return s
+}
+
+// bcd formats a binary-coded decimal version the way lsusb does, e.g. 2.00 or 1.10.
+func bcd(v gusb.USBVer) string { return fmt.Sprintf("%x.%02x", uint16(v)>>8, uint16(v)&0xff) }
+
+// SnapshotDiff is what changed between two Snapshots.
+type SnapshotDiff struct {
+	Added   []DeviceSnapshot
+	Removed []DeviceSnapshot
+	Changed []DeviceChange
+}
+
+// DeviceChange is a device present in both Snapshots, with differing fields.
+type DeviceChange struct {
+	Before, After DeviceSnapshot
+	Fields        []FieldChange
+}
+
+// FieldChange is one differing field of a DeviceChange, named as in its JSON encoding.
+type FieldChange struct {
+	Field         string
+	Before, After string
+}
+
+// Diff compares an earlier Snapshot a with a later b. Devices with a serial number are
+// followed across ports, so a moved device shows as a port_path change. Devices without
+// one (or sharing it with another of the same model) are identified by their port alone.
+func Diff(a, b Snapshot) *SnapshotDiff {
+	before, after := snapshotKeys(a), snapshotKeys(b)
+	diff := &SnapshotDiff{}
+	for _, d := range b.Devices {
+		if _, ok := before[snapshotKey(d, after)]; !ok {
+			diff.Added = append(diff.Added, d)
+		}
+	}
+	for _, d := range a.Devices {
+		k := snapshotKey(d, before)
+		n, ok := after[k]
+		if !ok {
+			diff.Removed = append(diff.Removed, d)
+			continue
+		}
+		if fields := diffFields(d, b.Devices[n]); len(fields) > 0 {
+			diff.Changed = append(diff.Changed, DeviceChange{Before: d, After: b.Devices[n], Fields: fields})
+		}
+	}
+	return diff
+}
+
+// Empty reports whether nothing changed.
+func (d *SnapshotDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// String reports the differences a line each, e.g. for a log or an alert.
+func (d *SnapshotDiff) String() string {
+	var b strings.Builder
+	for _, s := range d.Added {
+		fmt.Fprintf(&b, "+ %s %s:%s %s\n", s.PortPath, s.Vendor, s.Product, s.Name)
+	}
+	for _, s := range d.Removed {
+		fmt.Fprintf(&b, "- %s %s:%s %s\n", s.PortPath, s.Vendor, s.Product, s.Name)
+	}
+	for _, c := range d.Changed {
+		fmt.Fprintf(&b, "~ %s %s:%s %s\n", c.After.PortPath, c.After.Vendor, c.After.Product, c.After.Name)
+		for _, f := range c.Fields {
+			fmt.Fprintf(&b, "    %s: %q -> %q\n", f.Field, f.Before, f.After)
+		}
+	}
+	return b.String()
+}
+
+// snapshotKeys indexes the devices of s by their identity.
+func snapshotKeys(s Snapshot) map[string]int {
+	serials := make(map[string]int)
+	for _, d := range s.Devices {
+		if d.Serial != "" {
+			serials[serialKey(d)]++
+		}
+	}
+	keys := make(map[string]int, len(s.Devices))
+	for i, d := range s.Devices {
+		k := "port " + d.PortPath
+		if d.Serial != "" && serials[serialKey(d)] == 1 {
+			k = serialKey(d)
+		}
+		keys[k] = i
+	}
+	return keys
+}
+
+// snapshotKey is the identity d was given in keys, see snapshotKeys.
+func snapshotKey(d DeviceSnapshot, keys map[string]int) string {
+	if _, ok := keys[serialKey(d)]; ok && d.Serial != "" {
+		return serialKey(d)
+	}
+	return "port " + d.PortPath
+}
+
+func serialKey(d DeviceSnapshot) string {
+	return fmt.Sprintf("serial %s:%s %s", d.Vendor, d.Product, d.Serial)
+}
+
+var snapshotFields = []struct {
+	name  string
+	value func(DeviceSnapshot) string
+}{
+	{"port_path", func(d DeviceSnapshot) string { return d.PortPath }},
+	{"vendor", func(d DeviceSnapshot) string { return d.Vendor.String() }},
+	{"product", func(d DeviceSnapshot) string { return d.Product.String() }},
+	{"name", func(d DeviceSnapshot) string { return d.Name }},
+	{"serial", func(d DeviceSnapshot) string { return d.Serial }},
+	{"class", func(d DeviceSnapshot) string { return d.Class }},
+	{"usb_version", func(d DeviceSnapshot) string { return d.USBVersion }},
+	{"release", func(d DeviceSnapshot) string { return d.Release }},
+	{"speed_mbps", func(d DeviceSnapshot) string { return strconv.FormatFloat(d.SpeedMbps, 'f', -1, 64) }},
+	{"active_config", func(d DeviceSnapshot) string { return strconv.Itoa(d.ActiveConfig) }},
+	{"interfaces", func(d DeviceSnapshot) string {
+		s := make([]string, len(d.Interfaces))
+		for i, intf := range d.Interfaces {
+			s[i] = fmt.Sprintf("%d:%s/%s", intf.Number, intf.Class, intf.Driver)
+		}
+		return strings.Join(s, " ")
+	}},
+}
+
+func diffFields(a, b DeviceSnapshot) []FieldChange {
+	var changes []FieldChange
+	for _, f := range snapshotFields {
+		if va, vb := f.value(a), f.value(b); va != vb {
+			changes = append(changes, FieldChange{Field: f.name, Before: va, After: vb})
+		}
+	}
+	return changes
+}
@@ -0,0 +1,51 @@
+//go:build !usb_core
+
+package usb_test
+
+import (
+	"testing"
+
+	"github.com/pzl/usb"
+	"github.com/pzl/usb/usbtest"
+)
+
+func TestSnapshotDiff(t *testing.T) {
+	tree := fixtureTree(t)
+	before, err := usb.TakeSnapshot(usb.ListRoots(tree.Roots))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := usb.Diff(before, before); !d.Empty() {
+		t.Errorf("snapshot differs from itself:\n%s", d)
+	}
+
+	// the widget moves to port 4 with new firmware, and a second device appears
+	widget := usbtest.Device{Bus: 1, Dev: 3, Ports: []int{2, 3}}
+	if err := tree.Remove(widget); err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range []usbtest.Device{
+		{Bus: 1, Dev: 4, Ports: []int{2, 4}, Vendor: 0x1234, Product: 0x5678, Serial: "W0001", Release: 0x0110, Speed: "12"},
+		{Bus: 1, Dev: 5, Ports: []int{2, 1}, Vendor: 0xabcd, Product: 0x0001},
+	} {
+		if err := tree.Add(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	after, err := usb.TakeSnapshot(usb.ListRoots(tree.Roots))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := usb.Diff(before, after)
+	if len(d.Added) != 1 || d.Added[0].Vendor != 0xabcd || len(d.Removed) != 0 || len(d.Changed) != 1 {
+		t.Fatalf("diff:\n%s", d)
+	}
+	changed := map[string]string{}
+	for _, f := range d.Changed[0].Fields {
+		changed[f.Field] = f.After
+	}
+	if changed["port_path"] != "1-2.4" || changed["release"] != "1.10" {
+		t.Errorf("widget changes %v", changed)
+	}
+}
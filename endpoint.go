@@ -4,8 +4,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math"
+	"time"
 
-	"github.com/pzl/usb/gusb"
+	"github.com/pzl/usb/x/gusb"
+	"golang.org/x/sys/unix"
 )
 
 type Endpoint struct {
@@ -14,6 +17,7 @@ type Endpoint struct {
 	TransferType     int
 	MaxPacketSize    int
 	MaxISOPacketSize int
+	Interval         int // bInterval, polling interval of interrupt and isochronous endpoints
 
 	i *Interface
 }
@@ -26,23 +30,153 @@ type InEndpoint struct {
 	Endpoint
 }
 
+// ErrBufferNotPacketMultiple is returned by CheckBuffer when an IN transfer into the buffer
+// could end mid-packet, making the kernel report EOVERFLOW (babble) if the device sends a full packet.
+var ErrBufferNotPacketMultiple = errors.New("usb: buffer length is not a multiple of the endpoint max packet size")
+
+// PacketSize returns the max packet size in bytes, without the high-bandwidth
+// transaction bits (12..11) of wMaxPacketSize.
+func (e *Endpoint) PacketSize() int {
+	return e.MaxPacketSize & 0x7ff
+}
+
+// NewBuffer allocates a buffer of at least n bytes, rounded up to a multiple of
+// the endpoint packet size. Reading into it can not overflow.
+func (e *Endpoint) NewBuffer(n int) []byte {
+	ps := e.PacketSize()
+	if ps == 0 {
+		return make([]byte, n)
+	}
+	if n < ps {
+		n = ps
+	}
+	if rem := n % ps; rem != 0 {
+		n += ps - rem
+	}
+	return make([]byte, n)
+}
+
+// CheckBuffer returns ErrBufferNotPacketMultiple if buf could overflow on an IN transfer.
+func (e *Endpoint) CheckBuffer(buf []byte) error {
+	if ps := e.PacketSize(); ps != 0 && len(buf)%ps != 0 {
+		return fmt.Errorf("%w: %d bytes, packets of %d bytes", ErrBufferNotPacketMultiple, len(buf), ps)
+	}
+	return nil
+}
+
+// OverflowError is returned when a device sends more data than the IN buffer could hold (babble).
+// The kernel reports this as EOVERFLOW, which the error unwraps to.
+//
+// The kernel doesn't say how much the device sent: Attempted is an estimate, from the
+// buffer and packet sizes. Salvaged is what the URB reports it received, for
+// asynchronous transfers, and 0 for synchronous ones, which get nothing back.
+type OverflowError struct {
+	Endpoint   int // endpoint address
+	Requested  int // size of the buffer given
+	PacketSize int // max packet size from the descriptor
+	Attempted  int // estimate: the buffer, up to the end of the packet that didn't fit
+	Salvaged   int // bytes delivered into the buffer before the overflow
+}
+
+func (e *OverflowError) Error() string {
+	return fmt.Sprintf("usb: ep %02X overflowed: device sent more than fits a %d byte buffer (about %d bytes, %d salvaged, %d byte packets). "+
+		"Size IN buffers with Endpoint.NewBuffer, or the device is sending packets larger than its descriptor allows",
+		e.Endpoint, e.Requested, e.Attempted, e.Salvaged, e.PacketSize)
+}
+
+func (e *OverflowError) Unwrap() error { return unix.EOVERFLOW }
+
+// overflow describes an overflow of a requested byte buffer, estimating what the device
+// sent as a full packet past the last that fit, or one byte more without a packet size.
+func (e *Endpoint) overflow(requested int) *OverflowError {
+	ps := e.PacketSize()
+	attempted := requested + 1
+	if ps > 0 {
+		attempted = (requested/ps + 1) * ps
+	}
+	return &OverflowError{
+		Endpoint:   e.Address,
+		Requested:  requested,
+		PacketSize: ps,
+		Attempted:  attempted,
+		Salvaged:   0, // usbfs copies nothing back to a failed synchronous transfer
+	}
+}
+
 // TransferTypeBulk defines the bulk transfer type for an endpoint.
 // (Value is 0x02 as per USB specification section 9.6.6 bmAttributes bits 1..0,
 // and matches gusb.EndpointTypeBulk)
 const TransferTypeBulk = 0x02
 
+// TransferTypeInterrupt is the interrupt transfer type, gusb.EndpointTypeInterrupt.
+const TransferTypeInterrupt = 0x03
+
+// checkType checks the endpoint is of the bulk or interrupt transfer type typ.
+func (e *Endpoint) checkType(typ int) error {
+	if e.TransferType == typ {
+		return nil
+	}
+	name := "a bulk"
+	if typ == TransferTypeInterrupt {
+		name = "an interrupt"
+	}
+	return fmt.Errorf("usb: endpoint address %02X is not %s endpoint (type %02X)", e.Address, name, e.TransferType)
+}
+
 /* ---- Synchronous Sending ---- */
 
-func (e *Endpoint) CtrlTransfer() {
-	// @todo: Implement control transfer
+// SetupPacket is the setup stage of a control transfer, see gusb.SetupPacket.
+type SetupPacket = gusb.SetupPacket
+
+// CtrlTransfer does nothing.
+//
+// Deprecated: control transfers go to the default endpoint, which has no Endpoint:
+// use Device.Control or Device.ControlTransfer.
+func (e *Endpoint) CtrlTransfer() {}
+
+// ClearHalt clears a stall of the endpoint, as after a transfer failed with EPIPE,
+// so that transfers go through again. Its interface must be claimed.
+func (e *Endpoint) ClearHalt() error {
+	if e.i == nil || e.i.d == nil {
+		return ErrNotOpen
+	}
+	f, err := e.i.d.file()
+	if err != nil {
+		return err
+	}
+	if err := gusb.ClearHalt(f, uint32(e.Address)); err != nil {
+		return fmt.Errorf("usb: clearing halt of ep %02X: %w", e.Address, err)
+	}
+	return nil
+}
+
+// kernelTimeout converts a transfer timeout to the milliseconds usbfs takes, rounding
+// up so that a short timeout doesn't become none. 0 is no timeout.
+func kernelTimeout(d time.Duration) uint32 {
+	if d <= 0 {
+		return 0
+	}
+	ms := (d + time.Millisecond - 1) / time.Millisecond
+	if ms > math.MaxUint32 {
+		return math.MaxUint32
+	}
+	return uint32(ms)
+}
+
+// BulkOutTimeout sends data to a bulk OUT endpoint, giving up after timeout, to the
+// millisecond. A timeout of 0 waits forever.
+// It returns the number of bytes written and an error if one occurred. A transfer
+// interrupted by a signal fails with unix.EINTR rather than being sent again, as part
+// of data may have gone out already. BulkInTimeout just reads again.
+func (e *OutEndpoint) BulkOutTimeout(data []byte, timeout time.Duration) (int, error) {
+	return e.transferOut("BulkOut", TransferTypeBulk, data, timeout)
 }
 
-// BulkOut sends data to a bulk OUT endpoint.
-// It takes the data to send and a timeout in milliseconds.
-// It returns the number of bytes written and an error if one occurred.
-func (e *OutEndpoint) BulkOut(data []byte, timeoutMs int) (int, error) {
-	if e.i == nil || e.i.d == nil || e.i.d.f == nil {
-		return 0, errors.New("usb: device not open for BulkOut")
+// transferOut runs a synchronous OUT transfer on an endpoint of type typ. usbfs runs
+// those on interrupt endpoints as interrupt transfers.
+func (e *OutEndpoint) transferOut(op string, typ int, data []byte, timeout time.Duration) (int, error) {
+	if e.i == nil || e.i.d == nil {
+		return 0, ErrNotOpen
 	}
 
 	// Check if it's an OUT endpoint (bit 7 of address is 0)
@@ -50,32 +184,48 @@ func (e *OutEndpoint) BulkOut(data []byte, timeoutMs int) (int, error) {
 		return 0, fmt.Errorf("usb: endpoint address %02X is not an OUT endpoint", e.Address)
 	}
 
-	// Check if it's a Bulk endpoint
-	if e.TransferType != TransferTypeBulk {
-		return 0, fmt.Errorf("usb: endpoint address %02X is not a bulk endpoint (type %02X)", e.Address, e.TransferType)
+	if err := e.checkType(typ); err != nil {
+		return 0, err
+	}
+
+	f, err := e.i.d.file()
+	if err != nil {
+		return 0, err
+	}
+	if err := e.checkClaimed(); err != nil {
+		return 0, err
 	}
 
+	e.pace(len(data))
 	bt := gusb.BulkTransfer{
 		Ep:      uint32(e.Address), // Endpoint address including direction
 		Len:     uint32(len(data)),
-		Timeout: uint32(timeoutMs),
+		Timeout: kernelTimeout(timeout),
 		Data:    gusb.SlicePtr(data),
 	}
 
-	n, err := gusb.Ioctl(e.i.d.f, gusb.USBDEVFS_BULK, &bt)
+	start := time.Now()
+	n, err := gusb.Ioctl(f, gusb.USBDEVFS_BULK, &bt)
+	e.i.d.recordLatency(uint8(e.Address), start)
+	e.i.d.recordTransfer(err)
 	if err != nil {
-		return n, fmt.Errorf("usb: BulkOut to ep %02X failed: %w", e.Address, err)
+		return n, fmt.Errorf("usb: %s to ep %02X failed: %w", op, e.Address, err)
 	}
 	return n, nil
 }
 
-// BulkIn receives data from a bulk IN endpoint.
-// It takes a buffer to fill and a timeout in milliseconds.
+// BulkInTimeout receives data from a bulk IN endpoint, giving up after timeout, to
+// the millisecond. A timeout of 0 waits forever.
 // The size of the buffer determines the maximum amount of data to read.
 // It returns the number of bytes read into the buffer and an error if one occurred.
-func (e *InEndpoint) BulkIn(buffer []byte, timeoutMs int) (int, error) {
-	if e.i == nil || e.i.d == nil || e.i.d.f == nil {
-		return 0, errors.New("usb: device not open for BulkIn")
+func (e *InEndpoint) BulkInTimeout(buffer []byte, timeout time.Duration) (int, error) {
+	return e.transferIn("BulkIn", TransferTypeBulk, buffer, timeout)
+}
+
+// transferIn runs a synchronous IN transfer on an endpoint of type typ, see transferOut.
+func (e *InEndpoint) transferIn(op string, typ int, buffer []byte, timeout time.Duration) (int, error) {
+	if e.i == nil || e.i.d == nil {
+		return 0, ErrNotOpen
 	}
 
 	// Check if it's an IN endpoint (bit 7 of address is 1)
@@ -83,25 +233,57 @@ func (e *InEndpoint) BulkIn(buffer []byte, timeoutMs int) (int, error) {
 		return 0, fmt.Errorf("usb: endpoint address %02X is not an IN endpoint", e.Address)
 	}
 
-	// Check if it's a Bulk endpoint
-	if e.TransferType != TransferTypeBulk {
-		return 0, fmt.Errorf("usb: endpoint address %02X is not a bulk endpoint (type %02X)", e.Address, e.TransferType)
+	if err := e.checkType(typ); err != nil {
+		return 0, err
+	}
+
+	f, err := e.i.d.file()
+	if err != nil {
+		return 0, err
+	}
+	if err := e.checkClaimed(); err != nil {
+		return 0, err
+	}
+
+	if err := e.CheckBuffer(buffer); err != nil {
+		e.i.d.logf("WARNING: ep %02X: %v. Use NewBuffer to avoid EOVERFLOW\n", e.Address, err)
 	}
 
 	bt := gusb.BulkTransfer{
 		Ep:      uint32(e.Address), // Endpoint address including direction
 		Len:     uint32(len(buffer)),
-		Timeout: uint32(timeoutMs),
+		Timeout: kernelTimeout(timeout),
 		Data:    gusb.SlicePtr(buffer),
 	}
 
-	n, err := gusb.Ioctl(e.i.d.f, gusb.USBDEVFS_BULK, &bt)
-	if err != nil {
-		return n, fmt.Errorf("usb: BulkIn from ep %02X failed: %w", e.Address, err)
+	start := time.Now()
+	n, err := gusb.Ioctl(f, gusb.USBDEVFS_BULK, &bt)
+	e.i.d.recordLatency(uint8(e.Address), start)
+	e.i.d.recordTransfer(err)
+	if errors.Is(err, unix.EOVERFLOW) {
+		return 0, e.overflow(len(buffer))
+	} else if err != nil {
+		return n, fmt.Errorf("usb: %s from ep %02X failed: %w", op, e.Address, err)
 	}
 	return n, nil
 }
 
+// BulkOut sends data to a bulk OUT endpoint, giving up after timeoutMs milliseconds.
+//
+// Deprecated: use BulkOutTimeout, which takes a time.Duration.
+func (e *OutEndpoint) BulkOut(data []byte, timeoutMs int) (int, error) {
+	return e.BulkOutTimeout(data, time.Duration(timeoutMs)*time.Millisecond)
+}
+
+// BulkIn receives data from a bulk IN endpoint, giving up after timeoutMs milliseconds.
+//
+// Deprecated: use BulkInTimeout, which takes a time.Duration.
+func (e *InEndpoint) BulkIn(buffer []byte, timeoutMs int) (int, error) {
+	return e.BulkInTimeout(buffer, time.Duration(timeoutMs)*time.Millisecond)
+}
+
+// WriteContext sends buf to a bulk OUT endpoint, until ctx is done or the device's
+// Context closes, when the transfer is cancelled.
 func (e *OutEndpoint) WriteContext(ctx context.Context, buf []byte) (int, error) {
 	// Check if the context is already cancelled
 	select {
@@ -112,8 +294,11 @@ func (e *OutEndpoint) WriteContext(ctx context.Context, buf []byte) (int, error)
 	}
 
 	// Check if the device is open
-	if e.i == nil || e.i.d == nil || e.i.d.f == nil {
-		return 0, errors.New("usb: device not open for WriteContext")
+	if e.i == nil || e.i.d == nil {
+		return 0, ErrNotOpen
+	}
+	if _, err := e.i.d.file(); err != nil {
+		return 0, err
 	}
 
 	// Check if it's an OUT endpoint (bit 7 of address is 0)
@@ -126,31 +311,18 @@ func (e *OutEndpoint) WriteContext(ctx context.Context, buf []byte) (int, error)
 		return 0, fmt.Errorf("usb: endpoint address %02X is not a bulk endpoint (type %02X)", e.Address, e.TransferType)
 	}
 
-	// Create a channel to receive the result from the goroutine
-	resultChan := make(chan transferResult)
-
-	// Launch a goroutine to perform the blocking BulkOut operation
-	go func() {
-		n, err := e.BulkOut(buf, 0) // Use a timeout of 0 for non-blocking operation
-		resultChan <- transferResult{n, err}
-	}()
-
-	// Wait for either the context to be cancelled or the transfer to complete
-	select {
-	case <-ctx.Done():
-		// Context cancelled, return the context error
-		return 0, ctx.Err()
-	case result := <-resultChan:
-		// Transfer completed, return the result
-		return result.n, result.err
+	if e.i.d.lowLatency() {
+		return e.inline(ctx, func(timeout time.Duration) (int, error) { return e.BulkOutTimeout(buf, timeout) })
 	}
-}
 
-type transferResult struct {
-	n   int
-	err error
+	// through the async engine, so that cancelling discards the URB before returning,
+	// and nothing is left using buf
+	return e.submitWait(ctx, buf)
 }
 
+// ReadContext reads from a bulk IN endpoint into buf, until ctx is done or the
+// device's Context closes, when the transfer is cancelled: nothing it read is lost
+// to a later read.
 func (e *InEndpoint) ReadContext(ctx context.Context, buf []byte) (int, error) {
 	// Check if the context is already cancelled
 	select {
@@ -161,8 +333,11 @@ func (e *InEndpoint) ReadContext(ctx context.Context, buf []byte) (int, error) {
 	}
 
 	// Check if the device is open
-	if e.i == nil || e.i.d == nil || e.i.d.f == nil {
-		return 0, errors.New("usb: device not open for ReadContext")
+	if e.i == nil || e.i.d == nil {
+		return 0, ErrNotOpen
+	}
+	if _, err := e.i.d.file(); err != nil {
+		return 0, err
 	}
 
 	// Check if it's an IN endpoint (bit 7 of address is 1)
@@ -175,30 +350,23 @@ func (e *InEndpoint) ReadContext(ctx context.Context, buf []byte) (int, error) {
 		return 0, fmt.Errorf("usb: endpoint address %02X is not a bulk endpoint (type %02X)", e.Address, e.TransferType)
 	}
 
-	// Create a channel to receive the result from the goroutine
-	resultChan := make(chan transferResult)
-
-	// Launch a goroutine to perform the blocking BulkIn operation
-	go func() {
-		n, err := e.BulkIn(buf, 0) // Use a timeout of 0 for non-blocking operation
-		resultChan <- transferResult{n, err}
-	}()
-
-	// Wait for either the context to be cancelled or the transfer to complete
-	select {
-	case <-ctx.Done():
-		// Context cancelled, return the context error
-		return 0, ctx.Err()
-	case result := <-resultChan:
-		// Transfer completed, return the result
-		return result.n, result.err
+	if e.i.d.lowLatency() {
+		return e.inline(ctx, func(timeout time.Duration) (int, error) { return e.BulkInTimeout(buf, timeout) })
 	}
-}
 
-func (e *Endpoint) Bulk() {
-	// @todo: This might be a generic bulk transfer or could be deprecated by BulkIn/BulkOut
+	// through the async engine, so that cancelling discards the URB before returning,
+	// and nothing is left using buf
+	return e.submitWait(ctx, buf)
 }
 
-func (e *Endpoint) Interrupt() {
-	// @todo: Implement interrupt transfer
-}
+// Bulk does nothing.
+//
+// Deprecated: use InEndpoint.BulkInTimeout and OutEndpoint.BulkOutTimeout, or
+// ReadContext and WriteContext.
+func (e *Endpoint) Bulk() {}
+
+// Interrupt does nothing.
+//
+// Deprecated: use InEndpoint.InterruptIn and OutEndpoint.InterruptOut, or their
+// Context variants.
+func (e *Endpoint) Interrupt() {}
@@ -0,0 +1,293 @@
+//go:build !usb_core
+
+package usb
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Enumerator tracks the devices matching any of its Matchers, from an initial scan
+// and then as they are plugged and unplugged, handing each to Attach opened, and
+// to Detach once it's gone. The Enumerator closes devices itself. Each scan also
+// updates the Port, Ports and Parent of the devices it tracks.
+type Enumerator struct {
+	Matchers []Matcher // a device is tracked if any matches. None matches everything
+
+	// Attach is called with each newly found device, already opened. An error closes
+	// the device again, and it is not tracked until it is re-plugged.
+	Attach func(*Device) error
+	// Detach is called when a tracked device is unplugged, or Run returns, before it is closed.
+	Detach func(*Device)
+	// Moved is called after Attach when a device reappeared on another port than it was
+	// detached from, as when its cable is moved to another jack, with the port path it
+	// had. Devices are told apart by VID:PID and serial number, so those without a
+	// serial number are never reported moved.
+	Moved func(d *Device, from string)
+	// MoveWindow is how long after a device is unplugged its reappearance elsewhere is
+	// reported to Moved. Defaults to 30s.
+	MoveWindow time.Duration
+	// OnError receives errors opening or attaching devices, and scanning for them.
+	OnError func(error)
+
+	// Context, if set, holds the devices found: they are logged through it, and not
+	// attached while another Context holds them. Run stops when the Context is closed.
+	Context *Context
+
+	// OpenOptions are passed to Device.Open for each new device, e.g. OpenRetry, as
+	// freshly plugged devices are often still being probed.
+	OpenOptions []OpenOption
+
+	// PollInterval is how often to rescan when kernel hotplug events are not available.
+	// Defaults to 2s.
+	PollInterval time.Duration
+
+	mu      sync.Mutex
+	tracked map[string]*Device
+	gone    map[string]goneDevice // recently unplugged, by moveKey
+	rescan  chan struct{}
+}
+
+// goneDevice is where a device was unplugged from, and when.
+type goneDevice struct {
+	port string
+	at   time.Time
+}
+
+// Devices returns the devices currently attached.
+func (e *Enumerator) Devices() []*Device {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	devs := make([]*Device, 0, len(e.tracked))
+	for _, d := range e.tracked {
+		devs = append(devs, d)
+	}
+	return devs
+}
+
+// Rescan makes Run scan for devices again, as soon as it can. Kernel events already
+// trigger scans; this is for changes they don't report, such as a fake device tree
+// changing under Context roots.
+func (e *Enumerator) Rescan() {
+	select {
+	case e.rescanChan() <- struct{}{}:
+	default: // one is already pending
+	}
+}
+
+func (e *Enumerator) rescanChan() chan struct{} {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.rescan == nil {
+		e.rescan = make(chan struct{}, 1)
+	}
+	return e.rescan
+}
+
+// Run scans for devices, and keeps tracking them until ctx is done. Every device still
+// tracked is then detached and closed.
+func (e *Enumerator) Run(ctx context.Context) error {
+	e.mu.Lock()
+	e.tracked = make(map[string]*Device)
+	e.gone = make(map[string]goneDevice)
+	e.mu.Unlock()
+	rescan := e.rescanChan()
+	defer e.detachAll()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if e.Context != nil {
+		defer context.AfterFunc(e.Context, cancel)()
+	}
+
+	events, err := watchUevents(ctx)
+	if err != nil {
+		e.report(fmt.Errorf("usb: hotplug events unavailable, polling instead: %w", err))
+	}
+	interval := e.PollInterval
+	if interval <= 0 {
+		interval = 2 * time.Second
+	}
+	var tick <-chan time.Time
+	if events == nil {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		tick = t.C
+	}
+
+	e.scan(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-tick:
+			e.scan(ctx)
+		case <-rescan:
+			e.scan(ctx)
+		case ev, ok := <-events:
+			if !ok {
+				return ctx.Err()
+			}
+			if ev["DEVTYPE"] != "usb_device" {
+				continue // interface events follow their device's
+			}
+			e.scan(ctx)
+		}
+	}
+}
+
+func (e *Enumerator) matches(d *Device) bool {
+	if len(e.Matchers) == 0 {
+		return true
+	}
+	for _, m := range e.Matchers {
+		if m(d) {
+			return true
+		}
+	}
+	return false
+}
+
+// scan diffs the current device list against what is tracked. A partial list would
+// look like unplugs, so any error skips the scan.
+func (e *Enumerator) scan(ctx context.Context) {
+	list := func() ([]*Device, error) { return listContext(ctx) }
+	if e.Context != nil {
+		list = func() ([]*Device, error) { return e.Context.list(ctx) }
+	}
+	devs, err := list()
+	if err != nil {
+		e.report(err)
+		return
+	}
+	present := make(map[string]*Device, len(devs))
+	for _, d := range devs {
+		present[enumKey(d)] = d
+	}
+
+	now := clock().Now()
+	window := e.MoveWindow
+	if window <= 0 {
+		window = 30 * time.Second
+	}
+	e.mu.Lock()
+	var gone []*Device
+	for k, d := range e.tracked {
+		if p, ok := present[k]; ok {
+			d.refreshTopology(p)
+			continue
+		}
+		gone = append(gone, d)
+		delete(e.tracked, k)
+		if d.Serial != "" {
+			e.gone[moveKey(d)] = goneDevice{port: d.PortPath(), at: now}
+		}
+	}
+	for k, g := range e.gone {
+		if now.Sub(g.at) > window {
+			delete(e.gone, k)
+		}
+	}
+	var added []*Device
+	for k, d := range present {
+		if _, ok := e.tracked[k]; !ok && e.matches(d) {
+			added = append(added, d)
+		}
+	}
+	e.mu.Unlock()
+
+	for _, d := range gone {
+		e.detach(d)
+	}
+	for _, d := range added {
+		if e.Context != nil {
+			if err := e.Context.adopt(d); err != nil {
+				e.report(&DeviceError{Device: d, Err: err})
+				continue
+			}
+		}
+		if err := d.Open(e.OpenOptions...); err != nil {
+			d.Close()
+			e.report(&DeviceError{Device: d, Err: err})
+			continue
+		}
+		if e.Attach != nil {
+			if err := e.Attach(d); err != nil {
+				d.Close()
+				e.report(&DeviceError{Device: d, Err: err})
+				continue
+			}
+		}
+		e.mu.Lock()
+		e.tracked[enumKey(d)] = d
+		g, wasGone := e.gone[moveKey(d)]
+		if d.Serial != "" {
+			delete(e.gone, moveKey(d))
+		}
+		e.mu.Unlock()
+		if wasGone && d.Serial != "" && g.port != d.PortPath() && e.Moved != nil {
+			e.Moved(d, g.port)
+		}
+	}
+}
+
+// refreshTopology updates where d is attached from fresh, a newer listing of the same
+// device: its hub may have been re-enumerated, or the device listed without sysfs.
+func (d *Device) refreshTopology(fresh *Device) {
+	if d == fresh {
+		return
+	}
+	sameParent := (d.Parent == nil) == (fresh.Parent == nil) &&
+		(d.Parent == nil || enumKey(d.Parent) == enumKey(fresh.Parent))
+	if sameParent && d.PortPath() == fresh.PortPath() {
+		return
+	}
+	d.Port, d.Ports, d.Parent = fresh.Port, fresh.Ports, fresh.Parent
+}
+
+// moveKey identifies a device across re-enumeration, when it has a serial number.
+func moveKey(d *Device) string {
+	return fmt.Sprintf("%s:%s:%s", d.Vendor, d.Product, d.Serial)
+}
+
+// drop stops tracking d, detaching and closing it, so the next scan attaches it afresh.
+func (e *Enumerator) drop(d *Device) {
+	e.mu.Lock()
+	k := enumKey(d)
+	mine := e.tracked[k] == d
+	if mine {
+		delete(e.tracked, k)
+	}
+	e.mu.Unlock()
+	if mine {
+		e.detach(d)
+	}
+}
+
+func (e *Enumerator) detach(d *Device) {
+	if e.Detach != nil {
+		e.Detach(d)
+	}
+	d.Close()
+}
+
+func (e *Enumerator) detachAll() {
+	e.mu.Lock()
+	devs := make([]*Device, 0, len(e.tracked))
+	for k, d := range e.tracked {
+		devs = append(devs, d)
+		delete(e.tracked, k)
+	}
+	e.mu.Unlock()
+	for _, d := range devs {
+		e.detach(d)
+	}
+}
+
+func (e *Enumerator) report(err error) {
+	if e.OnError != nil {
+		e.OnError(err)
+	}
+}
@@ -0,0 +1,146 @@
+//go:build !usb_core
+
+package usb_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pzl/usb"
+)
+
+// enumEvent is an Enumerator callback, for tests to wait on.
+type enumEvent struct {
+	kind string // attach, detach or moved
+	dev  *usb.Device
+	from string
+}
+
+// runEnumerator runs e on the fixture tree's roots until the test ends, reporting its
+// callbacks.
+func runEnumerator(t *testing.T, e *usb.Enumerator) <-chan enumEvent {
+	t.Helper()
+	events := make(chan enumEvent, 16)
+	e.Attach = func(d *usb.Device) error { events <- enumEvent{kind: "attach", dev: d}; return nil }
+	e.Detach = func(d *usb.Device) { events <- enumEvent{kind: "detach", dev: d} }
+	e.Moved = func(d *usb.Device, from string) { events <- enumEvent{kind: "moved", dev: d, from: from} }
+	e.OnError = func(err error) { t.Log(err) }
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		e.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return events
+}
+
+func nextEvent(t *testing.T, events <-chan enumEvent, kind string) enumEvent {
+	t.Helper()
+	for {
+		select {
+		case ev := <-events:
+			if ev.kind == kind {
+				return ev
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no %s", kind)
+		}
+	}
+}
+
+func TestEnumeratorMoved(t *testing.T) {
+	tree := fixtureTree(t)
+	ctx := usb.NewContext(usb.WithRoots(tree.Roots))
+	defer ctx.Close()
+	e := &usb.Enumerator{
+		Context:  ctx,
+		Matchers: []usb.Matcher{func(d *usb.Device) bool { return d.Vendor == 0x1234 }},
+	}
+	events := runEnumerator(t, e)
+	if ev := nextEvent(t, events, "attach"); ev.dev.PortPath() != "1-2.3" {
+		t.Fatalf("attached at %s", ev.dev.PortPath())
+	}
+
+	// the unplug and the replug are seen by separate scans
+	w := fixtureWidget()
+	if err := tree.Remove(w); err != nil {
+		t.Fatal(err)
+	}
+	e.Rescan()
+	nextEvent(t, events, "detach")
+	w.Dev, w.Ports = 4, []int{2, 4}
+	if err := tree.Add(w); err != nil {
+		t.Fatal(err)
+	}
+	e.Rescan()
+	ev := nextEvent(t, events, "moved")
+	if ev.from != "1-2.3" || ev.dev.PortPath() != "1-2.4" || ev.dev.Port != 4 {
+		t.Errorf("moved from %s to %s, port %d", ev.from, ev.dev.PortPath(), ev.dev.Port)
+	}
+	if devs := e.Devices(); len(devs) != 1 || devs[0] != ev.dev {
+		t.Errorf("tracking %v", devs)
+	}
+}
+
+func TestHeartbeatReconnect(t *testing.T) {
+	tree := fixtureTree(t)
+	ctx := usb.NewContext(usb.WithRoots(tree.Roots))
+	defer ctx.Close()
+	h := &usb.Handle{
+		Serial:      "W0001",
+		Context:     ctx,
+		OpenOptions: []usb.OpenOption{usb.OpenRetry(1, time.Millisecond)},
+	}
+	runCtx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.Run(runCtx)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+	wait, stop := context.WithTimeout(context.Background(), 5*time.Second)
+	defer stop()
+	if d, err := h.Device(wait); err != nil || d.Device != 3 {
+		t.Fatalf("device: %v, %v", d, err)
+	}
+
+	// the widget wedges and re-enumerates as device 5, with no event to tell
+	w := fixtureWidget()
+	if err := tree.Remove(w); err != nil {
+		t.Fatal(err)
+	}
+	w.Dev = 5
+	if err := tree.Add(w); err != nil {
+		t.Fatal(err)
+	}
+	hb := usb.Heartbeat{
+		Interval:  5 * time.Millisecond,
+		MaxMissed: 2,
+		Beat: func(ctx context.Context, d *usb.Device) error {
+			if d.Device == 3 {
+				return errors.New("no answer")
+			}
+			return nil
+		},
+	}
+	hb.RunHandle(runCtx, h)
+	for {
+		d, err := h.Device(wait)
+		if err != nil {
+			t.Fatalf("not reconnected: %v", err)
+		}
+		if d.Device == 5 {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -13,7 +13,7 @@ func ExampleList() {
 	}
 
 	for _, d := range devices {
-		fmt.Printf("%04x:%04x - %s, %s\n", d.Vendor.ID, d.Product.ID, d.Vendor.Name(), d.Product.Name())
+		fmt.Printf("%s:%s - %s, %s\n", d.Vendor, d.Product, d.VendorName(), d.ProductName())
 	}
 }
 
@@ -50,3 +50,17 @@ func Example() {
 	// @todo this is super ugly
 	dev.ActiveConfig.Interfaces[1].Endpoints[1].CtrlTransfer( /*...*/ )
 }
+
+func ExampleParseVIDPID() {
+	vid, pid, err := usb.ParseVIDPID("1a86:0x7523")
+	if err != nil {
+		//handle
+	}
+	fmt.Println(vid, pid)
+	// Output: 1a86 7523
+}
+
+func ExampleHexdump() {
+	fmt.Print(usb.Hexdump([]byte("\x55\xaa\x00\x01Hello\r\n")))
+	// Output: 0000  55 aa 00 01 48 65 6c 6c  6f 0d 0a                 |U...Hello..|
+}
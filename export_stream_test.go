@@ -0,0 +1,7 @@
+//go:build !usb_core
+
+package usb
+
+// Chunk sizing of stream.go.
+func StreamChunkSize(o StreamOptions, e *Endpoint) int     { return o.chunkSize(e) }
+func ReadChunk(e *Endpoint, buf []byte, left int64) []byte { return e.readChunk(buf, left) }
@@ -0,0 +1,48 @@
+package usb
+
+import "github.com/pzl/usb/x/gusb"
+
+// Setup packets of otg.go, for the tests of package usb_test.
+var (
+	SetupTestMode  = testModeSetup
+	SetupPortTest  = portTestSetup
+	SetupOTGStatus = otgStatusSetup
+)
+
+// DevNodeRoot returns the root SetDevNodeRoot last set.
+func DevNodeRoot() string { return defaultRoots().USBFS }
+
+// DispatchOrder queues n transfers on each endpoint of prios, under MaxInFlight 1, and
+// returns the endpoint addresses in the order they are handed to the kernel as each
+// slot frees up.
+func DispatchOrder(prios map[uint8]EndpointPriority, n int) []uint8 {
+	eng := &asyncEngine{
+		inflight:    make(map[uintptr]*Transfer),
+		maxInFlight: 1,
+		intfFlight:  make(map[int]int),
+		queues:      make(map[uint8]*epQueue),
+	}
+	intf := &Interface{}
+	for addr, p := range prios {
+		eng.setPriority(addr, p)
+		ep := &Endpoint{Address: int(addr), i: intf}
+		for i := 0; i < n; i++ {
+			t := &Transfer{ep: ep}
+			t.urb, _ = gusb.NewURB(0)
+			t.urb.Endpoint = addr
+			eng.enqueue(t)
+		}
+	}
+	var order []uint8
+	for t := eng.next(); t != nil; t = eng.next() {
+		order = append(order, t.urb.Endpoint)
+	}
+	return order
+}
+
+// IsClaimed reports whether interface intf is in the device's claim set.
+func (d *Device) IsClaimed(intf int) bool { return d.isClaimed(intf) }
+
+// SelectAlt makes the interface describe its alternate setting alt, as SetAlt does
+// once the kernel selected it.
+func (i *Interface) SelectAlt(alt int) { i.selectAlt(alt) }
@@ -0,0 +1,113 @@
+package usb
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/pzl/usb/x/gusb"
+	"golang.org/x/sys/unix"
+)
+
+// ErrNoContainerID is returned for devices without a BOS Container ID capability.
+var ErrNoContainerID = errors.New("usb: device has no container ID")
+
+// Fingerprint returns a hash of what the device says about itself: its descriptors,
+// its manufacturer, product and serial strings, and its container ID if it has one.
+// Devices presenting the same VID:PID with different firmware, or a counterfeit
+// presenting a genuine one's, fingerprint differently. It is stable across
+// re-enumeration, and whether or not the device is open.
+//
+// Before Linux 6.6, sysfs has no BOS descriptor, and reading the container ID takes a
+// control request on the device's node. Where that fails, e.g. without write access
+// to the node, the fingerprint is made without the container ID.
+func (d *Device) Fingerprint() (string, error) {
+	raw, err := d.RawDescriptors()
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	field := func(name string, b []byte) {
+		fmt.Fprintf(h, "%s %d\n", name, len(b)) // lengths keep the fields apart
+		h.Write(b)
+	}
+	field("descriptors", raw)
+	field("manufacturer", []byte(d.vendorNameFromDevice))
+	field("product", []byte(d.productNameFromDevice))
+	field("serial", []byte(d.Serial))
+	if id, err := d.ContainerID(); err == nil {
+		field("container", id[:])
+	} else if !errors.Is(err, ErrNoContainerID) {
+		d.logf("INFO: %s: fingerprint without container ID: %v\n", d.PortPath(), err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// ContainerID returns the UUID from the device's BOS Container ID capability, which
+// is unique to the physical device: the USB 2 and 3 halves of a SuperSpeed device
+// share it. Before USB 2.1, devices have no BOS descriptor.
+func (d *Device) ContainerID() ([16]byte, error) {
+	bos, err := d.bos()
+	if err != nil {
+		return [16]byte{}, err
+	}
+	if id, ok := parseContainerID(bos); ok {
+		return id, nil
+	}
+	return [16]byte{}, ErrNoContainerID
+}
+
+// bos returns the device's BOS descriptor and its capabilities: from sysfs where the
+// kernel exposes them (6.6+), else by asking the device.
+func (d *Device) bos() ([]byte, error) {
+	if d.SysPath != "" {
+		if b, err := os.ReadFile(filepath.Join(d.SysPath, "bos_descriptors")); err == nil {
+			return b, nil
+		}
+	}
+	if uint16(d.USBVersion) < 0x0201 {
+		return nil, ErrNoContainerID
+	}
+	buf := make([]byte, 5)
+	err := backingUsbfs{}.withNode(*d, func(f *os.File) error {
+		n, err := gusb.Control(f, gusb.RequestDirIn, gusb.RequestGetDescriptor, uint16(gusb.DTBOS)<<8, 0, buf, usbfsTimeoutMs)
+		if err != nil {
+			return err
+		}
+		if n < 5 {
+			return ErrNoContainerID
+		}
+		buf = make([]byte, binary.LittleEndian.Uint16(buf[2:])) // wTotalLength
+		n, err = gusb.Control(f, gusb.RequestDirIn, gusb.RequestGetDescriptor, uint16(gusb.DTBOS)<<8, 0, buf, usbfsTimeoutMs)
+		buf = buf[:n]
+		return err
+	})
+	if errors.Is(err, unix.EPIPE) {
+		return nil, ErrNoContainerID // the device stalled the request: it has no BOS
+	}
+	return buf, err
+}
+
+// parseContainerID finds the Container ID capability in a BOS descriptor.
+func parseContainerID(bos []byte) (id [16]byte, ok bool) {
+	if len(bos) < 5 || bos[1] != byte(gusb.DTBOS) {
+		return id, false
+	}
+	for off := int(bos[0]); off+3 <= len(bos); {
+		l := int(bos[off])
+		if l < 3 || off+l > len(bos) {
+			break
+		}
+		// CONTAINER_ID capability 0x04: bReserved, then the UUID
+		if bos[off+1] == byte(gusb.DTDeviceCapability) && bos[off+2] == 0x04 && l >= 20 {
+			copy(id[:], bos[off+4:off+20])
+			return id, true
+		}
+		off += l
+	}
+	return id, false
+}
@@ -0,0 +1,63 @@
+package usb_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pzl/usb"
+)
+
+func TestFingerprint(t *testing.T) {
+	tree := fixtureTree(t)
+	widget := func() *usb.Device {
+		devs, err := usb.ListWhere("vendor==1234", usb.ListRoots(tree.Roots))
+		if err != nil || len(devs) != 1 {
+			t.Fatalf("listed %d devices, %v", len(devs), err)
+		}
+		return devs[0]
+	}
+	d := widget()
+	if _, err := d.ContainerID(); !errors.Is(err, usb.ErrNoContainerID) {
+		t.Errorf("container ID of a USB 2.0 device: %v", err)
+	}
+	fp, err := d.Fingerprint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, err := widget().Fingerprint(); err != nil || again != fp {
+		t.Errorf("fingerprint changed across listings: %s, %s, %v", fp, again, err)
+	}
+
+	// a BOS with a USB 2.0 extension, then a container ID
+	uuid := []byte{0: 0xde, 1: 0xad, 15: 0x01}
+	bos := append([]byte{5, 0x0f, 27, 0, 2, 7, 0x10, 0x02, 0x02, 0, 0, 0, 20, 0x10, 0x04, 0}, uuid...)
+	if err := os.WriteFile(filepath.Join(d.SysPath, "bos_descriptors"), bos, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if id, err := d.ContainerID(); err != nil || !bytes.Equal(id[:], uuid) {
+		t.Errorf("container ID % x, %v", id, err)
+	}
+	if other, err := d.Fingerprint(); err != nil || other == fp {
+		t.Errorf("fingerprint ignores the container ID: %s, %v", other, err)
+	}
+
+	// a USB 2.1 device, whose BOS sysfs doesn't show and the node can't be asked for
+	w := fixtureWidget()
+	w.Dev, w.Ports, w.Vendor, w.USBVersion = 4, []int{2, 4}, 0x4321, 0x0210
+	if err := tree.Add(w); err != nil {
+		t.Fatal(err)
+	}
+	devs, err := usb.ListWhere("vendor==4321", usb.ListRoots(tree.Roots))
+	if err != nil || len(devs) != 1 {
+		t.Fatalf("listed %d devices, %v", len(devs), err)
+	}
+	if _, err := devs[0].ContainerID(); err == nil || errors.Is(err, usb.ErrNoContainerID) {
+		t.Errorf("container ID read from a fixture node: %v", err)
+	}
+	if _, err := devs[0].Fingerprint(); err != nil {
+		t.Errorf("fingerprint without a readable BOS: %v", err)
+	}
+}
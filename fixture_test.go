@@ -0,0 +1,301 @@
+package usb_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pzl/usb"
+	"github.com/pzl/usb/usbtest"
+	"github.com/pzl/usb/x/gusb"
+)
+
+// fixtureTree is a root hub on bus 1, with a hub on port 2 and a
+// two-interface vendor device behind the hub's port 3.
+func fixtureTree(t *testing.T) *usbtest.Tree {
+	t.Helper()
+	tree, err := usbtest.NewTree(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	hub := usbtest.RootHub(1)
+	hub.Dev, hub.Ports, hub.Product = 2, []int{2}, 0x0001
+	for _, d := range []usbtest.Device{
+		usbtest.RootHub(1),
+		hub,
+		fixtureWidget(),
+	} {
+		if err := tree.Add(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return tree
+}
+
+// fixtureWidget is the non-hub device of fixtureTree, at 1-2.3.
+func fixtureWidget() usbtest.Device {
+	return usbtest.Device{
+		Bus: 1, Dev: 3, Ports: []int{2, 3},
+		Vendor: 0x1234, Product: 0x5678,
+		Manufacturer: "Acme", ProductName: "Widget", Serial: "W0001",
+		Speed: "12",
+		Configs: []usbtest.Config{{
+			Value: 1,
+			Interfaces: []usbtest.Interface{
+				{Number: 0, Class: 0xff, Endpoints: []usbtest.Endpoint{
+					{Address: 0x81, Attributes: 0x02, MaxPacketSize: 64},
+					{Address: 0x02, Attributes: 0x02, MaxPacketSize: 64},
+				}},
+				{Number: 1, Class: 0x03, Driver: "usbhid", Endpoints: []usbtest.Endpoint{
+					{Address: 0x83, Attributes: 0x03, MaxPacketSize: 8, Interval: 10},
+				}},
+			},
+		}},
+	}
+}
+
+// openWidget lists fixtureTree's widget through a Context with opts, without opening
+// it. Both are closed when the test ends.
+func openWidget(t *testing.T, opts ...usb.ContextOption) (*usb.Context, *usb.Device) {
+	t.Helper()
+	tree := fixtureTree(t)
+	ctx := usb.NewContext(append([]usb.ContextOption{usb.WithRoots(tree.Roots)}, opts...)...)
+	t.Cleanup(func() { ctx.Close() })
+	w, err := ctx.OpenDeviceWithVIDPID(0x1234, 0x5678)
+	if err != nil || w == nil {
+		t.Fatalf("widget: %v, %v", w, err)
+	}
+	t.Cleanup(func() { w.Close() })
+	return ctx, w
+}
+
+// listWidget lists tree's devices with List, and returns fixtureWidget's, failing the
+// test if it isn't there. It is closed when the test ends.
+func listWidget(t *testing.T, tree *usbtest.Tree) *usb.Device {
+	t.Helper()
+	devs, err := usb.List(usb.ListRoots(tree.Roots))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range devs {
+		if d.Vendor == 0x1234 {
+			t.Cleanup(func() { d.Close() })
+			return d
+		}
+	}
+	t.Fatal("widget not listed")
+	return nil
+}
+
+func TestListFixture(t *testing.T) {
+	tree := fixtureTree(t)
+	devs, err := usb.List(usb.ListRoots(tree.Roots))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devs) != 3 {
+		t.Fatalf("listed %d devices, want 3", len(devs))
+	}
+
+	w := listWidget(t, tree)
+	if w.Bus != 1 || w.Device != 3 || w.Serial != "W0001" || w.PortPath() != "1-2.3" {
+		t.Errorf("got bus %d dev %d serial %q path %s", w.Bus, w.Device, w.Serial, w.PortPath())
+	}
+	if w.Speed != usb.SpeedFull {
+		t.Errorf("speed %v, want %v", w.Speed, usb.SpeedFull)
+	}
+	if w.Parent == nil || !w.Parent.IsHub() || w.Parent.Parent == nil || !w.Parent.Parent.IsRootHub() {
+		t.Errorf("parents not resolved: %+v", w.Parent)
+	}
+	if w.ActiveConfig == nil || len(w.ActiveConfig.Interfaces) != 2 {
+		t.Fatalf("active config %+v", w.ActiveConfig)
+	}
+	if eps := w.ActiveConfig.Interfaces[0].Endpoints; len(eps) != 2 || eps[0].Address != 0x81 || eps[1].MaxPacketSize != 64 {
+		t.Errorf("interface 0 endpoints %+v", eps)
+	}
+	intf := w.ActiveConfig.Interfaces[1]
+	if drv, err := intf.GetDriver(); err != nil || drv != "usbhid" {
+		t.Errorf("interface 1 driver %q, %v", drv, err)
+	}
+	if alt, err := w.ActiveAltSetting(1); err != nil || alt != 0 {
+		t.Errorf("interface 1 alt setting %d, %v", alt, err)
+	}
+}
+
+// FuzzSysfsAttrs lists the fixture with garbage in the attributes the library parses.
+func FuzzSysfsAttrs(f *testing.F) {
+	f.Add("12", "3", "1", "1")
+	f.Add("53.3-480", "3", "", "1")
+	f.Add("", "", "", "")
+	f.Add("NaN", "-1", "256", "99999999999999999999")
+	f.Add("-Inf", "0x3", "1 2", "\x00")
+	f.Fuzz(func(t *testing.T, speed, devnum, config, busnum string) {
+		tree := fixtureTree(t)
+		dir := filepath.Join(tree.Roots.SysFS, "1-2.3")
+		for name, v := range map[string]string{"speed": speed, "devnum": devnum, "bConfigurationValue": config, "busnum": busnum} {
+			if err := os.WriteFile(filepath.Join(dir, name), []byte(v), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		devs, err := usb.List(usb.ListRoots(tree.Roots))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(devs) != 3 {
+			t.Fatalf("listed %d devices, want 3", len(devs))
+		}
+		for _, d := range devs {
+			if d.Speed.Mbps() < 0 || d.Speed.Mbps() != d.Speed.Mbps() {
+				t.Errorf("%s: speed %v from %q", d.PortPath(), d.Speed, speed)
+			}
+			if d.Bus < 0 || d.Device < 0 {
+				t.Errorf("%s: bus %d device %d from %q, %q", d.PortPath(), d.Bus, d.Device, busnum, devnum)
+			}
+			if d.ActiveConfig != nil && d.ActiveConfig.Value != 1 {
+				t.Errorf("%s: active config %d from %q", d.PortPath(), d.ActiveConfig.Value, config)
+			}
+		}
+	})
+}
+
+func TestListUnplugRace(t *testing.T) {
+	tree := fixtureTree(t)
+	// the device directory is gone, but not yet its sys/bus/usb/devices link
+	dir, err := filepath.EvalSymlinks(filepath.Join(tree.Roots.SysFS, "1-2.3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	devs, err := usb.List(usb.ListRoots(tree.Roots))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devs) != 2 {
+		t.Errorf("listed %d devices, want the 2 hubs", len(devs))
+	}
+}
+
+func TestVirtualHCD(t *testing.T) {
+	tree := fixtureTree(t)
+	tree.Controllers = map[int]string{2: "dummy_hcd.0"}
+	for _, d := range []usbtest.Device{usbtest.RootHub(2), {Bus: 2, Dev: 2, Ports: []int{1}, Vendor: 0x0525, Product: 0xa4a7}} {
+		if err := tree.Add(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	devs, err := usb.List(usb.ListRoots(tree.Roots))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range devs {
+		if d.Virtual != (d.Bus == 2) {
+			t.Errorf("%s: virtual %v", d.PortPath(), d.Virtual)
+		}
+	}
+	if devs, err := usb.List(usb.ListRoots(tree.Roots), usb.ExcludeVirtual()); err != nil || len(devs) != 3 {
+		t.Errorf("listed %d devices without virtual ones, want 3: %v", len(devs), err)
+	}
+	if devs, err := usb.ListWhere("virtual==true && vendor==0525", usb.ListRoots(tree.Roots)); err != nil || len(devs) != 1 {
+		t.Errorf("matched %d virtual gadgets, %v", len(devs), err)
+	}
+}
+
+func TestContextRootsFixture(t *testing.T) {
+	tree := fixtureTree(t)
+	ctx := usb.NewContext(usb.WithRoots(tree.Roots))
+	defer ctx.Close()
+
+	d, err := ctx.OpenDeviceWithVIDPID(0x1234, 0x5678)
+	if err != nil || d == nil {
+		t.Fatalf("OpenDeviceWithVIDPID: %v, %v", d, err)
+	}
+	defer d.Close()
+	node, err := d.DevNode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := tree.Roots.USBFS + "/001/003"; node != want {
+		t.Errorf("device node %s, want %s", node, want)
+	}
+}
+
+func TestListUsbfsOnly(t *testing.T) {
+	tree := fixtureTree(t)
+	devs, err := usb.List(usb.ListRoots(tree.Roots), usb.UsbfsOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devs) != 3 {
+		t.Fatalf("listed %d devices, want 3", len(devs))
+	}
+	for _, d := range devs {
+		if d.SysPath != "" {
+			t.Errorf("bus %d dev %d: SysPath %q, want none", d.Bus, d.Device, d.SysPath)
+		}
+		if d.Bus == 1 && d.Device == 3 && (d.Vendor != 0x1234 || d.Product != 0x5678) {
+			t.Errorf("device 3 is %04x:%04x, want 1234:5678", uint16(d.Vendor), uint16(d.Product))
+		}
+	}
+}
+
+func TestOpenDevicesErrors(t *testing.T) {
+	tree := fixtureTree(t)
+	// the hub's descriptors are truncated: the other devices still open
+	if err := os.WriteFile(filepath.Join(tree.Roots.SysFS, "1-2", "descriptors"), []byte{18, 1, 0}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	ctx := usb.NewContext(usb.WithRoots(tree.Roots))
+	defer ctx.Close()
+
+	devs, err := ctx.OpenDevices(func(*usb.Device) bool { return true })
+	for _, d := range devs {
+		d.Close()
+	}
+	var we *gusb.WalkError
+	if !errors.As(err, &we) || filepath.Base(we.Path) != "1-2" {
+		t.Errorf("error %v, want a WalkError for 1-2", err)
+	}
+	if len(devs) != 2 {
+		t.Errorf("opened %d devices, want 2", len(devs))
+	}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	devs, err = ctx.OpenDevicesContext(cancelled, func(*usb.Device) bool { return true })
+	if !errors.Is(err, context.Canceled) || len(devs) != 0 {
+		t.Errorf("cancelled: %d devices, %v", len(devs), err)
+	}
+}
+
+func TestListLegacyUsbfs(t *testing.T) {
+	tree := fixtureTree(t)
+	// /proc/bus/usb has a summary file and a drivers list beside the buses
+	for _, name := range []string{"devices", "drivers"} {
+		if err := os.WriteFile(filepath.Join(tree.Roots.USBFS, name), []byte("T:  Bus=01\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tree.Add(usbtest.RootHub(1000)); err != nil {
+		t.Fatal(err)
+	}
+	devs, err := usb.List(usb.ListRoots(tree.Roots), usb.UsbfsOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devs) != 4 {
+		t.Fatalf("listed %d devices, want 4", len(devs))
+	}
+	for _, d := range devs {
+		if d.Bus == 1000 {
+			if p, err := d.DevNode(); err != nil || filepath.Base(filepath.Dir(p)) != "1000" {
+				t.Errorf("bus 1000 node: %q, %v", p, err)
+			}
+			return
+		}
+	}
+	t.Error("no device on bus 1000")
+}
@@ -0,0 +1,466 @@
+//go:build gadget
+
+package usb_test
+
+// Functional tests against a Linux gadget zero (g_zero) device.
+// On a machine with a UDC (or the dummy_hcd module), run:
+//
+//	modprobe dummy_hcd; modprobe g_zero
+//	go test -tags gadget -run Gadget .
+//
+// as a user with write access to the device node and its sysfs bConfigurationValue.
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pzl/usb"
+	"github.com/pzl/usb/ch9test"
+	"github.com/pzl/usb/x/gusb"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	gadgetVID = 0x0525
+	gadgetPID = 0xa4a0
+
+	gadgetSourceSink = 1 // bConfigurationValue of the source/sink function
+	gadgetLoopback   = 2 // bConfigurationValue of the loopback function
+)
+
+func openGadget(t *testing.T, cfg int) (*usb.Device, *usb.OutEndpoint, *usb.InEndpoint) {
+	t.Helper()
+	dev, err := usb.VidPid(gadgetVID, gadgetPID)
+	if err == usb.ErrDeviceNotFound {
+		t.Skip("g_zero gadget not present")
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	if err := dev.Open(); err != nil {
+		t.Fatalf("opening gadget: %v", err)
+	}
+	t.Cleanup(func() { dev.Close() })
+
+	if dev.ActiveConfig == nil || dev.ActiveConfig.Value != cfg {
+		if err := dev.SetConfiguration(cfg); err != nil {
+			t.Skipf("unable to select gadget config %d: %v", cfg, err)
+		}
+	}
+	intf, err := dev.Interface(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := intf.Claim(); err != nil {
+		t.Fatalf("claiming interface: %v", err)
+	}
+	t.Cleanup(func() { intf.Release() })
+
+	out, err := intf.GetOutEndpoint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	in, err := intf.GetInEndpoint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dev, out, in
+}
+
+func TestGadgetSourceSinkBulk(t *testing.T) {
+	_, out, in := openGadget(t, gadgetSourceSink)
+
+	// with the default pattern=0 module param, the sink expects and the source sends zeros
+	if n, err := out.BulkOutTimeout(make([]byte, 4096), time.Second); err != nil || n != 4096 {
+		t.Fatalf("BulkOutTimeout: wrote %d: %v", n, err)
+	}
+	buf := in.NewBuffer(4096)
+	n, err := in.BulkInTimeout(buf, time.Second)
+	if err != nil {
+		t.Fatalf("BulkInTimeout: %v", err)
+	}
+	if !bytes.Equal(buf[:n], make([]byte, n)) {
+		t.Errorf("source sent non-zero data")
+	}
+}
+
+func TestGadgetLoopbackBulk(t *testing.T) {
+	_, out, in := openGadget(t, gadgetLoopback)
+
+	msg := bytes.Repeat([]byte("loopback"), 64)
+	if _, err := out.BulkOutTimeout(msg, time.Second); err != nil {
+		t.Fatalf("BulkOutTimeout: %v", err)
+	}
+	buf := in.NewBuffer(len(msg))
+	n, err := in.BulkInTimeout(buf, time.Second)
+	if err != nil {
+		t.Fatalf("BulkInTimeout: %v", err)
+	}
+	if !bytes.Equal(buf[:n], msg) {
+		t.Errorf("loopback mismatch: sent %d bytes, got %d", len(msg), n)
+	}
+}
+
+func TestGadgetBulkTimeout(t *testing.T) {
+	_, _, in := openGadget(t, gadgetLoopback)
+
+	// nothing was written, so nothing can come back
+	_, err := in.BulkInTimeout(in.NewBuffer(512), 100*time.Millisecond)
+	if !errors.Is(err, unix.ETIMEDOUT) {
+		t.Errorf("expected ETIMEDOUT, got %v", err)
+	}
+}
+
+func TestGadgetReadCancel(t *testing.T) {
+	_, out, in := openGadget(t, gadgetLoopback)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err := in.ReadContext(ctx, in.NewBuffer(512))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+
+	// the cancelled read is gone from the endpoint: the next one gets what comes back
+	msg := []byte("after cancel")
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := out.WriteContext(ctx, msg); err != nil {
+		t.Fatalf("WriteContext: %v", err)
+	}
+	buf := in.NewBuffer(512)
+	n, err := in.ReadContext(ctx, buf)
+	if err != nil || !bytes.Equal(buf[:n], msg) {
+		t.Errorf("ReadContext: got %q, %v", buf[:n], err)
+	}
+}
+
+func TestGadgetStreamCancel(t *testing.T) {
+	_, out, in := openGadget(t, gadgetLoopback)
+
+	// nothing comes back until written, so the stream is cancelled mid-chunk
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := in.ReadStream(ctx, io.Discard, 4096, usb.StreamOptions{NoMmap: true}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+
+	msg := []byte("after stream")
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := out.WriteContext(ctx, msg); err != nil {
+		t.Fatalf("WriteContext: %v", err)
+	}
+	buf := in.NewBuffer(512)
+	n, err := in.ReadContext(ctx, buf)
+	if err != nil || !bytes.Equal(buf[:n], msg) {
+		t.Errorf("ReadContext: got %q, %v", buf[:n], err)
+	}
+}
+
+func TestGadgetLowLatency(t *testing.T) {
+	dev, out, in := openGadget(t, gadgetLoopback)
+	dev.SetLowLatency(true)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := in.ReadContext(ctx, in.NewBuffer(512)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+
+	msg := []byte("ping")
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := out.WriteContext(ctx, msg); err != nil {
+		t.Fatalf("WriteContext: %v", err)
+	}
+	buf := in.NewBuffer(512)
+	n, err := in.ReadContext(ctx, buf)
+	if err != nil || !bytes.Equal(buf[:n], msg) {
+		t.Errorf("ReadContext: got %q, %v", buf[:n], err)
+	}
+}
+
+func TestGadgetSubmitBatch(t *testing.T) {
+	dev, out, in := openGadget(t, gadgetLoopback)
+	dev.SetLatencyTracking(true)
+
+	msgs := [][]byte{[]byte("one"), []byte("two"), []byte("three")}
+	ns, err := out.SubmitBatch(msgs)
+	if err != nil {
+		t.Fatalf("SubmitBatch: %v", err)
+	}
+	for i, n := range ns {
+		if n != len(msgs[i]) {
+			t.Errorf("message %d: sent %d of %d bytes", i, n, len(msgs[i]))
+		}
+	}
+	// latencies run from submission, not from the zero time
+	if l := out.Latency(); l.Count != uint64(len(msgs)) || l.Max > time.Second {
+		t.Errorf("latency of %d transfers, max %v", l.Count, l.Max)
+	}
+	buf := in.NewBuffer(512)
+	n, err := in.BulkInTimeout(buf, time.Second)
+	if err != nil || !bytes.HasPrefix([]byte("onetwothree"), buf[:n]) || n == 0 {
+		t.Errorf("looped back %q, %v", buf[:n], err)
+	}
+}
+
+func TestGadgetEndpointConn(t *testing.T) {
+	_, out, in := openGadget(t, gadgetLoopback)
+	c, err := usb.NewEndpointConn(in, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	c.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, err := c.Read(make([]byte, 16)); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+
+	c.SetDeadline(time.Now().Add(time.Second))
+	msg := bytes.Repeat([]byte("conn"), 128)
+	if _, err := c.Write(msg); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	got := make([]byte, len(msg))
+	if _, err := io.ReadFull(c, got); err != nil || !bytes.Equal(got, msg) {
+		t.Errorf("loopback mismatch: %v", err)
+	}
+}
+
+func TestGadgetClosedTransfer(t *testing.T) {
+	dev, out, _ := openGadget(t, gadgetLoopback)
+
+	dev.Close()
+	if _, err := out.BulkOutTimeout([]byte{0}, 100*time.Millisecond); !errors.Is(err, usb.ErrClosed) {
+		t.Errorf("expected ErrClosed, got %v", err)
+	}
+}
+
+func TestGadgetStatus(t *testing.T) {
+	dev, _, _ := openGadget(t, gadgetSourceSink)
+
+	st, err := dev.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.RemoteWakeup && !dev.SupportsRemoteWakeup() {
+		t.Error("remote wakeup armed on a configuration without it")
+	}
+	if self, err := dev.SelfPowered(); err != nil || self != st.SelfPowered {
+		t.Errorf("SelfPowered: %v, %v, status says %v", self, err, st.SelfPowered)
+	}
+}
+
+func TestGadgetControl(t *testing.T) {
+	dev, _, _ := openGadget(t, gadgetSourceSink)
+
+	// source/sink's vendor requests: 0x5b stores the data stage, 0x5c returns it
+	want := []byte("gadget zero control test")
+	if n, err := dev.Control(gusb.RequestTypeVendor, 0x5b, 0, 0, want, time.Second); err != nil || n != len(want) {
+		t.Fatalf("control write: %d, %v", n, err)
+	}
+	got := make([]byte, len(want))
+	n, err := dev.Control(gusb.RequestDirIn|gusb.RequestTypeVendor, 0x5c, 0, 0, got, time.Second)
+	if err != nil || !bytes.Equal(got[:n], want) {
+		t.Errorf("control read: %q, %v", got[:n], err)
+	}
+}
+
+func TestGadgetInterrupt(t *testing.T) {
+	t.Skip("gadget zero has no interrupt endpoints")
+}
+
+// TestGadgetIsochronous streams the source function's isochronous IN endpoint, in
+// alternate setting 1 of its interface. g_zero has it unless loaded with
+// isoc_maxpacket=0; dummy_hcd can't schedule isochronous transfers.
+func TestGadgetIsochronous(t *testing.T) {
+	dev, _, _ := openGadget(t, gadgetSourceSink)
+	intf, err := dev.Interface(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := intf.SetAlt(1); err != nil {
+		t.Skipf("no isochronous alternate setting: %v", err)
+	}
+	t.Cleanup(func() { intf.SetAlt(0) })
+	snap := intf.Snapshot()
+	if len(snap.IsoIn) == 0 {
+		t.Skip("alternate setting 1 has no isochronous IN endpoint")
+	}
+	in := snap.IsoIn[0]
+
+	s, err := in.StreamIso(usb.IsoStreamOptions{PacketsPerTransfer: 8, Transfers: 4})
+	if errors.Is(err, unix.EINVAL) || errors.Is(err, unix.ENOSPC) {
+		t.Skipf("host controller won't schedule isochronous transfers: %v", err)
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	got := 0
+	timeout := time.After(2 * time.Second)
+	for got < 32 {
+		select {
+		case p, ok := <-s.Packets():
+			if !ok {
+				t.Fatalf("stream ended after %d packets: %v", got, s.Err())
+			}
+			if len(p.Data) > in.MaxISOPacketSize {
+				t.Errorf("packet of %d bytes, max %d", len(p.Data), in.MaxISOPacketSize)
+			}
+			got++
+		case <-timeout:
+			t.Fatalf("received %d packets", got)
+		}
+	}
+	if err := s.Close(); err != nil || s.Err() != nil {
+		t.Errorf("close: %v, %v", err, s.Err())
+	}
+}
+
+func TestGadgetStall(t *testing.T) {
+	dev, _, in := openGadget(t, gadgetSourceSink)
+
+	if _, err := dev.Control(gusb.RequestDirOut|gusb.RequestTypeStandard|gusb.RecipientEndpoint, gusb.RequestSetFeature, gusb.FeatureEndpointHalt, uint16(in.Address), nil, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	buf := in.NewBuffer(1)
+	if _, err := in.BulkInTimeout(buf, time.Second); !errors.Is(err, unix.EPIPE) {
+		t.Fatalf("reading a halted endpoint: %v", err)
+	}
+	if err := in.ClearHalt(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := in.BulkInTimeout(buf, time.Second); err != nil {
+		t.Errorf("reading after clearing the halt: %v", err)
+	}
+}
+
+func TestGadgetChapter9(t *testing.T) {
+	dev, err := usb.VidPid(gadgetVID, gadgetPID)
+	if err == usb.ErrDeviceNotFound {
+		t.Skip("g_zero gadget not present")
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	if err := dev.Open(); err != nil {
+		t.Fatalf("opening gadget: %v", err)
+	}
+	defer dev.Close()
+
+	r := ch9test.Run(dev)
+	var b strings.Builder
+	r.WriteTo(&b)
+	if len(r.Failed()) > 0 {
+		t.Error(b.String())
+	} else {
+		t.Log(b.String())
+	}
+}
+
+// BenchmarkGadgetAsync keeps 64 small transfers in flight on the source endpoint,
+// reporting how many completions each wakeup of the reap loop handles, and the
+// syscalls spent per transfer. A blocking reap per transfer would be 1 and 1.
+func BenchmarkGadgetAsync(b *testing.B) {
+	dev, err := usb.VidPid(gadgetVID, gadgetPID)
+	if err != nil {
+		b.Skip("g_zero gadget not present")
+	}
+	if err := dev.Open(); err != nil {
+		b.Fatal(err)
+	}
+	defer dev.Close()
+	intf, err := dev.Interface(0)
+	if err != nil {
+		b.Fatal(err)
+	}
+	if err := intf.Claim(); err != nil {
+		b.Fatal(err)
+	}
+	defer intf.Release()
+	in, err := intf.GetInEndpoint()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	const depth = 64
+	queue := make(chan *usb.Transfer, depth)
+	submit := func() {
+		t, err := in.Submit(in.NewBuffer(64))
+		if err != nil {
+			b.Fatal(err)
+		}
+		queue <- t
+	}
+	for i := 0; i < depth; i++ {
+		submit()
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		t := <-queue
+		if _, err := t.Wait(context.Background()); err != nil {
+			b.Fatal(err)
+		}
+		submit()
+	}
+	b.StopTimer()
+
+	st := dev.AsyncStats()
+	if st.Wakeups > 0 {
+		b.ReportMetric(float64(st.Completed)/float64(st.Wakeups), "reaped/wakeup")
+	}
+	if st.Completed > 0 {
+		b.ReportMetric(float64(st.Reaps+st.Wakeups)/float64(st.Completed), "syscalls/transfer")
+	}
+}
+
+// BenchmarkGadgetReadStream reads the source endpoint with ReadStream, with the chunk
+// buffer mapped from usbfs, and in ordinary memory, which the kernel copies.
+func BenchmarkGadgetReadStream(b *testing.B) {
+	dev, err := usb.VidPid(gadgetVID, gadgetPID)
+	if err != nil {
+		b.Skip("g_zero gadget not present")
+	}
+	if err := dev.Open(); err != nil {
+		b.Fatal(err)
+	}
+	defer dev.Close()
+	intf, err := dev.Interface(0)
+	if err != nil {
+		b.Fatal(err)
+	}
+	if err := intf.Claim(); err != nil {
+		b.Fatal(err)
+	}
+	defer intf.Release()
+	in, err := intf.GetInEndpoint()
+	if err != nil {
+		b.Fatal(err)
+	}
+	if caps, err := dev.Capabilities(); err != nil || !caps.Has(usb.CapMmap) {
+		b.Logf("kernel lacks usbfs mmap (%v), both runs use ordinary memory", err)
+	}
+
+	const size = 1 << 20
+	for _, mode := range []struct {
+		name   string
+		noMmap bool
+	}{{"mmap", false}, {"copy", true}} {
+		b.Run(mode.name, func(b *testing.B) {
+			b.SetBytes(size)
+			opts := usb.StreamOptions{ChunkSize: 256 * 1024, NoMmap: mode.noMmap}
+			for i := 0; i < b.N; i++ {
+				if _, err := in.ReadStream(context.Background(), io.Discard, size, opts); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -51,6 +51,8 @@ func main() {
 	fmt.Fprintf(w, `// Code generated by usb (gen.go). DO NOT EDIT.
 // It was generated from https://usb-ids.gowdy.us/usb.ids on %s
 
+//go:build !usb_noids
+
 package usb
 
 import (
@@ -1,17 +1,7 @@
 /*
-Package gusb contains lower-level USB interaction. If you want to parse descriptors, send Ioctls manually, or other inspections, use this.
-
-Descriptors
-
-This is generally what you see when running lsusb, especially with the verbose flag. It reads the classification information the USB device provides to describe itself. The second byte of a descriptor header is a type constant. In C those IDs are USB_DT_* constants. In Go, they begin with DT. The struct types themselves are:
-
-	DeviceDescriptor
-	ConfigDescriptor
-	InterfaceDescriptor
-	EndpointDescriptor
-	StringDescriptor
-	DevQualifierDescriptor
-
+Package gusb forwards to github.com/pzl/usb/x/gusb, where the package has moved.
 
+Deprecated: import github.com/pzl/usb/x/gusb instead. This package keeps existing
+imports building until the next major release, but gets none of x/gusb's additions.
 */
 package gusb
@@ -1 +1,333 @@
 package gusb
+
+import (
+	"encoding/binary"
+	"io"
+	"os"
+
+	"github.com/pzl/usb/x/gusb"
+)
+
+// The package's types, constants and functions, forwarded unchanged.
+type (
+	BulkTransfer           = gusb.BulkTransfer
+	ConfigDescriptor       = gusb.ConfigDescriptor
+	ConnectInfo            = gusb.ConnectInfo
+	CtrlTransfer           = gusb.CtrlTransfer
+	DT                     = gusb.DT
+	DescClasses            = gusb.DescClasses
+	DescHeader             = gusb.DescHeader
+	DescriptorRange        = gusb.DescriptorRange
+	DevQualifierDescriptor = gusb.DevQualifierDescriptor
+	DeviceDescriptor       = gusb.DeviceDescriptor
+	DevicePath             = gusb.DevicePath
+	DeviceSpeed            = gusb.DeviceSpeed
+	DisconnectClaim        = gusb.DisconnectClaim
+	DisconnectSignal       = gusb.DisconnectSignal
+	EndpointAddress        = gusb.EndpointAddress
+	EndpointDescriptor     = gusb.EndpointDescriptor
+	EndpointDirection      = gusb.EndpointDirection
+	GetDriverS             = gusb.GetDriverS
+	HubPortinfo            = gusb.HubPortinfo
+	ISOSyncMode            = gusb.ISOSyncMode
+	ISOSyncType            = gusb.ISOSyncType
+	InterfaceDescriptor    = gusb.InterfaceDescriptor
+	IoctlPacket            = gusb.IoctlPacket
+	IoctlRequest           = gusb.IoctlRequest
+	IsoPacketDesc          = gusb.IsoPacketDesc
+	Logger                 = gusb.Logger
+	Roots                  = gusb.Roots
+	SetInterface           = gusb.SetInterface
+	SetupPacket            = gusb.SetupPacket
+	Streams                = gusb.Streams
+	StringDescriptor       = gusb.StringDescriptor
+	TransferType           = gusb.TransferType
+	URB                    = gusb.URB
+	URBType                = gusb.URBType
+	USBClass               = gusb.USBClass
+	USBID                  = gusb.USBID
+	USBProtocolDesc        = gusb.USBProtocolDesc
+	USBSubClass            = gusb.USBSubClass
+	USBVer                 = gusb.USBVer
+	VoidPtr                = gusb.VoidPtr
+	WalkError              = gusb.WalkError
+	WalkFunc               = gusb.WalkFunc
+)
+
+const (
+	AVSubclassAudioStream       = gusb.AVSubclassAudioStream
+	AVSubclassControlIntf       = gusb.AVSubclassControlIntf
+	AVSubclassVideoStream       = gusb.AVSubclassVideoStream
+	CapBulkContinuation         = gusb.CapBulkContinuation
+	CapBulkScatterGather        = gusb.CapBulkScatterGather
+	CapConnInfoEx               = gusb.CapConnInfoEx
+	CapDropPrivileges           = gusb.CapDropPrivileges
+	CapMmap                     = gusb.CapMmap
+	CapNoPacketSizeLim          = gusb.CapNoPacketSizeLim
+	CapReapAfterDisconnect      = gusb.CapReapAfterDisconnect
+	CapSuspend                  = gusb.CapSuspend
+	CapZeroPacket               = gusb.CapZeroPacket
+	DTBOS                       = gusb.DTBOS
+	DTConfig                    = gusb.DTConfig
+	DTCsRadioControl            = gusb.DTCsRadioControl
+	DTDebug                     = gusb.DTDebug
+	DTDevice                    = gusb.DTDevice
+	DTDeviceCapability          = gusb.DTDeviceCapability
+	DTDeviceQualifier           = gusb.DTDeviceQualifier
+	DTEncType                   = gusb.DTEncType
+	DTEndpoint                  = gusb.DTEndpoint
+	DTInterface                 = gusb.DTInterface
+	DTInterfaceAssoc            = gusb.DTInterfaceAssoc
+	DTInterfacePower            = gusb.DTInterfacePower
+	DTKey                       = gusb.DTKey
+	DTOTG                       = gusb.DTOTG
+	DTOtherSpeed                = gusb.DTOtherSpeed
+	DTPipeUsage                 = gusb.DTPipeUsage
+	DTRPipe                     = gusb.DTRPipe
+	DTSSEndpointComp            = gusb.DTSSEndpointComp
+	DTSSPISOCEndpointComp       = gusb.DTSSPISOCEndpointComp
+	DTSecurity                  = gusb.DTSecurity
+	DTString                    = gusb.DTString
+	DTWireAdapter               = gusb.DTWireAdapter
+	DTWirelessEPComp            = gusb.DTWirelessEPComp
+	DescRangeClass              = gusb.DescRangeClass
+	DescRangeGlobal             = gusb.DescRangeGlobal
+	DescRangeReserved           = gusb.DescRangeReserved
+	DescRangeVendor             = gusb.DescRangeVendor
+	DisconnectClaimExceptDriver = gusb.DisconnectClaimExceptDriver
+	DisconnectClaimIfDriver     = gusb.DisconnectClaimIfDriver
+	EndpointDirIN               = gusb.EndpointDirIN
+	EndpointDirOUT              = gusb.EndpointDirOUT
+	EndpointTypeBulk            = gusb.EndpointTypeBulk
+	EndpointTypeBulkStream      = gusb.EndpointTypeBulkStream
+	EndpointTypeControl         = gusb.EndpointTypeControl
+	EndpointTypeInterrupt       = gusb.EndpointTypeInterrupt
+	EndpointTypeIsochronous     = gusb.EndpointTypeIsochronous
+	EnvDebug                    = gusb.EnvDebug
+	EnvDevFSRoot                = gusb.EnvDevFSRoot
+	EnvSysFSRoot                = gusb.EnvSysFSRoot
+	FeatureAAltHNPSupport       = gusb.FeatureAAltHNPSupport
+	FeatureAHNPSupport          = gusb.FeatureAHNPSupport
+	FeatureBHNPEnable           = gusb.FeatureBHNPEnable
+	FeatureDeviceRemoteWakeup   = gusb.FeatureDeviceRemoteWakeup
+	FeatureEndpointHalt         = gusb.FeatureEndpointHalt
+	FeatureFunctionSuspend      = gusb.FeatureFunctionSuspend
+	FeatureLTMEnable            = gusb.FeatureLTMEnable
+	FeaturePortTest             = gusb.FeaturePortTest
+	FeatureTestMode             = gusb.FeatureTestMode
+	FeatureU1Enable             = gusb.FeatureU1Enable
+	FeatureU2Enable             = gusb.FeatureU2Enable
+	HIDBootAsKeyboard           = gusb.HIDBootAsKeyboard
+	HIDBootAsMouse              = gusb.HIDBootAsMouse
+	HIDBootAsNone               = gusb.HIDBootAsNone
+	HIDBootSupportFalse         = gusb.HIDBootSupportFalse
+	HIDBootSupportTrue          = gusb.HIDBootSupportTrue
+	HubProtocolFullSpeed        = gusb.HubProtocolFullSpeed
+	HubProtocolHiSpeed          = gusb.HubProtocolHiSpeed
+	HubProtocolHiSpeedManyTT    = gusb.HubProtocolHiSpeedManyTT
+	ISOSyncTypeAdaptive         = gusb.ISOSyncTypeAdaptive
+	ISOSyncTypeAsync            = gusb.ISOSyncTypeAsync
+	ISOSyncTypeNone             = gusb.ISOSyncTypeNone
+	ISOSyncTypeSync             = gusb.ISOSyncTypeSync
+	ISOUsageData                = gusb.ISOUsageData
+	ISOUsageFeedback            = gusb.ISOUsageFeedback
+	ISOUsageImplicit            = gusb.ISOUsageImplicit
+	LangChinesePRC              = gusb.LangChinesePRC
+	LangChineseTW               = gusb.LangChineseTW
+	LangEnglishUK               = gusb.LangEnglishUK
+	LangEnglishUS               = gusb.LangEnglishUS
+	LangFrench                  = gusb.LangFrench
+	LangGerman                  = gusb.LangGerman
+	LangItalian                 = gusb.LangItalian
+	LangJapanese                = gusb.LangJapanese
+	LangKorean                  = gusb.LangKorean
+	LangSpanish                 = gusb.LangSpanish
+	LegacyUSBFS                 = gusb.LegacyUSBFS
+	MAXDRIVERNAME               = gusb.MAXDRIVERNAME
+	OTGHostRequestFlag          = gusb.OTGHostRequestFlag
+	OTGStatusSelector           = gusb.OTGStatusSelector
+	RecipientDevice             = gusb.RecipientDevice
+	RecipientEndpoint           = gusb.RecipientEndpoint
+	RecipientInterface          = gusb.RecipientInterface
+	RecipientOther              = gusb.RecipientOther
+	RequestClearFeature         = gusb.RequestClearFeature
+	RequestDirIn                = gusb.RequestDirIn
+	RequestDirOut               = gusb.RequestDirOut
+	RequestGetConfiguration     = gusb.RequestGetConfiguration
+	RequestGetDescriptor        = gusb.RequestGetDescriptor
+	RequestGetInterface         = gusb.RequestGetInterface
+	RequestGetStatus            = gusb.RequestGetStatus
+	RequestSetAddress           = gusb.RequestSetAddress
+	RequestSetConfiguration     = gusb.RequestSetConfiguration
+	RequestSetDescriptor        = gusb.RequestSetDescriptor
+	RequestSetFeature           = gusb.RequestSetFeature
+	RequestSetInterface         = gusb.RequestSetInterface
+	RequestSetIsochDelay        = gusb.RequestSetIsochDelay
+	RequestSetSel               = gusb.RequestSetSel
+	RequestSynchFrame           = gusb.RequestSynchFrame
+	RequestTypeClass            = gusb.RequestTypeClass
+	RequestTypeStandard         = gusb.RequestTypeStandard
+	RequestTypeVendor           = gusb.RequestTypeVendor
+	SetupPacketSize             = gusb.SetupPacketSize
+	SpeedFull                   = gusb.SpeedFull
+	SpeedHigh                   = gusb.SpeedHigh
+	SpeedLow                    = gusb.SpeedLow
+	SpeedSuper                  = gusb.SpeedSuper
+	SpeedSuperPlus              = gusb.SpeedSuperPlus
+	SpeedUnknown                = gusb.SpeedUnknown
+	SpeedWireless               = gusb.SpeedWireless
+	SubclassVendorSpecific      = gusb.SubclassVendorSpecific
+	TestForceEnable             = gusb.TestForceEnable
+	TestJ                       = gusb.TestJ
+	TestK                       = gusb.TestK
+	TestPacket                  = gusb.TestPacket
+	TestSE0NAK                  = gusb.TestSE0NAK
+	URBBulkContinuation         = gusb.URBBulkContinuation
+	URBISOASAP                  = gusb.URBISOASAP
+	URBNoFSBR                   = gusb.URBNoFSBR
+	URBNoInterrupt              = gusb.URBNoInterrupt
+	URBShortNotOK               = gusb.URBShortNotOK
+	URBTypeBulk                 = gusb.URBTypeBulk
+	URBTypeControl              = gusb.URBTypeControl
+	URBTypeISO                  = gusb.URBTypeISO
+	URBTypeInterrupt            = gusb.URBTypeInterrupt
+	URBZeroPacket               = gusb.URBZeroPacket
+	USBClassAV                  = gusb.USBClassAV
+	USBClassAppSpecific         = gusb.USBClassAppSpecific
+	USBClassAudio               = gusb.USBClassAudio
+	USBClassBillboard           = gusb.USBClassBillboard
+	USBClassCBridge             = gusb.USBClassCBridge
+	USBClassCDCData             = gusb.USBClassCDCData
+	USBClassCSCId               = gusb.USBClassCSCId
+	USBClassComm                = gusb.USBClassComm
+	USBClassContentSec          = gusb.USBClassContentSec
+	USBClassDiagnostic          = gusb.USBClassDiagnostic
+	USBClassHID                 = gusb.USBClassHID
+	USBClassHealth              = gusb.USBClassHealth
+	USBClassHub                 = gusb.USBClassHub
+	USBClassMassStorage         = gusb.USBClassMassStorage
+	USBClassMisc                = gusb.USBClassMisc
+	USBClassPhysical            = gusb.USBClassPhysical
+	USBClassPrinter             = gusb.USBClassPrinter
+	USBClassSeeInterface        = gusb.USBClassSeeInterface
+	USBClassStillImage          = gusb.USBClassStillImage
+	USBClassVendorSpecific      = gusb.USBClassVendorSpecific
+	USBClassVideo               = gusb.USBClassVideo
+	USBClassWirelessController  = gusb.USBClassWirelessController
+	USBDEVFS_ALLOC_STREAMS      = gusb.USBDEVFS_ALLOC_STREAMS
+	USBDEVFS_BULK               = gusb.USBDEVFS_BULK
+	USBDEVFS_CLAIMINTERFACE     = gusb.USBDEVFS_CLAIMINTERFACE
+	USBDEVFS_CLAIM_PORT         = gusb.USBDEVFS_CLAIM_PORT
+	USBDEVFS_CLEAR_HALT         = gusb.USBDEVFS_CLEAR_HALT
+	USBDEVFS_CONNECT            = gusb.USBDEVFS_CONNECT
+	USBDEVFS_CONNECTINFO        = gusb.USBDEVFS_CONNECTINFO
+	USBDEVFS_CONTROL            = gusb.USBDEVFS_CONTROL
+	USBDEVFS_DISCARDURB         = gusb.USBDEVFS_DISCARDURB
+	USBDEVFS_DISCONNECT         = gusb.USBDEVFS_DISCONNECT
+	USBDEVFS_DISCONNECT_CLAIM   = gusb.USBDEVFS_DISCONNECT_CLAIM
+	USBDEVFS_DISCSIGNAL         = gusb.USBDEVFS_DISCSIGNAL
+	USBDEVFS_DROP_PRIVILEGES    = gusb.USBDEVFS_DROP_PRIVILEGES
+	USBDEVFS_FREE_STREAMS       = gusb.USBDEVFS_FREE_STREAMS
+	USBDEVFS_GETDRIVER          = gusb.USBDEVFS_GETDRIVER
+	USBDEVFS_GET_CAPABILITIES   = gusb.USBDEVFS_GET_CAPABILITIES
+	USBDEVFS_GET_SPEED          = gusb.USBDEVFS_GET_SPEED
+	USBDEVFS_HUB_PORTINFO       = gusb.USBDEVFS_HUB_PORTINFO
+	USBDEVFS_IOCTL              = gusb.USBDEVFS_IOCTL
+	USBDEVFS_REAPURB            = gusb.USBDEVFS_REAPURB
+	USBDEVFS_REAPURBNDELAY      = gusb.USBDEVFS_REAPURBNDELAY
+	USBDEVFS_RELEASEINTERFACE   = gusb.USBDEVFS_RELEASEINTERFACE
+	USBDEVFS_RELEASE_PORT       = gusb.USBDEVFS_RELEASE_PORT
+	USBDEVFS_RESET              = gusb.USBDEVFS_RESET
+	USBDEVFS_RESETEP            = gusb.USBDEVFS_RESETEP
+	USBDEVFS_SETCONFIGURATION   = gusb.USBDEVFS_SETCONFIGURATION
+	USBDEVFS_SETINTERFACE       = gusb.USBDEVFS_SETINTERFACE
+	USBDEVFS_SUBMITURB          = gusb.USBDEVFS_SUBMITURB
+	USBDescTypeHID              = gusb.USBDescTypeHID
+	USBDescTypeHub              = gusb.USBDescTypeHub
+	USBDescTypePhysical         = gusb.USBDescTypePhysical
+	USBDescTypeReport           = gusb.USBDescTypeReport
+)
+
+// DefaultRoots is a copy of x/gusb's DefaultRoots. Assigning to it has no effect on
+// packages using x/gusb, such as package usb: pass usb.WithRoots instead.
+var DefaultRoots = gusb.DefaultRoots
+
+func CheckLayout() error { return gusb.CheckLayout() }
+
+func Claim(f *os.File, ifno int32) error { return gusb.Claim(f, ifno) }
+
+func ClearHalt(f *os.File, ep uint32) error { return gusb.ClearHalt(f, ep) }
+
+func Control(f *os.File, reqType, req uint8, value, index uint16, data []byte, timeoutMs uint32) (int, error) {
+	return gusb.Control(f, reqType, req, value, index, data, timeoutMs)
+}
+
+func ControlSetup(f *os.File, s SetupPacket, data []byte, timeoutMs uint32) (int, error) {
+	return gusb.ControlSetup(f, s, data, timeoutMs)
+}
+
+func DiscardURB(f *os.File, u *URB) error { return gusb.DiscardURB(f, u) }
+
+func DisconnectAndClaim(f *os.File, ifno int32, flags uint32, driver string) error {
+	return gusb.DisconnectAndClaim(f, ifno, flags, driver)
+}
+
+func GetCapabilities(f *os.File) (uint32, error) { return gusb.GetCapabilities(f) }
+
+func GetDriver(f *os.File, ifno int32) (string, error) { return gusb.GetDriver(f, ifno) }
+
+func GetSpeed(f *os.File) (DeviceSpeed, error) { return gusb.GetSpeed(f) }
+
+func HubPorts(f *os.File) ([]int, error) { return gusb.HubPorts(f) }
+
+func Ioctl(f *os.File, ioctl IoctlRequest, data interface{}) (int, error) {
+	return gusb.Ioctl(f, ioctl, data)
+}
+
+func Ioctlnum(read bool, write bool, num uint8, size uint16) uint32 {
+	return gusb.Ioctlnum(read, write, num, size)
+}
+
+func LogEnabled(format string) bool { return gusb.LogEnabled(format) }
+
+func Logf(format string, v ...interface{}) { gusb.Logf(format, v...) }
+
+func NewConfig(b []byte) (ConfigDescriptor, error) { return gusb.NewConfig(b) }
+
+func NewDevQualifier(b []byte) (DevQualifierDescriptor, error) { return gusb.NewDevQualifier(b) }
+
+func NewDevice(b []byte) (DeviceDescriptor, error) { return gusb.NewDevice(b) }
+
+func NewEndpoint(b []byte) (EndpointDescriptor, error) { return gusb.NewEndpoint(b) }
+
+func NewInterface(b []byte) (InterfaceDescriptor, error) { return gusb.NewInterface(b) }
+
+func NewString(b []byte) (StringDescriptor, error) { return gusb.NewString(b) }
+
+func NewURB(numPackets int) (*URB, []IsoPacketDesc) { return gusb.NewURB(numPackets) }
+
+func NodePath(root string, bus, dev int) string { return gusb.NodePath(root, bus, dev) }
+
+func ParseDescriptor(r io.Reader) (DeviceDescriptor, error) { return gusb.ParseDescriptor(r) }
+
+func ParseUsbfsDescriptor(r io.Reader) (DeviceDescriptor, error) { return gusb.ParseUsbfsDescriptor(r) }
+
+func ReapURB(f *os.File, wait bool) (uintptr, error) { return gusb.ReapURB(f, wait) }
+
+func Release(f *os.File, ifno int32) error { return gusb.Release(f, ifno) }
+
+func Reset(f *os.File) error { return gusb.Reset(f) }
+
+func SetAltSetting(f *os.File, ifno int32, alt int32) error { return gusb.SetAltSetting(f, ifno, alt) }
+
+func SetConfiguration(f *os.File, cfg int32) error { return gusb.SetConfiguration(f, cfg) }
+
+func SetLogger(l Logger) { gusb.SetLogger(l) }
+
+func SlicePtr(b []byte) VoidPtr { return gusb.SlicePtr(b) }
+
+func SubmitURB(f *os.File, u *URB) error { return gusb.SubmitURB(f, u) }
+
+func UsbfsToBusOrder(b []byte, host binary.ByteOrder) []byte { return gusb.UsbfsToBusOrder(b, host) }
+
+func Walk(cb WalkFunc) ([]DeviceDescriptor, error) { return gusb.Walk(cb) }
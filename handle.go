@@ -0,0 +1,207 @@
+//go:build !usb_core
+
+package usb
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// ErrDisconnected is returned through a Handle while its device is unplugged
+// or re-enumerating, when the Handle's policy is HandleFail.
+var ErrDisconnected = errors.New("usb: device disconnected")
+
+// HandlePolicy decides what happens to calls made through a Handle while its device is gone.
+type HandlePolicy int
+
+const (
+	HandleWait HandlePolicy = iota // block until the device is back, or the call's ctx is done
+	HandleFail                     // fail at once with ErrDisconnected
+)
+
+// Handle is a device bound by identity rather than by open file: while Run is going,
+// the Handle re-opens its device whenever it comes back after a reset or replug.
+// At least one of Serial or PortPath must be set.
+type Handle struct {
+	Serial   string // serial number to match, if set
+	PortPath string // port path to match (see Device.PortPath), if set
+	Vendor   ID     // vendor to match, if non-zero
+	Product  ID     // product to match, if non-zero
+
+	Policy HandlePolicy
+
+	// OnOpen is called after each (re-)open, to claim interfaces and such.
+	// An error closes the device again until it is next plugged in.
+	OnOpen      func(*Device) error
+	OpenOptions []OpenOption
+	OnError     func(error)
+	// OnMove is called after OnOpen when the device came back on another port, with
+	// the port path it had. It only happens to Handles matching by Serial alone.
+	OnMove func(d *Device, from string)
+	// Context, if set, holds the device, see Enumerator.Context.
+	Context *Context
+
+	mu      sync.Mutex
+	dev     *Device
+	changed chan struct{} // closed and replaced whenever dev changes
+	enum    *Enumerator   // while Run is going
+}
+
+// Run tracks the device until ctx is done, then closes it.
+func (h *Handle) Run(ctx context.Context) error {
+	if h.Serial == "" && h.PortPath == "" {
+		return errors.New("usb: Handle needs a Serial or PortPath")
+	}
+	e := &Enumerator{
+		Matchers:    []Matcher{h.matches},
+		Attach:      h.attach,
+		Detach:      h.detach,
+		OnError:     h.OnError,
+		OpenOptions: h.OpenOptions,
+		Moved:       h.OnMove,
+		Context:     h.Context,
+	}
+	if len(e.OpenOptions) == 0 {
+		e.OpenOptions = []OpenOption{OpenRetry(5, 20*time.Millisecond), WaitUdevSettle(time.Second)}
+	}
+	h.mu.Lock()
+	h.enum = e
+	h.mu.Unlock()
+	defer func() {
+		h.mu.Lock()
+		h.enum = nil
+		h.mu.Unlock()
+	}()
+	return e.Run(ctx)
+}
+
+// Reconnect closes the current device, and has the Handle open it again from a fresh
+// listing: the same device if it kept its address, or the one it re-enumerated as.
+// It does nothing unless Run is going.
+func (h *Handle) Reconnect() {
+	h.mu.Lock()
+	e, d := h.enum, h.dev
+	h.mu.Unlock()
+	if e == nil {
+		return
+	}
+	if d != nil {
+		e.drop(d)
+	}
+	e.Rescan()
+}
+
+// Device returns the currently open device. While there is none it waits, or
+// fails with ErrDisconnected, according to the policy.
+func (h *Handle) Device(ctx context.Context) (*Device, error) {
+	for {
+		h.mu.Lock()
+		d, changed := h.dev, h.changedLocked()
+		h.mu.Unlock()
+		if d != nil {
+			return d, nil
+		}
+		if h.Policy == HandleFail {
+			return nil, ErrDisconnected
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// Do calls fn with the current device. If fn fails because the device went away,
+// then under HandleWait, fn is called again once the device is back.
+func (h *Handle) Do(ctx context.Context, fn func(*Device) error) error {
+	for {
+		d, err := h.Device(ctx)
+		if err != nil {
+			return err
+		}
+		err = fn(d)
+		if !isDisconnect(err) {
+			return err
+		}
+		if h.Policy == HandleFail {
+			return errors.Join(ErrDisconnected, err)
+		}
+		if err := h.waitReplaced(ctx, d); err != nil {
+			return err
+		}
+	}
+}
+
+// waitReplaced waits until the Handle no longer holds d.
+func (h *Handle) waitReplaced(ctx context.Context, d *Device) error {
+	for {
+		h.mu.Lock()
+		cur, changed := h.dev, h.changedLocked()
+		h.mu.Unlock()
+		if cur != d {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+func (h *Handle) matches(d *Device) bool {
+	return (h.Serial == "" || d.Serial == h.Serial) &&
+		(h.PortPath == "" || d.PortPath() == h.PortPath) &&
+		(h.Vendor == 0 || d.Vendor == h.Vendor) &&
+		(h.Product == 0 || d.Product == h.Product)
+}
+
+func (h *Handle) attach(d *Device) error {
+	h.mu.Lock()
+	busy := h.dev != nil
+	h.mu.Unlock()
+	if busy {
+		return errors.New("usb: Handle identity matches more than one device")
+	}
+	if h.OnOpen != nil {
+		if err := h.OnOpen(d); err != nil {
+			return err
+		}
+	}
+	h.set(d)
+	return nil
+}
+
+func (h *Handle) detach(d *Device) {
+	h.mu.Lock()
+	mine := h.dev == d
+	h.mu.Unlock()
+	if mine {
+		h.set(nil)
+	}
+}
+
+func (h *Handle) set(d *Device) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.dev = d
+	close(h.changedLocked())
+	h.changed = make(chan struct{})
+}
+
+func (h *Handle) changedLocked() chan struct{} {
+	if h.changed == nil {
+		h.changed = make(chan struct{})
+	}
+	return h.changed
+}
+
+// isDisconnect reports whether err means the device went away under the call.
+func isDisconnect(err error) bool {
+	return errors.Is(err, unix.ENODEV) || errors.Is(err, unix.ESHUTDOWN) || errors.Is(err, ErrClosed)
+}
@@ -0,0 +1,92 @@
+package usb
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"golang.org/x/sys/unix"
+)
+
+// transferCounters tally transfer outcomes on a device, for Health.
+type transferCounters struct {
+	transfers, protocol, stalls, overflows, timeouts atomic.Uint64
+}
+
+func (c *transferCounters) record(err error) {
+	c.transfers.Add(1)
+	switch {
+	case err == nil:
+	case errors.Is(err, unix.EPROTO), errors.Is(err, unix.EILSEQ), errors.Is(err, unix.ETIME):
+		c.protocol.Add(1)
+	case errors.Is(err, unix.EPIPE):
+		c.stalls.Add(1)
+	case errors.Is(err, unix.EOVERFLOW):
+		c.overflows.Add(1)
+	case errors.Is(err, unix.ETIMEDOUT):
+		c.timeouts.Add(1)
+	}
+}
+
+// Health summarizes signs of a marginal link: the kernel's counters from sysfs,
+// and the outcomes of transfers made through this package since the device was listed.
+// Rising protocol errors usually mean bad cabling or interference.
+type Health struct {
+	URBs        uint64 // URBs submitted to the device, by anyone (sysfs urbnum)
+	OverCurrent int    // over-current events on the upstream hub port
+	PortState   string // link state of the upstream hub port, e.g. "U0", if the kernel reports it
+	ConnectType string // e.g. "hotplug" or "hardwired", if the firmware describes the port
+
+	Transfers      uint64
+	ProtocolErrors uint64 // EPROTO, EILSEQ and ETIME: bit-stuff, CRC and response timeouts
+	Stalls         uint64
+	Overflows      uint64
+	Timeouts       uint64
+}
+
+// ErrorRate is the fraction of transfers that failed with a protocol error.
+func (h Health) ErrorRate() float64 {
+	if h.Transfers == 0 {
+		return 0
+	}
+	return float64(h.ProtocolErrors) / float64(h.Transfers)
+}
+
+// Health returns the device's error counters. sysfs fields the kernel doesn't
+// provide are left zero.
+func (d *Device) Health() Health {
+	var h Health
+	if d.SysPath != "" {
+		h.URBs, _ = strconv.ParseUint(readSysAttr(d.SysPath, "urbnum"), 10, 64)
+		port := filepath.Join(d.SysPath, "port")
+		h.OverCurrent, _ = strconv.Atoi(readSysAttr(port, "over_current_count"))
+		h.PortState = readSysAttr(port, "state")
+		h.ConnectType = readSysAttr(port, "connect_type")
+	}
+	if d.st != nil {
+		c := &d.st.counters
+		h.Transfers = c.transfers.Load()
+		h.ProtocolErrors = c.protocol.Load()
+		h.Stalls = c.stalls.Load()
+		h.Overflows = c.overflows.Load()
+		h.Timeouts = c.timeouts.Load()
+	}
+	return h
+}
+
+func readSysAttr(dir, name string) string {
+	b, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+func (d *Device) recordTransfer(err error) {
+	if d.st != nil {
+		d.st.counters.record(err)
+	}
+}
@@ -0,0 +1,96 @@
+//go:build !usb_core
+
+package usb
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// HeartbeatFailure reports a missed heartbeat.
+type HeartbeatFailure struct {
+	Time   time.Time
+	Missed int // consecutive failures so far, including this one
+	Err    error
+}
+
+// Heartbeat periodically runs a caller-provided operation on a device, such as a status
+// read, to notice a wedged device before real traffic does.
+type Heartbeat struct {
+	Interval time.Duration                              // between beats, default 1s
+	Timeout  time.Duration                              // per beat, default Interval
+	Beat     func(ctx context.Context, d *Device) error // the operation
+
+	// MaxMissed consecutive failures make the heartbeat act: with a Handle, the device
+	// is reset, and the Handle reconnected, see Handle.Reconnect. Default 3.
+	MaxMissed int
+}
+
+// Run beats on d until ctx is done. Failures are sent on the returned channel,
+// which is closed when Run stops; a slow reader misses failures rather than delaying beats.
+func (hb Heartbeat) Run(ctx context.Context, d *Device) <-chan HeartbeatFailure {
+	return hb.run(ctx, func(ctx context.Context) (*Device, error) { return d, nil }, nil)
+}
+
+// RunHandle beats on the Handle's current device until ctx is done. While the device
+// is gone, beats wait for it (or fail, per the Handle's policy). After MaxMissed
+// consecutive failures, the device is reset, and the Handle reconnected: to the same
+// device, or to whatever it re-enumerated as.
+func (hb Heartbeat) RunHandle(ctx context.Context, h *Handle) <-chan HeartbeatFailure {
+	return hb.run(ctx, h.Device, func(d *Device) {
+		d.Reset() // may fail on a wedged device, or re-enumerate it; reconnecting copes with either
+		h.Reconnect()
+	})
+}
+
+func (hb Heartbeat) run(ctx context.Context, device func(context.Context) (*Device, error), onMissed func(*Device)) <-chan HeartbeatFailure {
+	interval, timeout, maxMissed := hb.Interval, hb.Timeout, hb.MaxMissed
+	if interval <= 0 {
+		interval = time.Second
+	}
+	if timeout <= 0 {
+		timeout = interval
+	}
+	if maxMissed <= 0 {
+		maxMissed = 3
+	}
+	failures := make(chan HeartbeatFailure, 1)
+	go func() {
+		defer close(failures)
+		clk := clock()
+		missed := 0
+		for {
+			tick, stop := clk.NewTimer(interval)
+			select {
+			case <-ctx.Done():
+				stop()
+				return
+			case <-tick:
+			}
+			bctx, cancel := context.WithTimeout(ctx, timeout)
+			d, err := device(bctx)
+			if err == nil {
+				err = d.Do(bctx, func(d *Device) error { return hb.Beat(bctx, d) })
+			}
+			cancel()
+			if ctx.Err() != nil {
+				return
+			}
+			if err == nil {
+				missed = 0
+				continue
+			}
+			missed++
+			select {
+			case failures <- HeartbeatFailure{Time: clk.Now(), Missed: missed, Err: fmt.Errorf("usb: heartbeat: %w", err)}:
+			default:
+			}
+			if missed >= maxMissed && onMissed != nil && d != nil {
+				onMissed(d)
+				missed = 0
+			}
+		}
+	}()
+	return failures
+}
@@ -0,0 +1,66 @@
+package usb
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Hexdump formats b 16 bytes to a line: the offset, the bytes in hex, and those
+// that are printable ASCII, as in hexdump -C. It is empty for no bytes.
+//
+//	0000  55 aa 00 01 48 65 6c 6c  6f 0d 0a                 |U...Hello..|
+func Hexdump(b []byte) string {
+	var sb strings.Builder
+	for off := 0; off < len(b); off += 16 {
+		line := b[off:min(off+16, len(b))]
+		fmt.Fprintf(&sb, "%04x ", off)
+		for i := 0; i < 16; i++ {
+			if i == 8 {
+				sb.WriteByte(' ')
+			}
+			if i < len(line) {
+				fmt.Fprintf(&sb, " %02x", line[i])
+			} else {
+				sb.WriteString("   ")
+			}
+		}
+		sb.WriteString("  |")
+		for _, c := range line {
+			if c < 0x20 || c > 0x7e {
+				c = '.'
+			}
+			sb.WriteByte(c)
+		}
+		sb.WriteString("|\n")
+	}
+	return sb.String()
+}
+
+// MaxLoggedPayload is how many bytes of a payload FormatTransfer dumps.
+var MaxLoggedPayload = 256
+
+// FormatTransfer formats a transfer for a log: a heading with the endpoint, its
+// direction, the bytes moved and any error, then the payload's Hexdump, cut short
+// after MaxLoggedPayload bytes.
+//
+//	ep 81 IN 11 bytes
+//	0000  55 aa 00 01 48 65 6c 6c  6f 0d 0a                 |U...Hello..|
+func FormatTransfer(ep int, data []byte, err error) string {
+	dir := "OUT"
+	if ep&0x80 != 0 {
+		dir = "IN"
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "ep %02x %s %d bytes", ep, dir, len(data))
+	if err != nil {
+		fmt.Fprintf(&sb, ": %v", err)
+	}
+	sb.WriteByte('\n')
+	if len(data) > MaxLoggedPayload {
+		sb.WriteString(Hexdump(data[:MaxLoggedPayload]))
+		fmt.Fprintf(&sb, "... %d more bytes\n", len(data)-MaxLoggedPayload)
+	} else {
+		sb.WriteString(Hexdump(data))
+	}
+	return sb.String()
+}
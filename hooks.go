@@ -0,0 +1,75 @@
+package usb
+
+// OpenHook is middleware around Device.Open, for every device of a Context: it runs
+// before the device is opened, and calls next to open it. Work after next returns sees
+// the device open; returning an error without calling next refuses the open. Use it to
+// enforce policy in one place, e.g. logging, allowlists, quirks or autosuspend settings.
+type OpenHook func(d *Device, next func() error) error
+
+// ClaimHook is middleware around Interface.Claim, like OpenHook.
+type ClaimHook func(i *Interface, next func() error) error
+
+// WithOpenHooks adds hooks run around every Open of the Context's devices. Hooks added
+// first run outermost.
+func WithOpenHooks(hooks ...OpenHook) ContextOption {
+	return func(c *Context) { c.openHooks = append(c.openHooks, hooks...) }
+}
+
+// WithClaimHooks adds hooks run around every Claim of the Context's devices' interfaces.
+func WithClaimHooks(hooks ...ClaimHook) ContextOption {
+	return func(c *Context) { c.claimHooks = append(c.claimHooks, hooks...) }
+}
+
+// UseOpenHook adds an open hook to the Context, see WithOpenHooks.
+func (c *Context) UseOpenHook(h OpenHook) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.openHooks = append(c.openHooks, h)
+}
+
+// UseClaimHook adds a claim hook to the Context, see WithClaimHooks.
+func (c *Context) UseClaimHook(h ClaimHook) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.claimHooks = append(c.claimHooks, h)
+}
+
+// context returns the Context the device belongs to, if any.
+func (d *Device) context() *Context {
+	if d.st == nil {
+		return nil
+	}
+	d.st.mu.Lock()
+	defer d.st.mu.Unlock()
+	return d.ctx
+}
+
+func (d *Device) withOpenHooks(open func() error) error {
+	c := d.context()
+	if c == nil {
+		return open()
+	}
+	c.mu.Lock()
+	hooks := c.openHooks
+	c.mu.Unlock()
+	return chainHooks(hooks, d, open)
+}
+
+func (i *Interface) withClaimHooks(claim func() error) error {
+	c := i.d.context()
+	if c == nil {
+		return claim()
+	}
+	c.mu.Lock()
+	hooks := c.claimHooks
+	c.mu.Unlock()
+	return chainHooks(hooks, i, claim)
+}
+
+// chainHooks runs hooks around last, the first outermost.
+func chainHooks[H ~func(T, func() error) error, T any](hooks []H, v T, last func() error) error {
+	if len(hooks) == 0 {
+		return last()
+	}
+	return hooks[0](v, func() error { return chainHooks(hooks[1:], v, last) })
+}
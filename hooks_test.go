@@ -0,0 +1,48 @@
+package usb_test
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/pzl/usb"
+)
+
+func TestOpenHooks(t *testing.T) {
+	tree := fixtureTree(t)
+	var calls []string
+	refuse := errors.New("not on the allowlist")
+	ctx := usb.NewContext(usb.WithRoots(tree.Roots), usb.WithOpenHooks(
+		func(d *usb.Device, next func() error) error {
+			calls = append(calls, "log")
+			return next()
+		},
+		func(d *usb.Device, next func() error) error {
+			if d.Serial != "W0001" {
+				return refuse
+			}
+			err := next()
+			calls = append(calls, fmt.Sprintf("opened %v", err))
+			return err
+		},
+	))
+	defer ctx.Close()
+
+	devs, err := ctx.OpenDevices(func(*usb.Device) bool { return true })
+	if err != nil {
+		t.Fatal(err)
+	}
+	opened := 0
+	for _, d := range devs {
+		if err := d.Open(); err == nil {
+			opened++
+		} else if !errors.Is(err, refuse) {
+			t.Errorf("%s: %v", d.PortPath(), err)
+		}
+		d.Close()
+	}
+	if opened != 1 || len(calls) != 4 || !slices.Contains(calls, "opened <nil>") {
+		t.Errorf("opened %d devices, hooks ran %q", opened, calls)
+	}
+}
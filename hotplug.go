@@ -0,0 +1,67 @@
+//go:build !usb_core
+
+package usb
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// uevent is a kernel hotplug notification, as key=value pairs.
+type uevent map[string]string
+
+// watchUevents sends kernel uevents of the usb subsystem on the returned channel
+// until ctx is done. It fails if the netlink socket can't be opened, e.g. inside a
+// network namespace not receiving kernel events.
+func watchUevents(ctx context.Context) (<-chan uevent, error) {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, unix.NETLINK_KOBJECT_UEVENT)
+	if err != nil {
+		return nil, err
+	}
+	if err := unix.Bind(fd, &unix.SockaddrNetlink{Family: unix.AF_NETLINK, Groups: 1}); err != nil { // 1: kernel events
+		unix.Close(fd)
+		return nil, err
+	}
+	// wake up periodically to notice ctx being done
+	tv := unix.NsecToTimeval((500 * time.Millisecond).Nanoseconds())
+	if err := unix.SetsockoptTimeval(fd, unix.SOL_SOCKET, unix.SO_RCVTIMEO, &tv); err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+
+	events := make(chan uevent, 16)
+	go func() {
+		defer close(events)
+		defer unix.Close(fd)
+		buf := make([]byte, 8192)
+		for ctx.Err() == nil {
+			n, _, err := unix.Recvfrom(fd, buf, 0)
+			if err != nil {
+				continue // timeout, EINTR, or ENOBUFS when we fell behind. Rescanning catches up
+			}
+			ev := parseUevent(buf[:n])
+			if ev["SUBSYSTEM"] != "usb" {
+				continue
+			}
+			select {
+			case events <- ev:
+			case <-ctx.Done():
+			}
+		}
+	}()
+	return events, nil
+}
+
+// parseUevent splits "action@devpath\0KEY=value\0..." into its keys.
+func parseUevent(b []byte) uevent {
+	ev := uevent{}
+	for _, field := range bytes.Split(b, []byte{0}) {
+		if i := bytes.IndexByte(field, '='); i > 0 {
+			ev[string(field[:i])] = string(field[i+1:])
+		}
+	}
+	return ev
+}
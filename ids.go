@@ -3,118 +3,234 @@ package usb
 import (
 	"bufio"
 	"bytes"
-	"encoding/binary"
-	"encoding/hex"
 	"io"
-	"log"
 	"io/ioutil"
 	"os"
+	"sort"
 	"strings"
+	"sync"
 )
 
-var vmap vMap
+// idDB holds the vendor and product names of usb.ids, sorted by ID for binary search.
+// The names are slices of one string, so the tens of thousands of them take a few
+// allocations rather than a map entry and a string each.
+type idDB struct {
+	names    string
+	vendors  []idVendor
+	products []idName // each vendor's run, sorted by ID
+}
+
+type idName struct {
+	id  uint16
+	len uint16
+	off uint32
+}
 
-type vMap map[uint16]_vendor
-type _vendor struct {
-	name     string
-	products map[uint16]string
+type idVendor struct {
+	idName
+	first, last uint32 // products[first:last]
 }
 
-func createIDMap() vMap {
-	m := vMap{}
-	idbuf := make([]byte, 2)
-	lastVID := uint16(0)
+var (
+	idsMu     sync.RWMutex
+	idsLoaded bool
+	ids       *idDB
+)
 
-	usbids := usbIDs()
-	defer usbids.Close()
+// SetIDs replaces the vendor and product names VendorName and ProductName fall back
+// on, which are otherwise loaded from the system's usb.ids, or else the built-in copy,
+// on first use. r is in the usb.ids format. A nil r disables the names altogether,
+// for programs that never display them and would rather not pay for the table.
+func SetIDs(r io.Reader) error {
+	db := &idDB{}
+	if r != nil {
+		var err error
+		if db, err = parseIDs(r); err != nil {
+			return err
+		}
+	}
+	idsMu.Lock()
+	ids, idsLoaded = db, true
+	idsMu.Unlock()
+	return nil
+}
+
+// idTable returns the names, loading them on first use.
+func idTable() *idDB {
+	idsMu.RLock()
+	db, loaded := ids, idsLoaded
+	idsMu.RUnlock()
+	if loaded {
+		return db
+	}
+
+	idsMu.Lock()
+	defer idsMu.Unlock()
+	if !idsLoaded {
+		r := usbIDs()
+		defer r.Close()
+		var err error
+		if ids, err = parseIDs(r); err != nil {
+			logf("INFO: failed reading usb.ids: %v\n", err)
+		}
+		idsLoaded = true
+	}
+	return ids
+}
 
-	scanner := bufio.NewScanner(usbids)
-SCANNER:
+// parseIDs reads the vendors and their products, up to the first other section
+// (device classes). Whatever parsed is returned even on a read error.
+func parseIDs(r io.Reader) (*idDB, error) {
+	var (
+		names strings.Builder
+		db    idDB
+	)
+	name := func(b []byte) idName {
+		b = bytes.TrimSpace(b)
+		if len(b) > 0xffff {
+			b = b[:0xffff]
+		}
+		n := idName{len: uint16(len(b)), off: uint32(names.Len())}
+		names.Write(b)
+		return n
+	}
+
+	scanner := bufio.NewScanner(r)
 	for scanner.Scan() {
 		l := scanner.Bytes()
-
-		if len(l) < 1 {
+		if len(l) == 0 || l[0] == '#' {
 			continue
 		}
-		if l[0] == '#' {
+		if l[0] == '\t' {
+			if len(l) > 1 && l[1] == '\t' {
+				continue // interfaces of a product
+			}
+			id, ok := parseHex4(l[1:])
+			if !ok || len(db.vendors) == 0 {
+				continue
+			}
+			p := name(l[5:])
+			p.id = id
+			db.products = append(db.products, p)
+			db.vendors[len(db.vendors)-1].last = uint32(len(db.products))
 			continue
 		}
+		id, ok := parseHex4(l)
+		if !ok {
+			break // the classes, languages, HID usages... that follow the vendors
+		}
+		v := idVendor{idName: name(l[4:]), first: uint32(len(db.products)), last: uint32(len(db.products))}
+		v.id = id
+		db.vendors = append(db.vendors, v)
+	}
+	db.names = names.String()
+
+	sort.SliceStable(db.vendors, func(i, j int) bool { return db.vendors[i].id < db.vendors[j].id })
+	for _, v := range db.vendors {
+		run := db.products[v.first:v.last]
+		sort.SliceStable(run, func(i, j int) bool { return run[i].id < run[j].id })
+	}
+	return &db, scanner.Err()
+}
 
+func parseHex4(b []byte) (uint16, bool) {
+	if len(b) < 4 {
+		return 0, false
+	}
+	var v uint16
+	for _, c := range b[:4] {
 		switch {
-		case bytes.Equal(l[:2], []byte("C ")): //@todo
-			//@todo
-			break SCANNER
-		case bytes.Equal(l[:2], []byte("R ")): //@todo
-		case bytes.Equal(l[:2], []byte("L ")): //@todo
-		case bytes.Equal(l[:3], []byte("AT ")): //@todo
-		case bytes.Equal(l[:3], []byte("VT ")): //@todo
-		case bytes.Equal(l[:4], []byte("HID ")): //@todo
-		case bytes.Equal(l[:4], []byte("HCC ")): //@todo
-		case bytes.Equal(l[:4], []byte("PHY ")): //@todo
-		case bytes.Equal(l[:4], []byte("HUT ")): //@todo
-		case bytes.Equal(l[:5], []byte("BIAS ")): //@todo
-		case l[0] == '\t' && l[1] != '\t':
-			if lastVID == 0 {
-				continue
-			}
-			if _, err := hex.Decode(idbuf, l[1:5]); err != nil {
-				continue
-			}
-			m[lastVID].products[binary.BigEndian.Uint16(idbuf)] = strings.TrimSpace(string(l[5:]))
-			//single sub-item
-		case l[0] == '\t' && l[1] == '\t':
-			// sub-sub-item
+		case '0' <= c && c <= '9':
+			c -= '0'
+		case 'a' <= c && c <= 'f':
+			c -= 'a' - 10
+		case 'A' <= c && c <= 'F':
+			c -= 'A' - 10
 		default:
-			//vendor ID
-			if _, err := hex.Decode(idbuf, l[:4]); err != nil {
-				log.Printf("INFO: failed parsing line in usb.ids: %s\n", string(l))
-				continue
-			}
-			vid := binary.BigEndian.Uint16(idbuf)
-			m[vid] = _vendor{
-				name:     strings.TrimSpace(string(l[4:])),
-				products: make(map[uint16]string),
-			}
-			lastVID = vid
+			return 0, false
 		}
-
+		v = v<<4 | uint16(c)
 	}
+	return v, true
+}
 
-	return m
+func (db *idDB) str(n idName) string { return db.names[n.off : n.off+uint32(n.len)] }
+
+func (db *idDB) vendor(id uint16) (idVendor, bool) {
+	i := sort.Search(len(db.vendors), func(i int) bool { return db.vendors[i].id >= id })
+	if i < len(db.vendors) && db.vendors[i].id == id {
+		return db.vendors[i], true
+	}
+	return idVendor{}, false
 }
 
 func vendorName(id uint16) string {
-	if vmap == nil {
-		vmap = createIDMap()
-	}
-	if v, exists := vmap[id]; exists {
-		return v.name
+	db := idTable()
+	if v, ok := db.vendor(id); ok {
+		return db.str(v.idName)
 	}
 	return ""
 }
 
 func productName(vid uint16, pid uint16) string {
-	if vmap == nil {
-		vmap = createIDMap()
+	db := idTable()
+	v, ok := db.vendor(vid)
+	if !ok {
+		return ""
 	}
-	if v, exists := vmap[vid]; exists {
-		if p, ex := v.products[pid]; ex {
-			return p
-		}
+	run := db.products[v.first:v.last]
+	i := sort.Search(len(run), func(i int) bool { return run[i].id >= pid })
+	if i < len(run) && run[i].id == pid {
+		return db.str(run[i])
 	}
 	return ""
 }
 
+// Vendors iterates over the vendors of the ID database, see SetIDs, in ID order,
+// e.g. to autocomplete names. It has the shape of an iter.Seq2, for range-over-func:
+//
+//	usb.Vendors()(func(vid usb.ID, name string) bool {
+//		fmt.Println(vid, name)
+//		return true // false stops
+//	})
+func Vendors() func(yield func(ID, string) bool) {
+	return func(yield func(ID, string) bool) {
+		db := idTable()
+		for _, v := range db.vendors {
+			if !yield(ID(v.id), db.str(v.idName)) {
+				return
+			}
+		}
+	}
+}
+
+// ProductsOf iterates over the products of vendor vid in the ID database, in ID
+// order, like Vendors. There are none for unknown vendors.
+func ProductsOf(vid ID) func(yield func(ID, string) bool) {
+	return func(yield func(ID, string) bool) {
+		db := idTable()
+		v, ok := db.vendor(uint16(vid))
+		if !ok {
+			return
+		}
+		for _, p := range db.products[v.first:v.last] {
+			if !yield(ID(p.id), db.str(p)) {
+				return
+			}
+		}
+	}
+}
+
 func usbIDs() (r io.ReadCloser) {
 
 	idPaths := []string{"/usr/share/hwdata/usb.ids", "/usr/share/usb.ids", "/usr/share/libosinfo/usb.ids", "/usr/share/kcmusb/usb.ids", "/var/lib/usbutils/usb.ids"}
 
 	for i := range idPaths {
-		// log.Printf("DEBUG: checking for usb.ids at %s\n", idPaths[i])
+		// logf("DEBUG: checking for usb.ids at %s\n", idPaths[i])
 		if f, err := os.OpenFile(idPaths[i], os.O_RDONLY, 0644); err != nil {
 			continue
 		} else {
-			// log.Printf("DEBUG: success opening %s\n", idPaths[i])
+			// logf("DEBUG: success opening %s\n", idPaths[i])
 			r = f
 			break
 		}
@@ -122,7 +238,7 @@ func usbIDs() (r io.ReadCloser) {
 	if r == nil {
 		// must not have found any usable files in the above paths
 		// use the version we shipped with
-		// log.Println("DEBUG: using built-in usb.ids")
+		// logf("DEBUG: using built-in usb.ids\n")
 		r = ioutil.NopCloser(shippedUsbIds()) // turns the reader into a ReadCloser where Close is a no-op
 	}
 
@@ -0,0 +1,12 @@
+//go:build usb_noids
+
+package usb
+
+import (
+	"io"
+	"strings"
+)
+
+// shippedUsbIds is empty without the built-in database: names come from the
+// system's usb.ids, if there is one.
+func shippedUsbIds() io.Reader { return strings.NewReader("") }
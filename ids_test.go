@@ -0,0 +1,47 @@
+package usb_test
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/pzl/usb"
+)
+
+func TestSetIDs(t *testing.T) {
+	defer usb.SetIDs(nil)
+	ids := "# comment\n1234  Acme Corp.\n\t5678  Widget Pro\n\t\t00  interface\n\t0001  Gizmo\n4321  Other\nC 00  (Defined at Interface level)\n"
+	if err := usb.SetIDs(strings.NewReader(ids)); err != nil {
+		t.Fatal(err)
+	}
+	devs, err := usb.List(usb.ListRoots(fixtureTree(t).Roots))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range devs {
+		if d.Vendor == 0x1234 && (d.VendorName() != "Acme Corp." || d.ProductName() != "Widget Pro") {
+			t.Errorf("names %q %q", d.VendorName(), d.ProductName())
+		}
+	}
+
+	var products []string
+	usb.ProductsOf(0x1234)(func(pid usb.ID, name string) bool {
+		products = append(products, pid.String()+" "+name)
+		return true
+	})
+	if !slices.Equal(products, []string{"0001 Gizmo", "5678 Widget Pro"}) {
+		t.Errorf("products %q", products)
+	}
+	vendors := 0
+	usb.Vendors()(func(usb.ID, string) bool { vendors++; return false })
+	if vendors != 1 {
+		t.Errorf("vendors went on after stopping: %d", vendors)
+	}
+
+	usb.SetIDs(nil) // no database: the device's own strings
+	for _, d := range devs {
+		if d.Vendor == 0x1234 && (d.VendorName() != "Acme" || d.ProductName() != "Widget") {
+			t.Errorf("without ids, names %q %q", d.VendorName(), d.ProductName())
+		}
+	}
+}
@@ -1,30 +1,178 @@
 package usb
 
 import (
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pzl/usb/x/gusb"
+	"golang.org/x/sys/unix"
 )
 
 type Interface struct {
 	ID        int // interface number
 	Alternate int
+	Class     USBClass
+	SubClass  USBSubClass
+	Protocol  USBProtocolDesc
 	Endpoints []Endpoint
 
+	AltSettings []Interface // the interface's other alternate settings, see SetAlt
+
 	d *Device
 	//@todo: isKernelDriverActive -- should it be a `Driver string` property? method? bool?
 }
 
-// Kernel interface release handled automatically
-func (i *Interface) Claim() error { return backingUsbfs{}.claim(*i) }
+// Kernel interface release handled automatically.
+// Detaching the kernel driver of a hub, boot keyboard or mouse, or mounted storage
+// is refused with an UnsafeDetachError, unless the Force option is given.
+// The claim hooks of the device's Context run around it, see ClaimHook.
+// An interface claimed through another handle of the device in this program fails
+// with an AlreadyClaimedError.
+func (i *Interface) Claim(opts ...ClaimOption) error {
+	var o claimOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if err := i.ready(); err != nil {
+		return err
+	}
+	if i.d.ReadOnly() {
+		return ErrReadOnly
+	}
+	fresh, err := i.d.reserveClaim(i.ID)
+	if err != nil {
+		return err
+	}
+	err = i.withClaimHooks(func() error { return i.claim(o) })
+	// a timed-out claim may yet complete, and then be tracked: keep it reserved
+	if err != nil && fresh && !errors.Is(err, ErrOpTimeout) {
+		i.d.dropClaim(i.ID)
+	}
+	return err
+}
+
+// ClaimWithTimeout claims the interface like Claim, retrying for up to d while the
+// claim fails with EBUSY. Just after a device appears, the kernel is still probing
+// drivers for it, and claims fail until that settles.
+func (i *Interface) ClaimWithTimeout(d time.Duration, opts ...ClaimOption) error {
+	clk := clock()
+	deadline := clk.Now().Add(d)
+	for wait := 10 * time.Millisecond; ; wait = min(2*wait, 250*time.Millisecond) {
+		err := i.Claim(opts...)
+		if !errors.Is(err, unix.EBUSY) {
+			return err
+		}
+		left := deadline.Sub(clk.Now())
+		if left <= 0 {
+			return err
+		}
+		clk.Sleep(min(wait, left))
+	}
+}
+
+func (i *Interface) claim(o claimOptions) error {
+	if !o.force {
+		driver, checked, err := i.checkDetach()
+		if err != nil && !o.warn {
+			return err
+		} else if err != nil {
+			i.d.logf("WARNING: %v: detaching anyway\n", err)
+		}
+		if checked && o.driverFlags == 0 && driver != "usbfs" {
+			// detach only what was checked, should another driver bind meanwhile
+			o.driverFlags, o.driver, o.pinned = gusb.DisconnectClaimIfDriver, driver, true
+		}
+	}
+	return i.d.timed(fmt.Sprintf("claim interface %d", i.ID),
+		func() error { return (backingUsbfs{}).claimWith(*i, o) },
+		func() { i.d.trackClaim(i.ID, i.Alternate) })
+}
 
 // Kernel interface re-claim handled automatically
-func (i *Interface) Release() error { return backingUsbfs{}.release(*i) }
+// Transfers still pending on the interface's endpoints are cancelled first. Those of
+// the device's other interfaces carry on.
+func (i *Interface) Release() error {
+	if err := i.ready(); err != nil {
+		return err
+	}
+	i.d.st.mu.Lock()
+	eng := i.d.st.async
+	i.d.st.mu.Unlock()
+	if eng != nil {
+		eng.cancelInterface(i.ID)
+	}
+	return i.d.timed(fmt.Sprintf("release interface %d", i.ID),
+		func() error { return (backingUsbfs{}).release(*i) },
+		func() {
+			i.d.untrackClaim(i.ID)
+			i.d.dropClaim(i.ID)
+		})
+}
 
-func (i *Interface) SetAlt() error {
-	return nil //@todo
+// SetAlt selects an alternate setting of a claimed interface, failing with
+// ErrNotClaimed on one that isn't: usbfs would claim it behind our back.
+// The interface then describes the setting, with its class and Endpoints, and the one
+// it described before moves to AltSettings.
+// If the device has auto re-claim enabled, its re-init hook runs afterwards.
+func (i *Interface) SetAlt(alt int) error {
+	if i.d == nil {
+		return ErrNotOpen
+	}
+	f, err := i.d.file()
+	if err != nil {
+		return err
+	}
+	if !i.d.isClaimed(i.ID) {
+		return fmt.Errorf("usb: setting alternate %d of interface %d: %w", alt, i.ID, ErrNotClaimed)
+	}
+	if err := gusb.SetAltSetting(f, int32(i.ID), int32(alt)); err != nil {
+		return err
+	}
+	i.selectAlt(alt)
+	i.d.trackClaim(i.ID, alt)
+	return i.d.runReinit()
+}
+
+// selectAlt makes i describe its alternate setting alt, swapping it with the one in
+// AltSettings. An interface taken from AltSettings has none, and just takes the number.
+func (i *Interface) selectAlt(alt int) {
+	for k := range i.AltSettings {
+		s := &i.AltSettings[k]
+		if s.Alternate != alt {
+			continue
+		}
+		i.Alternate, s.Alternate = s.Alternate, i.Alternate
+		i.Class, s.Class = s.Class, i.Class
+		i.SubClass, s.SubClass = s.SubClass, i.SubClass
+		i.Protocol, s.Protocol = s.Protocol, i.Protocol
+		i.Endpoints, s.Endpoints = s.Endpoints, i.Endpoints
+		for e := range i.Endpoints {
+			i.Endpoints[e].i = i
+		}
+		for e := range s.Endpoints {
+			s.Endpoints[e].i = s
+		}
+		return
+	}
+	i.Alternate = alt
 }
 
 func (i *Interface) GetDriver() (string, error) {
-	return i.d.dataSource.getDriver(*i.d, i.ID)
+	if err := i.ready(); err != nil {
+		return "", err
+	}
+	var drv string
+	err := i.d.timed(fmt.Sprintf("get driver of interface %d", i.ID), func() (err error) {
+		drv, err = i.d.dataSource.getDriver(*i.d, i.ID)
+		return err
+	}, nil)
+	return drv, err
 }
 
 func (i *Interface) GetOutEndpoint() (*OutEndpoint, error) {
@@ -46,3 +194,102 @@ func (i *Interface) GetInEndpoint() (*InEndpoint, error) {
 	}
 	return nil, fmt.Errorf("usb: no IN endpoint found in interface %d", i.ID)
 }
+
+// ready checks the interface belongs to a listed device, in its active configuration,
+// rather than being built by hand or taken from Configs.
+func (i *Interface) ready() error {
+	if i == nil || i.d == nil || i.d.st == nil {
+		return ErrNotOpen
+	}
+	if i.d.ActiveConfig == nil {
+		return ErrNoActiveConfig
+	}
+	return nil
+}
+
+// sysPath returns the sysfs directory of the interface, e.g. /sys/bus/usb/devices/1-2:1.0
+func (i *Interface) sysPath() (string, error) {
+	if i.d == nil || i.d.SysPath == "" {
+		return "", ErrNotImplemented // only available through sysfs
+	}
+	if i.d.ActiveConfig == nil {
+		return "", ErrNoActiveConfig
+	}
+	return fmt.Sprintf("%s:%d.%d", i.d.SysPath, i.d.ActiveConfig.Value, i.ID), nil
+}
+
+func (i *Interface) readAttr(name string) (string, error) {
+	p, err := i.sysPath()
+	if err != nil {
+		return "", err
+	}
+	data, err := ioutil.ReadFile(filepath.Join(p, name))
+	return strings.TrimSpace(string(data)), err
+}
+
+// ActiveAltSetting returns the alternate setting currently selected on the interface.
+// It is read from sysfs (bAlternateSetting) when available, or else is the setting last
+// selected through this package on a claimed interface, and 0 if none was.
+func (i *Interface) ActiveAltSetting() (int, error) {
+	if v, err := i.readAttr("bAlternateSetting"); err == nil {
+		return strconv.Atoi(v)
+	}
+	if i.d == nil || i.d.st == nil {
+		return 0, ErrNotOpen
+	}
+	i.d.st.mu.Lock()
+	defer i.d.st.mu.Unlock()
+	return i.d.st.claimed[i.ID], nil
+}
+
+// Name returns the interface string descriptor (iInterface), as read by the kernel.
+// It is empty if the interface has none.
+func (i *Interface) Name() (string, error) {
+	name, err := i.readAttr("interface")
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	return name, err
+}
+
+// SupportsAutosuspend reports whether the bound driver allows the interface to autosuspend.
+func (i *Interface) SupportsAutosuspend() (bool, error) {
+	v, err := i.readAttr("supports_autosuspend")
+	return v == "1", err
+}
+
+// DriverModule returns the kernel module providing the bound driver, or an empty
+// string if no driver is bound, or it is built into the kernel.
+func (i *Interface) DriverModule() (string, error) {
+	p, err := i.sysPath()
+	if err != nil {
+		return "", err
+	}
+	mod, err := os.Readlink(filepath.Join(p, "driver", "module"))
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	return filepath.Base(mod), nil
+}
+
+// Authorized reports whether drivers may bind to this interface.
+func (i *Interface) Authorized() (bool, error) {
+	v, err := i.readAttr("authorized")
+	return v == "1", err
+}
+
+// SetAuthorized allows or forbids drivers from binding to this interface. Deauthorizing
+// unbinds any current driver. Requires write access to sysfs, usually root.
+func (i *Interface) SetAuthorized(authorized bool) error {
+	p, err := i.sysPath()
+	if err != nil {
+		return err
+	}
+	v := "0"
+	if authorized {
+		v = "1"
+	}
+	return ioutil.WriteFile(filepath.Join(p, "authorized"), []byte(v), 0200)
+}
@@ -0,0 +1,160 @@
+package usb_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/pzl/usb"
+	"github.com/pzl/usb/usbtest"
+)
+
+// openAltWidget lists a device whose interface 0 has a bulk IN endpoint in alternate
+// setting 0, and an interrupt IN and a bulk OUT endpoint in alternate setting 1, and
+// opens it. Both are closed when the test ends.
+func openAltWidget(t *testing.T) (*usbtest.Tree, *usb.Device) {
+	t.Helper()
+	tree, err := usbtest.NewTree(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range []usbtest.Device{
+		usbtest.RootHub(1),
+		{
+			Bus: 1, Dev: 2, Ports: []int{1},
+			Vendor: 0x1234, Product: 0x9abc,
+			Configs: []usbtest.Config{{
+				Value: 1,
+				Interfaces: []usbtest.Interface{
+					{Number: 0, Class: 0xff, Endpoints: []usbtest.Endpoint{
+						{Address: 0x81, Attributes: 0x02, MaxPacketSize: 512},
+					}},
+					{Number: 0, Alternate: 1, Class: 0xff, Protocol: 1, Endpoints: []usbtest.Endpoint{
+						{Address: 0x81, Attributes: 0x03, MaxPacketSize: 64, Interval: 4},
+						{Address: 0x02, Attributes: 0x02, MaxPacketSize: 512},
+					}},
+				},
+			}},
+		},
+	} {
+		if err := tree.Add(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx := usb.NewContext(usb.WithRoots(tree.Roots))
+	t.Cleanup(func() { ctx.Close() })
+	w, err := ctx.OpenDeviceWithVIDPID(0x1234, 0x9abc)
+	if err != nil || w == nil {
+		t.Fatalf("device: %v, %v", w, err)
+	}
+	t.Cleanup(func() { w.Close() })
+	if err := w.Open(); err != nil {
+		t.Fatal(err)
+	}
+	return tree, w
+}
+
+func TestSetAltUnclaimed(t *testing.T) {
+	_, w := openAltWidget(t)
+	intf, err := w.InterfaceByNumber(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := intf.SetAlt(1); !errors.Is(err, usb.ErrNotClaimed) {
+		t.Errorf("SetAlt on an unclaimed interface: %v", err)
+	}
+	if w.IsClaimed(0) {
+		t.Error("SetAlt left the interface to be re-claimed")
+	}
+	if intf.Alternate != 0 || len(intf.Endpoints) != 1 {
+		t.Errorf("interface describes alternate %d, with %d endpoints", intf.Alternate, len(intf.Endpoints))
+	}
+}
+
+func TestSelectAlt(t *testing.T) {
+	_, w := openAltWidget(t)
+	intf, err := w.InterfaceByNumber(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	intf.SelectAlt(1)
+	if intf.Alternate != 1 || intf.Protocol != 1 || len(intf.Endpoints) != 2 || intf.Endpoints[0].TransferType != usb.TransferTypeInterrupt {
+		t.Errorf("alternate 1: %+v", intf)
+	}
+	if len(intf.AltSettings) != 1 || intf.AltSettings[0].Alternate != 0 || len(intf.AltSettings[0].Endpoints) != 1 {
+		t.Errorf("other settings: %+v", intf.AltSettings)
+	}
+	if _, err := intf.GetOutEndpoint(); err != nil {
+		t.Errorf("alternate 1 OUT endpoint: %v", err)
+	}
+
+	intf.SelectAlt(0)
+	if intf.Alternate != 0 || len(intf.Endpoints) != 1 || intf.Endpoints[0].TransferType != usb.TransferTypeBulk {
+		t.Errorf("back to alternate 0: %+v", intf)
+	}
+	if _, err := intf.GetOutEndpoint(); err == nil {
+		t.Error("alternate 0 has an OUT endpoint")
+	}
+}
+
+func TestEndpointAltSetting(t *testing.T) {
+	tree, w := openAltWidget(t)
+	if _, err := w.Endpoint(0x02); err == nil {
+		t.Error("found an endpoint of alternate setting 1 in alternate setting 0")
+	}
+	if ep, err := w.Endpoint(0x81); err != nil || ep.TransferType != usb.TransferTypeBulk {
+		t.Errorf("alternate 0 endpoint 81: %+v, %v", ep, err)
+	}
+
+	// another program selected alternate setting 1
+	attr := filepath.Join(tree.Roots.SysFS, "1-1:1.0", "bAlternateSetting")
+	if err := os.WriteFile(attr, []byte(" 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if ep, err := w.Endpoint(0x81); err != nil || ep.TransferType != usb.TransferTypeInterrupt {
+		t.Errorf("alternate 1 endpoint 81: %+v, %v", ep, err)
+	}
+	if _, err := w.Endpoint(0x02); err != nil {
+		t.Errorf("alternate 1 endpoint 02: %v", err)
+	}
+	if snap := w.ActiveConfig.Interfaces[0].Snapshot(); snap.Alternate != 1 || len(snap.BulkOut) != 1 {
+		t.Errorf("snapshot of alternate 1: %+v", snap)
+	}
+}
+
+func TestClaimWithTimeoutFakeClock(t *testing.T) {
+	clk := usbtest.NewClock(time.Time{})
+	usb.SetClock(clk)
+	defer usb.SetClock(nil)
+
+	// the kernel is still probing: the first two claims fail with EBUSY
+	busy := 2
+	_, w := openWidget(t, usb.WithClaimHooks(func(*usb.Interface, func() error) error {
+		if busy > 0 {
+			busy--
+			return syscall.EBUSY
+		}
+		return nil
+	}))
+
+	done := make(chan error, 1)
+	go func() { done <- w.ActiveConfig.Interfaces[0].ClaimWithTimeout(time.Second) }()
+	for _, wait := range []time.Duration{10 * time.Millisecond, 20 * time.Millisecond} {
+		clk.BlockUntil(1)
+		select {
+		case err := <-done:
+			t.Fatalf("claim returned while backing off: %v", err)
+		default:
+		}
+		clk.Advance(wait)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if busy != 0 {
+		t.Errorf("%d busy claims left", busy)
+	}
+}
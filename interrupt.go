@@ -0,0 +1,76 @@
+package usb
+
+import (
+	"context"
+	"time"
+)
+
+// Interrupt transfers go out at the polling interval of the endpoint's bInterval: the
+// host controller visits the endpoint once per PollInterval, and a transfer completes
+// at one of those visits. Reading in a loop, with a transfer pending most of the time,
+// misses none of the reports a HID or sensor device sends.
+
+// InterruptIn reads one interrupt transfer from an interrupt IN endpoint, giving up
+// after timeout, to the millisecond. A timeout of 0 waits forever. Size buf with
+// NewBuffer: a report longer than buf fails with an OverflowError.
+func (e *InEndpoint) InterruptIn(buf []byte, timeout time.Duration) (int, error) {
+	return e.transferIn("InterruptIn", TransferTypeInterrupt, buf, timeout)
+}
+
+// InterruptOut sends data to an interrupt OUT endpoint, giving up after timeout, like
+// BulkOutTimeout.
+func (e *OutEndpoint) InterruptOut(data []byte, timeout time.Duration) (int, error) {
+	return e.transferOut("InterruptOut", TransferTypeInterrupt, data, timeout)
+}
+
+// InterruptInContext is InterruptIn, bounded by ctx rather than a timeout. The
+// transfer is cancelled when ctx is done, and nothing it read is lost to a later read.
+func (e *InEndpoint) InterruptInContext(ctx context.Context, buf []byte) (int, error) {
+	if err := e.checkType(TransferTypeInterrupt); err != nil {
+		return 0, err
+	}
+	return e.submitWait(ctx, buf)
+}
+
+// InterruptOutContext is InterruptOut, bounded by ctx rather than a timeout.
+func (e *OutEndpoint) InterruptOutContext(ctx context.Context, data []byte) (int, error) {
+	if err := e.checkType(TransferTypeInterrupt); err != nil {
+		return 0, err
+	}
+	return e.submitWait(ctx, data)
+}
+
+// PollInterval is how often the host polls an interrupt endpoint, from its bInterval
+// and the device's speed: bInterval frames of 1ms at full and low speed, or
+// 2^(bInterval-1) microframes of 125µs at high speed and above. It is 0 for other
+// endpoint types.
+func (e *Endpoint) PollInterval() time.Duration {
+	if e.TransferType != TransferTypeInterrupt {
+		return 0
+	}
+	var speed Speed
+	if e.i != nil && e.i.d != nil {
+		speed = e.i.d.Speed
+	}
+	if speed.AtLeast(SpeedHigh) {
+		return e.period(speed)
+	}
+	return time.Duration(max(e.Interval, 1)) * time.Millisecond
+}
+
+// period is the time between packets of a periodic endpoint: 2^(bInterval-1)
+// frames of 1ms at full and low speed, or microframes of 125µs at high speed and above.
+func (e *Endpoint) period(speed Speed) time.Duration {
+	unit := time.Millisecond
+	if speed.AtLeast(SpeedHigh) {
+		unit = 125 * time.Microsecond
+	}
+	interval := e.Interval
+	if interval < 1 {
+		interval = 1
+	}
+	if interval > 16 {
+		interval = 16
+	}
+	return unit << uint(interval-1)
+}
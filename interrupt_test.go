@@ -0,0 +1,36 @@
+package usb_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pzl/usb"
+)
+
+func TestInterruptEndpoint(t *testing.T) {
+	_, w := openWidget(t)
+	intr, err := w.Endpoint(0x83)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := intr.PollInterval(); got != 10*time.Millisecond {
+		t.Errorf("full speed bInterval 10 polls every %v, want 10ms", got)
+	}
+	w.Speed = usb.SpeedHigh
+	if got := intr.PollInterval(); got != 64*time.Millisecond {
+		t.Errorf("high speed bInterval 10 polls every %v, want 64ms", got)
+	}
+
+	bulk, err := w.Endpoint(0x81)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bulk.PollInterval() != 0 {
+		t.Errorf("bulk endpoint polls every %v", bulk.PollInterval())
+	}
+	in := &usb.InEndpoint{Endpoint: *bulk}
+	if _, err := in.InterruptIn(make([]byte, 64), time.Second); err == nil || !strings.Contains(err.Error(), "not an interrupt endpoint") {
+		t.Errorf("interrupt read of a bulk endpoint: %v", err)
+	}
+}
@@ -0,0 +1,290 @@
+//go:build !usb_core
+
+package usb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pzl/usb/x/gusb"
+	"golang.org/x/sys/unix"
+)
+
+// IsoPacket is one packet received from an isochronous IN stream.
+type IsoPacket struct {
+	Data  []byte
+	Err   error     // per-packet status, e.g. a CRC or missed-frame error
+	Frame int       // host controller (micro)frame the packet was scheduled in
+	Time  time.Time // estimated arrival: the URB completion time, less the packets after it
+}
+
+// IsoStreamOptions size an isochronous stream. Zero values pick the defaults.
+type IsoStreamOptions struct {
+	PacketsPerTransfer int // packets per URB, default 8
+	Transfers          int // URBs kept in flight, default the endpoint's Buffers.QueueDepth
+	Buffer             int // packets queued for the reader, default 64. Further packets are dropped
+
+	// StartFrame schedules the first URB at this (micro)frame, see Device.FrameNumber.
+	// Zero starts as soon as possible. Later URBs always follow on ASAP.
+	StartFrame int
+}
+
+// IsoStream continuously receives an isochronous IN endpoint, keeping several URBs
+// in flight so no (micro)frame goes unserviced. Their buffers come from Device.AllocBuffer.
+type IsoStream struct {
+	ep      *InEndpoint
+	opts    IsoStreamOptions
+	pktSize int
+	period  time.Duration
+
+	packets chan IsoPacket
+	ctx     context.Context // done once Close is called, to end a tuning wait
+	closing context.CancelFunc
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+	dropped atomic.Uint64
+	err     error
+}
+
+// StreamIso starts receiving the isochronous IN endpoint, which must be in the
+// active alternate setting of a claimed interface.
+func (e *InEndpoint) StreamIso(opts IsoStreamOptions) (*IsoStream, error) {
+	if e.TransferType != int(gusb.EndpointTypeIsochronous) {
+		return nil, fmt.Errorf("usb: endpoint address %02X is not an isochronous endpoint (type %02X)", e.Address, e.TransferType)
+	}
+	if (e.Address & 0x80) == 0 {
+		return nil, fmt.Errorf("usb: endpoint address %02X is not an IN endpoint", e.Address)
+	}
+	if e.i == nil || e.i.d == nil {
+		return nil, ErrNotOpen
+	}
+	if opts.PacketsPerTransfer < 1 {
+		opts.PacketsPerTransfer = 8
+	}
+	if opts.Transfers < 1 {
+		opts.Transfers = e.Buffers().QueueDepth
+	}
+	if opts.Buffer < 1 {
+		opts.Buffer = 64
+	}
+
+	s := &IsoStream{
+		ep:      e,
+		opts:    opts,
+		pktSize: e.MaxISOPacketSize,
+		period:  e.period(e.i.d.Speed),
+		packets: make(chan IsoPacket, opts.Buffer),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	s.ctx, s.closing = context.WithCancel(context.Background())
+	ring := make([]*Transfer, opts.Transfers)
+	for i := range ring {
+		start := 0
+		if i == 0 {
+			start = opts.StartFrame
+		}
+		buf, err := e.i.d.AllocBuffer(s.pktSize * opts.PacketsPerTransfer)
+		if err != nil {
+			s.cancel(ring[:i])
+			return nil, err
+		}
+		t, err := s.submit(buf, start)
+		if err != nil {
+			e.i.d.FreeBuffer(buf)
+			s.cancel(ring[:i])
+			s.closing()
+			return nil, err
+		}
+		ring[i] = t
+	}
+	go s.run(ring)
+	return s, nil
+}
+
+// Packets returns the received packets. It is closed when the stream ends.
+func (s *IsoStream) Packets() <-chan IsoPacket { return s.packets }
+
+// Dropped returns how many packets were discarded because the reader fell behind.
+func (s *IsoStream) Dropped() uint64 { return s.dropped.Load() }
+
+// Err returns what ended the stream, once Packets is closed. It is nil after Close.
+func (s *IsoStream) Err() error {
+	<-s.done
+	return s.err
+}
+
+// Close stops the stream, cancelling the URBs in flight.
+func (s *IsoStream) Close() error {
+	s.once.Do(func() {
+		s.closing()
+		close(s.stop)
+	})
+	<-s.done
+	return nil
+}
+
+// submit schedules an URB at the start frame, or as soon as possible if it's zero. The
+// endpoint's tuning applies, as to Submit.
+func (s *IsoStream) submit(buf []byte, start int) (*Transfer, error) {
+	flags, err := s.ep.tuning(s.ctx)
+	if err != nil {
+		return nil, err
+	}
+	t, err := s.ep.newTransfer(gusb.URBTypeISO, buf, s.opts.PacketsPerTransfer)
+	if err != nil {
+		return nil, err
+	}
+	t.urb.Flags |= uint32(flags)
+	if start == 0 {
+		t.urb.Flags |= gusb.URBISOASAP
+	} else {
+		t.urb.StartFrame = int32(start)
+	}
+	for i := range t.iso {
+		t.iso[i].Length = uint32(s.pktSize)
+	}
+	return t, t.eng.submit(t)
+}
+
+// cancel stops transfers that didn't make it into a running stream, and frees their buffers.
+func (s *IsoStream) cancel(ring []*Transfer) {
+	for _, t := range ring {
+		t.Cancel()
+		<-t.Done()
+		s.ep.i.d.FreeBuffer(t.buf)
+	}
+}
+
+func (s *IsoStream) run(ring []*Transfer) {
+	defer close(s.done)
+	defer close(s.packets)
+	defer func() {
+		for _, t := range ring {
+			s.ep.i.d.FreeBuffer(t.buf) // every transfer is done by now
+		}
+	}()
+	for i := 0; ; i = (i + 1) % len(ring) {
+		t := ring[i]
+		select {
+		case <-t.Done():
+		case <-s.stop:
+			for _, t := range ring {
+				t.Cancel()
+				<-t.Done()
+			}
+			return
+		}
+		if t.err != nil && !errors.Is(t.err, ErrTransferCanceled) {
+			s.err = t.err
+			for _, t := range ring {
+				t.Cancel()
+				<-t.Done()
+			}
+			return
+		}
+		s.deliver(t)
+
+		next, err := s.submit(t.buf, 0)
+		if err != nil {
+			if s.ctx.Err() == nil {
+				s.err = err // not just closed while waiting out the tuning
+			}
+			for j, t := range ring {
+				if j != i {
+					t.Cancel()
+					<-t.Done()
+				}
+			}
+			return
+		}
+		ring[i] = next
+	}
+}
+
+// deliver splits a completed URB into packets, stamped relative to its completion.
+func (s *IsoStream) deliver(t *Transfer) {
+	n := len(t.iso)
+	for k, desc := range t.iso {
+		p := IsoPacket{
+			Data:  append([]byte(nil), t.buf[k*s.pktSize:k*s.pktSize+int(desc.ActualLength)]...),
+			Frame: t.StartFrame() + k,
+			Time:  t.completedAt.Add(-time.Duration(n-1-k) * s.period),
+		}
+		if status := int32(desc.Status); status != 0 {
+			p.Err = &URBStatusError{Endpoint: s.ep.Address, Errno: unix.Errno(-status)}
+		}
+		select {
+		case s.packets <- p:
+		default:
+			s.dropped.Add(1)
+		}
+	}
+}
+
+// JitterBuffer re-paces packets of an isochronous stream: each packet is released
+// Delay after its timestamp, smoothing out the bursts URB completions arrive in.
+type JitterBuffer struct {
+	Delay time.Duration
+
+	out  chan IsoPacket
+	late atomic.Uint64
+}
+
+// NewJitterBuffer paces packets from src, e.g. IsoStream.Packets(). The delay should cover
+// at least one URB worth of packets, or most packets will be released late.
+func NewJitterBuffer(src <-chan IsoPacket, delay time.Duration) *JitterBuffer {
+	j := &JitterBuffer{
+		Delay: delay,
+		out:   make(chan IsoPacket),
+	}
+	go func() {
+		defer close(j.out)
+		for p := range src {
+			if wait := time.Until(p.Time.Add(delay)); wait > 0 {
+				time.Sleep(wait)
+			} else {
+				j.late.Add(1)
+			}
+			j.out <- p
+		}
+	}()
+	return j
+}
+
+// Packets returns the paced packets. It is closed after the source is.
+func (j *JitterBuffer) Packets() <-chan IsoPacket { return j.out }
+
+// Late returns how many packets were released after their due time.
+func (j *JitterBuffer) Late() uint64 { return j.late.Load() }
+
+// ErrNoFrameNumber is returned by FrameNumber before any isochronous transfer completed.
+var ErrNoFrameNumber = errors.New("usb: no frame number observed yet")
+
+// FrameNumber returns the last host controller (micro)frame observed, and when.
+// usbfs has no ioctl to read the frame counter, so it is taken from the start frame
+// the kernel reports in completed isochronous URBs: stream an isochronous endpoint
+// first. Time-sensitive protocols can extrapolate from it with the endpoint period,
+// then start a stream at a chosen frame with IsoStreamOptions.StartFrame.
+func (d *Device) FrameNumber() (frame int, at time.Time, err error) {
+	if d.st == nil {
+		return 0, time.Time{}, ErrNotOpen
+	}
+	d.st.mu.Lock()
+	eng := d.st.async
+	d.st.mu.Unlock()
+	if eng == nil {
+		return 0, time.Time{}, ErrNoFrameNumber
+	}
+	eng.mu.Lock()
+	defer eng.mu.Unlock()
+	if eng.frameAt.IsZero() {
+		return 0, time.Time{}, ErrNoFrameNumber
+	}
+	return eng.frame, eng.frameAt, nil
+}
@@ -0,0 +1,126 @@
+package usb
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// BlockDevices returns the disks the kernel created for the device, as /dev paths,
+// e.g. /dev/sda for a USB stick or UAS enclosure. Partitions are not listed.
+func (d Device) BlockDevices() ([]string, error) {
+	return d.kernelNodes("block")
+}
+
+// TTYs returns the serial ports the kernel created for the device, as /dev paths,
+// e.g. /dev/ttyACM0 or /dev/ttyUSB0.
+func (d Device) TTYs() ([]string, error) {
+	return d.kernelNodes("tty")
+}
+
+// NetInterfaces returns the names of the network interfaces the kernel created for
+// the device, e.g. eth1 or wlan0, as they are currently named.
+func (d Device) NetInterfaces() ([]string, error) {
+	dirs, err := d.classDevices("net")
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(dirs))
+	for i, dir := range dirs {
+		names[i] = filepath.Base(dir)
+	}
+	return names, nil
+}
+
+// HidrawNodes returns the hidraw nodes of the device's HID interfaces, e.g. /dev/hidraw0,
+// for raw HID access through the kernel instead of claiming the interface.
+func (d Device) HidrawNodes() ([]string, error) {
+	return d.kernelNodes("hidraw")
+}
+
+// InputEventNodes returns the evdev nodes of the input devices the kernel created
+// for the device, e.g. /dev/input/event3 for a keyboard.
+func (d Device) InputEventNodes() ([]string, error) {
+	inputs, err := d.classDevices("input")
+	if err != nil {
+		return nil, err
+	}
+	var nodes []string
+	for _, dir := range inputs {
+		entries, _ := os.ReadDir(dir) // an inputN device holds its eventN, mouseN, jsN nodes
+		for _, e := range entries {
+			if e.IsDir() && strings.HasPrefix(e.Name(), "event") {
+				nodes = append(nodes, devName(filepath.Join(dir, e.Name())))
+			}
+		}
+	}
+	return nodes, nil
+}
+
+// kernelNodes returns the /dev paths of the device's class devices.
+func (d Device) kernelNodes(class string) ([]string, error) {
+	dirs, err := d.classDevices(class)
+	if err != nil {
+		return nil, err
+	}
+	nodes := make([]string, len(dirs))
+	for i, dir := range dirs {
+		nodes[i] = devName(dir)
+	}
+	return nodes, nil
+}
+
+// classDevices returns the sysfs directories of the class devices (those in a
+// directory named after their class, like block/sda or net/eth0) below the device
+// and its interfaces, leaving out devices behind it if it's a hub.
+func (d Device) classDevices(class string) ([]string, error) {
+	if d.SysPath == "" {
+		return nil, ErrNotImplemented // only available through sysfs
+	}
+	root, err := filepath.EvalSymlinks(d.SysPath)
+	if err != nil {
+		return nil, err
+	}
+	var found []string
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || path == root || !info.IsDir() {
+			return nil
+		}
+		if name := info.Name(); isUSBDeviceName(name) {
+			return filepath.SkipDir // a device on a hub port, not ours
+		}
+		if filepath.Base(filepath.Dir(path)) == class {
+			found = append(found, path)
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	sort.Strings(found)
+	return found, err
+}
+
+// isUSBDeviceName reports whether a sysfs directory name is a USB device's, like
+// 1-2.3, rather than an interface's (1-2.3:1.0) or anything else.
+func isUSBDeviceName(name string) bool {
+	dash := strings.IndexByte(name, '-')
+	return dash > 0 && !strings.ContainsRune(name, ':') && strings.Trim(name[:dash], "0123456789") == ""
+}
+
+// devName returns the /dev path of a class device, from the DEVNAME its uevent
+// reports, or else its sysfs name.
+func devName(dir string) string {
+	name := filepath.Base(dir)
+	if f, err := os.Open(filepath.Join(dir, "uevent")); err == nil {
+		defer f.Close()
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			if v, ok := strings.CutPrefix(sc.Text(), "DEVNAME="); ok {
+				name = v
+				break
+			}
+		}
+	}
+	return filepath.Join("/dev", name)
+}
@@ -0,0 +1,53 @@
+package usb_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pzl/usb"
+)
+
+func TestKernelDevices(t *testing.T) {
+	tree := fixtureTree(t)
+	intf := filepath.Join(tree.Roots.SysFS, "1-2.3:1.0")
+	for dir, uevent := range map[string]string{
+		"tty/ttyACM0":                             "MAJOR=166\nMINOR=0\nDEVNAME=ttyACM0\n",
+		"net/usb0":                                "INTERFACE=usb0\nIFINDEX=5\n",
+		"host3/target3:0:0/3:0:0:0/block/sdc":     "MAJOR=8\nMINOR=32\nDEVNAME=sdc\nDEVTYPE=disk\n",
+		"0003:1234:5678.0001/hidraw/hidraw2":      "MAJOR=240\nMINOR=2\nDEVNAME=hidraw2\n",
+		"0003:1234:5678.0001/input/input7/event4": "MAJOR=13\nMINOR=68\nDEVNAME=input/event4\n",
+		"0003:1234:5678.0001/input/input7/mouse1": "MAJOR=13\nMINOR=33\nDEVNAME=input/mouse1\n",
+	} {
+		if err := os.MkdirAll(filepath.Join(intf, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(intf, dir, "uevent"), []byte(uevent), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	devs, err := usb.List(usb.ListRoots(tree.Roots))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range devs {
+		ttys, err := d.TTYs()
+		if err != nil {
+			t.Fatal(err)
+		}
+		nets, _ := d.NetInterfaces()
+		disks, _ := d.BlockDevices()
+		hidraw, _ := d.HidrawNodes()
+		events, _ := d.InputEventNodes()
+		got := fmt.Sprint(ttys, nets, disks, hidraw, events)
+		want := "[] [] [] [] []" // the hubs don't own what's behind them
+		if d.Vendor == 0x1234 {
+			want = "[/dev/ttyACM0] [usb0] [/dev/sdc] [/dev/hidraw2] [/dev/input/event4]"
+		}
+		if got != want {
+			t.Errorf("%s: got %s, want %s", d.PortPath(), got, want)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package usb
+
+import (
+	"math"
+	"math/bits"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Latency histograms are log-linear, as HDR histograms: each power of two is split in
+// 2^histSubBits buckets, so a bucket's width is at most 1/64 of its value.
+const (
+	histSubBits  = 6
+	histSub      = 1 << histSubBits
+	histMaxBits  = 40 // ~18 minutes, in ns; longer latencies are clamped
+	histBuckets  = (histMaxBits - histSubBits + 1) * histSub
+	histMaxValue = 1<<histMaxBits - 1
+)
+
+// latencyHist is a histogram of transfer latencies in ns, safe for concurrent use.
+type latencyHist struct {
+	counts   [histBuckets]atomic.Uint64
+	total    atomic.Uint64
+	sum      atomic.Uint64
+	min, max atomic.Uint64
+}
+
+func newLatencyHist() *latencyHist {
+	h := &latencyHist{}
+	h.min.Store(math.MaxUint64)
+	return h
+}
+
+func histIndex(v uint64) int {
+	if v < histSub {
+		return int(v)
+	}
+	e := bits.Len64(v) - histSubBits - 1
+	return e*histSub + int(v>>e)
+}
+
+// histUpper is the largest value counted in bucket i.
+func histUpper(i int) uint64 {
+	if i < histSub {
+		return uint64(i)
+	}
+	e := i/histSub - 1
+	v := uint64(i%histSub+histSub) << e
+	return v + 1<<e - 1
+}
+
+func (h *latencyHist) record(d time.Duration) {
+	v := uint64(max(d, 0))
+	v = min(v, histMaxValue)
+	h.counts[histIndex(v)].Add(1)
+	h.total.Add(1)
+	h.sum.Add(v)
+	for m := h.min.Load(); v < m && !h.min.CompareAndSwap(m, v); m = h.min.Load() {
+	}
+	for m := h.max.Load(); v > m && !h.max.CompareAndSwap(m, v); m = h.max.Load() {
+	}
+}
+
+// LatencyBucket is a non-empty bucket of a latency histogram: Count transfers took at
+// most Upper, and more than the previous bucket's Upper.
+type LatencyBucket struct {
+	Upper time.Duration
+	Count uint64
+}
+
+// LatencySnapshot summarizes the latencies of an endpoint's transfers, from submission
+// to completion, failed ones included. Percentiles are bucket upper bounds, within 1.6%
+// of the exact value.
+type LatencySnapshot struct {
+	Count               uint64
+	Min, Max, Mean      time.Duration
+	P50, P90, P99, P999 time.Duration
+	Buckets             []LatencyBucket
+}
+
+// Percentile returns the latency that p percent of the transfers didn't exceed.
+func (s LatencySnapshot) Percentile(p float64) time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+	rank := uint64(math.Ceil(p / 100 * float64(s.Count)))
+	rank = max(rank, 1)
+	var seen uint64
+	for _, b := range s.Buckets {
+		if seen += b.Count; seen >= rank {
+			return min(b.Upper, s.Max)
+		}
+	}
+	return s.Max
+}
+
+func (h *latencyHist) snapshot() LatencySnapshot {
+	var s LatencySnapshot
+	for i := range h.counts {
+		if n := h.counts[i].Load(); n > 0 {
+			s.Buckets = append(s.Buckets, LatencyBucket{Upper: time.Duration(histUpper(i)), Count: n})
+			s.Count += n
+		}
+	}
+	if s.Count == 0 {
+		return s
+	}
+	s.Min = time.Duration(h.min.Load())
+	s.Max = time.Duration(h.max.Load())
+	s.Mean = time.Duration(h.sum.Load() / h.total.Load())
+	s.P50, s.P90, s.P99, s.P999 = s.Percentile(50), s.Percentile(90), s.Percentile(99), s.Percentile(99.9)
+	return s
+}
+
+// latencyTracker holds a device's histograms, by endpoint address.
+type latencyTracker struct {
+	mu    sync.Mutex
+	hists map[uint8]*latencyHist
+}
+
+func (l *latencyTracker) hist(addr uint8) *latencyHist {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	h := l.hists[addr]
+	if h == nil {
+		h = newLatencyHist()
+		l.hists[addr] = h
+	}
+	return h
+}
+
+// SetLatencyTracking starts or stops recording the latency of every transfer on the
+// device, per endpoint; see Latency. Stopping discards what was recorded. It costs a
+// clock read and a few atomic adds per transfer.
+func (d *Device) SetLatencyTracking(enable bool) {
+	if d.st == nil {
+		return
+	}
+	if !enable {
+		d.st.latency.Store(nil)
+	} else if d.st.latency.Load() == nil {
+		d.st.latency.CompareAndSwap(nil, &latencyTracker{hists: make(map[uint8]*latencyHist)})
+	}
+}
+
+// Latency returns the latencies recorded since SetLatencyTracking, by endpoint address,
+// 0 for control transfers. It returns nil if tracking is off.
+func (d *Device) Latency() map[int]LatencySnapshot {
+	if d.st == nil {
+		return nil
+	}
+	l := d.st.latency.Load()
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	hists := make(map[uint8]*latencyHist, len(l.hists))
+	for a, h := range l.hists {
+		hists[a] = h
+	}
+	l.mu.Unlock()
+	m := make(map[int]LatencySnapshot, len(hists))
+	for a, h := range hists {
+		m[int(a)] = h.snapshot()
+	}
+	return m
+}
+
+// Latency returns the latencies recorded on the endpoint, see Device.Latency.
+func (e *Endpoint) Latency() LatencySnapshot {
+	if e.i == nil || e.i.d == nil || e.i.d.st == nil {
+		return LatencySnapshot{}
+	}
+	l := e.i.d.st.latency.Load()
+	if l == nil {
+		return LatencySnapshot{}
+	}
+	l.mu.Lock()
+	h := l.hists[uint8(e.Address)]
+	l.mu.Unlock()
+	if h == nil {
+		return LatencySnapshot{}
+	}
+	return h.snapshot()
+}
+
+// recordLatency records a transfer on addr that started at start, if tracking is on.
+func (d *Device) recordLatency(addr uint8, start time.Time) {
+	if d.st == nil {
+		return
+	}
+	if l := d.st.latency.Load(); l != nil {
+		l.hist(addr).record(time.Since(start))
+	}
+}
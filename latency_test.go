@@ -0,0 +1,37 @@
+package usb_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pzl/usb/x/gusb"
+)
+
+func TestLatencyTracking(t *testing.T) {
+	_, w := openWidget(t)
+	if err := w.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 2)
+	w.Control(gusb.RequestDirIn, gusb.RequestGetStatus, 0, 0, buf, time.Second)
+	if l := w.Latency(); l != nil {
+		t.Errorf("recorded while off: %v", l)
+	}
+	w.SetLatencyTracking(true)
+	for range 3 {
+		w.Control(gusb.RequestDirIn, gusb.RequestGetStatus, 0, 0, buf, time.Second) // fails, but is timed
+	}
+	l := w.Latency()
+	if len(l) == 0 {
+		t.Fatal("nothing recorded while on")
+	}
+	s := l[0]
+	if s.Count != 3 || s.Min > s.P50 || s.P50 > s.P999 || s.P999 > s.Max || len(s.Buckets) == 0 {
+		t.Errorf("snapshot: %+v", s)
+	}
+	w.SetLatencyTracking(false)
+	if l := w.Latency(); l != nil {
+		t.Errorf("kept after disabling: %v", l)
+	}
+}
@@ -1,6 +1,8 @@
 // Code generated by usb (gen.go). DO NOT EDIT.
 // It was generated from https://usb-ids.gowdy.us/usb.ids on Apr 9 2019
 
+//go:build !usb_noids
+
 package usb
 
 import (
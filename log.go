@@ -0,0 +1,39 @@
+package usb
+
+import "github.com/pzl/usb/x/gusb"
+
+// Logger receives the package's diagnostic messages, prefixed with their level
+// (ERROR:, WARNING:, INFO:). *log.Logger satisfies it; the standard logger is the default.
+type Logger = gusb.Logger
+
+// LoggerFunc adapts a printf-style function to a Logger, e.g. from another logging package:
+//
+//	usb.SetLogger(usb.LoggerFunc(apexlog.Infof))
+type LoggerFunc func(format string, v ...interface{})
+
+func (f LoggerFunc) Printf(format string, v ...interface{}) { f(format, v...) }
+
+// SetLogger routes the diagnostics of this package and gusb to l. A nil Logger discards them.
+func SetLogger(l Logger) { gusb.SetLogger(l) }
+
+func logf(format string, v ...interface{}) { gusb.Logf(format, v...) }
+
+// logf logs through the device's Context Logger, if it has one.
+func (d *Device) logf(format string, v ...interface{}) {
+	if !gusb.LogEnabled(format) {
+		return
+	}
+	d.st.mu.Lock()
+	ctx := d.ctx
+	d.st.mu.Unlock()
+	if ctx != nil {
+		ctx.mu.Lock()
+		l := ctx.logger
+		ctx.mu.Unlock()
+		if l != nil {
+			l.Printf(format, v...)
+			return
+		}
+	}
+	logf(format, v...)
+}
@@ -0,0 +1,52 @@
+package usb
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// SetLowLatency makes ReadContext and WriteContext run a synchronous ioctl on the
+// caller's goroutine, rather than submitting an URB and waiting for the completion
+// loop to reap it, which saves tens of microseconds per transfer in tight
+// request/response loops.
+//
+// The tradeoff is cancellation: the transfer can no longer be cancelled when ctx is
+// cancelled or the device's Context closes. Only a ctx deadline is honoured, passed to
+// the kernel as the transfer's timeout, rounded up to the millisecond; without one the
+// call blocks until the device answers. Asynchronous transfers are unaffected.
+func (d *Device) SetLowLatency(enable bool) {
+	d.st.mu.Lock()
+	defer d.st.mu.Unlock()
+	d.st.lowLatency = enable
+}
+
+func (d *Device) lowLatency() bool {
+	d.st.mu.Lock()
+	defer d.st.mu.Unlock()
+	return d.st.lowLatency
+}
+
+// inline runs a synchronous transfer on the calling goroutine, with ctx's deadline
+// as its timeout, for low-latency mode.
+func (e *Endpoint) inline(ctx context.Context, transfer func(timeout time.Duration) (int, error)) (n int, err error) {
+	var timeout time.Duration // none
+	if deadline, ok := ctx.Deadline(); ok {
+		if timeout = time.Until(deadline); timeout <= 0 {
+			return 0, context.DeadlineExceeded
+		}
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			err = newPanicError(p)
+			e.i.d.fault()
+		}
+	}()
+	n, err = transfer(timeout)
+	if errors.Is(err, unix.ETIMEDOUT) && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	return n, err
+}
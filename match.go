@@ -0,0 +1,371 @@
+package usb
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/pzl/usb/x/gusb"
+)
+
+// Matcher decides whether a device is of interest.
+type Matcher func(*Device) bool
+
+// MatchClass matches devices of the given device class.
+func MatchClass(c USBClass) Matcher {
+	return func(d *Device) bool { return d.Class == c }
+}
+
+// MatchVendor matches devices from any of the given vendors.
+func MatchVendor(vids ...ID) Matcher {
+	return func(d *Device) bool {
+		for _, v := range vids {
+			if d.Vendor == v {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// MatchProduct matches one vendor and product ID pair.
+func MatchProduct(vid, pid ID) Matcher {
+	return func(d *Device) bool { return d.Vendor == vid && d.Product == pid }
+}
+
+// MatchAll matches devices matched by every one of ms.
+func MatchAll(ms ...Matcher) Matcher {
+	return func(d *Device) bool {
+		for _, m := range ms {
+			if !m(d) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// ParseMatch compiles a match expression, for selecting devices from config files or
+// the command line without writing Go. An expression compares device fields:
+//
+//	vendor==0x1a86 && class==cdc && port_path~="3-1.*"
+//
+// The operators are == and != for equality, and ~= for a glob pattern as in path.Match.
+// Comparisons combine with &&, || and !, and group with parentheses. Values are bare
+// words or double-quoted Go strings. The fields are:
+//
+//	vendor, product            hex IDs, with or without 0x
+//	class                      class number or name (e.g. hid, cdc, storage, vendor), of
+//	                           the device or any interface of its active configuration
+//	driver                     a kernel driver bound to any interface
+//	bus, device                numbers
+//	port_path, serial, name    strings; name is the Alias set by Rules
+//	vendor_name, product_name  strings
+//	virtual                    true or false, see Device.Virtual
+//
+// An empty expression matches every device.
+func ParseMatch(expr string) (Matcher, error) {
+	toks, err := lexMatch(expr)
+	if err != nil {
+		return nil, err
+	}
+	if len(toks) == 1 {
+		return func(*Device) bool { return true }, nil
+	}
+	p := &matchParser{expr: expr, toks: toks}
+	m, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, p.errorf(t, "unexpected %q", t.text)
+	}
+	return m, nil
+}
+
+// ListWhere lists the devices matching a match expression, see ParseMatch.
+func ListWhere(expr string, opts ...ListOption) ([]*Device, error) {
+	m, err := ParseMatch(expr)
+	if err != nil {
+		return nil, err
+	}
+	all, err := List(opts...)
+	if err != nil {
+		return nil, err
+	}
+	devs := make([]*Device, 0, len(all))
+	for _, d := range all {
+		if m(d) {
+			devs = append(devs, d)
+		}
+	}
+	return devs, nil
+}
+
+// MatchSyntaxError is returned by ParseMatch for a malformed expression.
+type MatchSyntaxError struct {
+	Expr string
+	Pos  int // byte offset of the offending token
+	Msg  string
+}
+
+func (e *MatchSyntaxError) Error() string {
+	return fmt.Sprintf("usb: match expression %q: at %d: %s", e.Expr, e.Pos, e.Msg)
+}
+
+// matchFields gives the values of each field of a device, in the canonical form
+// matchLiteral normalizes the compared values to.
+var matchFields = map[string]func(*Device) []string{
+	"vendor":       func(d *Device) []string { return []string{d.Vendor.String()} },
+	"product":      func(d *Device) []string { return []string{d.Product.String()} },
+	"bus":          func(d *Device) []string { return []string{strconv.Itoa(d.Bus)} },
+	"device":       func(d *Device) []string { return []string{strconv.Itoa(d.Device)} },
+	"port_path":    func(d *Device) []string { return []string{d.PortPath()} },
+	"serial":       func(d *Device) []string { return []string{d.Serial} },
+	"name":         func(d *Device) []string { return []string{d.Alias()} },
+	"vendor_name":  func(d *Device) []string { return []string{d.VendorName()} },
+	"product_name": func(d *Device) []string { return []string{d.ProductName()} },
+	"virtual":      func(d *Device) []string { return []string{strconv.FormatBool(d.Virtual)} },
+	"class": func(d *Device) []string {
+		vs := []string{fmt.Sprintf("%02x", uint8(d.Class))}
+		if d.ActiveConfig != nil {
+			for _, intf := range d.ActiveConfig.Interfaces {
+				vs = append(vs, fmt.Sprintf("%02x", uint8(intf.Class)))
+			}
+		}
+		return vs
+	},
+	"driver": func(d *Device) []string {
+		var vs []string
+		if d.ActiveConfig != nil {
+			for _, intf := range d.ActiveConfig.Interfaces {
+				if drv, err := intf.GetDriver(); err == nil && drv != "" {
+					vs = append(vs, drv)
+				}
+			}
+		}
+		return vs
+	},
+}
+
+// matchClasses are the class names accepted in expressions.
+var matchClasses = map[string]gusb.USBClass{
+	"audio":      gusb.USBClassAudio,
+	"cdc":        gusb.USBClassComm,
+	"comm":       gusb.USBClassComm,
+	"hid":        gusb.USBClassHID,
+	"physical":   gusb.USBClassPhysical,
+	"image":      gusb.USBClassStillImage,
+	"printer":    gusb.USBClassPrinter,
+	"storage":    gusb.USBClassMassStorage,
+	"hub":        gusb.USBClassHub,
+	"cdc_data":   gusb.USBClassCDCData,
+	"smartcard":  gusb.USBClassCSCId,
+	"video":      gusb.USBClassVideo,
+	"billboard":  gusb.USBClassBillboard,
+	"diagnostic": gusb.USBClassDiagnostic,
+	"wireless":   gusb.USBClassWirelessController,
+	"misc":       gusb.USBClassMisc,
+	"app":        gusb.USBClassAppSpecific,
+	"vendor":     gusb.USBClassVendorSpecific,
+}
+
+// matchLiteral normalizes a value compared with == or != to field's canonical form.
+func matchLiteral(field, v string) (string, error) {
+	switch field {
+	case "vendor", "product":
+		id, err := ParseID(v)
+		return id.String(), err
+	case "bus", "device":
+		n, err := strconv.Atoi(v)
+		return strconv.Itoa(n), err
+	case "virtual":
+		b, err := strconv.ParseBool(v)
+		return strconv.FormatBool(b), err
+	case "class":
+		if c, ok := matchClasses[strings.ToLower(v)]; ok {
+			return fmt.Sprintf("%02x", uint8(c)), nil
+		}
+		n, err := strconv.ParseUint(v, 0, 8)
+		return fmt.Sprintf("%02x", n), err
+	}
+	return v, nil
+}
+
+type matchTokKind int
+
+const (
+	tokEOF matchTokKind = iota
+	tokWord
+	tokString
+	tokOp
+)
+
+type matchTok struct {
+	kind matchTokKind
+	text string // unquoted, for strings
+	pos  int
+}
+
+var matchOps = []string{"==", "!=", "~=", "&&", "||", "!", "(", ")"}
+
+func lexMatch(expr string) ([]matchTok, error) {
+	var toks []matchTok
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+			continue
+		case c == '"':
+			q, err := strconv.QuotedPrefix(expr[i:])
+			if err != nil {
+				return nil, &MatchSyntaxError{Expr: expr, Pos: i, Msg: "unterminated string"}
+			}
+			s, _ := strconv.Unquote(q)
+			toks = append(toks, matchTok{tokString, s, i})
+			i += len(q)
+			continue
+		}
+		op := ""
+		for _, o := range matchOps {
+			if strings.HasPrefix(expr[i:], o) {
+				op = o
+				break
+			}
+		}
+		if op != "" {
+			toks = append(toks, matchTok{tokOp, op, i})
+			i += len(op)
+			continue
+		}
+		j := i
+		for j < len(expr) && !strings.ContainsRune(" \t\n\r\"!=~&|()", rune(expr[j])) {
+			j++
+		}
+		if j == i {
+			return nil, &MatchSyntaxError{Expr: expr, Pos: i, Msg: fmt.Sprintf("unexpected %q", c)}
+		}
+		toks = append(toks, matchTok{tokWord, expr[i:j], i})
+		i = j
+	}
+	return append(toks, matchTok{kind: tokEOF, pos: len(expr)}), nil
+}
+
+type matchParser struct {
+	expr string
+	toks []matchTok
+}
+
+func (p *matchParser) peek() matchTok { return p.toks[0] }
+
+func (p *matchParser) next() matchTok {
+	t := p.toks[0]
+	if t.kind != tokEOF {
+		p.toks = p.toks[1:]
+	}
+	return t
+}
+
+func (p *matchParser) accept(op string) bool {
+	if t := p.peek(); t.kind == tokOp && t.text == op {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *matchParser) errorf(t matchTok, format string, args ...any) error {
+	return &MatchSyntaxError{Expr: p.expr, Pos: t.pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+// or := and { "||" and }
+func (p *matchParser) or() (Matcher, error) {
+	m, err := p.and()
+	for err == nil && p.accept("||") {
+		var r Matcher
+		if r, err = p.and(); err == nil {
+			l := m
+			m = func(d *Device) bool { return l(d) || r(d) }
+		}
+	}
+	return m, err
+}
+
+// and := unary { "&&" unary }
+func (p *matchParser) and() (Matcher, error) {
+	m, err := p.unary()
+	for err == nil && p.accept("&&") {
+		var r Matcher
+		if r, err = p.unary(); err == nil {
+			m = MatchAll(m, r)
+		}
+	}
+	return m, err
+}
+
+// unary := "!" unary | "(" or ")" | field op value
+func (p *matchParser) unary() (Matcher, error) {
+	if p.accept("!") {
+		m, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return func(d *Device) bool { return !m(d) }, nil
+	}
+	if p.accept("(") {
+		m, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if t := p.next(); t.kind != tokOp || t.text != ")" {
+			return nil, p.errorf(t, "missing )")
+		}
+		return m, nil
+	}
+
+	f := p.next()
+	if f.kind != tokWord {
+		return nil, p.errorf(f, "expected a field name")
+	}
+	values, ok := matchFields[f.text]
+	if !ok {
+		return nil, p.errorf(f, "unknown field %q", f.text)
+	}
+	op := p.next()
+	if op.kind != tokOp || (op.text != "==" && op.text != "!=" && op.text != "~=") {
+		return nil, p.errorf(op, "expected ==, != or ~= after %s", f.text)
+	}
+	v := p.next()
+	if v.kind != tokWord && v.kind != tokString {
+		return nil, p.errorf(v, "expected a value after %s", op.text)
+	}
+
+	if op.text == "~=" {
+		if _, err := path.Match(v.text, ""); err != nil {
+			return nil, p.errorf(v, "bad pattern %q", v.text)
+		}
+		return func(d *Device) bool {
+			for _, s := range values(d) {
+				if ok, _ := path.Match(v.text, s); ok {
+					return true
+				}
+			}
+			return false
+		}, nil
+	}
+	lit, err := matchLiteral(f.text, v.text)
+	if err != nil {
+		return nil, p.errorf(v, "bad %s %q", f.text, v.text)
+	}
+	want := op.text == "=="
+	return func(d *Device) bool {
+		for _, s := range values(d) {
+			if s == lit {
+				return want
+			}
+		}
+		return !want
+	}, nil
+}
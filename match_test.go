@@ -0,0 +1,33 @@
+package usb_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/pzl/usb"
+)
+
+func TestListWhere(t *testing.T) {
+	tree := fixtureTree(t)
+	for expr, want := range map[string]int{
+		"":                                       3,
+		"vendor==0x1234 && class==hid":           1,
+		`port_path~="1-2*" && !class==hub`:       1,
+		"class==hub || driver==usbhid":           3,
+		"(bus==1 && device!=1) && serial==W0001": 1,
+		`serial~="W*"`:                           1,
+	} {
+		devs, err := usb.ListWhere(expr, usb.ListRoots(tree.Roots))
+		if err != nil {
+			t.Errorf("%s: %v", expr, err)
+		} else if len(devs) != want {
+			t.Errorf("%s: matched %d devices, want %d", expr, len(devs), want)
+		}
+	}
+	for _, expr := range []string{"vendor==", "vendor=1234", "colour==red", "class==nope", "(bus==1", `serial=="x`} {
+		var serr *usb.MatchSyntaxError
+		if _, err := usb.ParseMatch(expr); !errors.As(err, &serr) {
+			t.Errorf("%s: err %v, want a MatchSyntaxError", expr, err)
+		}
+	}
+}
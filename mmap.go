@@ -0,0 +1,79 @@
+package usb
+
+import (
+	"unsafe"
+
+	"github.com/pzl/usb/x/gusb"
+	"golang.org/x/sys/unix"
+)
+
+// Capabilities are the optional usbfs features the kernel supports for a device.
+type Capabilities uint32
+
+const (
+	CapZeroPacket          Capabilities = gusb.CapZeroPacket
+	CapBulkContinuation    Capabilities = gusb.CapBulkContinuation
+	CapNoPacketSizeLim     Capabilities = gusb.CapNoPacketSizeLim
+	CapBulkScatterGather   Capabilities = gusb.CapBulkScatterGather
+	CapReapAfterDisconnect Capabilities = gusb.CapReapAfterDisconnect
+	CapMmap                Capabilities = gusb.CapMmap // see Device.AllocBuffer
+	CapDropPrivileges      Capabilities = gusb.CapDropPrivileges
+	CapConnInfoEx          Capabilities = gusb.CapConnInfoEx
+	CapSuspend             Capabilities = gusb.CapSuspend
+)
+
+// Has reports whether all of caps are supported.
+func (c Capabilities) Has(caps Capabilities) bool { return c&caps == caps }
+
+// Capabilities asks the kernel which usbfs features it supports for the open device.
+func (d *Device) Capabilities() (Capabilities, error) {
+	f, err := d.file()
+	if err != nil {
+		return 0, err
+	}
+	caps, err := gusb.GetCapabilities(f)
+	return Capabilities(caps), err
+}
+
+// AllocBuffer returns a buffer of size bytes for asynchronous transfers on the device.
+// When the kernel supports CapMmap, it is mapped from the device's usbfs file, so URBs
+// using it are DMA'd in place rather than copied through kernel memory. Otherwise it
+// is ordinary memory. Release it with FreeBuffer, and don't touch it after.
+func (d *Device) AllocBuffer(size int) ([]byte, error) {
+	if caps, err := d.Capabilities(); err != nil || !caps.Has(CapMmap) || size <= 0 {
+		return make([]byte, size), nil
+	}
+	f, err := d.file()
+	if err != nil {
+		return nil, err
+	}
+	buf, err := unix.Mmap(int(f.Fd()), 0, size, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED)
+	if err != nil {
+		d.logf("INFO: usbfs mmap of %d bytes failed, using ordinary memory: %v\n", size, err)
+		return make([]byte, size), nil
+	}
+	d.st.mu.Lock()
+	if d.st.mapped == nil {
+		d.st.mapped = make(map[*byte]bool)
+	}
+	d.st.mapped[unsafe.SliceData(buf)] = true
+	d.st.mu.Unlock()
+	return buf, nil
+}
+
+// FreeBuffer releases a buffer from AllocBuffer. The mapping outlives the device
+// being closed, so buffers must be freed either way.
+func (d *Device) FreeBuffer(buf []byte) error {
+	if len(buf) == 0 {
+		return nil
+	}
+	p := unsafe.SliceData(buf)
+	d.st.mu.Lock()
+	mapped := d.st.mapped[p]
+	delete(d.st.mapped, p)
+	d.st.mu.Unlock()
+	if !mapped {
+		return nil // ordinary memory, left to the garbage collector
+	}
+	return unix.Munmap(buf[:cap(buf)])
+}
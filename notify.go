@@ -0,0 +1,141 @@
+//go:build !usb_core
+
+package usb
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/pzl/usb/x/class"
+	"github.com/pzl/usb/x/gusb"
+)
+
+// Notification is an event read from an interrupt endpoint: a HubChange, SerialState,
+// NetworkConnection, ResponseAvailable, SpeedChange or CDCNotification.
+//
+// The notification types and decoders live in package class, and are forwarded here.
+type Notification = class.Notification
+
+type (
+	HubChange         = class.HubChange
+	CDCNotification   = class.CDCNotification
+	SerialState       = class.SerialState
+	NetworkConnection = class.NetworkConnection
+	ResponseAvailable = class.ResponseAvailable
+	SpeedChange       = class.SpeedChange
+)
+
+// CDC notification codes, bNotification.
+const (
+	CDCNetworkConnection     = class.CDCNetworkConnection
+	CDCResponseAvailable     = class.CDCResponseAvailable
+	CDCSerialState           = class.CDCSerialState
+	CDCConnectionSpeedChange = class.CDCConnectionSpeedChange
+)
+
+// NotificationDecoder decodes the data of one interrupt transfer.
+type NotificationDecoder func(data []byte) ([]Notification, error)
+
+// ErrBadNotification is returned by decoders given malformed data.
+var ErrBadNotification = class.ErrBadNotification
+
+// DecodeHubChange is class.DecodeHubChange.
+func DecodeHubChange(data []byte) ([]Notification, error) { return class.DecodeHubChange(data) }
+
+// DecodeCDC is class.DecodeCDC.
+func DecodeCDC(data []byte) ([]Notification, error) { return class.DecodeCDC(data) }
+
+// NotificationReader keeps a transfer pending on an interrupt IN endpoint, and
+// delivers what it reads decoded into Notifications.
+type NotificationReader struct {
+	ep     *InEndpoint
+	decode NotificationDecoder
+
+	events chan Notification
+	stop   chan struct{}
+	done   chan struct{}
+	once   sync.Once
+	err    error
+}
+
+// Notifications starts reading the interrupt IN endpoint, which must belong to a claimed
+// interface, e.g. with DecodeCDC on a CDC ACM control interface. A hub's status change
+// endpoint, with DecodeHubChange, is normally held by the kernel hub driver.
+func (e *InEndpoint) Notifications(decode NotificationDecoder) (*NotificationReader, error) {
+	if e.TransferType != int(gusb.EndpointTypeInterrupt) {
+		return nil, fmt.Errorf("usb: endpoint address %02X is not an interrupt endpoint (type %02X)", e.Address, e.TransferType)
+	}
+	if (e.Address & 0x80) == 0 {
+		return nil, fmt.Errorf("usb: endpoint address %02X is not an IN endpoint", e.Address)
+	}
+	if e.PacketSize() == 0 {
+		return nil, fmt.Errorf("usb: endpoint address %02X has a max packet size of 0", e.Address)
+	}
+	if e.i == nil || e.i.d == nil {
+		return nil, ErrNotOpen
+	}
+	r := &NotificationReader{
+		ep:     e,
+		decode: decode,
+		events: make(chan Notification, 16),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	buf := e.NewBuffer(e.PacketSize())
+	t, err := e.Submit(buf)
+	if err != nil {
+		return nil, err
+	}
+	go r.run(t, buf)
+	return r, nil
+}
+
+// Events returns the decoded notifications. It is closed when the reader stops.
+func (r *NotificationReader) Events() <-chan Notification { return r.events }
+
+// Err returns what stopped the reader, once Events is closed. It is nil after Close.
+func (r *NotificationReader) Err() error {
+	<-r.done
+	return r.err
+}
+
+// Close stops reading, cancelling the pending transfer.
+func (r *NotificationReader) Close() error {
+	r.once.Do(func() { close(r.stop) })
+	<-r.done
+	return nil
+}
+
+func (r *NotificationReader) run(t *Transfer, buf []byte) {
+	defer close(r.done)
+	defer close(r.events)
+	for {
+		select {
+		case <-t.Done():
+		case <-r.stop:
+			t.Cancel()
+			<-t.Done()
+			return
+		}
+		n, err := t.Result()
+		if err != nil {
+			r.err = err
+			return
+		}
+		ns, err := r.decode(buf[:n])
+		if err != nil {
+			r.ep.i.d.logf("WARNING: endpoint %02X: %v\n", r.ep.Address, err)
+		}
+		for _, ev := range ns {
+			select {
+			case r.events <- ev:
+			case <-r.stop:
+				return
+			}
+		}
+		if t, err = r.ep.Submit(buf); err != nil {
+			r.err = err
+			return
+		}
+	}
+}
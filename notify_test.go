@@ -0,0 +1,32 @@
+//go:build !usb_core
+
+package usb_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/pzl/usb"
+)
+
+func TestDecodeNotifications(t *testing.T) {
+	hub, err := usb.DecodeHubChange([]byte{0x05, 0x01})
+	if want := []usb.Notification{usb.HubChange{Hub: true, Ports: []int{2, 8}}}; err != nil || !reflect.DeepEqual(hub, want) {
+		t.Errorf("hub change: %+v, %v", hub, err)
+	}
+
+	cdc, err := usb.DecodeCDC([]byte{
+		0xa1, 0x20, 0, 0, 2, 0, 2, 0, 0x03, 0x00, // SERIAL_STATE, DCD and DSR, on interface 2
+		0xa1, 0x00, 1, 0, 0, 0, 0, 0, // NETWORK_CONNECTION, connected
+	})
+	want := []usb.Notification{
+		usb.SerialState{Interface: 2, DCD: true, DSR: true},
+		usb.NetworkConnection{Connected: true},
+	}
+	if err != nil || !reflect.DeepEqual(cdc, want) {
+		t.Errorf("CDC: %+v, %v", cdc, err)
+	}
+	if _, err := usb.DecodeCDC([]byte{0xa1, 0x20, 0, 0, 0, 0, 2, 0}); err == nil {
+		t.Error("truncated SERIAL_STATE decoded")
+	}
+}
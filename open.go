@@ -0,0 +1,77 @@
+package usb
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const maxOpenBackoff = time.Second
+
+// udevDataDir is where udev records the devices it finished processing.
+var udevDataDir = "/run/udev/data"
+
+// OpenOption configures Device.Open.
+type OpenOption func(*openOptions)
+
+type openOptions struct {
+	retries  int
+	backoff  time.Duration
+	settle   time.Duration
+	readOnly bool
+}
+
+// OpenRetry retries opening up to retries more times, when it fails the way it does
+// while the kernel or udev are still probing a new device: EBUSY, EAGAIN, or the node
+// missing or lacking its permissions yet (ENOENT, EACCES). The pause starts at backoff
+// and doubles with each attempt, up to a second.
+func OpenRetry(retries int, backoff time.Duration) OpenOption {
+	return func(o *openOptions) {
+		o.retries, o.backoff = retries, backoff
+	}
+}
+
+// WaitUdevSettle waits, up to timeout, for udev to finish processing the device
+// (its node created and permissions applied) before opening it. It does nothing
+// on systems without udev.
+func WaitUdevSettle(timeout time.Duration) OpenOption {
+	return func(o *openOptions) { o.settle = timeout }
+}
+
+// ReadOnly opens the device node O_RDONLY, for workflows that only read descriptors.
+// It needs only read permission on the node, and never disturbs the device: claims,
+// resets and transfers fail with ErrReadOnly.
+func ReadOnly() OpenOption {
+	return func(o *openOptions) { o.readOnly = true }
+}
+
+func retryOpen(err error) bool {
+	for _, e := range []error{unix.EBUSY, unix.EAGAIN, unix.ENOENT, unix.EACCES} {
+		if errors.Is(err, e) {
+			return true
+		}
+	}
+	return false
+}
+
+// waitUdevSettle polls for the udev database entry of the device, which udev writes
+// once its rules ran. It gives up silently at the timeout: Open reports any real problem.
+func (d *Device) waitUdevSettle(timeout time.Duration) {
+	if _, err := os.Stat(udevDataDir); err != nil {
+		return
+	}
+	major, minor, err := d.devNumber()
+	if err != nil {
+		return
+	}
+	entry := fmt.Sprintf("%s/c%d:%d", udevDataDir, major, minor)
+	clk := clock()
+	for deadline := clk.Now().Add(timeout); clk.Now().Before(deadline); clk.Sleep(10 * time.Millisecond) {
+		if _, err := os.Stat(entry); err == nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package usb
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrOpTimeout is matched by an OpTimeoutError.
+var ErrOpTimeout = errors.New("usb: operation timed out")
+
+// OpTimeoutError is returned when a claim, release or driver operation outlasts the
+// Context's operation timeout, see WithOpTimeout.
+type OpTimeoutError struct {
+	Op      string // e.g. "claim interface 0"
+	Timeout time.Duration
+}
+
+func (e *OpTimeoutError) Error() string {
+	return fmt.Sprintf("usb: %s timed out after %v", e.Op, e.Timeout)
+}
+
+func (e *OpTimeoutError) Is(target error) bool { return target == ErrOpTimeout }
+
+// WithOpTimeout bounds how long claiming and releasing interfaces, and querying or
+// detaching their kernel drivers, may block on the Context's devices. A wedged device
+// can hold these ioctls indefinitely; past d the caller gets an OpTimeoutError instead.
+// The ioctl itself can't be interrupted, and finishes (or not) in the background. A
+// claim or release that completes after the caller gave up is still recorded, so a
+// late claim is released on Close like any other.
+func WithOpTimeout(d time.Duration) ContextOption {
+	return func(c *Context) { c.opTimeout = d }
+}
+
+// SetOpTimeout changes the operation timeout, see WithOpTimeout. Zero disables it.
+func (c *Context) SetOpTimeout(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.opTimeout = d
+}
+
+func (d *Device) opTimeout() time.Duration {
+	if d.st == nil {
+		return 0
+	}
+	d.st.mu.Lock()
+	ctx := d.ctx
+	d.st.mu.Unlock()
+	if ctx == nil {
+		return 0
+	}
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+	return ctx.opTimeout
+}
+
+// timed runs fn, giving up after the device's operation timeout, if any. If fn
+// succeeds, then is run, even when fn outlasted the timeout: it records what fn did.
+func (d *Device) timed(op string, fn func() error, then func()) error {
+	run := func() error {
+		err := fn()
+		if err == nil && then != nil {
+			then()
+		}
+		return err
+	}
+	timeout := d.opTimeout()
+	if timeout <= 0 {
+		return run()
+	}
+	done := make(chan error, 1)
+	go func() { done <- run() }()
+	expired, stop := clock().NewTimer(timeout)
+	defer stop()
+	select {
+	case err := <-done:
+		return err
+	case <-expired:
+		d.logf("usb: %s on %s still blocked after %v", op, d.PortPath(), timeout)
+		return &OpTimeoutError{Op: op, Timeout: timeout}
+	}
+}
@@ -0,0 +1,126 @@
+package usb
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pzl/usb/x/gusb"
+)
+
+// TestMode is a USB 2.0 electrical test mode, for compliance testing of a high-speed
+// port's signal quality.
+type TestMode uint8
+
+// Test modes, usb 2.0 section 7.1.20.
+const (
+	TestJ           TestMode = gusb.TestJ      // drive a constant J state
+	TestK           TestMode = gusb.TestK      // drive a constant K state
+	TestSE0NAK      TestMode = gusb.TestSE0NAK // receive, NAKing every IN
+	TestPacket      TestMode = gusb.TestPacket // repeat the test packet, for eye diagrams
+	TestForceEnable TestMode = gusb.TestForceEnable
+)
+
+func (m TestMode) String() string {
+	switch m {
+	case TestJ:
+		return "Test_J"
+	case TestK:
+		return "Test_K"
+	case TestSE0NAK:
+		return "Test_SE0_NAK"
+	case TestPacket:
+		return "Test_Packet"
+	case TestForceEnable:
+		return "Test_Force_Enable"
+	}
+	return fmt.Sprintf("TestMode(%d)", uint8(m))
+}
+
+// otgTimeout bounds the standard requests of this file.
+const otgTimeout = usbfsTimeoutMs * time.Millisecond
+
+// SetTestMode puts the device's upstream port into a test mode with SET_FEATURE
+// (TEST_MODE). The device enters it once the request completes, and leaves it only
+// when power cycled: it stops answering until then. Only high-speed devices have test
+// modes; TestForceEnable is for hub ports, see SetPortTestMode.
+func (d *Device) SetTestMode(m TestMode) error {
+	if _, err := d.ControlTransfer(testModeSetup(m), nil, otgTimeout); err != nil {
+		return fmt.Errorf("usb: setting %v: %w", m, err)
+	}
+	return nil
+}
+
+// SetPortTestMode puts a downstream port of the hub into a test mode with the hub
+// class SET_FEATURE(PORT_TEST). Per usb 2.0 section 11.24.2.13, the hub's ports must
+// be suspended, disabled or powered off first, and the hub reset afterwards.
+func (d *Device) SetPortTestMode(port int, m TestMode) error {
+	if !d.IsHub() {
+		return fmt.Errorf("usb: %s is not a hub", d.PortPath())
+	}
+	if port < 1 || port > 0xff {
+		return fmt.Errorf(badIndexNumber, "port", port)
+	}
+	if _, err := d.ControlTransfer(portTestSetup(port, m), nil, otgTimeout); err != nil {
+		return fmt.Errorf("usb: setting %v on port %d: %w", m, port, err)
+	}
+	return nil
+}
+
+// testModeSetup is SET_FEATURE(TEST_MODE), the test selector in wIndex's high byte.
+func testModeSetup(m TestMode) SetupPacket {
+	return SetupPacket{
+		RequestType: gusb.RequestDirOut | gusb.RequestTypeStandard | gusb.RecipientDevice,
+		Request:     gusb.RequestSetFeature,
+		Value:       gusb.FeatureTestMode,
+		Index:       uint16(m) << 8,
+	}
+}
+
+// portTestSetup is the hub's SET_FEATURE(PORT_TEST): the test selector in wIndex's
+// high byte, the port in its low byte.
+func portTestSetup(port int, m TestMode) SetupPacket {
+	return SetupPacket{
+		RequestType: gusb.RequestDirOut | gusb.RequestTypeClass | gusb.RecipientOther,
+		Request:     gusb.RequestSetFeature,
+		Value:       gusb.FeaturePortTest,
+		Index:       uint16(m)<<8 | uint16(port),
+	}
+}
+
+// OTGFeature is an OTG feature selector the host, as A-device, sets on a B-device.
+type OTGFeature uint16
+
+// OTG features, OTG 2.0 section 6.5.
+const (
+	OTGBHNPEnable     OTGFeature = gusb.FeatureBHNPEnable     // the B-device may take the host role
+	OTGAHNPSupport    OTGFeature = gusb.FeatureAHNPSupport    // the port supports HNP (OTG 1.3)
+	OTGAAltHNPSupport OTGFeature = gusb.FeatureAAltHNPSupport // HNP is on another port (OTG 1.3)
+)
+
+// SetOTGFeature sets an OTG feature of the device with SET_FEATURE.
+func (d *Device) SetOTGFeature(f OTGFeature) error {
+	_, err := d.Control(gusb.RequestDirOut|gusb.RequestTypeStandard|gusb.RecipientDevice,
+		gusb.RequestSetFeature, uint16(f), 0, nil, otgTimeout)
+	return err
+}
+
+// OTGHostRequest polls an OTG 2.0 B-device's status for its host request flag, set
+// while it wants to become host through HNP. Hosts poll every second or two.
+func (d *Device) OTGHostRequest() (bool, error) {
+	buf := make([]byte, 1)
+	n, err := d.ControlTransfer(otgStatusSetup(), buf, otgTimeout)
+	if err != nil {
+		return false, err
+	}
+	return n == 1 && buf[0]&gusb.OTGHostRequestFlag != 0, nil
+}
+
+// otgStatusSetup is GET_STATUS of the OTG status selector, one byte.
+func otgStatusSetup() SetupPacket {
+	return SetupPacket{
+		RequestType: gusb.RequestDirIn | gusb.RequestTypeStandard | gusb.RecipientDevice,
+		Request:     gusb.RequestGetStatus,
+		Index:       gusb.OTGStatusSelector,
+		Length:      1,
+	}
+}
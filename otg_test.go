@@ -0,0 +1,23 @@
+package usb_test
+
+import (
+	"testing"
+
+	"github.com/pzl/usb"
+)
+
+func TestOTGSetup(t *testing.T) {
+	for _, c := range []struct {
+		got  usb.SetupPacket
+		want string // on the wire
+	}{
+		{usb.SetupTestMode(usb.TestPacket), "00 03 0002 0400 0000"},
+		{usb.SetupPortTest(3, usb.TestK), "23 03 0015 0203 0000"},
+		{usb.SetupPortTest(0xff, usb.TestForceEnable), "23 03 0015 05ff 0000"},
+		{usb.SetupOTGStatus(), "80 00 0000 f000 0001"},
+	} {
+		if got := c.got.String(); got != c.want {
+			t.Errorf("setup packet %s, want %s", got, c.want)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package usb
+
+import (
+	"sync"
+	"time"
+)
+
+// Pacing limits the rate an OUT endpoint is written at, for device firmware that
+// overflows its buffers when the host writes at full bus speed. Zero rates are unlimited.
+// Burst is how far ahead of the rate a writer may get after being idle, in seconds' worth
+// of data; it defaults to a tenth of a second.
+type Pacing struct {
+	BytesPerSecond   float64
+	PacketsPerSecond float64
+	Burst            time.Duration
+}
+
+// SetPacing paces writes to the endpoint, synchronous and asynchronous.
+// A zero Pacing removes the limit.
+func (e *OutEndpoint) SetPacing(p Pacing) {
+	if e.i != nil && e.i.d != nil {
+		e.i.d.SetEndpointPacing(e.Address, p)
+	}
+}
+
+// SetEndpointPacing paces writes to the OUT endpoint with the given address.
+// Writes wait for their turn before starting; Submit blocks for it too.
+func (d *Device) SetEndpointPacing(addr int, p Pacing) {
+	d.st.mu.Lock()
+	defer d.st.mu.Unlock()
+	if p.BytesPerSecond <= 0 && p.PacketsPerSecond <= 0 {
+		delete(d.st.pacers, uint8(addr))
+		return
+	}
+	if d.st.pacers == nil {
+		d.st.pacers = make(map[uint8]*pacer)
+	}
+	d.st.pacers[uint8(addr)] = newPacer(p)
+}
+
+// pace waits until n bytes may be written to the endpoint.
+func (e *Endpoint) pace(n int) {
+	if e.i == nil || e.i.d == nil || e.i.d.st == nil {
+		return
+	}
+	st := e.i.d.st
+	st.mu.Lock()
+	p := st.pacers[uint8(e.Address)]
+	st.mu.Unlock()
+	if p == nil {
+		return
+	}
+	packets := 1 // a zero-length write is still a packet
+	if ps := e.PacketSize(); ps > 0 && n > ps {
+		packets = (n + ps - 1) / ps
+	}
+	clock().Sleep(p.reserve(float64(n), float64(packets)))
+}
+
+// pacer is a token bucket on bytes and one on packets, filled at the paced rates.
+type pacer struct {
+	Pacing
+
+	mu             sync.Mutex
+	bytes, packets float64 // tokens, negative when reserved ahead
+	last           time.Time
+}
+
+func newPacer(p Pacing) *pacer {
+	if p.Burst <= 0 {
+		p.Burst = 100 * time.Millisecond
+	}
+	return &pacer{
+		Pacing:  p,
+		bytes:   p.BytesPerSecond * p.Burst.Seconds(),
+		packets: p.PacketsPerSecond * p.Burst.Seconds(),
+		last:    clock().Now(),
+	}
+}
+
+// reserve takes tokens for a write, returning how long to wait before it.
+func (p *pacer) reserve(bytes, packets float64) time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := clock().Now()
+	elapsed := now.Sub(p.last).Seconds()
+	p.last = now
+
+	var wait time.Duration
+	take := func(tokens *float64, rate, n float64) {
+		if rate <= 0 {
+			return
+		}
+		*tokens = min(*tokens+elapsed*rate, rate*p.Burst.Seconds()) - n
+		if *tokens < 0 {
+			wait = max(wait, time.Duration(-*tokens/rate*float64(time.Second)))
+		}
+	}
+	take(&p.bytes, p.BytesPerSecond, bytes)
+	take(&p.packets, p.PacketsPerSecond, packets)
+	return wait
+}
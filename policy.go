@@ -0,0 +1,111 @@
+package usb
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrPolicy is matched by a PolicyError.
+var ErrPolicy = errors.New("usb: device refused by policy")
+
+// PolicyError is returned for a device the Context's Policy refuses: when listing it
+// through the Context, opening it, or transferring to it.
+type PolicyError struct {
+	Vendor, Product ID
+	PortPath        string
+	Reason          string
+}
+
+func (e *PolicyError) Error() string {
+	return fmt.Sprintf("usb: device %s:%s at %s refused by policy: %s", e.Vendor, e.Product, e.PortPath, e.Reason)
+}
+
+func (e *PolicyError) Is(target error) bool { return target == ErrPolicy }
+
+// Policy restricts which devices a Context may talk to, for deployments that must
+// never talk to rogue devices. A device matching any Deny matcher is refused. If there
+// are Allow matchers, a device must also match one of them.
+type Policy struct {
+	Allow []Matcher
+	Deny  []Matcher
+}
+
+// NewPolicy builds a Policy from match expressions (see ParseMatch), as kept in a
+// config file, e.g. allowing "vendor==1a86 && product==7523" and `serial~="LAB-*"`,
+// and denying "class==storage".
+func NewPolicy(allow, deny []string) (*Policy, error) {
+	p := &Policy{}
+	for _, expr := range allow {
+		m, err := ParseMatch(expr)
+		if err != nil {
+			return nil, err
+		}
+		p.Allow = append(p.Allow, m)
+	}
+	for _, expr := range deny {
+		m, err := ParseMatch(expr)
+		if err != nil {
+			return nil, err
+		}
+		p.Deny = append(p.Deny, m)
+	}
+	return p, nil
+}
+
+// Check returns a PolicyError if the policy refuses d.
+func (p *Policy) Check(d *Device) error {
+	refuse := func(reason string) error {
+		return &PolicyError{Vendor: d.Vendor, Product: d.Product, PortPath: d.PortPath(), Reason: reason}
+	}
+	for i, m := range p.Deny {
+		if m(d) {
+			return refuse(fmt.Sprintf("matches deny rule %d", i))
+		}
+	}
+	if len(p.Allow) == 0 {
+		return nil
+	}
+	for _, m := range p.Allow {
+		if m(d) {
+			return nil
+		}
+	}
+	return refuse("matches no allow rule")
+}
+
+// WithPolicy makes the Context enforce p on its devices.
+func WithPolicy(p *Policy) ContextOption {
+	return func(c *Context) { c.policy = p }
+}
+
+// SetPolicy replaces the Context's policy, nil for none. Devices the Context already
+// holds are checked again: transfers to those now refused fail with a PolicyError.
+func (c *Context) SetPolicy(p *Policy) {
+	c.mu.Lock()
+	c.policy = p
+	devs := make([]*Device, 0, len(c.devices))
+	for d := range c.devices {
+		devs = append(devs, d)
+	}
+	c.mu.Unlock()
+	for _, d := range devs {
+		var err error
+		if p != nil {
+			err = p.Check(d)
+		}
+		d.st.mu.Lock()
+		d.st.refused = err
+		d.st.mu.Unlock()
+	}
+}
+
+// checkPolicy returns the error of the Context's policy for d, if any.
+func (c *Context) checkPolicy(d *Device) error {
+	c.mu.Lock()
+	p := c.policy
+	c.mu.Unlock()
+	if p == nil {
+		return nil
+	}
+	return p.Check(d)
+}
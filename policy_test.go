@@ -0,0 +1,38 @@
+package usb_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/pzl/usb"
+)
+
+func TestPolicy(t *testing.T) {
+	p, err := usb.NewPolicy([]string{"class==hub", `serial~="W*"`}, []string{"class==storage"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, w := openWidget(t, usb.WithPolicy(p))
+	if err := w.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	// now only hubs are allowed: the open widget is cut off
+	hubsOnly, _ := usb.NewPolicy([]string{"class==hub"}, nil)
+	ctx.SetPolicy(hubsOnly)
+	if _, err := w.ActiveConfig.Interfaces[0].Endpoints[0].Submit(make([]byte, 64)); !errors.Is(err, usb.ErrPolicy) {
+		t.Errorf("transfer after policy change: %v", err)
+	}
+	intf := &w.ActiveConfig.Interfaces[0]
+	for op, err := range map[string]error{"reset": w.Reset(), "release": intf.Release(), "set alt": intf.SetAlt(0)} {
+		if !errors.Is(err, usb.ErrPolicy) {
+			t.Errorf("%s after policy change: %v", op, err)
+		}
+	}
+	if _, err := w.Status(); !errors.Is(err, usb.ErrPolicy) {
+		t.Errorf("status after policy change: %v", err)
+	}
+	if _, err := ctx.OpenDevices(func(d *usb.Device) bool { return d.Vendor == 0x1234 }); !errors.Is(err, usb.ErrPolicy) {
+		t.Errorf("listing refused device: %v", err)
+	}
+}
@@ -0,0 +1,123 @@
+package usb
+
+// EndpointPriority orders queued asynchronous transfers between endpoints of a device,
+// once AsyncOptions.MaxInFlight is reached. Queued transfers of endpoints with a higher
+// Level are always submitted first. Endpoints sharing a Level take turns in proportion
+// to their Weight (minimum, and default, 1). Transfers of one endpoint keep their order.
+type EndpointPriority struct {
+	Level  int
+	Weight int
+}
+
+// SetEndpointPriority sets the priority of the endpoint with the given address.
+// For example, keeping an interrupt status endpoint serviced during a large bulk upload:
+//
+//	dev.SetAsyncOptions(usb.AsyncOptions{MaxInFlight: 8})
+//	dev.SetEndpointPriority(0x81, usb.EndpointPriority{Level: 1})
+func (d *Device) SetEndpointPriority(addr int, p EndpointPriority) {
+	d.st.mu.Lock()
+	defer d.st.mu.Unlock()
+	if d.st.priorities == nil {
+		d.st.priorities = make(map[uint8]EndpointPriority)
+	}
+	d.st.priorities[uint8(addr)] = p
+	if d.st.async != nil {
+		d.st.async.setPriority(uint8(addr), p)
+	}
+}
+
+// epQueue holds transfers of one endpoint waiting for a submission slot.
+type epQueue struct {
+	EndpointPriority
+	credit int // smooth weighted round-robin state
+	intf   int // interface of the endpoint
+	q      []*Transfer
+}
+
+func (eng *asyncEngine) queue(addr uint8) *epQueue {
+	q, ok := eng.queues[addr]
+	if !ok {
+		q = &epQueue{EndpointPriority: EndpointPriority{Weight: 1}}
+		eng.queues[addr] = q
+	}
+	return q
+}
+
+func (eng *asyncEngine) setPriority(addr uint8, p EndpointPriority) {
+	eng.mu.Lock()
+	defer eng.mu.Unlock()
+	if p.Weight < 1 {
+		p.Weight = 1
+	}
+	eng.queue(addr).EndpointPriority = p
+}
+
+func (eng *asyncEngine) enqueue(t *Transfer) {
+	q := eng.queue(t.urb.Endpoint)
+	q.intf = t.intf()
+	q.q = append(q.q, t)
+	t.queued = true
+}
+
+func (eng *asyncEngine) unqueue(t *Transfer) {
+	q := eng.queue(t.urb.Endpoint)
+	for i := range q.q {
+		if q.q[i] == t {
+			q.q = append(q.q[:i], q.q[i+1:]...)
+			break
+		}
+	}
+	t.queued = false
+}
+
+// anyQueued reports whether transfers are waiting for a slot intf could take.
+func (eng *asyncEngine) anyQueued(intf int) bool {
+	for _, q := range eng.queues {
+		if len(q.q) > 0 && (!eng.perIntf || q.intf == intf) {
+			return true
+		}
+	}
+	return false
+}
+
+// next pops the transfer to submit next: from the highest level with anything queued
+// and a slot free, picking between endpoints of that level by smooth weighted round-robin.
+func (eng *asyncEngine) next() *Transfer {
+	var best *epQueue
+	total := 0
+	level, found := 0, false
+	for _, q := range eng.queues {
+		if len(q.q) > 0 && !eng.full(q.intf) && (!found || q.Level > level) {
+			level, found = q.Level, true
+		}
+	}
+	if !found {
+		return nil
+	}
+	for _, q := range eng.queues {
+		if len(q.q) == 0 || q.Level != level || eng.full(q.intf) {
+			continue
+		}
+		q.credit += q.Weight
+		total += q.Weight
+		if best == nil || q.credit > best.credit {
+			best = q
+		}
+	}
+	best.credit -= total
+	t := best.q[0]
+	best.q = best.q[1:]
+	t.queued = false
+	return t
+}
+
+func (eng *asyncEngine) cancelQueued(err error) {
+	for _, q := range eng.queues {
+		for _, t := range q.q {
+			t.queued = false
+			t.err = err
+			t.finish()
+		}
+		q.q = nil
+	}
+}
@@ -0,0 +1,43 @@
+package usb_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/pzl/usb"
+)
+
+func TestEndpointPriority(t *testing.T) {
+	// a higher level drains first
+	order := usb.DispatchOrder(map[uint8]usb.EndpointPriority{0x81: {Level: 1}, 0x02: {}}, 3)
+	if want := []uint8{0x81, 0x81, 0x81, 0x02, 0x02, 0x02}; !slices.Equal(order, want) {
+		t.Errorf("levels: order % x, want % x", order, want)
+	}
+
+	// a level shares its slots by weight, spread out rather than in runs: 3 to 1 in
+	// every 4 submissions while both have transfers queued. Weight 0 counts as 1
+	for _, c := range []struct {
+		prios  map[uint8]usb.EndpointPriority
+		window int
+		share  int // of 0x02 in each window
+	}{
+		{map[uint8]usb.EndpointPriority{0x02: {Weight: 3}, 0x83: {Weight: 1}}, 4, 3},
+		{map[uint8]usb.EndpointPriority{0x02: {}, 0x83: {Weight: 1}}, 2, 1},
+	} {
+		order := usb.DispatchOrder(c.prios, 6)
+		if len(order) != 12 {
+			t.Fatalf("%v: submitted %d of 12", c.prios, len(order))
+		}
+		for start := 0; start+c.window <= 8; start += c.window {
+			n := 0
+			for _, addr := range order[start : start+c.window] {
+				if addr == 0x02 {
+					n++
+				}
+			}
+			if n != c.share {
+				t.Errorf("%v: order % x, %d of 02 in submissions %d to %d, want %d", c.prios, order, n, start, start+c.window, c.share)
+			}
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package usb
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Rule gives a user-defined Name (and optional Settings) to any device matching all of its
+// non-empty criteria, much like a udev rule. VID and PID are hexadecimal, with or without
+// a 0x prefix. PortPath is the sysfs-style path of the device, e.g. "3-1.2". Match is
+// a match expression for anything else, see ParseMatch.
+type Rule struct {
+	VID      string            `json:"vid,omitempty" yaml:"vid,omitempty"`
+	PID      string            `json:"pid,omitempty" yaml:"pid,omitempty"`
+	Serial   string            `json:"serial,omitempty" yaml:"serial,omitempty"`
+	PortPath string            `json:"port_path,omitempty" yaml:"port_path,omitempty"`
+	Match    string            `json:"match,omitempty" yaml:"match,omitempty"`
+	Name     string            `json:"name" yaml:"name"`
+	Settings map[string]string `json:"settings,omitempty" yaml:"settings,omitempty"`
+}
+
+// Rules is an ordered list of naming rules. The first matching Rule wins.
+type Rules []Rule
+
+// LoadRules reads a JSON array of Rule from r.
+func LoadRules(r io.Reader) (Rules, error) {
+	var rs Rules
+	if err := json.NewDecoder(r).Decode(&rs); err != nil {
+		return nil, fmt.Errorf("usb: unable to decode rules: %w", err)
+	}
+	return rs, rs.Validate()
+}
+
+// DecodeRules decodes a list of Rule from data with unmarshal, and validates them.
+// It reads rules in formats the package has no decoder for: pass yaml.Unmarshal of
+// gopkg.in/yaml.v3 for YAML, which uses the yaml struct tags of Rule.
+func DecodeRules(data []byte, unmarshal func([]byte, any) error) (Rules, error) {
+	var rs Rules
+	if err := unmarshal(data, &rs); err != nil {
+		return nil, fmt.Errorf("usb: unable to decode rules: %w", err)
+	}
+	return rs, rs.Validate()
+}
+
+// Validate checks every rule has a name, and parseable IDs and match expression.
+func (rs Rules) Validate() error {
+	for i, r := range rs {
+		if r.Name == "" {
+			return fmt.Errorf("usb: rule %d has no name", i)
+		}
+		if _, err := parseRuleID(r.VID); err != nil {
+			return fmt.Errorf("usb: rule %d (%s): bad vid: %w", i, r.Name, err)
+		}
+		if _, err := parseRuleID(r.PID); err != nil {
+			return fmt.Errorf("usb: rule %d (%s): bad pid: %w", i, r.Name, err)
+		}
+		if r.Match != "" {
+			if _, err := ParseMatch(r.Match); err != nil {
+				return fmt.Errorf("usb: rule %d (%s): %w", i, r.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Matches reports whether d satisfies every criteria set in the rule.
+// A rule with no criteria matches nothing.
+func (r Rule) Matches(d *Device) bool {
+	if r.VID == "" && r.PID == "" && r.Serial == "" && r.PortPath == "" && r.Match == "" {
+		return false
+	}
+	if r.VID != "" {
+		if vid, err := parseRuleID(r.VID); err != nil || vid != d.Vendor {
+			return false
+		}
+	}
+	if r.PID != "" {
+		if pid, err := parseRuleID(r.PID); err != nil || pid != d.Product {
+			return false
+		}
+	}
+	if r.Serial != "" && r.Serial != d.Serial {
+		return false
+	}
+	if r.PortPath != "" && r.PortPath != d.PortPath() {
+		return false
+	}
+	if r.Match != "" {
+		if m, err := ParseMatch(r.Match); err != nil || !m(d) {
+			return false
+		}
+	}
+	return true
+}
+
+// Match returns the first rule matching d, or nil.
+func (rs Rules) Match(d *Device) *Rule {
+	for i := range rs {
+		if rs[i].Matches(d) {
+			return &rs[i]
+		}
+	}
+	return nil
+}
+
+// Apply sets the alias of each device to its first matching rule.
+// Devices matching no rule have their alias cleared.
+func (rs Rules) Apply(devs ...*Device) {
+	for _, d := range devs {
+		d.rule = rs.Match(d)
+	}
+}
+
+func parseRuleID(s string) (ID, error) {
+	if s == "" {
+		return 0, nil
+	}
+	return ParseID(s)
+}
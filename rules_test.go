@@ -0,0 +1,80 @@
+package usb_test
+
+import (
+	"encoding/json"
+	"maps"
+	"strings"
+	"testing"
+
+	"github.com/pzl/usb"
+)
+
+func TestRules(t *testing.T) {
+	rs, err := usb.LoadRules(strings.NewReader(`[
+		{"vid": "0x1234", "pid": "5678", "port_path": "1-2.4", "name": "elsewhere"},
+		{"vid": "1234", "serial": "W0001", "name": "widget", "settings": {"baud": "9600"}},
+		{"match": "vendor==1234", "name": "any-acme"},
+		{"match": "class==hub", "name": "hub"}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := fixtureTree(t)
+	ctx := usb.NewContext(usb.WithRoots(tree.Roots))
+	defer ctx.Close()
+	ctx.SetRules(rs)
+	devs, err := ctx.OpenDevices(func(*usb.Device) bool { return true })
+	for _, d := range devs {
+		defer d.Close()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	aliases := map[string]string{}
+	for _, d := range devs {
+		aliases[d.PortPath()] = d.Alias()
+	}
+	// the widget's port rules out the first rule; the second, ahead of the third, names it
+	if want := map[string]string{"usb1": "hub", "1-2": "hub", "1-2.3": "widget"}; !maps.Equal(aliases, want) {
+		t.Errorf("aliases %v, want %v", aliases, want)
+	}
+
+	w := devs[0]
+	for _, d := range devs {
+		if d.Vendor == 0x1234 {
+			w = d
+		}
+	}
+	if r := w.Rule(); r == nil || r.Settings["baud"] != "9600" {
+		t.Errorf("widget rule %+v", r)
+	}
+	if (usb.Rule{Name: "empty"}).Matches(w) {
+		t.Error("a rule without criteria matched")
+	}
+	usb.Rules{{Serial: "nope", Name: "other"}}.Apply(w)
+	if w.Alias() != "" {
+		t.Errorf("alias %q after no rule matched", w.Alias())
+	}
+}
+
+func TestRulesInvalid(t *testing.T) {
+	for _, src := range []string{
+		`[{"vid": "1234"}]`,
+		`[{"vid": "xyz", "name": "a"}]`,
+		`[{"pid": "123456", "name": "a"}]`,
+		`[{"match": "vendor==", "name": "a"}]`,
+		`{"name": "a"}`,
+	} {
+		if _, err := usb.LoadRules(strings.NewReader(src)); err == nil {
+			t.Errorf("loaded %s", src)
+		}
+	}
+	// other formats go through their own unmarshal, and are validated alike
+	if _, err := usb.DecodeRules([]byte(`[{"vid": "1234"}]`), json.Unmarshal); err == nil {
+		t.Error("decoded a rule without a name")
+	}
+	rs, err := usb.DecodeRules([]byte(`[{"serial": "W0001", "name": "widget"}]`), json.Unmarshal)
+	if err != nil || len(rs) != 1 || rs[0].Name != "widget" {
+		t.Errorf("decoded %+v, %v", rs, err)
+	}
+}
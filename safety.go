@@ -0,0 +1,181 @@
+package usb
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pzl/usb/x/gusb"
+)
+
+// ErrUnsafeDetach is matched by an UnsafeDetachError.
+var ErrUnsafeDetach = errors.New("usb: refusing to detach kernel driver")
+
+// UnsafeDetachError is returned by Claim instead of detaching a kernel driver the
+// machine likely depends on: a hub's, a boot keyboard or mouse's, or a mass storage
+// driver with filesystems mounted or otherwise in use. Claim with Force or WarnOnly
+// to detach anyway.
+type UnsafeDetachError struct {
+	Interface int
+	Driver    string
+	Reason    string
+}
+
+func (e *UnsafeDetachError) Error() string {
+	return fmt.Sprintf("usb: refusing to detach driver %s from interface %d: %s (claim with usb.Force or usb.WarnOnly to override)", e.Driver, e.Interface, e.Reason)
+}
+
+func (e *UnsafeDetachError) Is(target error) bool { return target == ErrUnsafeDetach }
+
+// ClaimOption configures Interface.Claim.
+type ClaimOption func(*claimOptions)
+
+type claimOptions struct {
+	force       bool
+	warn        bool
+	driverFlags uint32 // gusb.DisconnectClaim* filter on the driver detached
+	driver      string
+	pinned      bool // the filter is the driver checkDetach saw, not the caller's
+}
+
+// Force lets Claim detach kernel drivers the safety interlock would refuse to.
+func Force() ClaimOption { return func(o *claimOptions) { o.force = true } }
+
+// WarnOnly makes Claim log why detaching a driver is unsafe, then detach it anyway,
+// rather than refuse. Force skips the checks altogether.
+func WarnOnly() ClaimOption { return func(o *claimOptions) { o.warn = true } }
+
+// IfDriver makes Claim detach only the named kernel driver: if another is bound, Claim
+// fails with EBUSY and leaves it be. The check and the claim are a single ioctl, so the
+// decision holds even if drivers are re-bound concurrently.
+func IfDriver(name string) ClaimOption {
+	return func(o *claimOptions) { o.driverFlags, o.driver = gusb.DisconnectClaimIfDriver, name }
+}
+
+// ExceptDriver makes Claim fail with EBUSY rather than detach the named kernel driver.
+func ExceptDriver(name string) ClaimOption {
+	return func(o *claimOptions) { o.driverFlags, o.driver = gusb.DisconnectClaimExceptDriver, name }
+}
+
+// checkDetach returns an UnsafeDetachError if the interface's bound kernel driver
+// should not be detached. Without sysfs, or with no driver bound, there is nothing to check.
+// checked reports whether sysfs was read, and driver is what it found bound, if anything.
+func (i *Interface) checkDetach() (driver string, checked bool, err error) {
+	p, err := i.sysPath()
+	if err != nil {
+		return "", false, nil
+	}
+	link, err := os.Readlink(filepath.Join(p, "driver"))
+	if os.IsNotExist(err) {
+		return "", true, nil
+	} else if err != nil {
+		return "", false, nil
+	}
+	driver = filepath.Base(link)
+	if driver == "usbfs" {
+		return driver, true, nil
+	}
+
+	unsafe := func(reason string) (string, bool, error) {
+		return driver, true, &UnsafeDetachError{Interface: i.ID, Driver: driver, Reason: reason}
+	}
+	switch {
+	case i.d.Class == gusb.USBClassHub || i.Class == gusb.USBClassHub:
+		return unsafe("it is a hub, every device behind it would disconnect")
+	case i.Class == gusb.USBClassHID && i.SubClass == 1 && (i.Protocol == 1 || i.Protocol == 2):
+		return unsafe("it is a boot keyboard or mouse")
+	case i.Class == gusb.USBClassMassStorage || driver == "usb-storage" || driver == "uas":
+		// vendor-specific storage is bound to usb-storage by quirk, so check by driver too
+		if mounted := mountedBlockDevices(p); len(mounted) > 0 {
+			return unsafe("it has mounted filesystems on " + strings.Join(mounted, ", "))
+		}
+		if used := heldBlockDevices(p); len(used) > 0 {
+			return unsafe("its block devices are in use by " + strings.Join(used, ", "))
+		}
+	}
+	return driver, true, nil
+}
+
+// blockDevices returns the block devices, and their partitions, below a sysfs
+// interface directory: their maj:min numbers mapped to their directories.
+func blockDevices(intfPath string) map[string]string {
+	devs := make(map[string]string)
+	if real, err := filepath.EvalSymlinks(intfPath); err == nil {
+		intfPath = real // sys/bus/usb/devices entries are links, which Walk doesn't follow
+	}
+	filepath.Walk(intfPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		var dir string
+		switch {
+		case info.IsDir() && filepath.Base(filepath.Dir(path)) == "block":
+			dir = path // a disk
+		case info.Name() == "partition":
+			dir = filepath.Dir(path) // one of its partitions
+		default:
+			return nil
+		}
+		if b, err := os.ReadFile(filepath.Join(dir, "dev")); err == nil {
+			devs[strings.TrimSpace(string(b))] = dir
+		}
+		return nil
+	})
+	return devs
+}
+
+// heldBlockDevices returns what uses the block devices below a sysfs interface directory
+// without a mount: device-mapper or md devices stacked on them (sysfs holders), and swap.
+func heldBlockDevices(intfPath string) []string {
+	var used []string
+	names := make(map[string]bool)
+	for _, dir := range blockDevices(intfPath) {
+		names[filepath.Base(dir)] = true
+		holders, _ := os.ReadDir(filepath.Join(dir, "holders"))
+		for _, h := range holders {
+			used = append(used, filepath.Base(dir)+" (held by "+h.Name()+")")
+		}
+	}
+	if b, err := os.ReadFile("/proc/swaps"); err == nil {
+		for _, line := range strings.Split(string(b), "\n") {
+			if f := strings.Fields(line); len(f) > 0 && names[filepath.Base(f[0])] {
+				used = append(used, filepath.Base(f[0])+" (swap)")
+			}
+		}
+	}
+	return used
+}
+
+// mountedBlockDevices returns the block devices (and partitions) below a sysfs
+// interface directory that appear in the mount table.
+func mountedBlockDevices(intfPath string) []string {
+	devs := blockDevices(intfPath)
+	if len(devs) == 0 {
+		return nil
+	}
+
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	seen := make(map[string]bool)
+	var mounted []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		// id parent major:minor root mountpoint ...
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 3 {
+			continue
+		}
+		if dir, ok := devs[fields[2]]; ok && !seen[filepath.Base(dir)] {
+			name := filepath.Base(dir)
+			seen[name] = true
+			mounted = append(mounted, name)
+		}
+	}
+	return mounted
+}
@@ -0,0 +1,58 @@
+package usb_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pzl/usb"
+	"github.com/pzl/usb/usbtest"
+)
+
+func TestClaimStorageInUse(t *testing.T) {
+	tree := fixtureTree(t)
+	disk := usbtest.Device{
+		Bus: 1, Dev: 4, Ports: []int{1}, Vendor: 0x0781, Product: 0x5567,
+		Configs: []usbtest.Config{{Value: 1, Interfaces: []usbtest.Interface{{
+			Class: 0x08, SubClass: 0x06, Protocol: 0x50, Driver: "usb-storage",
+			Endpoints: []usbtest.Endpoint{
+				{Address: 0x81, Attributes: 0x02, MaxPacketSize: 512},
+				{Address: 0x02, Attributes: 0x02, MaxPacketSize: 512},
+			},
+		}}}},
+	}
+	if err := tree.Add(disk); err != nil {
+		t.Fatal(err)
+	}
+	// sdb, with a device-mapper device stacked on it
+	block := filepath.Join(tree.Roots.SysFS, "1-1:1.0", "host0", "target0:0:0", "0:0:0:0", "block", "sdb")
+	if err := os.MkdirAll(filepath.Join(block, "holders", "dm-0"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(block, "dev"), []byte("8:16\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	devs, err := usb.List(usb.ListRoots(tree.Roots))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range devs {
+		if d.Vendor != 0x0781 {
+			continue
+		}
+		intf, err := d.InterfaceByNumber(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := intf.Claim(); !errors.Is(err, usb.ErrUnsafeDetach) {
+			t.Errorf("Claim: %v, want ErrUnsafeDetach", err)
+		}
+		if err := intf.Claim(usb.WarnOnly()); errors.Is(err, usb.ErrUnsafeDetach) {
+			t.Errorf("Claim(WarnOnly): %v", err)
+		}
+		return
+	}
+	t.Fatal("storage device not listed")
+}
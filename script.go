@@ -0,0 +1,211 @@
+//go:build !usb_core
+
+package usb
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/pzl/usb/x/gusb"
+)
+
+// ErrUnexpectedData is returned by a script's read or IN control step when the data
+// doesn't start with the expected bytes.
+var ErrUnexpectedData = errors.New("usb: unexpected data")
+
+// Script is a declarative init sequence for a device: the claims, alternate settings,
+// control requests and transfers that bring it up, loaded from a file rather than
+// written in Go for each new device. E.g., in JSON:
+//
+//	{"name": "widget", "steps": [
+//		{"op": "claim", "interface": 1},
+//		{"op": "alt", "interface": 1, "alt": 2},
+//		{"op": "control", "request_type": 64, "request": 1, "value": 3},
+//		{"op": "write", "endpoint": 2, "data": "55 aa 01"},
+//		{"op": "read", "endpoint": 129, "length": 64, "expect": "55 aa"}
+//	]}
+type Script struct {
+	Name  string `json:"name,omitempty"`
+	Steps []Step `json:"steps"`
+}
+
+// Step is one operation of a Script. Op is one of:
+//
+//	claim    claim Interface
+//	release  release Interface
+//	alt      select alternate setting Alt of Interface
+//	control  a control request: RequestType, Request, Value, Index, then Data sent,
+//	         or for IN requests Length bytes read and checked against Expect
+//	write    write Data to Endpoint
+//	read     read up to Length bytes from Endpoint, checked against Expect
+//	sleep    wait DelayMs
+//
+// Data and Expect are hex bytes, optionally separated by spaces or colons.
+type Step struct {
+	Op          string `json:"op"`
+	Interface   int    `json:"interface,omitempty"`
+	Alt         int    `json:"alt,omitempty"`
+	Endpoint    int    `json:"endpoint,omitempty"` // address, direction bit included
+	RequestType uint8  `json:"request_type,omitempty"`
+	Request     uint8  `json:"request,omitempty"`
+	Value       uint16 `json:"value,omitempty"`
+	Index       uint16 `json:"index,omitempty"`
+	Data        string `json:"data,omitempty"`
+	Length      int    `json:"length,omitempty"`
+	Expect      string `json:"expect,omitempty"`     // a prefix of the data read
+	TimeoutMs   int    `json:"timeout_ms,omitempty"` // default 1000
+	DelayMs     int    `json:"delay_ms,omitempty"`
+}
+
+// StepError is the error of a Script step, numbered from 0.
+type StepError struct {
+	Step int
+	Op   string
+	Err  error
+}
+
+func (e *StepError) Error() string {
+	return fmt.Sprintf("usb: script step %d (%s): %v", e.Step, e.Op, e.Err)
+}
+
+func (e *StepError) Unwrap() error { return e.Err }
+
+// LoadScript reads a JSON Script from r.
+func LoadScript(r io.Reader) (*Script, error) {
+	var s Script
+	if err := json.NewDecoder(r).Decode(&s); err != nil {
+		return nil, fmt.Errorf("usb: unable to decode script: %w", err)
+	}
+	return &s, s.Validate()
+}
+
+// Validate checks every step has a known op, parseable hex bytes, and a length that
+// fits a control request: 0 to 65535.
+func (s *Script) Validate() error {
+	for i, st := range s.Steps {
+		var err error
+		switch st.Op {
+		case "claim", "release", "alt", "sleep":
+		case "control", "write", "read":
+			var data []byte
+			if data, err = parseHexBytes(st.Data); err == nil {
+				_, err = parseHexBytes(st.Expect)
+			}
+			if err == nil && (st.Length < 0 || st.Length > 0xffff || len(data) > 0xffff) {
+				err = fmt.Errorf("length %d, %d data bytes: out of range", st.Length, len(data))
+			}
+		default:
+			err = errors.New("unknown op")
+		}
+		if err != nil {
+			return &StepError{Step: i, Op: st.Op, Err: err}
+		}
+	}
+	return nil
+}
+
+// Run validates the script, then runs the steps in order on an open device, stopping
+// at the first to fail.
+func (s *Script) Run(ctx context.Context, d *Device) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+	for i, st := range s.Steps {
+		if err := st.run(ctx, d); err != nil {
+			return &StepError{Step: i, Op: st.Op, Err: err}
+		}
+	}
+	return nil
+}
+
+func (st Step) run(ctx context.Context, d *Device) error {
+	timeout := time.Duration(st.TimeoutMs) * time.Millisecond
+	if timeout <= 0 {
+		timeout = time.Second
+	}
+	data, err := parseHexBytes(st.Data)
+	if err != nil {
+		return err
+	}
+	expect, err := parseHexBytes(st.Expect)
+	if err != nil {
+		return err
+	}
+
+	switch st.Op {
+	case "claim", "release", "alt":
+		intf, err := d.InterfaceByNumber(st.Interface)
+		if err != nil {
+			return err
+		}
+		switch st.Op {
+		case "claim":
+			return intf.Claim()
+		case "release":
+			return intf.Release()
+		}
+		return intf.SetAlt(st.Alt)
+	case "control":
+		setup := gusb.SetupPacket{RequestType: st.RequestType, Request: st.Request, Value: st.Value, Index: st.Index}
+		if setup.In() {
+			data = make([]byte, st.Length)
+		}
+		setup.Length = uint16(len(data))
+		n, err := d.ControlTransfer(setup, data, timeout)
+		if err != nil || !setup.In() {
+			return err
+		}
+		return checkExpect(data[:n], expect)
+	case "write", "read":
+		ep, err := d.Endpoint(st.Endpoint)
+		if err != nil {
+			return err
+		}
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		if st.Op == "write" {
+			_, err = (&OutEndpoint{Endpoint: *ep}).WriteContext(ctx, data)
+			return err
+		}
+		buf := make([]byte, st.Length)
+		n, err := (&InEndpoint{Endpoint: *ep}).ReadContext(ctx, buf)
+		if err != nil {
+			return err
+		}
+		return checkExpect(buf[:n], expect)
+	case "sleep":
+		done, stop := clock().NewTimer(time.Duration(st.DelayMs) * time.Millisecond)
+		defer stop()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-done:
+			return nil
+		}
+	}
+	return errors.New("unknown op")
+}
+
+func checkExpect(got, expect []byte) error {
+	if !bytes.HasPrefix(got, expect) {
+		return fmt.Errorf("%w: got % x, want % x", ErrUnexpectedData, got, expect)
+	}
+	return nil
+}
+
+// parseHexBytes parses bytes like "55 aa 01", "55:aa:01" or "55aa01".
+func parseHexBytes(s string) ([]byte, error) {
+	s = strings.NewReplacer(" ", "", ":", "", "\t", "").Replace(s)
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("bad hex bytes %q", s)
+	}
+	return b, nil
+}
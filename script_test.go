@@ -0,0 +1,82 @@
+//go:build !usb_core
+
+package usb_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/pzl/usb"
+)
+
+func TestScript(t *testing.T) {
+	for _, bad := range []string{
+		`{"steps": [{"op": "claim"}, {"op": "write", "data": "5g"}]}`,
+		`{"steps": [{"op": "read", "endpoint": 129, "length": -1}]}`,
+		`{"steps": [{"op": "control", "request_type": 192, "length": 65536}]}`,
+	} {
+		if _, err := usb.LoadScript(strings.NewReader(bad)); err == nil {
+			t.Errorf("loaded %s", bad)
+		}
+	}
+
+	var claimed []int
+	_, w := openWidget(t, usb.WithClaimHooks(func(i *usb.Interface, next func() error) error {
+		claimed = append(claimed, i.ID)
+		return nil
+	}))
+	if err := w.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := usb.LoadScript(strings.NewReader(`{"name": "widget", "steps": [
+		{"op": "claim", "interface": 1},
+		{"op": "claim", "interface": 0},
+		{"op": "sleep", "delay_ms": 1},
+		{"op": "claim", "interface": 7}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Run(context.Background(), w)
+	var se *usb.StepError
+	if !errors.As(err, &se) || se.Step != 3 || !errors.Is(err, usb.ErrInvalidInterfaceIndex) {
+		t.Errorf("run: %v", err)
+	}
+	if len(claimed) != 2 || claimed[0] != 1 || claimed[1] != 0 {
+		t.Errorf("claimed %v", claimed)
+	}
+}
+
+func TestScriptTransfers(t *testing.T) {
+	_, w := openWidget(t)
+	if err := w.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the fixture's node takes no ioctls: each step gets as far as the kernel. Reads
+	// and writes go through the completion loop, which may have failed on the node
+	// first, closing it to transfers
+	for _, tc := range []struct {
+		step usb.Step
+		want error
+	}{
+		{usb.Step{Op: "control", RequestType: 0xc0, Request: 1, Length: 4, Expect: "55"}, syscall.ENOTTY},
+		{usb.Step{Op: "control", RequestType: 0x40, Request: 1, Data: "55 aa"}, syscall.ENOTTY},
+		{usb.Step{Op: "write", Endpoint: 0x02, Data: "55 aa 01"}, syscall.ENOTTY},
+		{usb.Step{Op: "read", Endpoint: 0x81, Length: 64, Expect: "55 aa"}, syscall.ENOTTY},
+		{usb.Step{Op: "read", Endpoint: 0x85, Length: 64}, nil},
+		{usb.Step{Op: "read", Endpoint: 0x81, Length: -1}, nil},
+	} {
+		s := &usb.Script{Steps: []usb.Step{tc.step}}
+		err := s.Run(context.Background(), w)
+		var se *usb.StepError
+		kernel := errors.Is(err, tc.want) || (tc.step.Op != "control" && errors.Is(err, usb.ErrClosed))
+		if !errors.As(err, &se) || se.Step != 0 || (tc.want != nil && !kernel) {
+			t.Errorf("%+v: %v", tc.step, err)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package usb
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SensorKind is what a Sensor measures.
+type SensorKind string
+
+const (
+	SensorTemperature SensorKind = "temperature" // °C
+	SensorVoltage     SensorKind = "voltage"     // V
+	SensorCurrent     SensorKind = "current"     // A
+	SensorPower       SensorKind = "power"       // W
+	SensorEnergy      SensorKind = "energy"      // Wh
+	SensorFan         SensorKind = "fan"         // RPM
+	SensorCapacity    SensorKind = "capacity"    // percent charged
+)
+
+// Sensor is one reading from a hwmon or power_supply device the kernel created for
+// a USB device, such as a temperature dongle, a UPS, or a battery pack.
+type Sensor struct {
+	Source string // hwmon chip name, or power supply name, e.g. "BAT1"
+	Name   string // the reading's label if it has one, else e.g. "temp1" or "voltage_now"
+	Kind   SensorKind
+	Value  float64 // in the unit of its Kind
+	Status string  // power supplies only: Charging, Discharging, Full...
+}
+
+// hwmonInput matches hwmon readings, e.g. temp1_input, and gives the scale to the
+// SensorKind's unit from sysfs' (milli°C, mV, mA, µW, µJ).
+var hwmonInput = regexp.MustCompile(`^(temp|in|curr|power|energy|fan)(\d+)_(input|average)$`)
+
+var hwmonKinds = map[string]struct {
+	kind  SensorKind
+	scale float64
+}{
+	"temp":   {SensorTemperature, 1e-3},
+	"in":     {SensorVoltage, 1e-3},
+	"curr":   {SensorCurrent, 1e-3},
+	"power":  {SensorPower, 1e-6},
+	"energy": {SensorEnergy, 1e-6 / 3600},
+	"fan":    {SensorFan, 1},
+}
+
+// power_supply attributes, and their scale from sysfs' (µV, µA, µW, µWh, tenths of °C).
+var supplyAttrs = map[string]struct {
+	kind  SensorKind
+	scale float64
+}{
+	"voltage_now": {SensorVoltage, 1e-6},
+	"current_now": {SensorCurrent, 1e-6},
+	"power_now":   {SensorPower, 1e-6},
+	"energy_now":  {SensorEnergy, 1e-6},
+	"temp":        {SensorTemperature, 0.1},
+	"capacity":    {SensorCapacity, 1},
+}
+
+// Sensors returns the current readings of the hwmon and power_supply devices the
+// kernel created for the device. Devices without any return none, and no error.
+func (d Device) Sensors() ([]Sensor, error) {
+	var sensors []Sensor
+	hwmons, err := d.classDevices("hwmon")
+	if err != nil {
+		return nil, err
+	}
+	for _, dir := range hwmons {
+		sensors = append(sensors, hwmonSensors(dir)...)
+	}
+	supplies, err := d.classDevices("power_supply")
+	if err != nil {
+		return nil, err
+	}
+	for _, dir := range supplies {
+		sensors = append(sensors, supplySensors(dir)...)
+	}
+	return sensors, nil
+}
+
+func hwmonSensors(dir string) []Sensor {
+	source := readTrimmed(filepath.Join(dir, "name"))
+	if source == "" {
+		source = filepath.Base(dir)
+	}
+	entries, _ := os.ReadDir(dir)
+	var sensors []Sensor
+	for _, e := range entries {
+		m := hwmonInput.FindStringSubmatch(e.Name())
+		if m == nil {
+			continue
+		}
+		v, err := strconv.ParseFloat(readTrimmed(filepath.Join(dir, e.Name())), 64)
+		if err != nil {
+			continue
+		}
+		k := hwmonKinds[m[1]]
+		name := readTrimmed(filepath.Join(dir, m[1]+m[2]+"_label"))
+		if name == "" {
+			name = m[1] + m[2]
+		}
+		sensors = append(sensors, Sensor{Source: source, Name: name, Kind: k.kind, Value: v * k.scale})
+	}
+	return sensors
+}
+
+func supplySensors(dir string) []Sensor {
+	source := filepath.Base(dir)
+	status := readTrimmed(filepath.Join(dir, "status"))
+	attrs := make([]string, 0, len(supplyAttrs))
+	for a := range supplyAttrs {
+		attrs = append(attrs, a)
+	}
+	sort.Strings(attrs)
+	var sensors []Sensor
+	for _, a := range attrs {
+		v, err := strconv.ParseFloat(readTrimmed(filepath.Join(dir, a)), 64)
+		if err != nil {
+			continue // not reported by this supply
+		}
+		k := supplyAttrs[a]
+		sensors = append(sensors, Sensor{Source: source, Name: a, Kind: k.kind, Value: v * k.scale, Status: status})
+	}
+	return sensors
+}
+
+func readTrimmed(path string) string {
+	b, _ := os.ReadFile(path)
+	return strings.TrimSpace(string(b))
+}
@@ -0,0 +1,41 @@
+package usb_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pzl/usb"
+)
+
+func TestSensors(t *testing.T) {
+	tree := fixtureTree(t)
+	intf := filepath.Join(tree.Roots.SysFS, "1-2.3:1.1")
+	for path, v := range map[string]string{
+		"hwmon/hwmon4/name":                    "widget",
+		"hwmon/hwmon4/temp1_input":             "41500",
+		"hwmon/hwmon4/temp1_label":             "board",
+		"power_supply/widget-battery/capacity": "87",
+		"power_supply/widget-battery/status":   "Discharging",
+	} {
+		p := filepath.Join(intf, path)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(v+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s, err := listWidget(t, tree).Sensors()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []usb.Sensor{
+		{Source: "widget", Name: "board", Kind: usb.SensorTemperature, Value: 41.5},
+		{Source: "widget-battery", Name: "capacity", Kind: usb.SensorCapacity, Value: 87, Status: "Discharging"},
+	}
+	if fmt.Sprint(s) != fmt.Sprint(want) {
+		t.Errorf("sensors %+v, want %+v", s, want)
+	}
+}
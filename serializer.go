@@ -0,0 +1,110 @@
+package usb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+)
+
+// ErrUnhealthy is returned by Device.Do once the device has faulted too many times in a row.
+var ErrUnhealthy = errors.New("usb: device marked unhealthy after repeated faults")
+
+// defaultFaultThreshold is how many consecutive faults mark a device unhealthy.
+const defaultFaultThreshold = 3
+
+// PanicError is a panic recovered from code doing I/O on a device, converted to an error.
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string { return fmt.Sprintf("usb: recovered panic: %v", e.Value) }
+
+func newPanicError(v interface{}) *PanicError {
+	return &PanicError{Value: v, Stack: debug.Stack()}
+}
+
+// Do runs fn with exclusive use of the device: calls of Do on one device never overlap.
+// If ctx is done before fn returns, Do returns ctx.Err() straight away, but the next
+// command still waits for fn to finish. A panic in fn is recovered and returned as a *PanicError.
+//
+// Panics and timeouts are faults. After SetFaultThreshold consecutive faults (3 by default)
+// the device is unhealthy, and Do returns ErrUnhealthy without running fn until ResetHealth.
+func (d *Device) Do(ctx context.Context, fn func(*Device) error) error {
+	if !d.Healthy() {
+		return ErrUnhealthy
+	}
+	select {
+	case d.st.cmd <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	result := make(chan error, 1)
+	go func() {
+		defer func() { <-d.st.cmd }()
+		var err error
+		defer func() {
+			if r := recover(); r != nil {
+				err = newPanicError(r)
+			}
+			result <- err
+		}()
+		err = fn(d)
+	}()
+
+	select {
+	case err := <-result:
+		var perr *PanicError
+		if errors.As(err, &perr) {
+			d.fault()
+		} else {
+			d.succeed()
+		}
+		return err
+	case <-ctx.Done():
+		d.fault()
+		return ctx.Err()
+	}
+}
+
+// Healthy reports whether the device has stayed under its fault threshold.
+func (d *Device) Healthy() bool {
+	d.st.mu.Lock()
+	defer d.st.mu.Unlock()
+	return !d.st.unhealthy
+}
+
+// ResetHealth clears the fault count, and the unhealthy mark.
+func (d *Device) ResetHealth() {
+	d.st.mu.Lock()
+	defer d.st.mu.Unlock()
+	d.st.faults = 0
+	d.st.unhealthy = false
+}
+
+// SetFaultThreshold sets how many consecutive faults mark the device unhealthy. n < 1 restores the default.
+func (d *Device) SetFaultThreshold(n int) {
+	if n < 1 {
+		n = defaultFaultThreshold
+	}
+	d.st.mu.Lock()
+	defer d.st.mu.Unlock()
+	d.st.faultThreshold = n
+}
+
+func (d *Device) fault() {
+	d.st.mu.Lock()
+	defer d.st.mu.Unlock()
+	d.st.faults++
+	if d.st.faults >= d.st.faultThreshold {
+		d.st.unhealthy = true
+	}
+}
+
+func (d *Device) succeed() {
+	d.st.mu.Lock()
+	defer d.st.mu.Unlock()
+	d.st.faults = 0
+}
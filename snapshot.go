@@ -0,0 +1,52 @@
+package usb
+
+import "github.com/pzl/usb/x/gusb"
+
+// InterfaceSnapshot is an interface's endpoints, resolved by direction and transfer
+// type, as of the alternate setting in effect.
+type InterfaceSnapshot struct {
+	Interface int // bInterfaceNumber
+	Alternate int // the alternate setting in effect
+
+	BulkIn, InterruptIn, IsoIn    []*InEndpoint
+	BulkOut, InterruptOut, IsoOut []*OutEndpoint
+}
+
+// ClaimSnapshot claims the interface like Claim, and returns its endpoints.
+func (i *Interface) ClaimSnapshot(opts ...ClaimOption) (*InterfaceSnapshot, error) {
+	if err := i.Claim(opts...); err != nil {
+		return nil, err
+	}
+	return i.Snapshot(), nil
+}
+
+// Snapshot returns the endpoints of the interface's alternate setting in effect.
+func (i *Interface) Snapshot() *InterfaceSnapshot {
+	setting := i.selected()
+	s := &InterfaceSnapshot{Interface: i.ID, Alternate: setting.Alternate}
+	for _, ep := range setting.Endpoints {
+		ep.i = setting
+		if ep.Address&0x80 != 0 {
+			in := &InEndpoint{Endpoint: ep}
+			switch gusb.TransferType(ep.TransferType) {
+			case gusb.EndpointTypeBulk:
+				s.BulkIn = append(s.BulkIn, in)
+			case gusb.EndpointTypeInterrupt:
+				s.InterruptIn = append(s.InterruptIn, in)
+			case gusb.EndpointTypeIsochronous:
+				s.IsoIn = append(s.IsoIn, in)
+			}
+		} else {
+			out := &OutEndpoint{Endpoint: ep}
+			switch gusb.TransferType(ep.TransferType) {
+			case gusb.EndpointTypeBulk:
+				s.BulkOut = append(s.BulkOut, out)
+			case gusb.EndpointTypeInterrupt:
+				s.InterruptOut = append(s.InterruptOut, out)
+			case gusb.EndpointTypeIsochronous:
+				s.IsoOut = append(s.IsoOut, out)
+			}
+		}
+	}
+	return s
+}
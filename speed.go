@@ -0,0 +1,99 @@
+package usb
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/pzl/usb/x/gusb"
+)
+
+// Speed is the signalling rate a device is connected at: a rate in steps of 100 kbps,
+// a lane count and a wireless flag, packed so the predefined speeds are constants.
+// Values are comparable, and the predefined speeds can be used with ==.
+type Speed uint64
+
+const (
+	speedRateMask   = 1<<40 - 1 // 100 kbps steps
+	speedLanesShift = 40        // 8 bits of lane count
+	speedWireless   = 1 << 48
+)
+
+const (
+	SpeedUnknown     Speed = 0
+	SpeedLow         Speed = 15 | 1<<speedLanesShift
+	SpeedFull        Speed = 120 | 1<<speedLanesShift
+	SpeedHigh        Speed = 4800 | 1<<speedLanesShift
+	SpeedWireless    Speed = SpeedHigh | speedWireless
+	SpeedSuper       Speed = 50000 | 1<<speedLanesShift
+	SpeedSuperPlus   Speed = 100000 | 1<<speedLanesShift
+	SpeedSuperPlusX2 Speed = 200000 | 2<<speedLanesShift
+)
+
+// Mbps returns the total signalling rate across all lanes.
+func (s Speed) Mbps() float64 { return float64(s&speedRateMask) / 10 }
+
+// Lanes returns the number of lanes, 0 when unknown.
+func (s Speed) Lanes() int { return int(s >> speedLanesShift & 0xff) }
+
+// Wireless reports whether this is Wireless USB, which shares High speed's rate.
+func (s Speed) Wireless() bool { return s&speedWireless != 0 }
+
+// AtLeast reports whether s is as fast as, or faster than o.
+// An unknown speed is not at least anything but SpeedUnknown.
+func (s Speed) AtLeast(o Speed) bool { return s&speedRateMask >= o&speedRateMask }
+
+func (s Speed) String() string {
+	switch s {
+	case SpeedUnknown:
+		return "Unknown"
+	case SpeedLow:
+		return "Low, 1.5 Mbps"
+	case SpeedFull:
+		return "Full, 12Mbps"
+	case SpeedHigh:
+		return "High, 480 Mbps"
+	case SpeedWireless:
+		return "Wireless, 480 Mbps"
+	case SpeedSuper:
+		return "Super, 5 Gbps"
+	case SpeedSuperPlus:
+		return "Super Plus, 10 Gbps"
+	case SpeedSuperPlusX2:
+		return "Super Plus x2, 20 Gbps"
+	}
+	if s.Lanes() > 1 {
+		return fmt.Sprintf("%g Mbps, %d lanes", s.Mbps(), s.Lanes())
+	}
+	return fmt.Sprintf("%g Mbps", s.Mbps())
+}
+
+// speedFromSysfs converts the sysfs "speed" attribute (in Mbps) and lane count.
+// Lane count 0 means the kernel didn't say, and is taken as 1. Rates that aren't
+// positive, or don't fit, are unknown.
+func speedFromSysfs(mbps float64, lanes int) Speed {
+	rate := math.Round(mbps * 10)
+	if !(rate > 0 && rate <= speedRateMask) {
+		return SpeedUnknown
+	}
+	lanes = min(max(lanes, 1), 0xff)
+	return Speed(rate) | Speed(lanes)<<speedLanesShift
+}
+
+// speedFromUsbfs converts the kernel's enum usb_device_speed.
+func speedFromUsbfs(s gusb.DeviceSpeed) Speed {
+	switch s {
+	case gusb.SpeedLow:
+		return SpeedLow
+	case gusb.SpeedFull:
+		return SpeedFull
+	case gusb.SpeedHigh:
+		return SpeedHigh
+	case gusb.SpeedWireless:
+		return SpeedWireless
+	case gusb.SpeedSuper:
+		return SpeedSuper
+	case gusb.SpeedSuperPlus:
+		return SpeedSuperPlus
+	}
+	return SpeedUnknown
+}
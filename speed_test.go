@@ -0,0 +1,49 @@
+package usb_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pzl/usb"
+)
+
+func TestSpeed(t *testing.T) {
+	if s := usb.SpeedSuperPlusX2; s.Mbps() != 20000 || s.Lanes() != 2 || s.Wireless() {
+		t.Errorf("%v: %g Mbps, %d lanes, wireless %v", s, s.Mbps(), s.Lanes(), s.Wireless())
+	}
+	if s := usb.SpeedWireless; s.Mbps() != 480 || !s.Wireless() || s == usb.SpeedHigh || !s.AtLeast(usb.SpeedHigh) {
+		t.Errorf("%v: %g Mbps, wireless %v", s, s.Mbps(), s.Wireless())
+	}
+	if usb.SpeedLow.Mbps() != 1.5 || !usb.SpeedSuper.AtLeast(usb.SpeedHigh) || usb.SpeedFull.AtLeast(usb.SpeedHigh) {
+		t.Error("speeds out of order")
+	}
+	if usb.SpeedUnknown.AtLeast(usb.SpeedLow) || !usb.SpeedUnknown.AtLeast(usb.SpeedUnknown) {
+		t.Error("unknown speed compares as known")
+	}
+
+	// from sysfs, with lanes on newer kernels. Predefined speeds print their names
+	tree := fixtureTree(t)
+	dir := filepath.Join(tree.Roots.SysFS, "1-2.3")
+	for _, c := range []struct{ speed, lanes, want string }{
+		{"1.5", "", "Low, 1.5 Mbps"},
+		{"53.3-480", "", "Wireless, 480 Mbps"},
+		{"10000", "1", "Super Plus, 10 Gbps"},
+		{"20000", "2", "Super Plus x2, 20 Gbps"},
+		{"40000", "2", "40000 Mbps, 2 lanes"},
+		{"1e300", "", "Unknown"},
+	} {
+		for name, v := range map[string]string{"speed": c.speed, "rx_lanes": c.lanes, "tx_lanes": c.lanes} {
+			if err := os.WriteFile(filepath.Join(dir, name), []byte(v), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		devs, err := usb.ListWhere("vendor==1234", usb.ListRoots(tree.Roots))
+		if err != nil || len(devs) != 1 {
+			t.Fatalf("listed %d devices, %v", len(devs), err)
+		}
+		if got := devs[0].Speed.String(); got != c.want {
+			t.Errorf("sysfs speed %q, lanes %q: %s, want %s", c.speed, c.lanes, got, c.want)
+		}
+	}
+}
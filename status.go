@@ -0,0 +1,73 @@
+package usb
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+
+	"github.com/pzl/usb/x/gusb"
+)
+
+// DeviceStatus is the device's answer to a standard GET_STATUS request: its state at
+// runtime, where the configuration's attributes only say what it is capable of.
+type DeviceStatus struct {
+	SelfPowered  bool // running from its own supply rather than the bus, right now
+	RemoteWakeup bool // the host armed remote wakeup, e.g. before suspending it
+	U1Enabled    bool // usb 3.0+ link power states
+	U2Enabled    bool
+	LTMEnabled   bool // usb 3.0+ latency tolerance messages
+}
+
+// Status asks the device for its status. An open device is asked through its handle,
+// and fails like its other I/O if that is read-only or refused by policy. Otherwise
+// Status opens a read-write handle of its own on the device node for the request,
+// which needs write access to it.
+func (d Device) Status() (DeviceStatus, error) {
+	buf := make([]byte, 2)
+	get := func(f *os.File) error {
+		n, err := gusb.ControlSetup(f, gusb.SetupPacket{
+			RequestType: gusb.RequestDirIn | gusb.RequestTypeStandard | gusb.RecipientDevice,
+			Request:     gusb.RequestGetStatus,
+			Length:      2,
+		}, buf, usbfsTimeoutMs)
+		if err == nil && n < 2 {
+			err = errors.New("usb: short GET_STATUS reply")
+		}
+		return err
+	}
+	f, err := d.file()
+	switch {
+	case err == nil:
+		err = get(f)
+	case errors.Is(err, ErrNotOpen) || errors.Is(err, ErrClosed):
+		if f, err = os.OpenFile(d.nodePath(), os.O_RDWR, 0); err == nil {
+			err = get(f)
+			f.Close()
+		}
+	}
+	if err != nil {
+		return DeviceStatus{}, err
+	}
+	bits := binary.LittleEndian.Uint16(buf)
+	return DeviceStatus{
+		SelfPowered:  bits&(1<<0) != 0,
+		RemoteWakeup: bits&(1<<1) != 0,
+		U1Enabled:    bits&(1<<2) != 0,
+		U2Enabled:    bits&(1<<3) != 0,
+		LTMEnabled:   bits&(1<<4) != 0,
+	}, nil
+}
+
+// SupportsRemoteWakeup reports whether the active configuration declares remote
+// wakeup. Whether it is armed is in Status, and whether it may wake the system in Wakeup.
+func (d Device) SupportsRemoteWakeup() bool {
+	return d.ActiveConfig != nil && d.ActiveConfig.RemoteWakeup
+}
+
+// SelfPowered reports whether the device is running from its own supply, from its
+// status. A configuration declaring SelfPowered may still draw from the bus, e.g. a
+// hub whose power brick is unplugged.
+func (d Device) SelfPowered() (bool, error) {
+	s, err := d.Status()
+	return s.SelfPowered, err
+}
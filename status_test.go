@@ -0,0 +1,24 @@
+package usb_test
+
+import (
+	"errors"
+	"syscall"
+	"testing"
+
+	"github.com/pzl/usb"
+)
+
+func TestStatus(t *testing.T) {
+	_, w := openWidget(t)
+
+	// not open: through a handle of its own, on the fixture's plain file
+	if _, err := w.Status(); !errors.Is(err, syscall.ENOTTY) {
+		t.Errorf("status of a closed device: %v", err)
+	}
+	if err := w.Open(usb.ReadOnly()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Status(); !errors.Is(err, usb.ErrReadOnly) {
+		t.Errorf("status of a read-only device: %v", err)
+	}
+}
@@ -0,0 +1,167 @@
+//go:build !usb_core
+
+package usb
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// Progress reports how far a streaming transfer got.
+type Progress struct {
+	Done    int64         // bytes transferred so far
+	Total   int64         // bytes expected in all, or -1 if unknown
+	Elapsed time.Duration // since the transfer started
+	Rate    float64       // average bytes per second
+}
+
+// StreamOptions tune WriteStream and ReadStream.
+type StreamOptions struct {
+	// ChunkSize is the size of each bulk transfer, rounded down to a multiple of
+	// the endpoint packet size (but at least one packet). Default the endpoint's
+	// Buffers.ChunkSize.
+	ChunkSize int
+
+	// Progress, if set, is called after every chunk, from the transferring goroutine.
+	Progress func(Progress)
+
+	// NoMmap keeps the chunk buffer in ordinary memory. By default, when the kernel
+	// supports it, the buffer is mapped from the device (see Device.AllocBuffer), and
+	// the kernel uses it in place, sparing a copy per chunk.
+	NoMmap bool
+}
+
+func (o StreamOptions) chunk(e *Endpoint) []byte {
+	return make([]byte, o.chunkSize(e))
+}
+
+// buffer returns the chunk buffer of a stream, mapped from the device where it can be.
+// free releases it.
+func (o StreamOptions) buffer(e *Endpoint) (buf []byte, free func()) {
+	n := o.chunkSize(e)
+	if !o.NoMmap && e.i != nil && e.i.d != nil {
+		d := e.i.d
+		if caps, err := d.Capabilities(); err == nil && caps.Has(CapMmap) {
+			if buf, err := d.AllocBuffer(n); err == nil {
+				return buf, func() { d.FreeBuffer(buf) }
+			}
+		}
+	}
+	return make([]byte, n), func() {}
+}
+
+func (o StreamOptions) chunkSize(e *Endpoint) int {
+	n := o.ChunkSize
+	if n <= 0 {
+		n = e.Buffers().ChunkSize
+	}
+	if ps := e.PacketSize(); ps > 0 {
+		n -= n % ps
+		if n == 0 {
+			n = ps
+		}
+	}
+	return n
+}
+
+// readChunk returns the part of buf to read into with left bytes to go, or -1 for
+// unknown: whole packets, so the device can't overflow it, or just left bytes when the
+// endpoint has no packet size to round to.
+func (e *Endpoint) readChunk(buf []byte, left int64) []byte {
+	if left < 0 || left >= int64(len(buf)) {
+		return buf
+	}
+	ps := int64(e.PacketSize())
+	if ps == 0 {
+		return buf[:left]
+	}
+	return buf[:min((left+ps-1)/ps*ps, int64(len(buf)))]
+}
+
+type progressMeter struct {
+	fn    func(Progress)
+	start time.Time
+	p     Progress
+}
+
+func newProgressMeter(fn func(Progress), total int64) *progressMeter {
+	return &progressMeter{fn: fn, start: time.Now(), p: Progress{Total: total}}
+}
+
+func (m *progressMeter) add(n int) {
+	m.p.Done += int64(n)
+	if m.fn == nil {
+		return
+	}
+	m.p.Elapsed = time.Since(m.start)
+	if s := m.p.Elapsed.Seconds(); s > 0 {
+		m.p.Rate = float64(m.p.Done) / s
+	}
+	m.fn(m.p)
+}
+
+// WriteStream sends everything read from r to a bulk OUT endpoint, in chunks.
+// total is only used for Progress reports, pass -1 if unknown.
+// It returns the number of bytes sent.
+func (e *OutEndpoint) WriteStream(ctx context.Context, r io.Reader, total int64, opts StreamOptions) (int64, error) {
+	if err := e.checkType(TransferTypeBulk); err != nil {
+		return 0, err
+	}
+	// each chunk is an URB waited on, so cancelling discards it before buf is freed
+	buf, free := opts.buffer(&e.Endpoint)
+	defer free()
+	m := newProgressMeter(opts.Progress, total)
+	for {
+		n, rerr := io.ReadFull(r, buf)
+		if n > 0 {
+			w, err := e.submitWait(ctx, buf[:n])
+			m.add(w)
+			if err != nil {
+				return m.p.Done, err
+			}
+			if w < n {
+				return m.p.Done, io.ErrShortWrite
+			}
+		}
+		if errors.Is(rerr, io.EOF) || errors.Is(rerr, io.ErrUnexpectedEOF) {
+			return m.p.Done, nil
+		} else if rerr != nil {
+			return m.p.Done, rerr
+		}
+	}
+}
+
+// ReadStream receives from a bulk IN endpoint into w, in chunks, until total bytes
+// arrived. With total -1, it reads until the device ends the transfer with a short chunk.
+// It returns the number of bytes received.
+func (e *InEndpoint) ReadStream(ctx context.Context, w io.Writer, total int64, opts StreamOptions) (int64, error) {
+	if err := e.checkType(TransferTypeBulk); err != nil {
+		return 0, err
+	}
+	buf, free := opts.buffer(&e.Endpoint)
+	defer free()
+	m := newProgressMeter(opts.Progress, total)
+	for total < 0 || m.p.Done < total {
+		left := int64(-1)
+		if total >= 0 {
+			left = total - m.p.Done
+		}
+		chunk := e.readChunk(buf, left)
+		n, err := e.submitWait(ctx, chunk)
+		if n > 0 {
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				return m.p.Done, werr
+			}
+		}
+		m.add(n)
+		if err != nil {
+			return m.p.Done, err
+		}
+		if n < len(chunk) && total < 0 {
+			break
+		}
+	}
+	return m.p.Done, nil
+}
@@ -0,0 +1,38 @@
+//go:build !usb_core
+
+package usb_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pzl/usb"
+	"github.com/pzl/usb/x/gusb"
+)
+
+// TestPacketSizeZero sizes buffers for an endpoint whose descriptor gives no max packet
+// size, which nothing can round to.
+func TestPacketSizeZero(t *testing.T) {
+	for _, ps := range []int{0, 64} {
+		e := &usb.Endpoint{Address: 0x81, TransferType: usb.TransferTypeBulk, MaxPacketSize: ps}
+		if b := e.NewBuffer(10); len(b) != max(10, ps) {
+			t.Errorf("packets of %d: NewBuffer(10) of %d bytes", ps, len(b))
+		}
+		if err := e.CheckBuffer(make([]byte, 10)); (err == nil) != (ps == 0) {
+			t.Errorf("packets of %d: CheckBuffer of 10 bytes: %v", ps, err)
+		}
+		if n := usb.StreamChunkSize(usb.StreamOptions{ChunkSize: 1000}, e); n != 1000-1000%max(ps, 1) {
+			t.Errorf("packets of %d: chunks of %d bytes", ps, n)
+		}
+		buf := make([]byte, 256)
+		for left, want := range map[int64]int{-1: 256, 300: 256, 10: max(10, ps), 0: 0} {
+			if n := len(usb.ReadChunk(e, buf, left)); n != want {
+				t.Errorf("packets of %d: %d bytes left, reads %d, want %d", ps, left, n, want)
+			}
+		}
+	}
+	in := &usb.InEndpoint{Endpoint: usb.Endpoint{Address: 0x83, TransferType: int(gusb.EndpointTypeInterrupt)}}
+	if _, err := in.Notifications(usb.DecodeCDC); err == nil || !strings.Contains(err.Error(), "max packet size of 0") {
+		t.Errorf("notifications from an endpoint without packets: %v", err)
+	}
+}
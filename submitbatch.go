@@ -0,0 +1,113 @@
+package usb
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pzl/usb/x/gusb"
+)
+
+// SubmitBatch transfers each of bufs on a bulk or interrupt endpoint, and waits for
+// them all: see SubmitBatchContext.
+func (e *Endpoint) SubmitBatch(bufs [][]byte) ([]int, error) {
+	return e.SubmitBatchContext(context.Background(), bufs)
+}
+
+// SubmitBatchContext submits a transfer for each of bufs at once, and waits until all
+// are done, for bursts of small messages such as HID reports to an LED controller. The
+// URBs go to the kernel in one pass, and unless AsyncOptions.MaxInFlight queues some,
+// all but the last ask the host controller not to interrupt on completion. It returns
+// the bytes transferred of each buffer, and the first error. If ctx is done first,
+// what is left is cancelled.
+func (e *Endpoint) SubmitBatchContext(ctx context.Context, bufs [][]byte) ([]int, error) {
+	if e.i == nil || e.i.d == nil {
+		return nil, ErrNotOpen
+	}
+	var typ gusb.URBType
+	switch e.TransferType {
+	case TransferTypeBulk:
+		typ = gusb.URBTypeBulk
+	case int(gusb.EndpointTypeInterrupt):
+		typ = gusb.URBTypeInterrupt
+	default:
+		return nil, fmt.Errorf("usb: endpoint address %02X: asynchronous transfers of type %02X not supported", e.Address, e.TransferType)
+	}
+	if len(bufs) == 0 {
+		return nil, nil
+	}
+
+	ts := make([]*Transfer, 0, len(bufs))
+	total := 0
+	for _, buf := range bufs {
+		t, err := e.newTransfer(typ, buf, 0)
+		if err != nil {
+			drop(ts, err)
+			return nil, err
+		}
+		ts = append(ts, t)
+		total += len(buf)
+	}
+	if (e.Address & 0x80) == 0 {
+		e.pace(total)
+	}
+	flags, err := e.tuning(ctx)
+	if err != nil {
+		drop(ts, err)
+		return nil, err
+	}
+	for _, t := range ts {
+		t.urb.Flags |= uint32(flags)
+	}
+	submitted, err := ts[0].eng.submitBatch(ts)
+	drop(ts[submitted:], err)
+
+	ns := make([]int, len(bufs))
+	for i, t := range ts[:submitted] {
+		n, werr := t.Wait(ctx)
+		ns[i] = n
+		if werr != nil && err == nil {
+			err = werr
+		}
+	}
+	return ns, err
+}
+
+// drop ends transfers that never reached the kernel with err, releasing their URBs
+// and buffers. Unlike finish, it keeps them out of Completions: the caller got err
+// rather than the transfers.
+func drop(ts []*Transfer, err error) {
+	for _, t := range ts {
+		t.err = err
+		t.completedAt = time.Now()
+		t.urb, t.iso, t.buf = nil, nil, nil
+		close(t.done)
+	}
+}
+
+// submitBatch submits transfers under a single hold of the lock, returning how many
+// made it: on an error, those after the failed one are not submitted.
+func (eng *asyncEngine) submitBatch(ts []*Transfer) (int, error) {
+	eng.mu.Lock()
+	defer eng.mu.Unlock()
+	if eng.stopping {
+		return 0, ErrClosed
+	}
+	if eng.maxInFlight <= 0 {
+		// the last URB's completion interrupt reports the others. With a queue, the
+		// last submitted is not known in advance, and every one must interrupt
+		for _, t := range ts[:len(ts)-1] {
+			t.urb.Flags |= gusb.URBNoInterrupt
+		}
+	}
+	for i, t := range ts {
+		if eng.maxInFlight > 0 && (eng.full(t.intf()) || eng.anyQueued(t.intf())) {
+			eng.enqueue(t)
+			continue
+		}
+		if err := eng.submitLocked(t); err != nil {
+			return i, fmt.Errorf("usb: submitting transfer on ep %02X: %w", t.ep.Address, err)
+		}
+	}
+	return len(ts), nil
+}
@@ -0,0 +1,27 @@
+package usb_test
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSubmitBatchFailure(t *testing.T) {
+	_, w := openWidget(t)
+	if err := w.Open(); err != nil {
+		t.Fatal(err)
+	}
+	c := w.Completions()
+	ep := &w.ActiveConfig.Interfaces[0].Endpoints[1] // bulk OUT 02
+	if _, err := ep.SubmitBatch([][]byte{{1}, {2}, {3}}); err == nil {
+		t.Fatal("submitted to a fixture")
+	}
+	if s := w.AsyncStats(); s.Submitted != 0 {
+		t.Errorf("%d URBs left with the kernel", s.Submitted)
+	}
+	// the dropped transfers are the batch's error, not completions
+	select {
+	case tr := <-c:
+		t.Errorf("completion of a transfer never submitted: %v", tr)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,110 @@
+package usb
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// AttrError reports a sysfs attribute that could not be read, or held something
+// other than what the kernel writes there. A device unplugged while its attributes
+// are read gives an AttrError matching unix.ENODEV.
+type AttrError struct {
+	Path  string
+	Value string // the attribute's content, if it was read
+	Err   error
+}
+
+func (e *AttrError) Error() string {
+	if e.Value == "" {
+		return fmt.Sprintf("usb: sysfs attribute %s: %v", e.Path, e.Err)
+	}
+	return fmt.Sprintf("usb: sysfs attribute %s: %q: %v", e.Path, e.Value, e.Err)
+}
+
+func (e *AttrError) Unwrap() error { return e.Err }
+
+var (
+	errAttrEmpty = errors.New("empty")
+	errAttrRange = errors.New("out of range")
+)
+
+// maxAttrSize is the most a sysfs attribute holds: one page.
+const maxAttrSize = 4096
+
+// readAttr reads a sysfs attribute, trimmed of the kernel's trailing newline.
+func readAttr(path string) (string, error) {
+	f, err := os.Open(path)
+	if err == nil {
+		defer f.Close()
+		buf := make([]byte, maxAttrSize)
+		var n int
+		n, err = f.Read(buf)
+		if err == nil || err == io.EOF {
+			return strings.TrimSpace(string(buf[:n])), nil
+		}
+	}
+	if os.IsNotExist(err) || errors.Is(err, unix.ENODEV) {
+		// the attribute may just not exist, but if its directory went too, so did the device
+		if _, serr := os.Stat(filepath.Dir(path)); serr != nil || errors.Is(err, unix.ENODEV) {
+			err = unix.ENODEV
+		}
+	}
+	return "", &AttrError{Path: path, Err: err}
+}
+
+// parseAttrInt parses a decimal sysfs attribute in [0, max].
+func parseAttrInt(s string, max int) (int, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return -1, errAttrEmpty
+	}
+	v, err := strconv.ParseUint(s, 10, 31)
+	if err != nil {
+		return -1, errors.Unwrap(err) // strconv's ErrSyntax or ErrRange, without repeating the input
+	}
+	if int(v) > max {
+		return -1, errAttrRange
+	}
+	return int(v), nil
+}
+
+// parseAttrSpeed parses the speed attribute, in Mbps. The kernel writes a number, or
+// "53.3-480" for Wireless USB, which is reported as 0.
+func parseAttrSpeed(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	switch s {
+	case "":
+		return 0, errAttrEmpty
+	case "53.3-480":
+		return 0, nil
+	}
+	mbps, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, errors.Unwrap(err)
+	}
+	if math.IsNaN(mbps) || math.IsInf(mbps, 0) || mbps < 0 {
+		return 0, errAttrRange // ParseFloat takes "NaN" and "Inf"
+	}
+	return mbps, nil
+}
+
+// readAttrInt reads and parses a decimal sysfs attribute in [0, max].
+func readAttrInt(path string, max int) (int, error) {
+	s, err := readAttr(path)
+	if err != nil {
+		return -1, err
+	}
+	v, err := parseAttrInt(s, max)
+	if err != nil {
+		return -1, &AttrError{Path: path, Value: s, Err: err}
+	}
+	return v, nil
+}
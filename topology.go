@@ -0,0 +1,158 @@
+//go:build !usb_core
+
+package usb
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Tree is the tree of attached USB devices, one root per bus.
+// It is plain data, suitable for encoding/json.
+type Tree struct {
+	Buses []*TreeNode `json:"buses"`
+}
+
+// TreeNode is one device in a Tree.
+type TreeNode struct {
+	Bus        int             `json:"bus"`
+	Device     int             `json:"device"`
+	Port       int             `json:"port"`
+	PortPath   string          `json:"port_path"`
+	Vendor     ID              `json:"vendor"`
+	Product    ID              `json:"product"`
+	Name       string          `json:"name,omitempty"`
+	Serial     string          `json:"serial,omitempty"`
+	Class      string          `json:"class"`
+	SpeedMbps  float64         `json:"speed_mbps"`
+	Interfaces []TreeInterface `json:"interfaces,omitempty"`
+	Children   []*TreeNode     `json:"children,omitempty"`
+}
+
+// TreeInterface is an interface of the active configuration of a TreeNode.
+type TreeInterface struct {
+	Number int    `json:"number"`
+	Class  string `json:"class"`
+	Driver string `json:"driver,omitempty"`
+}
+
+// Topology enumerates the attached devices into a tree following the hub ports.
+func Topology() (*Tree, error) {
+	list, err := List()
+	if err != nil {
+		return nil, err
+	}
+	nodes := make(map[string]*TreeNode, len(list))
+	for _, d := range list {
+		nodes[d.PortPath()] = toTreeNode(d)
+	}
+
+	t := &Tree{}
+	for _, d := range list {
+		n := nodes[d.PortPath()]
+		if parent, ok := nodes[parentPortPath(d)]; ok && !d.IsRootHub() {
+			parent.Children = append(parent.Children, n)
+		} else {
+			t.Buses = append(t.Buses, n)
+		}
+	}
+	sort.Slice(t.Buses, func(i, j int) bool { return t.Buses[i].Bus < t.Buses[j].Bus })
+	for _, n := range nodes {
+		sort.Slice(n.Children, func(i, j int) bool { return n.Children[i].Port < n.Children[j].Port })
+	}
+	return t, nil
+}
+
+func parentPortPath(d *Device) string {
+	if len(d.Ports) <= 1 {
+		return fmt.Sprintf("usb%d", d.Bus)
+	}
+	ports := make([]string, len(d.Ports)-1)
+	for i, p := range d.Ports[:len(d.Ports)-1] {
+		ports[i] = strconv.Itoa(p)
+	}
+	return fmt.Sprintf("%d-%s", d.Bus, strings.Join(ports, "."))
+}
+
+func toTreeNode(d *Device) *TreeNode {
+	n := &TreeNode{
+		Bus:       d.Bus,
+		Device:    d.Device,
+		Port:      d.Port,
+		PortPath:  d.PortPath(),
+		Vendor:    d.Vendor,
+		Product:   d.Product,
+		Name:      strings.TrimSpace(d.VendorName() + " " + d.ProductName()),
+		Serial:    d.Serial,
+		Class:     d.Class.String(),
+		SpeedMbps: d.Speed.Mbps(),
+	}
+	if d.IsRootHub() {
+		n.Class = "root_hub"
+	}
+	if d.ActiveConfig != nil {
+		for _, intf := range d.ActiveConfig.Interfaces {
+			drv, _ := intf.GetDriver()
+			n.Interfaces = append(n.Interfaces, TreeInterface{
+				Number: intf.ID,
+				Class:  intf.Class.String(),
+				Driver: drv,
+			})
+		}
+	}
+	return n
+}
+
+// WriteTree renders the topology like `lsusb -t`: a line per interface, indented by hub depth.
+func (t *Tree) WriteTree(w io.Writer) error {
+	for _, root := range t.Buses {
+		driver := ""
+		if len(root.Interfaces) > 0 {
+			driver = root.Interfaces[0].Driver
+		}
+		if _, err := fmt.Fprintf(w, "/:  Bus %03d.Port %03d: Dev %03d, Class=%s, Driver=%s, %s\n",
+			root.Bus, root.Port+1, root.Device, root.Class, driver, treeSpeed(root.SpeedMbps)); err != nil {
+			return err
+		}
+		if err := writeSubtree(w, root.Children, 1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeSubtree(w io.Writer, nodes []*TreeNode, depth int) error {
+	indent := strings.Repeat("    ", depth)
+	for _, n := range nodes {
+		intfs := n.Interfaces
+		if len(intfs) == 0 {
+			intfs = []TreeInterface{{Class: n.Class}} // unconfigured, still list the device
+		}
+		for _, intf := range intfs {
+			if _, err := fmt.Fprintf(w, "%s|__ Port %03d: Dev %03d, If %d, Class=%s, Driver=%s, %s\n",
+				indent, n.Port, n.Device, intf.Number, intf.Class, intf.Driver, treeSpeed(n.SpeedMbps)); err != nil {
+				return err
+			}
+		}
+		if err := writeSubtree(w, n.Children, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *Tree) String() string {
+	var b strings.Builder
+	t.WriteTree(&b)
+	return b.String()
+}
+
+func treeSpeed(mbps float64) string {
+	if mbps <= 0 {
+		return "?"
+	}
+	return strconv.FormatFloat(mbps, 'f', -1, 64) + "M"
+}
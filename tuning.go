@@ -0,0 +1,104 @@
+package usb
+
+import (
+	"context"
+	"time"
+
+	"github.com/pzl/usb/x/gusb"
+)
+
+// URBFlags are usbfs flags for the URBs of asynchronous transfers.
+type URBFlags uint32
+
+const (
+	// URBShortNotOK fails an IN transfer ending in a short packet with EREMOTEIO, and with
+	// URBBulkContinuation on the following transfers, has the kernel drop those queued
+	// behind it until one is submitted without the continuation flag.
+	URBShortNotOK URBFlags = gusb.URBShortNotOK
+	// URBBulkContinuation marks a bulk IN transfer as continuing the previous one.
+	URBBulkContinuation URBFlags = gusb.URBBulkContinuation
+	// URBZeroPacket ends an OUT transfer that's a multiple of the packet size with a zero-length packet.
+	URBZeroPacket URBFlags = gusb.URBZeroPacket
+	// URBNoInterrupt asks the host controller not to raise an interrupt on completion,
+	// where it batches completions. Only set it on transfers followed by one without.
+	URBNoInterrupt URBFlags = gusb.URBNoInterrupt
+)
+
+// EndpointTuning adjusts how the asynchronous transfers of an endpoint are issued, for
+// chatty devices that NAK constantly and keep an embedded host busy. The NAK and PING
+// retries themselves are scheduled by the host controller, out of reach of usbfs: what
+// can be tuned is how often the library hands it work, and how completions are signalled.
+type EndpointTuning struct {
+	Flags URBFlags // added to every URB submitted on the endpoint
+
+	// MinInterval spaces out submissions on the endpoint: Submit waits until this long
+	// after the previous one. Waits in SubmitBatchContext and the context-taking reads
+	// and writes end when their context does. On an interrupt IN endpoint that mostly NAKs, resubmitting
+	// less often than bInterval trades latency for fewer completions to handle.
+	MinInterval time.Duration
+}
+
+// SetTuning tunes the endpoint's asynchronous transfers, see Device.SetEndpointTuning.
+func (e *Endpoint) SetTuning(t EndpointTuning) {
+	if e.i != nil && e.i.d != nil {
+		e.i.d.SetEndpointTuning(e.Address, t)
+	}
+}
+
+// SetEndpointTuning tunes the asynchronous transfers (Submit, the streams built on it, and
+// EndpointConn) of the endpoint with the given address. Synchronous transfers go through
+// an ioctl with no flags, and are unaffected. A zero EndpointTuning restores the defaults.
+func (d *Device) SetEndpointTuning(addr int, t EndpointTuning) {
+	d.st.mu.Lock()
+	defer d.st.mu.Unlock()
+	if t == (EndpointTuning{}) {
+		delete(d.st.tuning, uint8(addr))
+		return
+	}
+	if d.st.tuning == nil {
+		d.st.tuning = make(map[uint8]*endpointTuner)
+	}
+	d.st.tuning[uint8(addr)] = &endpointTuner{EndpointTuning: t}
+}
+
+// endpointTuner is the tuning of an endpoint, and when it was last submitted to.
+type endpointTuner struct {
+	EndpointTuning
+	next time.Time // earliest next submission
+}
+
+// tuning returns the URB flags for a transfer on the endpoint, after waiting out its
+// MinInterval. The wait ends early with an error if ctx is done, or the device's
+// Context is closed.
+func (e *Endpoint) tuning(ctx context.Context) (URBFlags, error) {
+	if e.i == nil || e.i.d == nil || e.i.d.st == nil {
+		return 0, nil
+	}
+	st := e.i.d.st
+	st.mu.Lock()
+	t := st.tuning[uint8(e.Address)]
+	if t == nil {
+		st.mu.Unlock()
+		return 0, nil
+	}
+	flags, now := t.Flags, clock().Now()
+	wait := t.next.Sub(now)
+	if wait <= 0 {
+		t.next = now.Add(t.MinInterval)
+		st.mu.Unlock()
+		return flags, nil
+	}
+	t.next = now.Add(wait + t.MinInterval)
+	st.mu.Unlock()
+
+	due, stop := clock().NewTimer(wait)
+	defer stop()
+	select {
+	case <-due:
+		return flags, nil
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	case <-e.i.d.ctxDone():
+		return 0, context.Canceled
+	}
+}
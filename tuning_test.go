@@ -0,0 +1,50 @@
+package usb_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pzl/usb"
+	"github.com/pzl/usb/usbtest"
+)
+
+func TestTuningIntervalCancel(t *testing.T) {
+	clk := usbtest.NewClock(time.Time{})
+	usb.SetClock(clk)
+	defer usb.SetClock(nil)
+	_, w := openWidget(t)
+	if err := w.Open(); err != nil {
+		t.Fatal(err)
+	}
+	ep := &w.ActiveConfig.Interfaces[0].Endpoints[1] // bulk OUT 02
+	ep.SetTuning(usb.EndpointTuning{Flags: usb.URBZeroPacket, MinInterval: time.Hour})
+
+	// the first batch goes straight on, to fail on the fixture's node
+	if _, err := ep.SubmitBatch([][]byte{{1}}); err == nil {
+		t.Fatal("submitted to a fixture")
+	}
+	// the second waits out the interval, until cancelled
+	bctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, err := ep.SubmitBatchContext(bctx, [][]byte{{2}})
+		done <- err
+	}()
+	clk.BlockUntil(1)
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled batch: %v", err)
+	}
+
+	// the abandoned wait is gone: a sleeper is the only one the clock sees
+	slept := make(chan struct{})
+	go func() {
+		clk.Sleep(time.Millisecond)
+		close(slept)
+	}()
+	clk.BlockUntil(1)
+	clk.Advance(time.Millisecond)
+	<-slept
+}
@@ -0,0 +1,135 @@
+//go:build !usb_core
+
+package usb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// ErrAbortUpload can be returned (or wrapped) by the Upload hooks to fail
+// the upload at once, rather than retrying the chunk.
+var ErrAbortUpload = errors.New("usb: upload aborted")
+
+// Upload sends a large image to a bulk OUT endpoint in chunks, the way most firmware
+// updaters do: announce the chunk, send it, have the device acknowledge it.
+// After a failed Run, Offset holds the end of the last acknowledged chunk, and
+// calling Run again resumes from there.
+type Upload struct {
+	Endpoint *OutEndpoint
+	Data     io.ReaderAt
+	Size     int64
+
+	ChunkSize  int           // default the endpoint's Buffers.ChunkSize, rounded like StreamOptions.ChunkSize
+	Retries    int           // attempts per chunk after the first, default 3. Negative disables retrying
+	RetryDelay time.Duration // pause before a retry, default 100ms
+
+	// Before, if set, is called ahead of each chunk, e.g. to send the device its address.
+	Before func(ctx context.Context, offset int64, chunk []byte) error
+	// Verify, if set, is called once a chunk is sent, e.g. to read back a status or CRC.
+	// An error retries the chunk.
+	Verify func(ctx context.Context, offset int64, chunk []byte) error
+	// Progress, if set, is called after each acknowledged chunk.
+	Progress func(Progress)
+
+	Offset int64 // where the upload starts, or resumes
+}
+
+// UploadError is returned by Upload.Run when a chunk failed every attempt.
+type UploadError struct {
+	Offset   int64 // start of the failing chunk
+	Attempts int
+	Err      error // the last attempt's error
+}
+
+func (e *UploadError) Error() string {
+	return fmt.Sprintf("usb: upload chunk at offset %d failed after %d attempts: %v", e.Offset, e.Attempts, e.Err)
+}
+
+func (e *UploadError) Unwrap() error { return e.Err }
+
+// Run uploads from Offset to Size.
+func (u *Upload) Run(ctx context.Context) error {
+	if u.Endpoint == nil || u.Data == nil {
+		return errors.New("usb: upload needs an Endpoint and Data")
+	}
+	retries, delay := u.Retries, u.RetryDelay
+	if retries == 0 {
+		retries = 3
+	} else if retries < 0 {
+		retries = 0
+	}
+	if delay == 0 {
+		delay = 100 * time.Millisecond
+	}
+
+	buf := StreamOptions{ChunkSize: u.ChunkSize}.chunk(&u.Endpoint.Endpoint)
+	m := newProgressMeter(u.Progress, u.Size)
+	m.p.Done = u.Offset
+	for u.Offset < u.Size {
+		chunk := buf
+		if left := u.Size - u.Offset; left < int64(len(chunk)) {
+			chunk = chunk[:left]
+		}
+		if n, err := u.Data.ReadAt(chunk, u.Offset); n < len(chunk) {
+			return fmt.Errorf("usb: reading upload data at offset %d: %w", u.Offset, err)
+		}
+
+		var err error
+		attempt := 0
+		for ; attempt <= retries; attempt++ {
+			if attempt > 0 {
+				wait, stop := clock().NewTimer(delay)
+				select {
+				case <-ctx.Done():
+					stop()
+					return ctx.Err()
+				case <-wait:
+				}
+			}
+			if err = u.sendChunk(ctx, chunk); err == nil || !retryable(ctx, err) {
+				break
+			}
+		}
+		if err != nil {
+			return &UploadError{Offset: u.Offset, Attempts: min(attempt+1, retries+1), Err: err}
+		}
+		u.Offset += int64(len(chunk))
+		m.add(len(chunk))
+	}
+	return nil
+}
+
+func (u *Upload) sendChunk(ctx context.Context, chunk []byte) error {
+	if u.Before != nil {
+		if err := u.Before(ctx, u.Offset, chunk); err != nil {
+			return err
+		}
+	}
+	n, err := u.Endpoint.WriteContext(ctx, chunk)
+	if err != nil {
+		return err
+	} else if n < len(chunk) {
+		return io.ErrShortWrite
+	}
+	if u.Verify != nil {
+		return u.Verify(ctx, u.Offset, chunk)
+	}
+	return nil
+}
+
+// retryable reports whether a chunk failing with err is worth another attempt.
+func retryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	for _, fatal := range []error{ErrAbortUpload, ErrClosed, ErrNotOpen, ErrUnhealthy, context.Canceled, context.DeadlineExceeded} {
+		if errors.Is(err, fatal) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,61 @@
+package usb
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// URBStatusError is a failed URB, with the kernel's status decoded.
+// It unwraps to the errno, so errors.Is(err, unix.EPIPE) still works.
+type URBStatusError struct {
+	Endpoint int
+	Errno    unix.Errno
+}
+
+func (e *URBStatusError) Error() string {
+	return fmt.Sprintf("usb: transfer on ep %02X failed: %s (%v)", e.Endpoint, URBStatusText(e.Errno), e.Errno)
+}
+
+func (e *URBStatusError) Unwrap() error { return e.Errno }
+
+// URBStatusText describes what an URB completion status means, after the kernel's
+// Documentation/driver-api/usb/error-codes.rst. The errno's own text is generic,
+// e.g. EPROTO is just "protocol error".
+func URBStatusText(errno unix.Errno) string {
+	switch errno {
+	case 0:
+		return "completed"
+	case unix.EINPROGRESS:
+		return "still in progress"
+	case unix.ENOENT:
+		return "unlinked synchronously (cancelled)"
+	case unix.ECONNRESET:
+		return "unlinked asynchronously (cancelled)"
+	case unix.EPROTO:
+		return "bit-stuff error, or no response packet in time"
+	case unix.EILSEQ:
+		return "CRC mismatch, or no response packet"
+	case unix.ETIME:
+		return "no response packet in time"
+	case unix.EPIPE:
+		return "endpoint stalled"
+	case unix.ECOMM:
+		return "data arrived faster than the host could write it to memory"
+	case unix.ENOSR:
+		return "data could not be read from memory fast enough"
+	case unix.EOVERFLOW:
+		return "babble: more data than the buffer or max packet size"
+	case unix.EREMOTEIO:
+		return "short packet, with the short-not-ok flag set"
+	case unix.ENODEV:
+		return "device removed"
+	case unix.EXDEV:
+		return "isochronous transfer only partially completed"
+	case unix.EINVAL:
+		return "invalid URB, or bad isochronous scheduling"
+	case unix.ESHUTDOWN:
+		return "device or host controller disabled"
+	}
+	return errno.Error()
+}
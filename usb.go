@@ -4,9 +4,13 @@ package usb
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
+
+	"github.com/pzl/usb/x/gusb"
 )
 
 func init() {
@@ -14,53 +18,188 @@ func init() {
 
 // Context manages all resources related to USB device handling.
 type Context struct {
+	parent    context.Context
 	done      chan struct{}
 	closeOnce sync.Once
+	stopAfter func() bool
 
 	mu      sync.Mutex
 	devices map[*Device]bool
+	rules   Rules
+	logger  Logger
+	roots   *gusb.Roots // nil for gusb.DefaultRoots
+
+	opTimeout time.Duration // for claim, release and driver ioctls. Zero waits forever
+	buffers   Buffers
+	claimMode ClaimMode
+
+	openHooks  []OpenHook
+	claimHooks []ClaimHook
+	policy     *Policy
+}
+
+// ErrOtherContext is returned for a device already held by another, open, Context.
+var ErrOtherContext = errors.New("usb: device belongs to another Context")
+
+// owners maps each device held by a Context (by enumKey) to it, so that Contexts stay isolated.
+var (
+	ownersMu sync.Mutex
+	owners   = make(map[string]*Context)
+)
+
+// enumKey identifies a device for as long as it stays plugged in. Device numbers
+// are not reused until they wrap, so a re-plugged device gets a new key.
+func enumKey(d *Device) string {
+	return fmt.Sprintf("%d-%d", d.Bus, d.Device)
+}
+
+// Roots are the sysfs and usbfs directories devices are enumerated under, see
+// gusb.Roots.
+type Roots = gusb.Roots
+
+// ContextOption configures a new Context.
+type ContextOption func(*Context)
+
+// WithRoots makes the Context enumerate devices under other sysfs and usbfs
+// directories than the standard ones, e.g. in a chroot or a test fixture.
+func WithRoots(r Roots) ContextOption {
+	return func(c *Context) { c.roots = &r }
 }
 
 // NewContext returns a new Context instance.
-func NewContext() *Context {
+func NewContext(opts ...ContextOption) *Context {
+	return NewContextWithParent(context.Background(), opts...)
+}
+
+// NewContextWithParent returns a new Context carrying the values and deadline of parent.
+// It is cancelled like Close when parent is done, though devices must still be closed.
+func NewContextWithParent(parent context.Context, opts ...ContextOption) *Context {
 	ctx := &Context{
+		parent:  parent,
 		done:    make(chan struct{}),
 		devices: make(map[*Device]bool),
 	}
+	for _, opt := range opts {
+		opt(ctx)
+	}
+	ctx.stopAfter = context.AfterFunc(parent, ctx.cancel)
 	return ctx
 }
 
+// WithTimeout derives a context.Context from c, cancelled after d or when c is closed.
+func WithTimeout(c *Context, d time.Duration) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(c, d)
+}
+
+// WithDeadline derives a context.Context from c, cancelled at t or when c is closed.
+func WithDeadline(c *Context, t time.Time) (context.Context, context.CancelFunc) {
+	return context.WithDeadline(c, t)
+}
+
+// WithValue derives a context.Context from c carrying key and val.
+func WithValue(c *Context, key, val any) context.Context {
+	return context.WithValue(c, key, val)
+}
+
+func (c *Context) cancel() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+	})
+}
+
+// SetRules sets the naming rules applied to every device this Context opens.
+func (c *Context) SetRules(rs Rules) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rules = rs
+}
+
 // OpenDevices calls opener with each enumerated device.
 // If the opener returns true, the device is opened and a Device is returned if the operation succeeds.
 // Every Device returned (whether an error is also returned or not) must be closed.
-// If there are any errors enumerating the devices,
-// the final one is returned along with any successfully opened devices.
+// Errors are returned joined, along with any successfully opened devices: a
+// *gusb.WalkError for each device that couldn't be enumerated, and a *DeviceError for
+// each the opener accepted that couldn't be opened. Use errors.As to pick them out.
 func (c *Context) OpenDevices(opener func(desc *Device) bool) ([]*Device, error) {
-	list, err := List()
-	if err != nil {
+	return c.OpenDevicesContext(context.Background(), opener)
+}
+
+// OpenDevicesContext is OpenDevices, giving up once ctx is done: enumeration stops
+// between devices, and ctx's error is joined to those returned with the devices
+// opened so far. A sysfs read that blocks can't be interrupted, only stopped after.
+func (c *Context) OpenDevicesContext(ctx context.Context, opener func(desc *Device) bool) ([]*Device, error) {
+	list, err := c.list(ctx)
+	if err != nil && len(list) == 0 {
 		return nil, err
 	}
 
-	var reterr error
+	c.mu.Lock()
+	c.rules.Apply(list...)
+	c.mu.Unlock()
+
+	errs := []error{err}
 	var ret []*Device
 	for _, dev := range list {
-
+		if ctx.Err() != nil {
+			if !errors.Is(err, ctx.Err()) {
+				errs = append(errs, ctx.Err())
+			}
+			break
+		}
 		if !opener(dev) { // dev here is *usb.Device from List()
 			continue
 		}
-		dev.ctx = c // Associate context with the device
+		if err := c.adopt(dev); err != nil {
+			errs = append(errs, &DeviceError{Device: dev, Err: err})
+			continue
+		}
 		ret = append(ret, dev)
-		c.mu.Lock()
-		c.devices[dev] = true
-		c.mu.Unlock()
+	}
+	return ret, errors.Join(errs...)
+}
 
+// list enumerates devices under the Context's roots.
+func (c *Context) list(ctx context.Context) ([]*Device, error) {
+	if c.roots == nil {
+		return listContext(ctx)
 	}
-	return ret, reterr
+	return listContext(ctx, ListRoots(*c.roots))
+}
+
+// SetLogger gives the Context's devices their own Logger, instead of the package one.
+func (c *Context) SetLogger(l Logger) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.logger = l
+}
+
+// adopt associates d with the Context, unless another Context holds the same device.
+func (c *Context) adopt(d *Device) error {
+	if err := c.checkPolicy(d); err != nil {
+		return err
+	}
+	key := enumKey(d)
+	ownersMu.Lock()
+	if owner, ok := owners[key]; ok && owner != c {
+		ownersMu.Unlock()
+		return ErrOtherContext
+	}
+	owners[key] = c
+	ownersMu.Unlock()
+
+	d.st.mu.Lock()
+	d.ctx = c
+	d.st.mu.Unlock()
+	c.mu.Lock()
+	c.devices[d] = true
+	c.mu.Unlock()
+	return nil
 }
 
 // OpenDeviceWithVIDPID opens Device from specific VendorId and ProductId.
 // If none is found, it returns nil and nil error. If there are multiple devices
-// with the same VID/PID, it will return one of them, picked arbitrarily.
+// with the same VID/PID, it will return one of them, picked arbitrarily;
+// use OpenDeviceWithVIDPIDStrict to refuse that instead.
 // If there were any errors during device list traversal, it is possible
 // it will return a non-nil device and non-nil error. A Device.Close() must
 // be called to release the device if the returned device wasn't nil.
@@ -82,10 +221,60 @@ func (c *Context) OpenDeviceWithVIDPID(vid, pid ID) (*Device, error) {
 	return devs[0], nil
 }
 
+// ErrMultipleDevices is matched by a MultipleDevicesError, from OpenDeviceWithVIDPIDStrict.
+var ErrMultipleDevices = errors.New("usb: multiple devices match")
+
+// MultipleDevicesError lists the devices that matched when exactly one was expected.
+type MultipleDevicesError struct {
+	Vendor, Product ID
+	Candidates      []*Device
+}
+
+func (e *MultipleDevicesError) Error() string {
+	list := make([]string, len(e.Candidates))
+	for i, d := range e.Candidates {
+		list[i] = fmt.Sprintf("bus %d dev %d serial %q", d.Bus, d.Device, d.Serial)
+	}
+	return fmt.Sprintf("usb: %d devices match %s:%s: %s", len(e.Candidates), e.Vendor, e.Product, strings.Join(list, ", "))
+}
+
+func (e *MultipleDevicesError) Is(target error) bool { return target == ErrMultipleDevices }
+
+// OpenDeviceWithVIDPIDStrict is like OpenDeviceWithVIDPID, but rather than picking one of
+// several matching devices, it opens none and returns a *MultipleDevicesError listing them.
+func (c *Context) OpenDeviceWithVIDPIDStrict(vid, pid ID) (*Device, error) {
+	devs, err := c.OpenDevices(func(desc *Device) bool {
+		return desc.Vendor == vid && desc.Product == pid
+	})
+	switch len(devs) {
+	case 0:
+		return nil, err
+	case 1:
+		return devs[0], nil
+	}
+	for _, d := range devs {
+		d.Close()
+	}
+	return nil, &MultipleDevicesError{Vendor: vid, Product: pid, Candidates: devs}
+}
+
 func (c *Context) closeDev(d *Device) {
 	c.mu.Lock()
-	defer c.mu.Unlock()
 	delete(c.devices, d)
+	held := false
+	key := enumKey(d)
+	for other := range c.devices {
+		held = held || enumKey(other) == key
+	}
+	c.mu.Unlock()
+	if held {
+		return
+	}
+	ownersMu.Lock()
+	if owners[key] == c {
+		delete(owners, key)
+	}
+	ownersMu.Unlock()
 }
 
 func (c *Context) checkOpenDevs() error {
@@ -98,19 +287,23 @@ func (c *Context) checkOpenDevs() error {
 }
 
 // Close releases the Context and all associated resources.
+// Any ReadContext or WriteContext in progress on a device opened through this Context
+// is cancelled. It is safe to call more than once.
+// An error is returned if devices remain open, and those must still be closed.
 func (c *Context) Close() error {
-	if err := c.checkOpenDevs(); err != nil {
-		return err
+	if c.stopAfter != nil {
+		c.stopAfter()
 	}
-	c.closeOnce.Do(func() {
-		close(c.done)
-	})
-	return nil
+	c.cancel()
+	return c.checkOpenDevs()
 }
 
-// Deadline returns no deadline, as usb.Context does not support deadlines.
+// Deadline returns the deadline of the parent context, if any.
 func (c *Context) Deadline() (deadline time.Time, ok bool) {
-	return time.Time{}, false
+	if c.parent == nil {
+		return time.Time{}, false
+	}
+	return c.parent.Deadline()
 }
 
 // Done returns a channel that's closed when the Context is closed.
@@ -118,17 +311,24 @@ func (c *Context) Done() <-chan struct{} {
 	return c.done
 }
 
-// Err returns context.Canceled if the Context has been closed, nil otherwise.
+// Err returns the parent's error if it ended the Context, context.Canceled if the Context
+// has been closed, nil otherwise.
 func (c *Context) Err() error {
 	select {
 	case <-c.done:
+		if c.parent != nil && c.parent.Err() != nil {
+			return c.parent.Err()
+		}
 		return context.Canceled
 	default:
 		return nil
 	}
 }
 
-// Value returns nil, as usb.Context does not carry request-scoped values.
+// Value returns the value associated with key by the parent context, if any.
 func (c *Context) Value(key any) any {
-	return nil
-}
\ No newline at end of file
+	if c.parent == nil {
+		return nil
+	}
+	return c.parent.Value(key)
+}
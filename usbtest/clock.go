@@ -0,0 +1,106 @@
+package usbtest
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock is a fake usb.Clock whose time moves only when Advance is called, so that
+// retries, backoffs and timeouts run deterministically, without real sleeps.
+//
+//	clk := usbtest.NewClock(time.Time{})
+//	usb.SetClock(clk)
+//	defer usb.SetClock(nil)
+//	go func() { done <- intf.ClaimWithTimeout(time.Second) }()
+//	clk.BlockUntil(1)
+//	clk.Advance(10 * time.Millisecond)
+type Clock struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	now     time.Time
+	waiters []waiter
+}
+
+type waiter struct {
+	at time.Time
+	c  chan time.Time
+}
+
+// stopped is a stop function for an already-fired timer.
+func stopped() bool { return false }
+
+// NewClock returns a Clock reading start.
+func NewClock(start time.Time) *Clock {
+	c := &Clock{now: start}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+// Now returns the fake time.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// After returns a channel receiving the fake time once it has advanced by d.
+func (c *Clock) After(d time.Duration) <-chan time.Time {
+	ch, _ := c.NewTimer(d)
+	return ch
+}
+
+// NewTimer is After, with a function removing the waiter before it fires. It reports
+// whether it did, as time.Timer.Stop. A stopped timer no longer counts for BlockUntil.
+func (c *Clock) NewTimer(d time.Duration) (<-chan time.Time, func() bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch, stopped
+	}
+	c.waiters = append(c.waiters, waiter{at: c.now.Add(d), c: ch})
+	c.cond.Broadcast()
+	return ch, func() bool { return c.stop(ch) }
+}
+
+func (c *Clock) stop(ch chan time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, w := range c.waiters {
+		if w.c == ch {
+			c.waiters = append(c.waiters[:i], c.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Sleep blocks until the fake time has advanced by d.
+func (c *Clock) Sleep(d time.Duration) { <-c.After(d) }
+
+// Advance moves the fake time forward by d, waking the sleepers and firing the
+// After channels that fall due, in order.
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	sort.SliceStable(c.waiters, func(i, j int) bool { return c.waiters[i].at.Before(c.waiters[j].at) })
+	n := 0
+	for ; n < len(c.waiters) && !c.waiters[n].at.After(c.now); n++ {
+		c.waiters[n].c <- c.now
+	}
+	c.waiters = c.waiters[n:]
+}
+
+// BlockUntil waits until n goroutines are blocked in Sleep, or on an After channel or
+// timer that has not yet fired or been stopped: the point at which the code under test is waiting for time
+// to pass, and Advance can be called.
+func (c *Clock) BlockUntil(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.waiters) < n {
+		c.cond.Wait()
+	}
+}
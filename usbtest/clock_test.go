@@ -0,0 +1,40 @@
+package usbtest
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClockStoppedTimer(t *testing.T) {
+	clk := NewClock(time.Time{})
+	_, stop := clk.NewTimer(time.Second)
+	if !stop() {
+		t.Error("stopping a pending timer reported it had fired")
+	}
+	if stop() {
+		t.Error("stopping twice reported a pending timer")
+	}
+
+	// with the stopped timer gone, BlockUntil(1) waits for the sleeper
+	slept := make(chan struct{})
+	go func() {
+		clk.Sleep(time.Millisecond)
+		close(slept)
+	}()
+	clk.BlockUntil(1)
+	clk.Advance(time.Millisecond)
+	select {
+	case <-slept:
+	case <-time.After(5 * time.Second):
+		t.Fatal("BlockUntil returned before the sleeper waited")
+	}
+
+	c, stop := clk.NewTimer(time.Millisecond)
+	clk.Advance(time.Millisecond)
+	if stop() {
+		t.Error("stopping a fired timer reported it pending")
+	}
+	if got := <-c; !got.Equal(clk.Now()) {
+		t.Errorf("fired at %v", got)
+	}
+}
@@ -0,0 +1,296 @@
+// Package usbtest writes fake sysfs and usbfs trees, describing whatever devices a
+// test needs, for enumerating with usb.ListRoots or usb.WithRoots.
+//
+//	tree, err := usbtest.NewTree(t.TempDir())
+//	tree.Add(usbtest.RootHub(1))
+//	tree.Add(usbtest.Device{Bus: 1, Dev: 2, Ports: []int{1}, Vendor: 0x1234, Product: 0x5678})
+//	devs, err := usb.List(usb.ListRoots(tree.Roots))
+package usbtest
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pzl/usb/x/gusb"
+)
+
+// Endpoint describes an endpoint descriptor.
+type Endpoint struct {
+	Address       uint8 // including the direction bit
+	Attributes    uint8 // transfer type in bits 0-1
+	MaxPacketSize uint16
+	Interval      uint8
+}
+
+// Interface describes an interface descriptor, and its sysfs directory.
+type Interface struct {
+	Number, Alternate         uint8
+	Class, SubClass, Protocol uint8
+	Endpoints                 []Endpoint
+	Extra                     []byte // class or vendor descriptors following the interface's
+	Driver                    string // bound kernel driver, if any
+}
+
+// Config describes a configuration descriptor.
+type Config struct {
+	Value      uint8
+	Attributes uint8 // default 0x80, bus powered
+	MaxPower   uint8 // in 2mA units
+	Interfaces []Interface
+}
+
+// Device describes a device: its descriptors, and its sysfs attributes.
+type Device struct {
+	Bus, Dev int
+	Ports    []int // port path from the root hub. Empty for the root hub itself
+
+	USBVersion                uint16 // bcdUSB, default 0x0200
+	Class, SubClass, Protocol uint8
+	MaxPacketSize0            uint8 // default 64
+	Vendor, Product           uint16
+	Release                   uint16 // bcdDevice
+
+	Manufacturer, ProductName, Serial string
+
+	Speed        string // sysfs speed in Mbps, default "480"
+	ActiveConfig int    // bConfigurationValue, default the first config's. -1 for unconfigured
+	Configs      []Config
+}
+
+// RootHub describes a typical root hub for bus.
+func RootHub(bus int) Device {
+	return Device{
+		Bus:          bus,
+		Dev:          1,
+		Class:        uint8(gusb.USBClassHub),
+		Vendor:       0x1d6b, // Linux Foundation
+		Product:      0x0002,
+		Manufacturer: "Linux",
+		ProductName:  "EHCI Host Controller",
+		Configs: []Config{{
+			Value:      1,
+			Attributes: 0xe0,
+			Interfaces: []Interface{{
+				Class:     uint8(gusb.USBClassHub),
+				Endpoints: []Endpoint{{Address: 0x81, Attributes: 0x03, MaxPacketSize: 4, Interval: 12}},
+				Driver:    "hub",
+			}},
+		}},
+	}
+}
+
+// Name is the device's sysfs name, e.g. usb1 or 1-2.3.
+func (d Device) Name() string {
+	if len(d.Ports) == 0 {
+		return fmt.Sprintf("usb%d", d.Bus)
+	}
+	ports := make([]string, len(d.Ports))
+	for i, p := range d.Ports {
+		ports[i] = strconv.Itoa(p)
+	}
+	return fmt.Sprintf("%d-%s", d.Bus, strings.Join(ports, "."))
+}
+
+// Descriptors returns the raw descriptors, as read from sysfs or usbfs: the device
+// descriptor, then each configuration with its interfaces and endpoints.
+func (d Device) Descriptors() []byte {
+	usbVer, mps0 := d.USBVersion, d.MaxPacketSize0
+	if usbVer == 0 {
+		usbVer = 0x0200
+	}
+	if mps0 == 0 {
+		mps0 = 64
+	}
+	b := []byte{18, byte(gusb.DTDevice), 0, 0, d.Class, d.SubClass, d.Protocol, mps0, 0, 0, 0, 0, 0, 0, 1, 2, 3, byte(len(d.Configs))}
+	binary.LittleEndian.PutUint16(b[2:], usbVer)
+	binary.LittleEndian.PutUint16(b[8:], d.Vendor)
+	binary.LittleEndian.PutUint16(b[10:], d.Product)
+	binary.LittleEndian.PutUint16(b[12:], d.Release)
+
+	for _, c := range d.Configs {
+		var body []byte
+		numIntf := 0
+		for _, i := range c.Interfaces {
+			if i.Alternate == 0 {
+				numIntf++
+			}
+			body = append(body, 9, byte(gusb.DTInterface), i.Number, i.Alternate, byte(len(i.Endpoints)), i.Class, i.SubClass, i.Protocol, 0)
+			body = append(body, i.Extra...)
+			for _, e := range i.Endpoints {
+				body = append(body, 7, byte(gusb.DTEndpoint), e.Address, e.Attributes, byte(e.MaxPacketSize), byte(e.MaxPacketSize>>8), e.Interval)
+			}
+		}
+		attrs := c.Attributes
+		if attrs == 0 {
+			attrs = 0x80
+		}
+		hdr := []byte{9, byte(gusb.DTConfig), 0, 0, byte(numIntf), c.Value, 0, attrs, c.MaxPower}
+		binary.LittleEndian.PutUint16(hdr[2:], uint16(len(hdr)+len(body)))
+		b = append(append(b, hdr...), body...)
+	}
+	return b
+}
+
+// Tree is a fake sysfs and usbfs tree in a directory.
+type Tree struct {
+	Dir   string
+	Roots gusb.Roots // to enumerate the tree's devices with
+
+	// Controllers names the host controller device of a bus, e.g. "dummy_hcd.0", which
+	// holds its root hub's directory. Buses not listed have theirs straight in platform.
+	Controllers map[int]string
+}
+
+// NewTree creates an empty tree in dir, which should be empty (e.g. t.TempDir()).
+func NewTree(dir string) (*Tree, error) {
+	t := &Tree{
+		Dir: dir,
+		Roots: gusb.Roots{
+			SysFS: filepath.Join(dir, "sys", "bus", "usb", "devices"),
+			USBFS: filepath.Join(dir, "dev", "bus", "usb"),
+		},
+	}
+	for _, p := range []string{t.Roots.SysFS, t.Roots.USBFS, t.driversDir()} {
+		if err := os.MkdirAll(p, 0755); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+func (t *Tree) driversDir() string { return filepath.Join(t.Dir, "sys", "bus", "usb", "drivers") }
+
+// devicesDir is where a device's real sysfs directory goes, nested below its hubs
+// as in /sys/devices. sys/bus/usb/devices only holds links to these.
+func (t *Tree) devicesDir(d Device) string {
+	parts := []string{t.Dir, "sys", "devices", "platform"}
+	if hcd := t.Controllers[d.Bus]; hcd != "" {
+		parts = append(parts, hcd)
+	}
+	parts = append(parts, fmt.Sprintf("usb%d", d.Bus))
+	for i := range d.Ports {
+		parts = append(parts, Device{Bus: d.Bus, Ports: d.Ports[:i+1]}.Name())
+	}
+	return filepath.Join(parts...)
+}
+
+// Add writes a device into the tree: its sysfs directory and attributes, interface
+// directories, and usbfs node (a regular file holding its descriptors).
+func (t *Tree) Add(d Device) error {
+	if d.Speed == "" {
+		d.Speed = "480"
+	}
+	if d.ActiveConfig == 0 && len(d.Configs) > 0 {
+		d.ActiveConfig = int(d.Configs[0].Value)
+	}
+	dir := t.devicesDir(d)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	desc := d.Descriptors()
+	active := ""
+	if d.ActiveConfig > 0 {
+		active = strconv.Itoa(d.ActiveConfig)
+	}
+	attrs := map[string]string{
+		"busnum":              strconv.Itoa(d.Bus),
+		"devnum":              strconv.Itoa(d.Dev),
+		"idVendor":            fmt.Sprintf("%04x", d.Vendor),
+		"idProduct":           fmt.Sprintf("%04x", d.Product),
+		"bDeviceClass":        fmt.Sprintf("%02x", d.Class),
+		"bConfigurationValue": active,
+		"speed":               d.Speed,
+		"dev":                 fmt.Sprintf("189:%d", (d.Bus-1)*128+d.Dev-1),
+		"descriptors":         string(desc),
+	}
+	for name, v := range map[string]string{"manufacturer": d.Manufacturer, "product": d.ProductName, "serial": d.Serial} {
+		if v != "" {
+			attrs[name] = v
+		}
+	}
+	if err := writeAttrs(dir, attrs); err != nil {
+		return err
+	}
+	if err := t.link(dir, d.Name()); err != nil {
+		return err
+	}
+
+	for _, c := range d.Configs {
+		if int(c.Value) != d.ActiveConfig {
+			continue // the kernel only creates interfaces of the active configuration
+		}
+		for _, i := range c.Interfaces {
+			if i.Alternate != 0 {
+				continue
+			}
+			name := fmt.Sprintf("%s:%d.%d", d.Name(), c.Value, i.Number)
+			idir := filepath.Join(dir, name)
+			if err := os.MkdirAll(idir, 0755); err != nil {
+				return err
+			}
+			if err := writeAttrs(idir, map[string]string{
+				"bInterfaceNumber":   fmt.Sprintf("%02x", i.Number),
+				"bAlternateSetting":  fmt.Sprintf("%2d", i.Alternate),
+				"bInterfaceClass":    fmt.Sprintf("%02x", i.Class),
+				"bInterfaceSubClass": fmt.Sprintf("%02x", i.SubClass),
+				"bInterfaceProtocol": fmt.Sprintf("%02x", i.Protocol),
+				"bNumEndpoints":      fmt.Sprintf("%02x", len(i.Endpoints)),
+			}); err != nil {
+				return err
+			}
+			if i.Driver != "" {
+				drv := filepath.Join(t.driversDir(), i.Driver)
+				if err := os.MkdirAll(drv, 0755); err != nil {
+					return err
+				}
+				if err := os.Symlink(drv, filepath.Join(idir, "driver")); err != nil {
+					return err
+				}
+			}
+			if err := t.link(idir, name); err != nil {
+				return err
+			}
+		}
+	}
+
+	node := gusb.NodePath(t.Roots.USBFS, d.Bus, d.Dev)
+	if err := os.MkdirAll(filepath.Dir(node), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(node, desc, 0644)
+}
+
+// link adds the sys/bus/usb/devices entry for a device or interface directory.
+func (t *Tree) link(target, name string) error {
+	return os.Symlink(target, filepath.Join(t.Roots.SysFS, name))
+}
+
+// Remove deletes a device from the tree, as if unplugged.
+func (t *Tree) Remove(d Device) error {
+	matches, _ := filepath.Glob(filepath.Join(t.Roots.SysFS, d.Name()+":*"))
+	for _, m := range append(matches, filepath.Join(t.Roots.SysFS, d.Name())) {
+		if err := os.Remove(m); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.RemoveAll(t.devicesDir(d)); err != nil {
+		return err
+	}
+	return os.Remove(gusb.NodePath(t.Roots.USBFS, d.Bus, d.Dev))
+}
+
+func writeAttrs(dir string, attrs map[string]string) error {
+	for name, v := range attrs {
+		if name != "descriptors" {
+			v += "\n" // sysfs text attributes end in a newline
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(v), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
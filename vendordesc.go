@@ -0,0 +1,113 @@
+package usb
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/pzl/usb/x/gusb"
+)
+
+// DescriptorDecoder decodes a descriptor the library doesn't know, bLength and
+// bDescriptorType included, into a typed value.
+type DescriptorDecoder func(b []byte) (any, error)
+
+type decoderKey struct {
+	vendor ID
+	dt     uint8
+}
+
+var (
+	decodersMu sync.RWMutex
+	decoders   = map[decoderKey]DescriptorDecoder{}
+)
+
+// RegisterDescriptor registers dec for descriptors of type dt in the devices of
+// vendor vid, or of any vendor with a vid of 0, for ExtraDescriptors to decode. A
+// vendor's decoder wins over an any-vendor one. A nil dec removes the registration.
+//
+//	usb.RegisterDescriptor(0x1234, 0x41, func(b []byte) (any, error) { return parseWidgetCaps(b) })
+func RegisterDescriptor(vid ID, dt uint8, dec DescriptorDecoder) {
+	decodersMu.Lock()
+	defer decodersMu.Unlock()
+	if dec == nil {
+		delete(decoders, decoderKey{vid, dt})
+		return
+	}
+	decoders[decoderKey{vid, dt}] = dec
+}
+
+func decoderFor(vid ID, dt uint8) DescriptorDecoder {
+	decodersMu.RLock()
+	defer decodersMu.RUnlock()
+	if dec, ok := decoders[decoderKey{vid, dt}]; ok {
+		return dec
+	}
+	return decoders[decoderKey{0, dt}]
+}
+
+// ExtraDescriptor is a descriptor among the device's that isn't a device,
+// configuration, interface or endpoint one: class-specific and vendor descriptors.
+type ExtraDescriptor struct {
+	Type      uint8 // bDescriptorType
+	Config    int   // bConfigurationValue of the configuration it is in
+	Interface int   // bInterfaceNumber it follows, or -1 if none yet
+	Alternate int
+	Endpoint  int    // address of the endpoint it follows, or -1 if none yet
+	Raw       []byte // bLength and bDescriptorType included
+	Value     any    // from the registered decoder, nil without one
+	Err       error  // from the registered decoder
+}
+
+func (e ExtraDescriptor) String() string {
+	switch {
+	case e.Err != nil:
+		return fmt.Sprintf("descriptor 0x%02x: %v", e.Type, e.Err)
+	case e.Value != nil:
+		return fmt.Sprintf("descriptor 0x%02x: %+v", e.Type, e.Value)
+	}
+	return fmt.Sprintf("descriptor 0x%02x: % x", e.Type, e.Raw)
+}
+
+// ExtraDescriptors returns the descriptors the library doesn't parse itself, in the
+// order the device lists them, decoded by the decoders registered for the device's
+// vendor. See RegisterDescriptor.
+func (d Device) ExtraDescriptors() ([]ExtraDescriptor, error) {
+	raw, err := d.RawDescriptors()
+	if err != nil {
+		return nil, err
+	}
+	var extras []ExtraDescriptor
+	cfg, intf, alt, ep := 0, -1, 0, -1
+	for off := 0; off+2 <= len(raw); {
+		l := int(raw[off])
+		if l < 2 || off+l > len(raw) {
+			return extras, fmt.Errorf("usb: malformed descriptor at offset %d", off)
+		}
+		b := raw[off : off+l]
+		off += l
+		switch gusb.DT(b[1]) {
+		case gusb.DTDevice, gusb.DTString:
+		case gusb.DTConfig:
+			if l > 5 {
+				cfg = int(b[5])
+			}
+			intf, alt, ep = -1, 0, -1
+		case gusb.DTInterface:
+			if l > 3 {
+				intf, alt = int(b[2]), int(b[3])
+			}
+			ep = -1
+		case gusb.DTEndpoint:
+			if l > 2 {
+				ep = int(b[2])
+			}
+		default:
+			e := ExtraDescriptor{Type: b[1], Config: cfg, Interface: intf, Alternate: alt, Endpoint: ep, Raw: b}
+			if dec := decoderFor(d.Vendor, b[1]); dec != nil {
+				e.Value, e.Err = dec(b)
+			}
+			extras = append(extras, e)
+		}
+	}
+	return extras, nil
+}
@@ -0,0 +1,58 @@
+package usb_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/pzl/usb"
+	"github.com/pzl/usb/usbtest"
+)
+
+func TestExtraDescriptors(t *testing.T) {
+	tree, err := usbtest.NewTree(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range []usbtest.Device{usbtest.RootHub(1), {
+		Bus: 1, Dev: 2, Ports: []int{1}, Vendor: 0x1234, Product: 0x9999,
+		Configs: []usbtest.Config{{Value: 1, Interfaces: []usbtest.Interface{{
+			Class:     0xff,
+			Extra:     []byte{5, 0x41, 1, 0x10, 0x00}, // version, and a capability word
+			Endpoints: []usbtest.Endpoint{{Address: 0x81, Attributes: 0x02, MaxPacketSize: 64}},
+		}}}},
+	}} {
+		if err := tree.Add(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	type caps struct {
+		Version uint8
+		Caps    uint16
+	}
+	usb.RegisterDescriptor(0x1234, 0x41, func(b []byte) (any, error) {
+		if len(b) < 5 {
+			return nil, errors.New("short")
+		}
+		return caps{b[2], uint16(b[3]) | uint16(b[4])<<8}, nil
+	})
+	defer usb.RegisterDescriptor(0x1234, 0x41, nil)
+
+	devs, err := usb.List(usb.ListRoots(tree.Roots), usb.ExcludeRootHubs())
+	if err != nil || len(devs) != 1 {
+		t.Fatalf("listed %d devices: %v", len(devs), err)
+	}
+	extras, err := devs[0].ExtraDescriptors()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(extras) != 1 {
+		t.Fatalf("got %d extra descriptors, want 1", len(extras))
+	}
+	e := extras[0]
+	if e.Type != 0x41 || e.Config != 1 || e.Interface != 0 || e.Endpoint != -1 {
+		t.Errorf("descriptor at config %d interface %d endpoint %d, type %02x", e.Config, e.Interface, e.Endpoint, e.Type)
+	}
+	if c, ok := e.Value.(caps); !ok || c.Version != 1 || c.Caps != 0x10 || e.Err != nil {
+		t.Errorf("decoded %+v, %v", e.Value, e.Err)
+	}
+}
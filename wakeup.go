@@ -0,0 +1,144 @@
+package usb
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrNoWakeup is returned when a device can't wake the system: it doesn't support
+// remote wakeup, or isn't on sysfs.
+var ErrNoWakeup = errors.New("usb: device cannot wake the system")
+
+// WakeupLink is one step of the path a wakeup signal takes to the system: the device,
+// each hub above it, the host controller, and the controller's ACPI wakeup device.
+type WakeupLink struct {
+	Path    string // sysfs directory, or ACPI device name for the last link
+	Enabled bool
+}
+
+var acpiWakeup = "/proc/acpi/wakeup"
+
+// Wakeup reports whether the device is allowed to wake the system (power/wakeup).
+func (d Device) Wakeup() (bool, error) {
+	v, err := readWakeup(d.SysPath)
+	return v == "enabled", err
+}
+
+// SetWakeup allows or forbids the device to wake the system. Waking also needs every
+// link above the device enabled, see EnableWakeupChain.
+func (d Device) SetWakeup(enable bool) error {
+	if _, err := readWakeup(d.SysPath); err != nil {
+		return err
+	}
+	return writeWakeup(d.SysPath, enable)
+}
+
+// WakeupChain returns the links a wakeup from the device goes through, from the
+// device up. The system only wakes if all of them are enabled.
+func (d Device) WakeupChain() ([]WakeupLink, error) {
+	if d.SysPath == "" {
+		return nil, ErrNoWakeup
+	}
+	dir, err := filepath.EvalSymlinks(d.SysPath)
+	if err != nil {
+		return nil, err
+	}
+	var chain []WakeupLink
+	for ; filepath.Base(dir) != "devices" && dir != "/"; dir = filepath.Dir(dir) {
+		v, err := readWakeup(dir)
+		if err != nil {
+			if len(chain) == 0 {
+				return nil, err // the device itself can't wake
+			}
+			continue // a directory without wakeup between the controller and the bus
+		}
+		chain = append(chain, WakeupLink{Path: dir, Enabled: v == "enabled"})
+		if !isUSBDeviceName(filepath.Base(dir)) && !strings.HasPrefix(filepath.Base(dir), "usb") {
+			// the host controller: past it, it's up to ACPI
+			if link, ok := acpiWakeupLink(filepath.Base(dir)); ok {
+				chain = append(chain, link)
+			}
+			break
+		}
+	}
+	return chain, nil
+}
+
+// EnableWakeupChain enables wakeup on the device and every link above it, then checks
+// the whole chain, returning an error naming any link that stayed disabled.
+func (d Device) EnableWakeupChain() error {
+	chain, err := d.WakeupChain()
+	if err != nil {
+		return err
+	}
+	for _, l := range chain {
+		if l.Enabled {
+			continue
+		}
+		if filepath.IsAbs(l.Path) {
+			err = writeWakeup(l.Path, true)
+		} else {
+			err = os.WriteFile(acpiWakeup, []byte(l.Path), 0) // writing the name toggles it
+		}
+		if err != nil {
+			return fmt.Errorf("usb: enabling wakeup on %s: %w", l.Path, err)
+		}
+	}
+	if chain, err = d.WakeupChain(); err != nil {
+		return err
+	}
+	for _, l := range chain {
+		if !l.Enabled {
+			return fmt.Errorf("usb: wakeup still disabled on %s", l.Path)
+		}
+	}
+	return nil
+}
+
+// readWakeup reads dir/power/wakeup, which is empty or missing for devices that can't wake.
+func readWakeup(dir string) (string, error) {
+	if dir == "" {
+		return "", ErrNoWakeup
+	}
+	b, err := os.ReadFile(filepath.Join(dir, "power", "wakeup"))
+	if os.IsNotExist(err) {
+		return "", ErrNoWakeup
+	} else if err != nil {
+		return "", err
+	}
+	v := strings.TrimSpace(string(b))
+	if v == "" {
+		return "", ErrNoWakeup
+	}
+	return v, nil
+}
+
+func writeWakeup(dir string, enable bool) error {
+	v := "disabled"
+	if enable {
+		v = "enabled"
+	}
+	return os.WriteFile(filepath.Join(dir, "power", "wakeup"), []byte(v), 0)
+}
+
+// acpiWakeupLink finds the ACPI wakeup device of a PCI host controller, e.g. XHC for 0000:00:14.0.
+func acpiWakeupLink(pci string) (WakeupLink, bool) {
+	f, err := os.Open(acpiWakeup)
+	if err != nil {
+		return WakeupLink{}, false
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		// Device	S-state	  Status   Sysfs node
+		fields := strings.Fields(sc.Text())
+		if len(fields) >= 4 && fields[3] == "pci:"+pci {
+			return WakeupLink{Path: fields[0], Enabled: fields[2] == "*enabled"}, true
+		}
+	}
+	return WakeupLink{}, false
+}
@@ -0,0 +1,36 @@
+package usb_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWakeupChain(t *testing.T) {
+	tree := fixtureTree(t)
+	for dev, v := range map[string]string{"1-2.3": "disabled\n", "1-2": "disabled\n", "usb1": "enabled\n"} {
+		dir := filepath.Join(tree.Roots.SysFS, dev, "power")
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "wakeup"), []byte(v), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	d := listWidget(t, tree)
+	if on, err := d.Wakeup(); err != nil || on {
+		t.Errorf("Wakeup: %v, %v", on, err)
+	}
+	if err := d.EnableWakeupChain(); err != nil {
+		t.Fatal(err)
+	}
+	chain, err := d.WakeupChain()
+	if err != nil || len(chain) != 3 {
+		t.Fatalf("chain %+v, %v", chain, err)
+	}
+	for _, l := range chain {
+		if !l.Enabled {
+			t.Errorf("%s still disabled", l.Path)
+		}
+	}
+}
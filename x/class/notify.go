@@ -0,0 +1,147 @@
+// Package class decodes class-specific data read from devices, such as hub and CDC
+// notifications.
+//
+// Experimental: the package is outside package usb's compatibility promise, and its
+// API may change in any release. Package usb forwards the names it has long exported.
+package class
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Notification is an event read from an interrupt endpoint: a HubChange, SerialState,
+// NetworkConnection, ResponseAvailable, SpeedChange or CDCNotification.
+type Notification interface{ notification() }
+
+// HubChange is a hub's status change bitmap: which ports, or the hub itself, changed.
+// Read the port status with a GET_STATUS request to learn what changed.
+type HubChange struct {
+	Hub   bool
+	Ports []int // 1-based
+}
+
+// CDC notification codes, bNotification.
+const (
+	CDCNetworkConnection     = 0x00
+	CDCResponseAvailable     = 0x01
+	CDCSerialState           = 0x20
+	CDCConnectionSpeedChange = 0x2a
+)
+
+// CDCNotification is a CDC notification DecodeCDC has no type for.
+type CDCNotification struct {
+	Code      uint8 // bNotification
+	Value     uint16
+	Interface int // wIndex
+	Data      []byte
+}
+
+// SerialState is a CDC ACM SERIAL_STATE notification, the UART's line state.
+type SerialState struct {
+	Interface int
+	DCD       bool // bRxCarrier, carrier detect
+	DSR       bool // bTxCarrier, data set ready
+	Break     bool
+	Ring      bool
+	Framing   bool // framing error
+	Parity    bool // parity error
+	Overrun   bool // received data was lost
+}
+
+// NetworkConnection is a CDC NETWORK_CONNECTION notification.
+type NetworkConnection struct {
+	Interface int
+	Connected bool
+}
+
+// ResponseAvailable is a CDC RESPONSE_AVAILABLE notification: the device has an
+// encapsulated response to read with a GET_ENCAPSULATED_RESPONSE request.
+type ResponseAvailable struct {
+	Interface int
+}
+
+// SpeedChange is a CDC CONNECTION_SPEED_CHANGE notification, in bits per second.
+type SpeedChange struct {
+	Interface        int
+	Downlink, Uplink uint32
+}
+
+func (HubChange) notification()         {}
+func (CDCNotification) notification()   {}
+func (SerialState) notification()       {}
+func (NetworkConnection) notification() {}
+func (ResponseAvailable) notification() {}
+func (SpeedChange) notification()       {}
+
+// ErrBadNotification is returned by decoders given malformed data.
+var ErrBadNotification = errors.New("usb: malformed notification")
+
+// DecodeHubChange decodes a hub's status change endpoint: bit 0 for the hub, bit n for port n.
+func DecodeHubChange(data []byte) ([]Notification, error) {
+	var c HubChange
+	for i, b := range data {
+		for bit := 0; bit < 8; bit++ {
+			if b&(1<<bit) == 0 {
+				continue
+			}
+			if n := i*8 + bit; n == 0 {
+				c.Hub = true
+			} else {
+				c.Ports = append(c.Ports, n)
+			}
+		}
+	}
+	if !c.Hub && len(c.Ports) == 0 {
+		return nil, nil
+	}
+	return []Notification{c}, nil
+}
+
+// DecodeCDC decodes CDC notifications: an 8 byte setup-like header, then wLength bytes.
+func DecodeCDC(data []byte) ([]Notification, error) {
+	var ns []Notification
+	for len(data) > 0 {
+		if len(data) < 8 {
+			return ns, fmt.Errorf("%w: %d byte CDC header", ErrBadNotification, len(data))
+		}
+		code := data[1]
+		value := binary.LittleEndian.Uint16(data[2:])
+		intf := int(binary.LittleEndian.Uint16(data[4:]))
+		length := int(binary.LittleEndian.Uint16(data[6:]))
+		if len(data) < 8+length {
+			return ns, fmt.Errorf("%w: CDC notification %02x wants %d bytes, has %d", ErrBadNotification, code, length, len(data)-8)
+		}
+		payload := data[8 : 8+length]
+		data = data[8+length:]
+
+		switch {
+		case code == CDCSerialState && len(payload) >= 2:
+			bits := binary.LittleEndian.Uint16(payload)
+			ns = append(ns, SerialState{
+				Interface: intf,
+				DCD:       bits&0x01 != 0,
+				DSR:       bits&0x02 != 0,
+				Break:     bits&0x04 != 0,
+				Ring:      bits&0x08 != 0,
+				Framing:   bits&0x10 != 0,
+				Parity:    bits&0x20 != 0,
+				Overrun:   bits&0x40 != 0,
+			})
+		case code == CDCNetworkConnection:
+			ns = append(ns, NetworkConnection{Interface: intf, Connected: value != 0})
+		case code == CDCResponseAvailable:
+			ns = append(ns, ResponseAvailable{Interface: intf})
+		case code == CDCConnectionSpeedChange && len(payload) >= 8:
+			ns = append(ns, SpeedChange{
+				Interface: intf,
+				Downlink:  binary.LittleEndian.Uint32(payload),
+				Uplink:    binary.LittleEndian.Uint32(payload[4:]),
+			})
+		default:
+			ns = append(ns, CDCNotification{Code: code, Value: value, Interface: intf, Data: append([]byte(nil), payload...)})
+		}
+	}
+	return ns, nil
+}
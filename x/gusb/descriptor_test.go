@@ -0,0 +1,216 @@
+package gusb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"unsafe"
+)
+
+var Desc = []byte{
+	0x12, 0x01, 0x00, 0x02, 0x00, 0x00, 0x00, 0x40, 0xc5, 0x04, 0xa2, 0x11, 0x00,
+	0x01, 0x01, 0x02, 0x00, 0x01, 0x09, 0x02, 0x20, 0x00, 0x01, 0x01, 0x00, 0xc0,
+	0x31, 0x09, 0x04, 0x00, 0x00, 0x02, 0xff, 0xff, 0xff, 0x00, 0x07, 0x05, 0x81,
+	0x02, 0x00, 0x02, 0xff, 0x07, 0x05, 0x02, 0x02, 0x00, 0x02, 0xff,
+}
+
+var R DeviceDescriptor
+
+func BenchmarkDescriptors(b *testing.B) {
+	b.ReportAllocs()
+	var result DeviceDescriptor
+	var err error
+
+	for n := 0; n < b.N; n++ {
+		result, err = NewDevice(Desc)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	// fighting the compiler
+	R = result
+}
+
+func TestParseDescriptorUnconfigured(t *testing.T) {
+	// device claims 2 configs, describes one with bConfigurationValue 0 and
+	// an interface numbered beyond bNumInterfaces
+	b := []byte{
+		0x12, 0x01, 0x00, 0x02, 0x00, 0x00, 0x00, 0x40, 0xc5, 0x04, 0xa2, 0x11, 0x00,
+		0x01, 0x01, 0x02, 0x00, 0x02, 0x09, 0x02, 0x19, 0x00, 0x01, 0x00, 0x00, 0xc0,
+		0x31, 0x09, 0x04, 0x03, 0x00, 0x01, 0xff, 0xff, 0xff, 0x00, 0x07, 0x05, 0x81,
+		0x02, 0x00, 0x02, 0xff,
+	}
+	d, err := ParseDescriptor(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Configs) != 2 {
+		t.Fatalf("expected 2 config slots, got %d", len(d.Configs))
+	}
+	if d.Configs[0].Value != 0 || d.Configs[1].Length != 0 {
+		t.Errorf("unexpected configs: %v", d.Configs)
+	}
+	if i := d.Configs[0].Interfaces[0]; i.InterfaceNumber != 3 || len(i.Endpoints) != 1 {
+		t.Errorf("interface 3 should be stored in the first slot: %v", i)
+	}
+}
+
+func TestParseDescriptorSparseInterfaces(t *testing.T) {
+	// config of 2 interfaces, numbered 0 and 20, interface 0 with an alternate setting
+	b := []byte{
+		0x12, 0x01, 0x00, 0x02, 0x00, 0x00, 0x00, 0x40, 0xc5, 0x04, 0xa2, 0x11, 0x00,
+		0x01, 0x01, 0x02, 0x00, 0x01,
+		0x09, 0x02, 0x32, 0x00, 0x02, 0x01, 0x00, 0xc0, 0x31,
+		0x09, 0x04, 0x00, 0x00, 0x00, 0xff, 0xff, 0xff, 0x00,
+		0x09, 0x04, 0x00, 0x01, 0x01, 0xff, 0xff, 0xff, 0x00,
+		0x07, 0x05, 0x81, 0x01, 0x00, 0x02, 0x01,
+		0x09, 0x04, 0x14, 0x00, 0x01, 0xff, 0xff, 0xff, 0x00,
+		0x07, 0x05, 0x02, 0x02, 0x00, 0x02, 0x00,
+	}
+	d, err := ParseDescriptor(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	intfs := d.Configs[0].Interfaces
+	if len(intfs) != 2 || intfs[0].InterfaceNumber != 0 || intfs[1].InterfaceNumber != 20 {
+		t.Fatalf("unexpected interfaces: %v", intfs)
+	}
+	if len(intfs[0].Endpoints) != 0 || len(intfs[0].AltSettings) != 1 || intfs[0].AltSettings[0].Endpoints[0].Address != 0x81 {
+		t.Errorf("alternate setting not kept apart: %v", intfs[0])
+	}
+	if intfs[1].Endpoints[0].Address != 0x02 {
+		t.Errorf("interface 20 endpoints: %v", intfs[1].Endpoints)
+	}
+}
+
+func TestURBSize(t *testing.T) {
+	// struct usbdevfs_urb, without the trailing iso descriptors
+	want := uintptr(44)
+	if unsafe.Sizeof(VoidPtr(0)) == 8 {
+		want = 56
+	}
+	if got := unsafe.Sizeof(URB{}); got != want {
+		t.Errorf("URB is %d bytes, kernel expects %d", got, want)
+	}
+}
+
+func TestCheckLayout(t *testing.T) {
+	if err := CheckLayout(); err != nil {
+		t.Error(err)
+	}
+}
+
+// Descriptors are little endian on the wire, and must parse the same on any host.
+func TestDescriptorByteOrder(t *testing.T) {
+	dev, err := ParseDescriptor(bytes.NewReader(Desc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dev.USBVer != 0x0200 || dev.Vendor != 0x04c5 || dev.Product != 0x11a2 || dev.Version != 0x0100 {
+		t.Errorf("device descriptor: bcdUSB %04x, vendor %04x, product %04x, bcdDevice %04x",
+			uint16(dev.USBVer), uint16(dev.Vendor), uint16(dev.Product), uint16(dev.Version))
+	}
+	if got := dev.Configs[0].TotalLength; got != 0x20 {
+		t.Errorf("wTotalLength %#x, want 0x20", got)
+	}
+	if got := dev.Configs[0].Interfaces[0].Endpoints[0].MaxPacketSize; got != 0x200 {
+		t.Errorf("wMaxPacketSize %#x, want 0x200", got)
+	}
+}
+
+// ioctl arguments are serialized for the kernel, which reads them as native C structs.
+func TestIoctlArgNativeLayout(t *testing.T) {
+	arg := IoctlPacket{IfNo: 0x01020304, IoctlCode: 0x05060708, Data: 0x090a0b0c}
+	var b bytes.Buffer
+	if err := binary.Write(&b, binary.NativeEndian, &arg); err != nil {
+		t.Fatal(err)
+	}
+	native := unsafe.Slice((*byte)(unsafe.Pointer(&arg)), unsafe.Sizeof(arg))
+	if !bytes.Equal(b.Bytes(), native) {
+		t.Errorf("serialized % x, native % x", b.Bytes(), native)
+	}
+}
+
+func TestSetupPacket(t *testing.T) {
+	raw := []byte{0x80, 0x06, 0x00, 0x01, 0x00, 0x00, 0x12, 0x00} // GET_DESCRIPTOR device, 18 bytes
+	var s SetupPacket
+	if err := s.UnmarshalBinary(raw); err != nil {
+		t.Fatal(err)
+	}
+	want := SetupPacket{RequestType: RequestDirIn, Request: RequestGetDescriptor, Value: uint16(DTDevice) << 8, Length: 18}
+	if s != want || !s.In() || s.Type() != RequestTypeStandard || s.Recipient() != RecipientDevice {
+		t.Errorf("decoded %v, want %v", s, want)
+	}
+	if b, err := s.MarshalBinary(); err != nil || !bytes.Equal(b, raw) {
+		t.Errorf("encoded % x, %v", b, err)
+	}
+	if err := s.UnmarshalBinary(raw[:7]); err == nil {
+		t.Error("decoded a short packet")
+	}
+}
+
+func TestRestartable(t *testing.T) {
+	for _, c := range []struct {
+		data interface{}
+		want bool
+	}{
+		{&BulkTransfer{Ep: 0x81}, true},
+		{&BulkTransfer{Ep: 0x02}, false},
+		{&CtrlTransfer{RequestType: RequestDirIn}, true},
+		{&CtrlTransfer{RequestType: RequestTypeVendor}, false},
+		{new(int32), true},
+	} {
+		if got := restartable(c.data); got != c.want {
+			t.Errorf("restartable(%+v) = %v, want %v", c.data, got, c.want)
+		}
+	}
+}
+
+func TestEnv(t *testing.T) {
+	env := map[string]string{EnvSysFSRoot: "/host/sys/bus/usb/devices"}
+	r := rootsFromEnv(func(k string) string { return env[k] })
+	if r.SysFS != env[EnvSysFSRoot] || r.USBFS != findUSBFS() {
+		t.Errorf("roots: %+v", r)
+	}
+	env[EnvDevFSRoot] = "/host/dev/bus/usb"
+	if r := rootsFromEnv(func(k string) string { return env[k] }); r.USBFS != env[EnvDevFSRoot] {
+		t.Errorf("roots: %+v", r)
+	}
+
+	defer func(l int) { logLevel = l }(logLevel)
+	for v, want := range map[string]int{"": -1, "x": -1, "-2": -1, "0": 0, " 2\n": 2, "9": 4} {
+		if got := logLevelFromEnv(v); got != want {
+			t.Errorf("USB_DEBUG=%q: level %d, want %d", v, got, want)
+		}
+	}
+	logLevel = 2
+	for format, want := range map[string]bool{"ERROR: x": true, "WARNING: x": true, "INFO: x": false, "DEBUG: x": false, "x": false} {
+		if LogEnabled(format) != want {
+			t.Errorf("%q at level 2: want %v", format, want)
+		}
+	}
+}
+
+func TestUsbfsToBusOrder(t *testing.T) {
+	// Desc as a big-endian host's usbfs node has it: the device descriptor's 16-bit
+	// fields swapped, the configuration left in bus order
+	be := bytes.Clone(Desc)
+	for _, off := range []int{2, 8, 10, 12} {
+		be[off], be[off+1] = be[off+1], be[off]
+	}
+	got := UsbfsToBusOrder(bytes.Clone(be), binary.BigEndian)
+	if !bytes.Equal(got, Desc) {
+		t.Errorf("converted:\n% x\nwant\n% x", got, Desc)
+	}
+	d, err := ParseDescriptor(bytes.NewReader(got))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Vendor != 0x04c5 || d.Product != 0x11a2 || d.USBVer != 0x0200 || d.Configs[0].TotalLength != 0x20 {
+		t.Errorf("parsed %04x:%04x usb %04x, config length %d", d.Vendor, d.Product, d.USBVer, d.Configs[0].TotalLength)
+	}
+	if got := UsbfsToBusOrder(bytes.Clone(Desc), binary.LittleEndian); !bytes.Equal(got, Desc) {
+		t.Errorf("changed on a little-endian host:\n% x", got)
+	}
+}
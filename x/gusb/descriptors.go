@@ -451,6 +451,7 @@ type InterfaceDescriptor struct {
 	DescClasses      // 3 * uint8. Class,Subclass,Protocol
 	StrIndex         uint8
 	Endpoints        []EndpointDescriptor
+	AltSettings      []InterfaceDescriptor // further alternate settings of this interface, as described
 	extradata        []byte
 }
 
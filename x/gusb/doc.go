@@ -0,0 +1,19 @@
+/*
+Package gusb contains lower-level USB interaction. If you want to parse descriptors, send Ioctls manually, or other inspections, use this.
+
+Experimental: the package is outside package usb's compatibility promise, and its API may change in any release, as it follows the kernel's usbfs structures and ioctls. Package usb forwards the few types its own API uses, such as USBClass and SetupPacket, which stay as they are.
+
+Descriptors
+
+This is generally what you see when running lsusb, especially with the verbose flag. It reads the classification information the USB device provides to describe itself. The second byte of a descriptor header is a type constant. In C those IDs are USB_DT_* constants. In Go, they begin with DT. The struct types themselves are:
+
+	DeviceDescriptor
+	ConfigDescriptor
+	InterfaceDescriptor
+	EndpointDescriptor
+	StringDescriptor
+	DevQualifierDescriptor
+
+
+*/
+package gusb
@@ -0,0 +1,58 @@
+package gusb
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Environment variables read at startup, like libusb's LIBUSB_DEBUG, so containers and
+// test harnesses can redirect the library without code changes. Programs can still
+// override them, with Roots or usb.WithRoots and usb.SetDevNodeRoot.
+const (
+	EnvSysFSRoot = "USB_SYSFS_ROOT" // replaces DefaultRoots.SysFS
+	EnvDevFSRoot = "USB_DEVFS_ROOT" // replaces DefaultRoots.USBFS
+	EnvDebug     = "USB_DEBUG"      // log level: 0 none, 1 errors, 2 warnings, 3 info, 4 debug
+)
+
+// rootsFromEnv is DefaultRoots, with the variables' values in place of the standard
+// locations.
+func rootsFromEnv(getenv func(string) string) Roots {
+	r := Roots{SysFS: getenv(EnvSysFSRoot), USBFS: getenv(EnvDevFSRoot)}
+	if r.SysFS == "" {
+		r.SysFS = "/sys/bus/usb/devices"
+	}
+	if r.USBFS == "" {
+		r.USBFS = findUSBFS()
+	}
+	return r
+}
+
+// logLevelFromEnv parses USB_DEBUG, -1 if unset or not a number: everything is logged.
+func logLevelFromEnv(v string) int {
+	n, err := strconv.Atoi(strings.TrimSpace(v))
+	if err != nil || n < 0 {
+		return -1
+	}
+	return min(n, 4)
+}
+
+// LogEnabled reports whether USB_DEBUG lets through a message, going by its level
+// prefix (ERROR:, WARNING:, INFO:, DEBUG:). Unprefixed messages count as info.
+func LogEnabled(format string) bool {
+	if logLevel < 0 {
+		return true
+	}
+	level := 3
+	switch {
+	case strings.HasPrefix(format, "ERROR:"):
+		level = 1
+	case strings.HasPrefix(format, "WARNING:"):
+		level = 2
+	case strings.HasPrefix(format, "DEBUG:"):
+		level = 4
+	}
+	return level <= logLevel
+}
+
+var logLevel = logLevelFromEnv(os.Getenv(EnvDebug))
@@ -0,0 +1,113 @@
+package gusb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// Hand-craft an IOCTL to send to an open file descriptor.
+// data must be a pointer.
+// Requests interrupted by a signal are issued again, see restartable, as the Go
+// runtime's preemption signals would otherwise fail them at random.
+func Ioctl(f *os.File, ioctl IoctlRequest, data interface{}) (int, error) {
+	if data == nil {
+		// argument-less requests, e.g. USBDEVFS_RESET
+		r, _, err := unix.Syscall(unix.SYS_IOCTL, uintptr(f.Fd()), uintptr(uint32(ioctl)), 0)
+		for err == unix.EINTR {
+			r, _, err = unix.Syscall(unix.SYS_IOCTL, uintptr(f.Fd()), uintptr(uint32(ioctl)), 0)
+		}
+		if err != 0 {
+			return int(r), err
+		}
+		return int(r), nil
+	}
+	if size := ioctlSize(ioctl); binary.Size(data) < size {
+		// the kernel would read or write past the argument
+		return -1, fmt.Errorf("gusb: ioctl %08x argument is %d bytes, want %d", uint32(ioctl), binary.Size(data), size)
+	}
+	// ioctl arguments are C structs in the host's byte order: the kernel converts
+	// to USB's little endian itself. Serialize to pass to kernel
+	b := new(bytes.Buffer)
+	if err := binary.Write(b, binary.NativeEndian, data); err != nil {
+		return -1, err
+	}
+	// the conversion from unsafe.Pointer to uintptr MUST
+	// occur in the call expression. For compiler to recognize
+	// this pattern, and have the GC not muck with things
+	//nolint:unconvert
+	r, _, err := unix.Syscall(
+		unix.SYS_IOCTL,                           // ioctl
+		uintptr(f.Fd()),                          // file
+		uintptr(uint32(ioctl)),                   // request
+		uintptr(unsafe.Pointer(&(b.Bytes()[0]))), // argument
+	)
+	for err == unix.EINTR && restartable(data) {
+		r, _, err = unix.Syscall(unix.SYS_IOCTL, uintptr(f.Fd()), uintptr(uint32(ioctl)), uintptr(unsafe.Pointer(&(b.Bytes()[0]))))
+	}
+	if err != 0 {
+		//return -1, os.NewSyscallError("ioctl", err)
+		return int(r), err
+	}
+	// read back the (possibly) kernel-modified bytes into the original struct given
+	if err := binary.Read(b, binary.NativeEndian, data); err != nil {
+		return int(r), err // @todo: more user-friendly error what's going on here. Ioctl may have succeeded, but parsing failed
+	}
+	return int(r), nil
+}
+
+// ioctlPtr sends an IOCTL whose argument is used in place, by address, rather than
+// serialized. The caller must keep the pointed-to memory alive as long as the kernel uses it.
+// A request interrupted by a signal is issued again. EAGAIN is returned as is: it is
+// how USBDEVFS_REAPURBNDELAY says nothing has completed.
+func ioctlPtr(f *os.File, ioctl IoctlRequest, p unsafe.Pointer) error {
+	_, _, err := unix.Syscall(unix.SYS_IOCTL, uintptr(f.Fd()), uintptr(uint32(ioctl)), uintptr(p))
+	for err == unix.EINTR {
+		_, _, err = unix.Syscall(unix.SYS_IOCTL, uintptr(f.Fd()), uintptr(uint32(ioctl)), uintptr(p))
+	}
+	if err != 0 {
+		return err
+	}
+	return nil
+}
+
+// restartable reports whether an ioctl that failed with EINTR can be issued again.
+// All can but synchronous OUT transfers: the kernel drops what an interrupted IN
+// transfer read, so reading again loses nothing more, but part of an OUT transfer may
+// have gone out already, and sending it again would repeat it. Those return EINTR.
+func restartable(data interface{}) bool {
+	switch t := data.(type) {
+	case *BulkTransfer:
+		return t.Ep&RequestDirIn != 0
+	case *CtrlTransfer:
+		return t.RequestType&RequestDirIn != 0
+	}
+	return true
+}
+
+/*
+Can be used to calculate an IOCTL number dynamically. Here's an example translation from the C def for USBDEVFS_CONTROL
+	#define USBDEVFS_CONTROL     _IOWR('U', 0, struct usbdevfs_ctrltransfer)
+WR means read and write, so both should be set to true. char is 'U', which is true for all the usbfs subsystem. num is 0 (second param). size is: sizeof that struct (0x18 on 64 bit).
+
+so call Ioctlnum(true, true, 0, 0x18) will give you 0xC0185500 = USBDEVFS_CONTROL.
+*/
+func Ioctlnum(read bool, write bool, num uint8, size uint16) uint32 {
+	const IOCTL_USB_CHAR = 'U' // 0x55
+	r, w := 0, 0
+	if read {
+		r++
+	}
+	if write {
+		w++
+	}
+	return uint32(num) |
+		uint32(IOCTL_USB_CHAR)<<8 |
+		uint32(size)<<16 |
+		uint32(w)<<30 |
+		uint32(r)<<31
+}
@@ -0,0 +1,52 @@
+package gusb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"unsafe"
+)
+
+// URB is used in place by the kernel, so its native layout must match struct
+// usbdevfs_urb exactly. These fail to compile on an architecture where it doesn't.
+var (
+	_ = [1]struct{}{}[unsafe.Sizeof(URB{})-urbSize]
+	_ = [1]struct{}{}[unsafe.Offsetof(URB{}.Buffer)-urbBufferOffset]
+	_ = [1]struct{}{}[unsafe.Offsetof(URB{}.UserContext)-urbContextOffset]
+	_ = [1]struct{}{}[unsafe.Sizeof(IsoPacketDesc{})-12]
+)
+
+// ioctlSize returns the argument size encoded in an ioctl request number.
+func ioctlSize(req IoctlRequest) int { return int(uint32(req)>>16) & 0x3fff }
+
+// CheckLayout verifies that the structs passed to the kernel have the sizes encoded
+// in their ioctl numbers on this architecture, as a self-check for ports to new
+// platforms. Ioctl also refuses a too-small argument, rather than let the kernel
+// write past it.
+func CheckLayout() error {
+	for _, c := range []struct {
+		req  IoctlRequest
+		name string
+		arg  any
+	}{
+		{USBDEVFS_CONTROL, "CtrlTransfer", CtrlTransfer{}},
+		{USBDEVFS_BULK, "BulkTransfer", BulkTransfer{}},
+		{USBDEVFS_SETINTERFACE, "SetInterface", SetInterface{}},
+		{USBDEVFS_DISCSIGNAL, "DisconnectSignal", DisconnectSignal{}},
+		{USBDEVFS_GETDRIVER, "GetDriverS", GetDriverS{}},
+		{USBDEVFS_CONNECTINFO, "ConnectInfo", ConnectInfo{}},
+		{USBDEVFS_IOCTL, "IoctlPacket", IoctlPacket{}},
+		{USBDEVFS_HUB_PORTINFO, "HubPortinfo", HubPortinfo{}},
+		{USBDEVFS_DISCONNECT_CLAIM, "DisconnectClaim", DisconnectClaim{}},
+	} {
+		if got, want := binary.Size(c.arg), ioctlSize(c.req); got != want {
+			return fmt.Errorf("gusb: %s is %d bytes, its ioctl %08x expects %d", c.name, got, uint32(c.req), want)
+		}
+	}
+	if got, want := ioctlSize(USBDEVFS_SUBMITURB), int(unsafe.Sizeof(URB{})); got != want {
+		return fmt.Errorf("gusb: URB is %d bytes, USBDEVFS_SUBMITURB expects %d", want, got)
+	}
+	if got, want := ioctlSize(USBDEVFS_REAPURB), int(unsafe.Sizeof(uintptr(0))); got != want {
+		return fmt.Errorf("gusb: USBDEVFS_REAPURB expects a %d byte pointer, not %d", got, want)
+	}
+	return nil
+}
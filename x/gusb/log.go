@@ -0,0 +1,37 @@
+package gusb
+
+import (
+	"log"
+	"sync"
+)
+
+// Logger receives diagnostic messages. *log.Logger satisfies it.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+var (
+	logMu  sync.RWMutex
+	logger Logger = log.Default()
+)
+
+// SetLogger routes this package's diagnostics to l. A nil Logger discards them.
+func SetLogger(l Logger) {
+	logMu.Lock()
+	defer logMu.Unlock()
+	logger = l
+}
+
+// Logf writes a diagnostic message to the current Logger, unless USB_DEBUG filters
+// it out, see LogEnabled.
+func Logf(format string, v ...interface{}) {
+	if !LogEnabled(format) {
+		return
+	}
+	logMu.RLock()
+	l := logger
+	logMu.RUnlock()
+	if l != nil {
+		l.Printf(format, v...)
+	}
+}
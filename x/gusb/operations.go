@@ -0,0 +1,224 @@
+package gusb
+
+import (
+	"errors"
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// Claim detaches any kernel driver from an interface and claims it, in one ioctl where
+// the kernel supports it, so the driver can't re-bind in between.
+// usbfs itself, i.e. a claim by another process, is never detached.
+func Claim(f *os.File, ifno int32) error {
+	err := DisconnectAndClaim(f, ifno, DisconnectClaimExceptDriver, "usbfs")
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, unix.EBUSY):
+		// claimed through usbfs: by this file, which claiming again is fine, or by another
+		if r, errno := Ioctl(f, USBDEVFS_CLAIMINTERFACE, &ifno); r == -1 {
+			return errno
+		}
+		return nil
+	case !errors.Is(err, unix.ENOTTY):
+		return err
+	}
+	// before Linux 3.6: detach, then claim
+	if r, errno := Ioctl(f, USBDEVFS_IOCTL, &IoctlPacket{
+		IfNo:      ifno,
+		IoctlCode: int32(USBDEVFS_DISCONNECT), // disconn kernel driver
+		Data:      0,
+	}); errno == unix.ENODATA {
+		// Debug: no previous kernel driver attached
+	} else if r == -1 {
+		Logf("ERROR: driver disconnect failed: %d, %v\n", r, errno)
+	}
+
+	if r, errno := Ioctl(f, USBDEVFS_CLAIMINTERFACE, &ifno); r == -1 {
+		return errno
+	}
+	return nil
+}
+
+// DisconnectAndClaim flags, filtering which kernel driver may be detached.
+const (
+	DisconnectClaimIfDriver     = 0x01 // only detach the named driver, fail with EBUSY for another
+	DisconnectClaimExceptDriver = 0x02 // detach any driver but the named one, which fails with EBUSY
+)
+
+// DisconnectAndClaim detaches the kernel driver bound to an interface, subject to flags,
+// and claims the interface, atomically. It fails with ENOTTY before Linux 3.6.
+func DisconnectAndClaim(f *os.File, ifno int32, flags uint32, driver string) error {
+	dc := DisconnectClaim{Interface: uint32(ifno), Flags: flags}
+	copy(dc.Driver[:MAXDRIVERNAME], driver)
+	if r, errno := Ioctl(f, USBDEVFS_DISCONNECT_CLAIM, &dc); r == -1 {
+		return errno
+	}
+	return nil
+}
+
+func Release(f *os.File, ifno int32) error {
+	if r, errno := Ioctl(f, USBDEVFS_RELEASEINTERFACE, &ifno); r == -1 {
+		return errno
+	}
+
+	if r, errno := Ioctl(f, USBDEVFS_IOCTL, &IoctlPacket{
+		IfNo:      ifno,
+		IoctlCode: int32(USBDEVFS_CONNECT), //reconnect kernel driver
+		Data:      0,
+	}); r == -1 {
+		Logf("ERROR: driver connect failed: %d, %v\n", r, errno)
+	}
+	return nil
+}
+
+func SetConfiguration(f *os.File, cfg int32) error {
+	if r, errno := Ioctl(f, USBDEVFS_SETCONFIGURATION, &cfg); r == -1 {
+		return errno
+	}
+	return nil
+}
+
+func SetAltSetting(f *os.File, ifno int32, alt int32) error {
+	if r, errno := Ioctl(f, USBDEVFS_SETINTERFACE, &SetInterface{
+		Interface:  uint32(ifno),
+		AltSetting: uint32(alt),
+	}); r == -1 {
+		return errno
+	}
+	return nil
+}
+
+func Reset(f *os.File) error {
+	if r, errno := Ioctl(f, USBDEVFS_RESET, nil); r == -1 {
+		return errno
+	}
+	return nil
+}
+
+// ClearHalt clears the halt (stall) of endpoint ep, with a CLEAR_FEATURE request, and
+// resets the host's data toggle for it, which the request alone would leave out of step.
+func ClearHalt(f *os.File, ep uint32) error {
+	if r, errno := Ioctl(f, USBDEVFS_CLEAR_HALT, &ep); r == -1 {
+		return errno
+	}
+	return nil
+}
+
+// NewURB allocates a URB followed by numPackets iso packet descriptors in one block,
+// as the kernel expects for isochronous URBs, and returns both.
+func NewURB(numPackets int) (*URB, []IsoPacketDesc) {
+	size := unsafe.Sizeof(URB{}) + uintptr(numPackets)*unsafe.Sizeof(IsoPacketDesc{})
+	mem := make([]uint64, (size+7)/8) // uint64 for alignment
+	u := (*URB)(unsafe.Pointer(&mem[0]))
+	u.NumberOfPackets = int32(numPackets)
+	if numPackets == 0 {
+		return u, nil
+	}
+	descs := unsafe.Slice((*IsoPacketDesc)(unsafe.Add(unsafe.Pointer(u), unsafe.Sizeof(URB{}))), numPackets)
+	return u, descs
+}
+
+// SubmitURB queues u with the kernel. u, and the buffer it points to, must stay
+// reachable until the URB is returned by ReapURB.
+func SubmitURB(f *os.File, u *URB) error {
+	return ioctlPtr(f, USBDEVFS_SUBMITURB, unsafe.Pointer(u))
+}
+
+// DiscardURB cancels a submitted URB. It must still be reaped.
+func DiscardURB(f *os.File, u *URB) error {
+	return ioctlPtr(f, USBDEVFS_DISCARDURB, unsafe.Pointer(u))
+}
+
+// ReapURB returns the address of a completed URB, as it was given to SubmitURB.
+// If wait is false, it returns unix.EAGAIN when no URB has completed yet.
+func ReapURB(f *os.File, wait bool) (uintptr, error) {
+	var addr uintptr
+	req := USBDEVFS_REAPURBNDELAY
+	if wait {
+		req = USBDEVFS_REAPURB
+	}
+	if err := ioctlPtr(f, req, unsafe.Pointer(&addr)); err != nil {
+		return 0, err
+	}
+	return addr, nil
+}
+
+// Control runs a control transfer on endpoint 0. data is filled for IN requests
+// (bit 7 of reqType set), and sent for OUT requests. It returns the bytes transferred.
+func Control(f *os.File, reqType, req uint8, value, index uint16, data []byte, timeoutMs uint32) (int, error) {
+	return ControlSetup(f, SetupPacket{
+		RequestType: reqType,
+		Request:     req,
+		Value:       value,
+		Index:       index,
+		Length:      uint16(len(data)),
+	}, data, timeoutMs)
+}
+
+// HubPorts returns the device number attached to each port of a hub, 0 for empty
+// ports. f must be the hub's node.
+func HubPorts(f *os.File) ([]int, error) {
+	var info HubPortinfo
+	if _, err := Ioctl(f, USBDEVFS_HUB_PORTINFO, &info); err != nil {
+		return nil, err
+	}
+	ports := make([]int, 0, info.NPorts)
+	for _, dev := range info.Port[:min(int(info.NPorts), len(info.Port))] {
+		ports = append(ports, int(uint8(dev)))
+	}
+	return ports, nil
+}
+
+func GetDriver(f *os.File, ifno int32) (string, error) {
+	drv := GetDriverS{
+		Interface: uint32(ifno),
+	}
+
+	_, err := Ioctl(f, USBDEVFS_GETDRIVER, &drv)
+	if err == unix.ENODATA { // empty if nothing is in use
+		// empty string?
+	} else if err != nil {
+		Logf("ERROR: Could not get driver: %v\n", err)
+		return "", err
+	}
+	return string(drv.Driver[:]), nil
+}
+
+// GetCapabilities returns the usbfs features the kernel supports for the device, see CapMmap etc.
+func GetCapabilities(f *os.File) (uint32, error) {
+	var caps uint32
+	if _, err := Ioctl(f, USBDEVFS_GET_CAPABILITIES, &caps); err != nil {
+		return 0, err
+	}
+	return caps, nil
+}
+
+func GetSpeed(f *os.File) (DeviceSpeed, error) {
+	r, err := Ioctl(f, USBDEVFS_GET_SPEED, nil)
+	if err != nil {
+		Logf("ERROR: Unable to get device speed: %v\n", err)
+		return SpeedUnknown, err
+	}
+	return DeviceSpeed(r), nil
+}
+
+/*
+func Ctl(f *os.File, d ...interface{}) (int, error) {
+	if r, err := Ioctl(f, USBDEVFS_CONTROL, &CtrlTransfer{
+		RequestType: uint8(d),
+		Request:     uint8(d),
+		Value:       uint16(d),
+		Index:       uint16(d),
+		Length:      uint16(len(d)),
+		Timeout:     uint32(d),
+		Data:        slicePtr(data),
+	}); r == -1 {
+		return -1, err
+	} else {
+		return r, nil
+	}
+}
+*/
@@ -0,0 +1,87 @@
+package gusb
+
+// From:
+//  -/usr/include/linux/usb/ch9.h
+//  -USB 3.2 spec, chapter 9.4
+
+// bmRequestType bits of a setup packet: a direction, a type and a recipient, or'ed
+// together. Equivalent to USB_DIR_*, USB_TYPE_* and USB_RECIP_*.
+const (
+	RequestDirOut = 0x00 // host to device
+	RequestDirIn  = 0x80 // device to host
+
+	RequestTypeStandard = 0x00
+	RequestTypeClass    = 0x20
+	RequestTypeVendor   = 0x40
+
+	RecipientDevice    = 0x00
+	RecipientInterface = 0x01
+	RecipientEndpoint  = 0x02
+	RecipientOther     = 0x03 // e.g. a hub's port
+)
+
+// Standard requests, bRequest. Equivalent to USB_REQ_* constants.
+const (
+	RequestGetStatus        = 0x00
+	RequestClearFeature     = 0x01
+	RequestSetFeature       = 0x03
+	RequestSetAddress       = 0x05
+	RequestGetDescriptor    = 0x06 // wValue: descriptor type << 8 | index. wIndex: language, for strings
+	RequestSetDescriptor    = 0x07
+	RequestGetConfiguration = 0x08
+	RequestSetConfiguration = 0x09
+	RequestGetInterface     = 0x0a
+	RequestSetInterface     = 0x0b
+	RequestSynchFrame       = 0x0c
+	RequestSetSel           = 0x30 // usb 3.0+
+	RequestSetIsochDelay    = 0x31
+)
+
+// Feature selectors of SET_FEATURE and CLEAR_FEATURE, wValue. Equivalent to USB_*_FEATURE
+// constants. Which apply depends on the recipient.
+const (
+	FeatureEndpointHalt       = 0x00 // endpoint
+	FeatureFunctionSuspend    = 0x00 // interface, usb 3.0+
+	FeatureDeviceRemoteWakeup = 0x01 // device
+	FeatureTestMode           = 0x02 // device, usb 2.0+: test selector in wIndex's high byte
+	FeatureBHNPEnable         = 0x03 // device, OTG
+	FeatureAHNPSupport        = 0x04
+	FeatureAAltHNPSupport     = 0x05
+	FeatureU1Enable           = 0x30 // device, usb 3.0+
+	FeatureU2Enable           = 0x31
+	FeatureLTMEnable          = 0x32
+
+	FeaturePortTest = 21 // a hub's port, class request: test selector in wIndex's high byte
+)
+
+// Test selectors of FeatureTestMode and FeaturePortTest, usb 2.0 tables 9-7 and 11-24.
+// Equivalent to USB_TEST_* / TEST_* constants.
+const (
+	TestJ           = 0x01
+	TestK           = 0x02
+	TestSE0NAK      = 0x03
+	TestPacket      = 0x04
+	TestForceEnable = 0x05 // hub ports only
+)
+
+// OTGStatusSelector is the wIndex of a GET_STATUS request for an OTG 2.0 device's
+// status: one byte, with OTGHostRequestFlag set while the B-device wants to be host.
+const (
+	OTGStatusSelector  = 0xf000
+	OTGHostRequestFlag = 0x01
+)
+
+// Language IDs of string descriptors, wIndex of GET_DESCRIPTOR. String descriptor 0
+// lists those a device supports; nearly all offer LangEnglishUS.
+const (
+	LangEnglishUS  = 0x0409
+	LangEnglishUK  = 0x0809
+	LangGerman     = 0x0407
+	LangFrench     = 0x040c
+	LangSpanish    = 0x0c0a
+	LangItalian    = 0x0410
+	LangJapanese   = 0x0411
+	LangKorean     = 0x0412
+	LangChineseTW  = 0x0404
+	LangChinesePRC = 0x0804
+)
@@ -0,0 +1,87 @@
+package gusb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"runtime"
+)
+
+// SetupPacketSize is the length of a setup packet on the wire.
+const SetupPacketSize = 8
+
+// SetupPacket is the 8 byte setup stage of a control transfer, as the host sends it.
+// Gadget-side and usbip code receives these to parse.
+type SetupPacket struct {
+	RequestType uint8 // bmRequestType: direction, type and recipient, see RequestDirIn et al.
+	Request     uint8 // bRequest
+	Value       uint16
+	Index       uint16
+	Length      uint16 // bytes of the data stage
+}
+
+// In reports whether the data stage goes from device to host.
+func (s SetupPacket) In() bool { return s.RequestType&RequestDirIn != 0 }
+
+// Type returns the type bits of bmRequestType: RequestTypeStandard, Class or Vendor.
+func (s SetupPacket) Type() uint8 { return s.RequestType & 0x60 }
+
+// Recipient returns the recipient bits of bmRequestType, e.g. RecipientInterface.
+func (s SetupPacket) Recipient() uint8 { return s.RequestType & 0x1f }
+
+// MarshalBinary encodes the packet as sent on the bus, little-endian.
+func (s SetupPacket) MarshalBinary() ([]byte, error) {
+	return s.AppendBinary(make([]byte, 0, SetupPacketSize))
+}
+
+// AppendBinary appends the encoded packet to b.
+func (s SetupPacket) AppendBinary(b []byte) ([]byte, error) {
+	b = append(b, s.RequestType, s.Request)
+	b = binary.LittleEndian.AppendUint16(b, s.Value)
+	b = binary.LittleEndian.AppendUint16(b, s.Index)
+	return binary.LittleEndian.AppendUint16(b, s.Length), nil
+}
+
+// UnmarshalBinary decodes a packet from the first 8 bytes of b.
+func (s *SetupPacket) UnmarshalBinary(b []byte) error {
+	if len(b) < SetupPacketSize {
+		return fmt.Errorf("gusb: setup packet of %d bytes, want %d", len(b), SetupPacketSize)
+	}
+	*s = SetupPacket{
+		RequestType: b[0],
+		Request:     b[1],
+		Value:       binary.LittleEndian.Uint16(b[2:]),
+		Index:       binary.LittleEndian.Uint16(b[4:]),
+		Length:      binary.LittleEndian.Uint16(b[6:]),
+	}
+	return nil
+}
+
+func (s SetupPacket) String() string {
+	return fmt.Sprintf("%02x %02x %04x %04x %04x", s.RequestType, s.Request, s.Value, s.Index, s.Length)
+}
+
+// ControlSetup runs a control transfer with the given setup packet. data holds the
+// data stage, at least s.Length bytes: filled for IN requests, sent for OUT requests.
+func ControlSetup(f *os.File, s SetupPacket, data []byte, timeoutMs uint32) (int, error) {
+	if int(s.Length) > len(data) {
+		return 0, fmt.Errorf("gusb: setup packet wants %d bytes of data, has %d", s.Length, len(data))
+	}
+	ct := CtrlTransfer{
+		RequestType: s.RequestType,
+		Request:     s.Request,
+		Value:       s.Value,
+		Index:       s.Index,
+		Length:      s.Length,
+		Timeout:     timeoutMs,
+	}
+	if s.Length > 0 {
+		ct.Data = SlicePtr(data)
+	}
+	n, err := Ioctl(f, USBDEVFS_CONTROL, &ct)
+	runtime.KeepAlive(data) // the kernel only has its address
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
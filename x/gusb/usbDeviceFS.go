@@ -45,30 +45,53 @@ type GetDriverS struct {
 type ConnectInfo struct {
 	Devnum uint32
 	Slow   uint8 // unsigned char
+	_      [3]byte
 }
 
-// this is super not correct
-// 44,56
+// struct usbdevfs_urb. Unlike the other structs here, it is not serialized through Ioctl:
+// the kernel holds on to its address until the URB is reaped, so it is used in place,
+// in native layout. 44 bytes on 32-bit, 56 on 64-bit.
 type URB struct {
-	Type         uint8
-	Endpoint     uint8
-	Status       int32
-	Flags        uint32
-	Buffer       VoidPtr
-	BufferLength int32
-	ActualLength int32
-	StartFrame   int32
-	//fucking, a union?!
-	ErrorCount   int32
-	Signr        uint32
-	UserContext  VoidPtr
-	IsoFrameDesc struct { // 12,12
-		Length       uint32
-		ActualLength uint32
-		Status       uint32
-	}
+	Type            URBType
+	Endpoint        uint8
+	Status          int32
+	Flags           uint32
+	Buffer          VoidPtr
+	BufferLength    int32
+	ActualLength    int32
+	StartFrame      int32
+	NumberOfPackets int32 // union with StreamID, for bulk streams
+	ErrorCount      int32
+	Signr           uint32
+	UserContext     VoidPtr
+	// iso_frame_desc[] trails the struct, see IsoPacketDesc
 }
 
+type IsoPacketDesc struct {
+	Length       uint32
+	ActualLength uint32
+	Status       uint32
+}
+
+type URBType uint8
+
+const (
+	URBTypeISO       URBType = 0
+	URBTypeInterrupt URBType = 1
+	URBTypeControl   URBType = 2
+	URBTypeBulk      URBType = 3
+)
+
+// URB.Flags
+const (
+	URBShortNotOK       = 0x01
+	URBISOASAP          = 0x02
+	URBBulkContinuation = 0x04
+	URBNoFSBR           = 0x20 // unused by the kernel
+	URBZeroPacket       = 0x40
+	URBNoInterrupt      = 0x80
+)
+
 type IoctlPacket struct { //usbdevfs_ioctl
 	IfNo      int32 //interface number
 	IoctlCode int32
@@ -92,6 +115,19 @@ type Streams struct {
 	Eps        []uint8
 }
 
+// USBDEVFS_GET_CAPABILITIES bits
+const (
+	CapZeroPacket          = 0x01
+	CapBulkContinuation    = 0x02
+	CapNoPacketSizeLim     = 0x04
+	CapBulkScatterGather   = 0x08
+	CapReapAfterDisconnect = 0x10
+	CapMmap                = 0x20
+	CapDropPrivileges      = 0x40
+	CapConnInfoEx          = 0x80
+	CapSuspend             = 0x100
+)
+
 type DeviceSpeed int
 
 const (
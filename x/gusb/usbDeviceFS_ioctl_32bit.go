@@ -1,4 +1,4 @@
-// +build 386 amd64p32 arm armbe mips mipsle mips64p32 mips64p32le ppc s390 sparc
+//go:build 386 || amd64p32 || arm || armbe || mips || mipsle || mips64p32 || mips64p32le || ppc || s390 || sparc
 
 package gusb
 
@@ -16,3 +16,10 @@ const (
 // Matches width of Kernel void * on each platform.
 type VoidPtr uint32 // 32-bit def
 type pad4 struct{}  // supposedly takes up 0 bytes
+
+// struct usbdevfs_urb layout, see URB
+const (
+	urbSize          = 44
+	urbBufferOffset  = 12
+	urbContextOffset = 40
+)
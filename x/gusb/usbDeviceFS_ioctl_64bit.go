@@ -1,4 +1,4 @@
-// +build amd64 arm64 arm64be ppc64 ppc64le mips64 mips64le s390x sparc64
+//go:build amd64 || arm64 || arm64be || ppc64 || ppc64le || mips64 || mips64le || s390x || sparc64 || riscv64 || loong64
 
 package gusb
 
@@ -16,3 +16,10 @@ const (
 // Matches width of Kernel void * on each platform.
 type VoidPtr uint64 // 64-bit width
 type pad4 uint32
+
+// struct usbdevfs_urb layout, see URB
+const (
+	urbSize          = 56
+	urbBufferOffset  = 16
+	urbContextOffset = 48
+)
@@ -0,0 +1,342 @@
+package gusb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+type DevicePath struct {
+	Bus     int
+	Dev     int
+	SysPath string
+}
+
+func support(p string) bool {
+	_, err := os.Stat(p)
+	return !os.IsNotExist(err)
+}
+
+// Roots are the directories devices are enumerated from. Point them elsewhere
+// for chroots, containers with remapped mounts, or test fixtures.
+type Roots struct {
+	SysFS string // sysfs device directory
+	USBFS string // usbfs device nodes, as BBB/DDD
+}
+
+// DefaultRoots are the standard Linux locations. USBFS is /dev/bus/usb, or on
+// systems without it, LegacyUSBFS if usbfs is mounted there. USB_SYSFS_ROOT and
+// USB_DEVFS_ROOT replace them, see EnvSysFSRoot.
+var DefaultRoots = rootsFromEnv(os.Getenv)
+
+// LegacyUSBFS is where usbfs was mounted before devtmpfs provided /dev/bus/usb. Its
+// layout is the same BBB/DDD, plus a devices summary file. Kernels since 3.5 have
+// dropped the mount, but older embedded ones still use it.
+const LegacyUSBFS = "/proc/bus/usb"
+
+func findUSBFS() string {
+	const devtmpfs = "/dev/bus/usb"
+	if support(devtmpfs) {
+		return devtmpfs
+	}
+	// the mount point stays on newer kernels, empty
+	if buses, _ := filepath.Glob(filepath.Join(LegacyUSBFS, "[0-9]*")); len(buses) > 0 {
+		return LegacyUSBFS
+	}
+	return devtmpfs
+}
+
+// NodePath returns the path of a device node under a usbfs root. Like the kernel, it
+// pads bus and device numbers to three digits, and leaves larger ones whole.
+func NodePath(root string, bus, dev int) string {
+	return filepath.Join(root, fmt.Sprintf("%03d", bus), fmt.Sprintf("%03d", dev))
+}
+
+// WalkFunc is called with each device found, its PathInfo filled in. Returning an
+// error stops the walk; filepath.SkipDir stops it without error.
+type WalkFunc func(*DeviceDescriptor) error
+
+// WalkError is a device the walk skipped, because its descriptors could not be read
+// or parsed.
+type WalkError struct {
+	Path string
+	Err  error
+}
+
+func (e *WalkError) Error() string { return fmt.Sprintf("usb: %s: %v", e.Path, e.Err) }
+
+func (e *WalkError) Unwrap() error { return e.Err }
+
+// Walk enumerates the devices under DefaultRoots.
+func Walk(cb WalkFunc) ([]DeviceDescriptor, error) {
+	return DefaultRoots.Walk(cb)
+}
+
+// Walk enumerates the devices under the roots, calling cb (if not nil) with each.
+// Devices that fail to parse are skipped, and returned as WalkErrors joined in the
+// error, along with the devices that parsed.
+func (r Roots) Walk(cb WalkFunc) ([]DeviceDescriptor, error) {
+	// if Linux kernel 2.6.26 +
+	// we can get most of the information from sysfs (/sys/bus/usb/devices..)
+	// instead of usbfs (/dev/bus/usb...). Usbfs is occasionally slower and wakes
+	// up USB devices.
+	useSys := r.SysFS != "" && support(r.SysFS)
+	useUSB := r.USBFS != "" && support(r.USBFS)
+
+	if !useSys && !useUSB {
+		return nil, fmt.Errorf("Not supported. Could not find %s or %s", r.SysFS, r.USBFS)
+	}
+	if useSys {
+		return walker(r.SysFS, walkSysFs, cb)
+	} else {
+		return walker(r.USBFS, walkUsbFs, cb)
+	}
+}
+
+type walkMethod func(path string, info os.FileInfo) (DeviceDescriptor, error)
+
+func walker(tree string, method walkMethod, cb WalkFunc) ([]DeviceDescriptor, error) {
+	devs := make([]DeviceDescriptor, 0, 20) // randomly preallocate some space. Because I wanted to?
+	var skipped []error
+
+	err := filepath.Walk(tree, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if path != tree && os.IsNotExist(err) {
+				return nil // unplugged while walking
+			}
+			return err
+		}
+		if path == tree {
+			return nil
+		}
+		d, err := method(path, info)
+		if err == filepath.SkipDir {
+			return err
+		} else if err != nil {
+			skipped = append(skipped, &WalkError{Path: path, Err: err})
+			return nil
+		}
+
+		if d.Length != 0 {
+			// callback if supplied, to modify device and/or stop iteration
+			if cb != nil {
+				err := cb(&d)
+				if err != nil {
+					return err
+				}
+			}
+			devs = append(devs, d)
+		}
+		return nil
+	})
+	return devs, errors.Join(append(skipped, err)...)
+}
+
+// SYSFS structure:
+// - usbX
+// 		X: ID of host controller on the machine
+// - X-A.B.C
+//		X: Host Controller ID as above
+//		A.B.C: Physical path to port where device is connected
+// - X-A.B.C:Y.Z
+//		X-A.B.C: as above
+//		Y: Active configuration
+//		Z: bInterfaceNumber
+
+func walkSysFs(path string, info os.FileInfo) (DeviceDescriptor, error) {
+	name := info.Name()
+	//ch, _ := utf8.DecodeRuneInString(name)
+	if /*!unicode.IsDigit(ch) || name[:3] == "usb" ||*/ strings.Contains(name, ":") {
+		return DeviceDescriptor{}, nil
+	}
+	f, err := os.Open(filepath.Join(path, "descriptors"))
+	if os.IsNotExist(err) {
+		return DeviceDescriptor{}, nil // unplugged since the directory was listed
+	} else if err != nil {
+		return DeviceDescriptor{}, err
+	}
+	defer f.Close()
+	dsc, err := ParseDescriptor(f)
+	if err != nil {
+		return dsc, err
+	}
+	dsc.PathInfo.SysPath = path
+
+	return dsc, nil
+}
+
+func walkUsbFs(path string, info os.FileInfo) (DeviceDescriptor, error) {
+	if _, err := strconv.Atoi(info.Name()); err != nil {
+		if info.IsDir() {
+			return DeviceDescriptor{}, filepath.SkipDir
+		}
+		return DeviceDescriptor{}, nil // e.g. the devices summary of LegacyUSBFS
+	}
+	if info.IsDir() {
+		return DeviceDescriptor{}, nil // a bus, its device nodes follow
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return DeviceDescriptor{}, nil // unplugged since the directory was listed
+	} else if err != nil {
+		return DeviceDescriptor{}, err
+	}
+	defer f.Close()
+	dsc, err := ParseUsbfsDescriptor(f)
+	if err != nil {
+		return dsc, err
+	}
+
+	dev, err := strconv.Atoi(info.Name())
+	if err != nil {
+		return dsc, err
+	}
+	bus, err := strconv.Atoi(filepath.Base(filepath.Dir(path)))
+	if err != nil {
+		return dsc, err
+	}
+
+	dsc.PathInfo.Bus = bus
+	dsc.PathInfo.Dev = dev
+	return dsc, nil
+}
+
+// ParseUsbfsDescriptor parses descriptors read from a usbfs node. Unlike sysfs, which
+// has them as sent on the bus, usbfs converts the device descriptor's 16-bit fields to
+// host byte order.
+func ParseUsbfsDescriptor(r io.Reader) (DeviceDescriptor, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return DeviceDescriptor{}, err
+	}
+	return ParseDescriptor(bytes.NewReader(UsbfsToBusOrder(b, binary.NativeEndian)))
+}
+
+// UsbfsToBusOrder converts the device descriptor at the start of b, read from a usbfs
+// node on a host of the given byte order, back to bus (little-endian) order, in place.
+// The configuration descriptors following it are left as they are: usbfs passes them
+// through untouched.
+func UsbfsToBusOrder(b []byte, host binary.ByteOrder) []byte {
+	if len(b) < 18 || b[1] != byte(DTDevice) {
+		return b
+	}
+	for _, off := range []int{2, 8, 10, 12} { // bcdUSB, idVendor, idProduct, bcdDevice
+		binary.LittleEndian.PutUint16(b[off:], host.Uint16(b[off:]))
+	}
+	return b
+}
+
+// ParseDescriptor parses descriptors in bus order, as in the sysfs descriptors
+// attribute: a device descriptor, then its configurations'. See ParseUsbfsDescriptor.
+func ParseDescriptor(r io.Reader) (DeviceDescriptor, error) {
+	var dev DeviceDescriptor
+	var curConf = -1                 // index into dev.Configs, not bConfigurationValue
+	var curIntf *InterfaceDescriptor // receives the endpoints that follow
+	var curEp int
+	var slots map[int]int // bInterfaceNumber -> index in the current config's Interfaces
+
+	f, err := ioutil.ReadAll(r)
+	if err != nil {
+		return dev, err
+	}
+
+	buf := bytes.NewBuffer(f)
+
+	for buf.Len() > 0 {
+		if length, err := buf.ReadByte(); err != nil {
+			return dev, err
+		} else if err := buf.UnreadByte(); err != nil {
+			return dev, err
+		} else {
+			body := make([]byte, length)
+			if n, err := buf.Read(body); err != nil {
+				return dev, err
+			} else if n != int(length) || length < 2 {
+				return dev, errors.New("short read")
+			} else {
+				h := DescHeader{
+					Length:     body[0],
+					Descriptor: DT(body[1]),
+				}
+				switch h.Descriptor {
+				case DTDevice:
+					dev, err = NewDevice(body)
+					if err != nil {
+						return dev, err
+					}
+				case DTConfig:
+					if dev.Length == 0 {
+						return dev, errors.New("config descriptor found before device descriptor")
+					}
+					cfg, err := NewConfig(body)
+					if err != nil {
+						return dev, err
+					}
+					// configs are stored in the order they are reported. bConfigurationValue
+					// is not guaranteed to run 1..bNumConfigurations (and is 0 on some broken devices)
+					curConf++
+					curIntf = nil
+					slots = map[int]int{}
+					if curConf < len(dev.Configs) {
+						dev.Configs[curConf] = cfg
+					} else {
+						dev.Configs = append(dev.Configs, cfg)
+					}
+				case DTString:
+					//dsc, err := NewString(body) don't know what to do here
+				case DTInterface:
+					if curConf < 0 {
+						return dev, errors.New("interface descriptor found before config descriptor")
+					}
+					intf, err := NewInterface(body)
+					if err != nil {
+						return dev, err
+					}
+					// interface numbers may be sparse, so they are stored in the order described.
+					// Further alternate settings of an interface go in its AltSettings
+					cfg := &dev.Configs[curConf]
+					curEp = 0
+					if slot, seen := slots[int(intf.InterfaceNumber)]; seen {
+						base := &cfg.Interfaces[slot]
+						base.AltSettings = append(base.AltSettings, intf)
+						curIntf = &base.AltSettings[len(base.AltSettings)-1]
+						continue
+					}
+					slot := len(slots)
+					if slot >= len(cfg.Interfaces) {
+						// config claims fewer interfaces than it describes. Skip it, and its endpoints
+						curIntf = nil
+						continue
+					}
+					slots[int(intf.InterfaceNumber)] = slot
+					cfg.Interfaces[slot] = intf
+					curIntf = &cfg.Interfaces[slot]
+				case DTEndpoint:
+					if curConf < 0 || curIntf == nil {
+						continue // orphaned endpoint
+					}
+					ep, err := NewEndpoint(body)
+					if err != nil {
+						return dev, err
+					}
+					if curEp >= len(curIntf.Endpoints) {
+						continue
+					}
+					curIntf.Endpoints[curEp] = ep
+					curEp++
+				default:
+					// log.Printf("Got unknown descriptor: %v, length: %v, body: %v\n", h.Descriptor, h.Length, body[2:])
+					continue
+				}
+			}
+		}
+	}
+	return dev, nil
+}